@@ -2,7 +2,7 @@ package godb
 
 
 import (
-    _ "fmt"
+	"fmt"
 )
 
 type Aggregator struct {
@@ -14,6 +14,21 @@ type Aggregator struct {
 	// aggregations in which order are to be computed for every group.
 	newAggState []AggState
 
+	// For GROUP BY ROLLUP, CUBE and GROUPING SETS, the sets of groupByFields
+	// (as indices) to group by.  Each child tuple is added to one group of
+	// every set, whose key has NULL for the fields not in the set.  Nil for
+	// an ordinary group-by, which groups by all of the fields.
+	groupingSets [][]int
+
+	// For each GROUPING() call of the query, the groupByFields (as indices)
+	// that are its arguments.  Each result tuple ends with a field for each
+	// call, whose bits are 1 for the arguments not in the grouping set of the
+	// tuple, with the first argument the most significant.
+	groupings [][]int
+
+	// The maximum number of groups held in memory; 0 for SpillTupleLimit
+	groupLimit int
+
 	child Operator // the child operator for the inputs to aggregate
 }
 
@@ -28,12 +43,19 @@ const DefaultGroup int = 0 // for handling the case of no group-by
 
 // Constructor for an aggregator with a group-by
 func NewGroupedAggregator(emptyAggState []AggState, groupByFields []Expr, child Operator) *Aggregator {
-	return &Aggregator{groupByFields, emptyAggState, child}
+	return &Aggregator{groupByFields, emptyAggState, nil, nil, 0, child}
+}
+
+// Constructor for an aggregator that groups by each of groupingSets, whose
+// elements are indices of groupByFields, and computes the GROUPING() calls
+// groupings
+func NewGroupingSetsAggregator(emptyAggState []AggState, groupByFields []Expr, groupingSets [][]int, groupings [][]int, child Operator) *Aggregator {
+	return &Aggregator{groupByFields, emptyAggState, groupingSets, groupings, 0, child}
 }
 
 // Constructor for an aggregator with no group-by
 func NewAggregator(emptyAggState []AggState, child Operator) *Aggregator {
-	return &Aggregator{nil, emptyAggState, child}
+	return &Aggregator{nil, emptyAggState, nil, nil, 0, child}
 }
 
 // Return a TupleDescriptor for this aggregation. If the aggregator has no group-by, the
@@ -54,8 +76,11 @@ func (a *Aggregator) Descriptor() *TupleDesc {
     td.Fields = fts
 
     for _, agg_state := range a.newAggState {
-        td.merge(agg_state.GetTupleDesc())
+        td.Fields = td.merge(agg_state.GetTupleDesc()).Fields
     }
+	for i := range a.groupings {
+		td.Fields = append(td.Fields, FieldType{fmt.Sprintf("__grouping%d", i), "", IntType})
+	}
 	return &td // TODO change me
 }
 
@@ -74,22 +99,21 @@ func (a *Aggregator) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 		return nil, GoDBError{MalformedDataError, "child iter unexpectedly nil"}
 
 	}
+	if a.groupByFields != nil || a.groupingSets != nil {
+		return a.groupedIterator(childIter), nil
+	}
 	// the map that stores the aggregation state of each group
 	aggState := make(map[any]*[]AggState)
-	if a.groupByFields == nil {
-		var newAggState []AggState
-		for _, as := range a.newAggState {
-			copy := as.Copy()
-			if copy == nil {
-				return nil, GoDBError{MalformedDataError, "aggState Copy unexpectedly returned nil"}
-			}
-			newAggState = append(newAggState, copy)
+	var newAggState []AggState
+	for _, as := range a.newAggState {
+		copy := as.Copy()
+		if copy == nil {
+			return nil, GoDBError{MalformedDataError, "aggState Copy unexpectedly returned nil"}
 		}
-
-		aggState[DefaultGroup] = &newAggState
+		newAggState = append(newAggState, copy)
 	}
-	// the list of group key tuples
-	var groupByList []*Tuple
+
+	aggState[DefaultGroup] = &newAggState
 	// the iterator for iterating thru the finalized aggregation results for each group
 	var finalizedIter func() (*Tuple, error)
 	return func() (*Tuple, error) {
@@ -102,42 +126,200 @@ func (a *Aggregator) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 				return nil, nil
 			}
 
-			if a.groupByFields == nil { // adds tuple to the aggregation in the case of no group-by
-				for i := 0; i < len(a.newAggState); i++ {
-					(*aggState[DefaultGroup])[i].AddTuple(t)
+			// adds tuple to the aggregation in the case of no group-by
+			for i := 0; i < len(a.newAggState); i++ {
+				(*aggState[DefaultGroup])[i].AddTuple(t)
+			}
+		}
+
+		if finalizedIter == nil { // builds the iterator for iterating thru the finalized aggregation results for each group
+			var tup *Tuple
+			for i := 0; i < len(a.newAggState); i++ {
+				newTup := (*aggState[DefaultGroup])[i].Finalize()
+				tup = joinTuples(tup, newTup)
+			}
+			finalizedIter = func() (*Tuple, error) { return nil, nil }
+			return tup, nil
+		}
+		return finalizedIter()
+	}, nil
+}
+
+// Set the maximum number of groups that the aggregator holds in memory, or,
+// if n is 0, use [SpillTupleLimit].  Tuples of further groups are partitioned
+// by hash into spill files (see spill.go), and the partitions aggregated one
+// at a time once the groups in memory have been returned.
+func (a *Aggregator) SetGroupLimit(n int) {
+	a.groupLimit = n
+}
+
+// The tuples of one partition of the input of an aggregator, which are
+// aggregated together
+type aggInput struct {
+	iter  func() (*Tuple, error)
+	depth int
+
+	// for a partition that was spilled to disk, its file, whose tuples end
+	// with the index of the grouping set to add them to
+	file *spillFile
+}
+
+func (in *aggInput) remove() {
+	if in.file != nil {
+		in.file.remove()
+	}
+}
+
+// The groups that an aggregator holds in memory: the key tuples, in the
+// order they were first seen, the grouping set of each, and the states,
+// by [groupingSetKey]
+type aggGroups struct {
+	list   []*Tuple
+	sets   []int
+	states map[any]*[]AggState
+}
+
+// Return the descriptor of the tuples that the aggregator spills: those of
+// its child, followed by the index of their grouping set
+func (a *Aggregator) spillDesc() *TupleDesc {
+	fields := append([]FieldType{}, a.child.Descriptor().Fields...)
+	return &TupleDesc{Fields: append(fields, FieldType{"__set", "", IntType})}
+}
+
+// Return an iterator through the groups of the tuples of childIter, which
+// aggregates the partitions that do not fit in memory after returning the
+// groups that do
+func (a *Aggregator) groupedIterator(childIter func() (*Tuple, error)) func() (*Tuple, error) {
+	sets := a.sets()
+	inputs := []*aggInput{{iter: childIter}}
+	var finalizedIter func() (*Tuple, error)
+	return func() (*Tuple, error) {
+		for {
+			if finalizedIter != nil {
+				t, err := finalizedIter()
+				if err != nil || t != nil {
+					return t, err
 				}
-			} else { // adds tuple to the aggregation with grouping
-				keygenTup, err := extractGroupByKeyTuple(a, t)
-				if err != nil {
-					return nil, err
+				finalizedIter = nil
+			}
+			if len(inputs) == 0 {
+				return nil, nil
+			}
+			in := inputs[0]
+			inputs = inputs[1:]
+			groups, spilled, err := a.build(in, sets)
+			if err != nil {
+				for _, in := range inputs {
+					in.remove()
 				}
+				inputs = nil
+				return nil, err
+			}
+			inputs = append(spilled, inputs...)
+			finalizedIter = getFinalizedTuplesIterator(a, sets, groups.list, groups.sets, groups.states)
+		}
+	}
+}
 
-				key := keygenTup.tupleKey()
-				if aggState[key] == nil {
-					asNew := make([]AggState, len(a.newAggState))
-					aggState[key] = &asNew
-					groupByList = append(groupByList, keygenTup)
-				}
+// Aggregate the tuples of the input in memory, adding each to a group of
+// every grouping set (or, for a spilled partition, of the set it was spilled
+// for).  Once the aggregator holds its group limit, tuples of new groups are
+// instead partitioned by hash into spill files, and the inputs for the
+// partitions are returned with the groups in memory.
+func (a *Aggregator) build(in *aggInput, sets [][]int) (*aggGroups, []*aggInput, error) {
+	defer in.remove()
+	limit := a.groupLimit
+	if limit <= 0 {
+		limit = SpillTupleLimit
+	}
+	nFields := len(a.child.Descriptor().Fields)
+	groups := &aggGroups{states: make(map[any]*[]AggState)}
+	var spill *partitionedSpill
 
-				addTupleToGrpAggState(a, t, aggState[key])
+	add := func(t *Tuple) error {
+		keygenTup, err := extractGroupByKeyTuple(a, t)
+		if err != nil {
+			return err
+		}
+		for i, set := range sets {
+			if in.file != nil && t.Fields[nFields].(IntField).Value != int64(i) {
+				continue
+			}
+			setTup := groupingSetKeyTuple(keygenTup, set)
+			key := groupingSetKey{i, setTup.tupleKey()}
+			if groups.states[key] == nil {
+				if len(groups.list) >= limit && in.depth < maxSpillDepth {
+					if spill == nil {
+						spill = newPartitionedSpill(a.spillDesc(), in.depth)
+					}
+					fields := append(append([]DBValue{}, t.Fields[:nFields]...), IntField{int64(i)})
+					if err := spill.add(key.key, &Tuple{Fields: fields}); err != nil {
+						return err
+					}
+					continue
+				}
+				asNew := make([]AggState, len(a.newAggState))
+				groups.states[key] = &asNew
+				groups.list = append(groups.list, setTup)
+				groups.sets = append(groups.sets, i)
 			}
+
+			addTupleToGrpAggState(a, t, groups.states[key])
 		}
+		return nil
+	}
 
-		if finalizedIter == nil { // builds the iterator for iterating thru the finalized aggregation results for each group
-			if a.groupByFields == nil {
-				var tup *Tuple
-				for i := 0; i < len(a.newAggState); i++ {
-					newTup := (*aggState[DefaultGroup])[i].Finalize()
-					tup = joinTuples(tup, newTup)
+	var err error
+	for {
+		var t *Tuple
+		t, err = in.iter()
+		if err != nil || t == nil {
+			break
+		}
+		if err = add(t); err != nil {
+			break
+		}
+	}
+	if err != nil {
+		if spill != nil {
+			spill.remove()
+		}
+		return nil, nil, err
+	}
+
+	if in.depth == 0 && spill == nil && len(groups.list) == 0 {
+		// like an aggregate without a group-by, the empty grouping set has
+		// a group even if there are no child tuples
+		for i, set := range sets {
+			if len(set) == 0 {
+				setTup := &Tuple{Desc: *a.keyDesc(), Fields: make([]DBValue, len(a.groupByFields))}
+				asNew := make([]AggState, len(a.newAggState))
+				for j, as := range a.newAggState {
+					asNew[j] = as.Copy()
 				}
-				finalizedIter = func() (*Tuple, error) { return nil, nil }
-				return tup, nil
-			} else {
-				finalizedIter = getFinalizedTuplesIterator(a, groupByList, aggState)
+				groups.states[groupingSetKey{i, setTup.tupleKey()}] = &asNew
+				groups.list = append(groups.list, setTup)
+				groups.sets = append(groups.sets, i)
 			}
 		}
-		return finalizedIter()
-	}, nil
+	}
+	if spill == nil {
+		return groups, nil, nil
+	}
+
+	var inputs []*aggInput
+	for _, f := range spill.files {
+		if f == nil {
+			continue
+		}
+		iter, err := f.iterator()
+		if err != nil {
+			spill.remove()
+			return nil, nil, err
+		}
+		inputs = append(inputs, &aggInput{iter, in.depth + 1, f})
+	}
+	return groups, inputs, nil
 }
 
 // Given a tuple t from a child iteror, return a tuple that identifies t's group.
@@ -148,15 +330,8 @@ func (a *Aggregator) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 // If there is any error during expression evaluation, return the error.
 func extractGroupByKeyTuple(a *Aggregator, t *Tuple) (*Tuple, error) {
 	// TODO: some code goes here
-    fts := []FieldType{}
-    for _, expr := range a.groupByFields {
-        fts = append(fts, expr.GetExprType())
-    }
-    td := TupleDesc{}
-    td.Fields = fts
-
     ret := Tuple{}
-    ret.Desc = td
+    ret.Desc = *a.keyDesc()
     ret.Fields = []DBValue{}
     for _, expr := range a.groupByFields {
         field, err := expr.EvalExpr(t)
@@ -183,27 +358,89 @@ func addTupleToGrpAggState(a *Aggregator, t *Tuple, grpAggState *[]AggState) {
     }
 }
 
+// Return the descriptor of the group key tuples of the aggregator
+func (a *Aggregator) keyDesc() *TupleDesc {
+	fts := []FieldType{}
+	for _, expr := range a.groupByFields {
+		fts = append(fts, expr.GetExprType())
+	}
+	return &TupleDesc{Fields: fts}
+}
+
+// Return the grouping sets of the aggregator; an ordinary group-by has the
+// single set of all of its fields
+func (a *Aggregator) sets() [][]int {
+	if a.groupingSets != nil {
+		return a.groupingSets
+	}
+	set := make([]int, len(a.groupByFields))
+	for i := range set {
+		set[i] = i
+	}
+	return [][]int{set}
+}
+
+// The key of a group of a grouping set.  Groups of different sets are
+// distinct even if their key tuples are the same, as when a grouped field is
+// NULL.
+type groupingSetKey struct {
+	set int
+	key any
+}
+
+// Return the key tuple of the group of the grouping set set that the group
+// key tuple key belongs to, which has NULL for the fields that are not in set
+func groupingSetKeyTuple(key *Tuple, set []int) *Tuple {
+	ret := Tuple{Desc: key.Desc, Fields: make([]DBValue, len(key.Fields))}
+	for _, i := range set {
+		ret.Fields[i] = key.Fields[i]
+	}
+	return &ret
+}
+
 // Given that all child tuples have been added, return an iterator that iterates
-// through the finalized aggregate result one group at a time. The returned tuples should
-// be structured according to the TupleDesc returned from the Descriptor() method.
-// HINT: you can call [aggState.Finalize()] to get the field for each AggState.
-// Then, you should get the groupByTuple and merge it with each of the AggState tuples using the
-// joinTuples function in tuple.go you wrote in lab 1.
-func getFinalizedTuplesIterator(a *Aggregator, groupByList []*Tuple, aggState map[any]*[]AggState) func() (*Tuple, error) {
-	curGbyTuple := 0 // "captured" counter to track the current tuple we are iterating over
+// through the finalized aggregate result one group at a time. The groups are
+// groupByList, whose grouping sets are the elements of sets indexed by
+// groupBySets. The returned tuples should be structured according to the
+// TupleDesc returned from the Descriptor() method, ending with the values of
+// the GROUPING() calls of the aggregator.
+func getFinalizedTuplesIterator(a *Aggregator, sets [][]int, groupByList []*Tuple, groupBySets []int, aggState map[any]*[]AggState) func() (*Tuple, error) {
+	inSet := make([][]bool, len(sets))
+	for i, set := range sets {
+		inSet[i] = make([]bool, len(a.groupByFields))
+		for _, j := range set {
+			inSet[i][j] = true
+		}
+	}
+	var groupingDesc TupleDesc
+	for i := range a.groupings {
+		groupingDesc.Fields = append(groupingDesc.Fields, FieldType{fmt.Sprintf("__grouping%d", i), "", IntType})
+	}
+	next := 0
 	return func() (*Tuple, error) {
-		// TODO: some code goes here
-        if curGbyTuple == len(groupByList) {
-            return nil, nil
-        }
-        t := groupByList[curGbyTuple]
-        t_key := t.tupleKey()
-        agg_states := aggState[t_key]
-        for _, agg_state := range *agg_states {
-            agg_state_tuple := agg_state.Finalize()
-            t = joinTuples(t, agg_state_tuple)
-        }
-        curGbyTuple++
-        return t, nil
+		if next == len(groupByList) {
+			return nil, nil
+		}
+		t := groupByList[next]
+		set := groupBySets[next]
+		next++
+		for _, as := range *aggState[groupingSetKey{set, t.tupleKey()}] {
+			t = joinTuples(t, as.Finalize())
+		}
+		if len(a.groupings) == 0 {
+			return t, nil
+		}
+		grouping := &Tuple{Desc: groupingDesc, Fields: make([]DBValue, len(a.groupings))}
+		for i, args := range a.groupings {
+			var bits int64
+			for _, j := range args {
+				bits <<= 1
+				if !inSet[set][j] {
+					bits |= 1
+				}
+			}
+			grouping.Fields[i] = IntField{bits}
+		}
+		return joinTuples(t, grouping), nil
 	}
 }
@@ -0,0 +1,149 @@
+package godb
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// An operator that returns an error after the first n tuples of its child
+type errorAfterOp struct {
+	Operator
+	n int
+}
+
+func (o *errorAfterOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	iter, err := o.Operator.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	returned := 0
+	return func() (*Tuple, error) {
+		if returned == o.n {
+			return nil, GoDBError{MalformedDataError, "child failed"}
+		}
+		returned++
+		return iter()
+	}, nil
+}
+
+// Make an aggregator of the count and sum of v in the table t, grouped by k
+func makeSpillAggregator(t *testing.T, c *Catalog, child func(Operator) Operator) *Aggregator {
+	file, err := c.GetTable("t")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	count, sum := &CountAggState{}, &SumAggState[int64]{}
+	v := &FieldExpr{FieldType{"v", "t", IntType}}
+	count.Init("n", v, intAggGetter)
+	sum.Init("s", v, intAggGetter)
+	k := &FieldExpr{FieldType{"k", "t", IntType}}
+	return NewGroupedAggregator([]AggState{count, sum}, []Expr{k}, child(file))
+}
+
+func TestAggregatorSpill(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("TMPDIR", tmpDir)
+	c, bp := makeSQLTestCatalog(t, "t (k int, g string, v int)\n")
+	var rows []string
+	for i := 0; i < 1000; i++ {
+		rows = append(rows, fmt.Sprintf("(%d, 'g%d', %d)", i%97, i%3, i))
+	}
+	mustRunSQL(t, c, bp, "insert into t values "+strings.Join(rows, ", "))
+
+	agg := makeSpillAggregator(t, c, func(op Operator) Operator { return op })
+	agg.SetGroupLimit(4)
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	res, err := runOp(agg, tid)
+	bp.CommitTransaction(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(res) != 97 {
+		t.Fatalf("expected 97 groups, got %d", len(res))
+	}
+	seen := make(map[int64]bool)
+	for _, tup := range res {
+		k := tup.Fields[0].(IntField).Value
+		var n, s int64
+		for i := k; i < 1000; i += 97 {
+			n++
+			s += i
+		}
+		if seen[k] || tup.Fields[1].(IntField).Value != n || tup.Fields[2].(IntField).Value != s {
+			t.Errorf("unexpected group %v, expected %d tuples with sum %d", tup, n, s)
+		}
+		seen[k] = true
+	}
+
+	files, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(files) != 0 {
+		t.Errorf("expected spill files to be removed, found %d", len(files))
+	}
+}
+
+func TestAggregatorSpillError(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("TMPDIR", tmpDir)
+	c, bp := makeSQLTestCatalog(t, "t (k int, g string, v int)\n")
+	var rows []string
+	for i := 0; i < 500; i++ {
+		rows = append(rows, fmt.Sprintf("(%d, 'g%d', %d)", i%97, i%3, i))
+	}
+	mustRunSQL(t, c, bp, "insert into t values "+strings.Join(rows, ", "))
+
+	agg := makeSpillAggregator(t, c, func(op Operator) Operator { return &errorAfterOp{op, 300} })
+	agg.SetGroupLimit(4)
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	_, err := runOp(agg, tid)
+	bp.AbortTransaction(tid)
+	if err == nil {
+		t.Fatalf("expected error from failing child")
+	}
+	files, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(files) != 0 {
+		t.Errorf("expected spill files to be removed, found %d", len(files))
+	}
+}
+
+func TestAggregatorSpillSQL(t *testing.T) {
+	defer func(limit int) { SpillTupleLimit = limit }(SpillTupleLimit)
+	c, bp := makeSQLTestCatalog(t, "t (k int, g string, v int)\n")
+	var rows []string
+	for i := 0; i < 1000; i++ {
+		rows = append(rows, fmt.Sprintf("(%d, 'g%d', %d)", i%97, i%3, i))
+	}
+	mustRunSQL(t, c, bp, "insert into t values "+strings.Join(rows, ", "))
+
+	queries := []string{
+		"select k, count(*), sum(v), min(g), max(v) from t group by k order by k",
+		"select g, count(distinct k), avg(v) from t group by g order by g",
+		"select k, g, sum(v), grouping(k, g) as b from t group by rollup(k, g) order by b, k, g",
+		"select k, g, count(*) from t group by cube(k, g) having count(*) > 10 order by k, g",
+	}
+	var expected [][]string
+	for _, sql := range queries {
+		var rows []string
+		for _, tup := range mustRunSQL(t, c, bp, sql) {
+			rows = append(rows, tup.PrettyPrintString(false))
+		}
+		expected = append(expected, rows)
+	}
+	// the results are the same when every few groups spill
+	SpillTupleLimit = 3
+	for i, sql := range queries {
+		expectRows(t, c, bp, sql, expected[i]...)
+	}
+	if len(expected[2]) != 97*3+97+1 {
+		t.Errorf("expected %d groups from %s, got %d", 97*3+97+1, queries[2], len(expected[2]))
+	}
+}
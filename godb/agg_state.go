@@ -27,7 +27,8 @@ type AggState interface {
 	GetTupleDesc() *TupleDesc
 }
 
-// Implements the aggregation state for COUNT
+// Implements the aggregation state for COUNT.  COUNT(*), whose expr is nil,
+// counts every tuple, while COUNT(expr) counts those where expr is not NULL.
 type CountAggState struct {
 	alias string
 	expr  Expr
@@ -46,6 +47,11 @@ func (a *CountAggState) Init(alias string, expr Expr, getter func(DBValue) any)
 }
 
 func (a *CountAggState) AddTuple(t *Tuple) {
+	if a.expr != nil {
+		if v, err := a.expr.EvalExpr(t); err != nil || v == nil {
+			return
+		}
+	}
 	a.count++
 }
 
@@ -72,12 +78,13 @@ type SumAggState[T Number] struct {
     alias string
     expr Expr
     sum T
+    found bool // whether any value was not NULL
     getter (func(DBValue) any)
 }
 
 func (a *SumAggState[T]) Copy() AggState {
 	// TODO: some code goes here
-    return &SumAggState[T]{a.alias, a.expr, a.sum, a.getter}
+    return &SumAggState[T]{a.alias, a.expr, a.sum, a.found, a.getter}
 }
 
 func intAggGetter(v DBValue) any {
@@ -97,6 +104,7 @@ func (a *SumAggState[T]) Init(alias string, expr Expr, getter func(DBValue) any)
     a.alias = alias
     a.expr = expr
     a.sum = 0
+    a.found = false
     a.getter = getter
 	return nil
 }
@@ -104,8 +112,13 @@ func (a *SumAggState[T]) Init(alias string, expr Expr, getter func(DBValue) any)
 func (a *SumAggState[T]) AddTuple(t *Tuple) {
 	// TODO: some code goes here
     eval, _ := a.expr.EvalExpr(t)
+    // NULLs are ignored by aggregates
+    if eval == nil {
+        return
+    }
     val := a.getter(eval).(T)
     a.sum += val
+    a.found = true
 }
 
 func (a *SumAggState[T]) GetTupleDesc() *TupleDesc {
@@ -120,7 +133,11 @@ func (a *SumAggState[T]) GetTupleDesc() *TupleDesc {
 func (a *SumAggState[T]) Finalize() *Tuple {
 	// TODO: some code goes here
     td := a.GetTupleDesc()
-    f := IntField{int64(a.sum)}
+    // the sum of only NULLs, or of no values, is NULL
+    var f DBValue
+    if a.found {
+        f = IntField{int64(a.sum)}
+    }
     fs := []DBValue{f}
     t := Tuple{*td, fs, nil}
     return &t
@@ -157,6 +174,10 @@ func (a *AvgAggState[T]) Init(alias string, expr Expr, getter func(DBValue) any)
 func (a *AvgAggState[T]) AddTuple(t *Tuple) {
 	// TODO: some code goes here
     eval, _ := a.expr.EvalExpr(t)
+    // NULLs are ignored by aggregates
+    if eval == nil {
+        return
+    }
     val := a.getter(eval).(T)
     a.sum += val
     a.count++
@@ -174,7 +195,11 @@ func (a *AvgAggState[T]) GetTupleDesc() *TupleDesc {
 func (a *AvgAggState[T]) Finalize() *Tuple {
 	// TODO: some code goes here
     td := a.GetTupleDesc()
-    f := IntField{int64(a.sum / a.count)}
+    // the average of only NULLs is NULL
+    var f DBValue
+    if a.count != 0 {
+        f = IntField{int64(a.sum / a.count)}
+    }
     fs := []DBValue{f}
     t := Tuple{*td, fs, nil}
     return &t
@@ -204,7 +229,7 @@ func (a *MaxAggState[T]) Init(alias string, expr Expr, getter func(DBValue) any)
 
 func (a *MaxAggState[T]) AddTuple(t *Tuple) {
 	v, err := a.expr.EvalExpr(t)
-	if err != nil {
+	if err != nil || v == nil {
 		return
 	}
 	val := a.getter(v).(T)
@@ -239,6 +264,10 @@ func (a *MaxAggState[T]) Finalize() *Tuple {
 	default:
 		f = IntField{any(a.max).(int64)}
 	}
+	// no non-NULL values were seen
+	if a.null {
+		f = nil
+	}
 	fs := []DBValue{f}
 	t := Tuple{*td, fs, nil}
 	return &t
@@ -272,7 +301,7 @@ func (a *MinAggState[T]) Init(alias string, expr Expr, getter func(DBValue) any)
 func (a *MinAggState[T]) AddTuple(t *Tuple) {
 	// TODO: some code goes here
 	v, err := a.expr.EvalExpr(t)
-	if err != nil {
+	if err != nil || v == nil {
 		return
 	}
 	val := a.getter(v).(T)
@@ -309,6 +338,10 @@ func (a *MinAggState[T]) Finalize() *Tuple {
 	default:
 		f = IntField{any(a.min).(int64)}
 	}
+	// no non-NULL values were seen
+	if a.null {
+		f = nil
+	}
 	fs := []DBValue{f}
 	t := Tuple{*td, fs, nil}
 	return &t
@@ -0,0 +1,360 @@
+package godb
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AggregateType describes an aggregate function: the number of constant
+// arguments it takes after the expression it aggregates, such as the
+// separator of string_agg, and a function that returns a new, uninitialized
+// state for aggregating values of type argType with those arguments.
+// Aggregates are looked up by name in [aggregates], so adding an aggregate
+// only requires an AggState implementation and an entry there.
+type AggregateType struct {
+	params   int
+	newState func(argType DBType, params []string) (AggState, error)
+}
+
+var aggregates = map[string]AggregateType{
+	//note should all be lower case
+	"count": {0, func(DBType, []string) (AggState, error) { return &CountAggState{}, nil }},
+	"sum":   {0, intAggregate(func() AggState { return &SumAggState[int64]{} })},
+	"avg":   {0, intAggregate(func() AggState { return &AvgAggState[int64]{} })},
+	"max": {0, func(t DBType, _ []string) (AggState, error) {
+		if t == StringType {
+			return &MaxAggState[string]{}, nil
+		}
+		return &MaxAggState[int64]{}, nil
+	}},
+	"min": {0, func(t DBType, _ []string) (AggState, error) {
+		if t == StringType {
+			return &MinAggState[string]{}, nil
+		}
+		return &MinAggState[int64]{}, nil
+	}},
+	"variance":        {0, intAggregate(func() AggState { return &VarianceAggState{sample: true} })},
+	"var_samp":        {0, intAggregate(func() AggState { return &VarianceAggState{sample: true} })},
+	"var_pop":         {0, intAggregate(func() AggState { return &VarianceAggState{} })},
+	"stddev":          {0, intAggregate(func() AggState { return &VarianceAggState{sample: true, stddev: true} })},
+	"stddev_samp":     {0, intAggregate(func() AggState { return &VarianceAggState{sample: true, stddev: true} })},
+	"stddev_pop":      {0, intAggregate(func() AggState { return &VarianceAggState{stddev: true} })},
+	"median":          {0, intAggregate(func() AggState { return &PercentileAggState{fraction: 0.5, continuous: true} })},
+	"percentile_cont": {1, percentileAggregate(true)},
+	"percentile_disc": {1, percentileAggregate(false)},
+	"string_agg": {1, func(t DBType, params []string) (AggState, error) {
+		if t != StringType {
+			return nil, GoDBError{TypeMismatchError, "string_agg requires a string argument"}
+		}
+		return &StringAggState{separator: params[0]}, nil
+	}},
+	"bool_and": {0, intAggregate(func() AggState { return &BoolAggState{and: true} })},
+	"bool_or":  {0, intAggregate(func() AggState { return &BoolAggState{} })},
+}
+
+func isAgg(funcName string) bool {
+	_, ok := aggregates[funcName]
+	return ok
+}
+
+// Return a function that makes aggregation states of integers with newState
+func intAggregate(newState func() AggState) func(DBType, []string) (AggState, error) {
+	return func(t DBType, _ []string) (AggState, error) {
+		if t == StringType {
+			return nil, GoDBError{TypeMismatchError, "aggregate requires an integer argument"}
+		}
+		return newState(), nil
+	}
+}
+
+func percentileAggregate(continuous bool) func(DBType, []string) (AggState, error) {
+	return func(t DBType, params []string) (AggState, error) {
+		fraction, err := strconv.ParseFloat(params[0], 64)
+		if err != nil || fraction < 0 || fraction > 1 {
+			return nil, GoDBError{ParseError, fmt.Sprintf("percentile %s must be a number between 0 and 1", params[0])}
+		}
+		return intAggregate(func() AggState { return &PercentileAggState{fraction: fraction, continuous: continuous} })(t, nil)
+	}
+}
+
+// Return an uninitialized state for the aggregate function name over values
+// of type t, with the constant arguments params, and the getter to
+// initialize it with.  If distinct is true, the state only aggregates the
+// distinct values of its expression.
+func newAggState(name string, t DBType, distinct bool, params []string) (AggState, func(DBValue) any, error) {
+	aggType, ok := aggregates[name]
+	if !ok {
+		return nil, nil, GoDBError{IllegalOperationError, fmt.Sprintf("unknown aggregate function %s", name)}
+	}
+	if len(params) != aggType.params {
+		return nil, nil, GoDBError{ParseError, fmt.Sprintf("expected %d arguments to aggregate %s", aggType.params+1, name)}
+	}
+	as, err := aggType.newState(t, params)
+	if err != nil {
+		return nil, nil, err
+	}
+	if distinct {
+		as = &DistinctAggState{inner: as}
+	}
+
+	var getter func(DBValue) any
+	switch t {
+	case IntType:
+		getter = intAggGetter
+	case StringType:
+		getter = stringAggGetter
+	}
+	return as, getter, nil
+}
+
+// Aggregates only the distinct non-NULL values of an expression with the
+// state inner, as in COUNT(DISTINCT x)
+type DistinctAggState struct {
+	inner AggState
+	expr  Expr
+	seen  map[DBValue]bool
+}
+
+func (a *DistinctAggState) Copy() AggState {
+	seen := make(map[DBValue]bool, len(a.seen))
+	for v := range a.seen {
+		seen[v] = true
+	}
+	return &DistinctAggState{a.inner.Copy(), a.expr, seen}
+}
+
+func (a *DistinctAggState) Init(alias string, expr Expr, getter func(DBValue) any) error {
+	a.expr = expr
+	a.seen = make(map[DBValue]bool)
+	return a.inner.Init(alias, expr, getter)
+}
+
+func (a *DistinctAggState) AddTuple(t *Tuple) {
+	v, err := a.expr.EvalExpr(t)
+	if err != nil || v == nil || a.seen[v] {
+		return
+	}
+	a.seen[v] = true
+	a.inner.AddTuple(t)
+}
+
+func (a *DistinctAggState) Finalize() *Tuple {
+	return a.inner.Finalize()
+}
+
+func (a *DistinctAggState) GetTupleDesc() *TupleDesc {
+	return a.inner.GetTupleDesc()
+}
+
+// Return a tuple with the single field alias of type t and value v
+func aggResult(alias string, t DBType, v DBValue) *Tuple {
+	td := TupleDesc{Fields: []FieldType{{alias, "", t}}}
+	return &Tuple{td, []DBValue{v}, nil}
+}
+
+// Implements the aggregation state for the sample or population variance
+// or standard deviation.  As for AVG, the result is truncated to an integer.
+// The sample variance of fewer than two values and the population variance
+// of no values are NULL.
+type VarianceAggState struct {
+	alias          string
+	expr           Expr
+	getter         func(DBValue) any
+	sample, stddev bool
+
+	// the count, mean and sum of squared differences from the mean of the
+	// values, which are updated with Welford's algorithm
+	count    int64
+	mean, m2 float64
+}
+
+func (a *VarianceAggState) Copy() AggState {
+	c := *a
+	return &c
+}
+
+func (a *VarianceAggState) Init(alias string, expr Expr, getter func(DBValue) any) error {
+	a.alias, a.expr, a.getter = alias, expr, getter
+	a.count, a.mean, a.m2 = 0, 0, 0
+	return nil
+}
+
+func (a *VarianceAggState) AddTuple(t *Tuple) {
+	v, err := a.expr.EvalExpr(t)
+	if err != nil || v == nil {
+		return
+	}
+	x := float64(a.getter(v).(int64))
+	a.count++
+	delta := x - a.mean
+	a.mean += delta / float64(a.count)
+	a.m2 += delta * (x - a.mean)
+}
+
+func (a *VarianceAggState) GetTupleDesc() *TupleDesc {
+	return &TupleDesc{Fields: []FieldType{{a.alias, "", IntType}}}
+}
+
+func (a *VarianceAggState) Finalize() *Tuple {
+	n := a.count
+	if a.sample {
+		n--
+	}
+	if n <= 0 {
+		return aggResult(a.alias, IntType, nil)
+	}
+	v := a.m2 / float64(n)
+	if a.stddev {
+		v = math.Sqrt(v)
+	}
+	return aggResult(a.alias, IntType, IntField{int64(v)})
+}
+
+// Implements the aggregation state for percentile_cont, which interpolates
+// between the values nearest to the percentile (truncating the result to an
+// integer), and percentile_disc, which returns the first value whose
+// position in the sorted values is at least the percentile.  MEDIAN is
+// percentile_cont(0.5).  The values are held in memory until the aggregate is
+// finalized.
+type PercentileAggState struct {
+	alias      string
+	expr       Expr
+	getter     func(DBValue) any
+	fraction   float64
+	continuous bool
+	values     []int64
+}
+
+func (a *PercentileAggState) Copy() AggState {
+	c := *a
+	c.values = append([]int64{}, a.values...)
+	return &c
+}
+
+func (a *PercentileAggState) Init(alias string, expr Expr, getter func(DBValue) any) error {
+	a.alias, a.expr, a.getter = alias, expr, getter
+	a.values = nil
+	return nil
+}
+
+func (a *PercentileAggState) AddTuple(t *Tuple) {
+	v, err := a.expr.EvalExpr(t)
+	if err != nil || v == nil {
+		return
+	}
+	a.values = append(a.values, a.getter(v).(int64))
+}
+
+func (a *PercentileAggState) GetTupleDesc() *TupleDesc {
+	return &TupleDesc{Fields: []FieldType{{a.alias, "", IntType}}}
+}
+
+func (a *PercentileAggState) Finalize() *Tuple {
+	n := len(a.values)
+	if n == 0 {
+		return aggResult(a.alias, IntType, nil)
+	}
+	values := append([]int64{}, a.values...)
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	if !a.continuous {
+		i := int(math.Ceil(a.fraction*float64(n))) - 1
+		if i < 0 {
+			i = 0
+		}
+		return aggResult(a.alias, IntType, IntField{values[i]})
+	}
+	pos := a.fraction * float64(n-1)
+	lo := int(math.Floor(pos))
+	v := float64(values[lo])
+	if lo+1 < n {
+		v += (pos - float64(lo)) * float64(values[lo+1]-values[lo])
+	}
+	return aggResult(a.alias, IntType, IntField{int64(v)})
+}
+
+// Implements the aggregation state for string_agg, which concatenates the
+// values of a string expression, separated by separator, in the order they
+// are added.  The result is NULL if there are no values.
+type StringAggState struct {
+	alias     string
+	expr      Expr
+	separator string
+	values    []string
+}
+
+func (a *StringAggState) Copy() AggState {
+	c := *a
+	c.values = append([]string{}, a.values...)
+	return &c
+}
+
+func (a *StringAggState) Init(alias string, expr Expr, getter func(DBValue) any) error {
+	a.alias, a.expr = alias, expr
+	a.values = nil
+	return nil
+}
+
+func (a *StringAggState) AddTuple(t *Tuple) {
+	v, err := a.expr.EvalExpr(t)
+	if err != nil || v == nil {
+		return
+	}
+	a.values = append(a.values, v.(StringField).Value)
+}
+
+func (a *StringAggState) GetTupleDesc() *TupleDesc {
+	return &TupleDesc{Fields: []FieldType{{a.alias, "", StringType}}}
+}
+
+func (a *StringAggState) Finalize() *Tuple {
+	if len(a.values) == 0 {
+		return aggResult(a.alias, StringType, nil)
+	}
+	return aggResult(a.alias, StringType, StringField{strings.Join(a.values, a.separator)})
+}
+
+// Implements the aggregation state for bool_and, which is true (1) if all of
+// the values of a predicate are true, and bool_or, which is true if any of
+// them is.  The values are those of a predicate, such as age > 40, or any
+// integers, which are true if they are not 0, and the result is NULL if there
+// are no values.
+type BoolAggState struct {
+	alias  string
+	expr   Expr
+	getter func(DBValue) any
+	and    bool
+	result DBValue
+}
+
+func (a *BoolAggState) Copy() AggState {
+	c := *a
+	return &c
+}
+
+func (a *BoolAggState) Init(alias string, expr Expr, getter func(DBValue) any) error {
+	a.alias, a.expr, a.getter = alias, expr, getter
+	a.result = nil
+	return nil
+}
+
+func (a *BoolAggState) AddTuple(t *Tuple) {
+	v, err := a.expr.EvalExpr(t)
+	if err != nil || v == nil {
+		return
+	}
+	b := boolField(a.getter(v).(int64) != 0)
+	if a.result == nil || (a.and && b == falseField) || (!a.and && b == trueField) {
+		a.result = b
+	}
+}
+
+func (a *BoolAggState) GetTupleDesc() *TupleDesc {
+	return &TupleDesc{Fields: []FieldType{{a.alias, "", IntType}}}
+}
+
+func (a *BoolAggState) Finalize() *Tuple {
+	return aggResult(a.alias, IntType, a.result)
+}
@@ -0,0 +1,76 @@
+package godb
+
+import (
+	"testing"
+)
+
+func TestDistinctAggregates(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "emp (name string, age int, dept int)\ndept (id int, dname string, budget int)\n")
+	mustRunSQL(t, c, bp, "insert into emp values ('sam', 25, 1), ('mary', 30, 2), ('joe', 40, 1), ('ann', null, 3), ('bob', 50, null)")
+	mustRunSQL(t, c, bp, "insert into dept values (1, 'eng', 100), (2, 'sales', 20), (3, 'hr', 60)")
+	mustRunSQL(t, c, bp, "insert into emp values ('tim', 40, 2)")
+	expectRows(t, c, bp, "select count(distinct age), sum(distinct age), count(distinct dept) from emp",
+		"4,145,3")
+	expectRows(t, c, bp, "select dept, count(distinct age) from emp where dept is not null group by dept order by dept",
+		"1,2", "2,2", "3,0")
+	if _, err := runSQL(c, bp, "select count(distinct *) from emp"); err == nil {
+		t.Errorf("expected error for count(distinct *)")
+	}
+}
+
+func TestStatisticalAggregates(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "emp (name string, age int, dept int)\ndept (id int, dname string, budget int)\n")
+	mustRunSQL(t, c, bp, "insert into emp values ('sam', 25, 1), ('mary', 30, 2), ('joe', 40, 1), ('ann', null, 3), ('bob', 50, null)")
+	mustRunSQL(t, c, bp, "insert into dept values (1, 'eng', 100), (2, 'sales', 20), (3, 'hr', 60)")
+	mustRunSQL(t, c, bp, "insert into emp values ('tim', 40, 2)")
+	// the ages are 25, 30, 40, 40, 50 and NULL
+	expectRows(t, c, bp, "select variance(age), var_samp(age), var_pop(age), stddev(age), stddev_samp(age), stddev_pop(age) from emp",
+		"95,95,76,9,9,8")
+	expectRows(t, c, bp, "select median(age), percentile_cont(age, 0.25), percentile_cont(age, 0.1), percentile_disc(age, 0.5), percentile_disc(age, 0.2), percentile_disc(age, 0) from emp",
+		"40,30,27,40,25,25")
+	// the sample variance of one value and the statistics of no values are NULL
+	expectRows(t, c, bp, "select dept, variance(age), var_pop(age), median(age) from emp where dept is not null group by dept order by dept",
+		"1,112,56,32", "2,50,25,35", "3,null,null,null")
+	expectRows(t, c, bp, "select name, median(age) over (partition by dept) from emp where dept = 1 order by name",
+		"joe,32", "sam,32")
+}
+
+func TestStringAndBoolAggregates(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "emp (name string, age int, dept int)\ndept (id int, dname string, budget int)\n")
+	mustRunSQL(t, c, bp, "insert into emp values ('sam', 25, 1), ('mary', 30, 2), ('joe', 40, 1), ('ann', null, 3), ('bob', 50, null)")
+	mustRunSQL(t, c, bp, "insert into dept values (1, 'eng', 100), (2, 'sales', 20), (3, 'hr', 60)")
+	mustRunSQL(t, c, bp, "insert into emp values ('tim', 40, 2)")
+	// integers are true if they are not 0, so age - 40 is false for an age of 40
+	expectRows(t, c, bp, "select dept, string_agg(name, ';'), bool_and(age - 40), bool_or(age - 40) from emp where dept is not null group by dept order by dept",
+		"1,sam;joe,0,1", "2,mary;tim,0,1", "3,ann,null,null")
+	expectRows(t, c, bp, "select bool_and(age), bool_or(age - age) from emp", "1,0")
+	// predicates are true or false, and NULL if they compare a NULL
+	expectRows(t, c, bp, "select dept, bool_and(age >= 30), bool_or(age > 35) from emp where dept is not null group by dept order by dept",
+		"1,0,1", "2,1,1", "3,null,null")
+	expectRows(t, c, bp, "select bool_and(age > 20 and dept < 4), bool_or((name like 'm%')), count(age between 30 and 40) from emp", "1,1,5")
+	expectRows(t, c, bp, "select name, bool_or(age > 35) over (partition by dept), bool_and(age > 35) over (partition by dept) from emp where dept = 1 order by name",
+		"joe,1,0", "sam,1,0")
+	expectRows(t, c, bp, "select string_agg(distinct dname, ', ') from dept where budget > 50", "eng, hr")
+	expectRows(t, c, bp, "select name, string_agg(name, '-') over (order by name rows between 1 preceding and current row) from emp where dept = 2 order by name",
+		"mary,mary", "tim,mary-tim")
+}
+
+func TestAggregateErrors(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "emp (name string, age int, dept int)\ndept (id int, dname string, budget int)\n")
+	mustRunSQL(t, c, bp, "insert into emp values ('sam', 25, 1), ('mary', 30, 2), ('joe', 40, 1), ('ann', null, 3), ('bob', 50, null)")
+	mustRunSQL(t, c, bp, "insert into dept values (1, 'eng', 100), (2, 'sales', 20), (3, 'hr', 60)")
+	mustRunSQL(t, c, bp, "insert into emp values ('tim', 40, 2)")
+	for _, sql := range []string{
+		"select stddev(name) from emp",
+		"select string_agg(age, ',') from emp",
+		"select string_agg(name) from emp",
+		"select median(age, 0.5) from emp",
+		"select percentile_cont(age, 1.5) from emp",
+		"select percentile_disc(age, dept) from emp",
+		"select percentile_disc(age) from emp",
+	} {
+		if _, err := runSQL(c, bp, sql); err == nil {
+			t.Errorf("expected error for %s", sql)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package godb
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// ANALYZE computes the statistics of tables (see table_stats.go) by scanning
+// them.  The number of tuples, the fraction of NULLs and the smallest and
+// largest value of each column are exact; the number of distinct values is
+// estimated with a HyperLogLog sketch of all of the values, and the most
+// common values and histogram of each column are computed from a uniform
+// sample of up to analyzeSampleSize tuples.
+
+const (
+	analyzeSampleSize = 30000
+	maxMCVs           = 10 // the most common values recorded for each column
+	histogramBuckets  = 50
+)
+
+// Parse and execute an ANALYZE statement
+//
+//	ANALYZE [table]
+//
+// which computes the statistics of the named table, or of every table.  Like
+// other DDL statements in GoDB, ANALYZE is not transactional.
+func processAnalyze(c *Catalog, query string) (QueryType, error) {
+	ts := newTokenStream(query)
+	if err := ts.expect("analyze"); err != nil {
+		return UnknownQueryType, err
+	}
+	tables := c.tables
+	if !ts.atEnd() {
+		name, err := ts.ident()
+		if err != nil {
+			return UnknownQueryType, err
+		}
+		t := c.tableMap[name]
+		if t == nil {
+			return UnknownQueryType, GoDBError{NoSuchTableError, fmt.Sprintf("no table '%s' found", name)}
+		}
+		tables = []*Table{t}
+	}
+	if !ts.atEnd() {
+		return UnknownQueryType, ts.errorf("unexpected text after ANALYZE")
+	}
+	for _, t := range tables {
+		if err := c.analyzeTable(t); err != nil {
+			return UnknownQueryType, err
+		}
+	}
+	return AnalyzeQueryType, nil
+}
+
+// Scan the file of t and replace its statistics
+func (c *Catalog) analyzeTable(t *Table) error {
+	file, err := c.GetTable(t.name)
+	if err != nil {
+		return err
+	}
+	tid := NewTID()
+	c.bp.BeginTransaction(tid)
+	defer c.bp.CommitTransaction(tid)
+	iter, err := file.Iterator(tid)
+	if err != nil {
+		return err
+	}
+
+	fields := t.desc.Fields
+	sketches := make([]*hyperLogLog, len(fields))
+	nulls := make([]int, len(fields))
+	mins := make([]DBValue, len(fields))
+	maxes := make([]DBValue, len(fields))
+	for i := range fields {
+		sketches[i] = newHyperLogLog()
+	}
+	// reservoir sampling, seeded so that the statistics of a table are
+	// reproducible
+	random := rand.New(rand.NewSource(1))
+	var sample []*Tuple
+	rows := 0
+	for {
+		tup, err := iter()
+		if err != nil {
+			return err
+		}
+		if tup == nil {
+			break
+		}
+		rows++
+		for i, v := range tup.Fields {
+			if v == nil {
+				nulls[i]++
+				continue
+			}
+			sketches[i].add(v)
+			if mins[i] == nil || compareValues(v, mins[i]) < 0 {
+				mins[i] = v
+			}
+			if maxes[i] == nil || compareValues(v, maxes[i]) > 0 {
+				maxes[i] = v
+			}
+		}
+		if len(sample) < analyzeSampleSize {
+			sample = append(sample, tup)
+		} else if j := random.Intn(rows); j < analyzeSampleSize {
+			sample[j] = tup
+		}
+	}
+
+	pages := 0
+	if f, ok := file.(interface{ NumPages() int }); ok {
+		pages = f.NumPages()
+	}
+	stats := NewTableStats(rows, pages)
+	for i, f := range fields {
+		col := &ColumnStats{min: mins[i], max: maxes[i], sketch: sketches[i]}
+		if rows > 0 {
+			col.nullFraction = float64(nulls[i]) / float64(rows)
+			col.distinct = math.Min(math.Round(sketches[i].estimate()), float64(rows-nulls[i]))
+		}
+		var values []DBValue
+		for _, tup := range sample {
+			if tup.Fields[i] != nil {
+				values = append(values, tup.Fields[i])
+			}
+		}
+		col.setDistribution(values, len(sample))
+		stats.columns[f.Fname] = col
+	}
+	t.stats = stats
+	return nil
+}
+
+// Set the most common values and histogram of the column from values, the
+// non-NULL values of a sample of sampleRows tuples.  Values are most common
+// if they occur more than once in the sample and are more common than
+// average; the histogram is of the remaining values.
+func (s *ColumnStats) setDistribution(values []DBValue, sampleRows int) {
+	s.mcvs, s.mcvFreqs, s.histogram = nil, nil, nil
+	if len(values) == 0 {
+		return
+	}
+	sort.SliceStable(values, func(i, j int) bool {
+		return compareValues(values[i], values[j]) < 0
+	})
+	type valueCount struct {
+		value DBValue
+		count int
+	}
+	var counts []valueCount
+	for _, v := range values {
+		if n := len(counts); n > 0 && compareValues(counts[n-1].value, v) == 0 {
+			counts[n-1].count++
+		} else {
+			counts = append(counts, valueCount{v, 1})
+		}
+	}
+	average := float64(len(values)) / float64(len(counts))
+	var common []valueCount
+	for _, vc := range counts {
+		if vc.count > 1 && float64(vc.count) > 1.25*average {
+			common = append(common, vc)
+		}
+	}
+	sort.SliceStable(common, func(i, j int) bool {
+		return common[i].count > common[j].count
+	})
+	if len(common) > maxMCVs {
+		common = common[:maxMCVs]
+	}
+	isCommon := make(map[DBValue]bool)
+	for _, vc := range common {
+		s.mcvs = append(s.mcvs, vc.value)
+		s.mcvFreqs = append(s.mcvFreqs, float64(vc.count)/float64(sampleRows))
+		isCommon[vc.value] = true
+	}
+
+	var rest []DBValue
+	for _, v := range values {
+		if !isCommon[v] {
+			rest = append(rest, v)
+		}
+	}
+	if len(rest) < 2 {
+		return
+	}
+	buckets := histogramBuckets
+	if len(rest)-1 < buckets {
+		buckets = len(rest) - 1
+	}
+	for i := 0; i <= buckets; i++ {
+		s.histogram = append(s.histogram, rest[i*(len(rest)-1)/buckets])
+	}
+}
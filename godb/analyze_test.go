@@ -0,0 +1,241 @@
+package godb
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"testing"
+)
+
+func expectNear(t *testing.T, what string, got float64, expected float64, tolerance float64) {
+	t.Helper()
+	if math.Abs(got-expected) > tolerance {
+		t.Errorf("expected %s %g, got %g", what, expected, got)
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "t (k int, s int, name string)\n")
+	// k is i, s is 0 for half of the tuples and i for the others, and name
+	// is 'name' + i%10, or NULL for every 5th tuple
+	var rows []string
+	for i := 0; i < 2000; i++ {
+		s, name := i, fmt.Sprintf("'name%d'", i%10)
+		if i%2 == 0 {
+			s = 0
+		}
+		if i%5 == 0 {
+			name = "null"
+		}
+		rows = append(rows, fmt.Sprintf("(%d, %d, %s)", i, s, name))
+	}
+	mustRunSQL(t, c, bp, "insert into t values "+strings.Join(rows, ", "))
+	mustRunSQL(t, c, bp, "analyze t")
+	stats := c.tableMap["t"].stats
+	if stats == nil {
+		t.Fatalf("expected statistics after ANALYZE")
+	}
+	file, _ := c.GetTable("t")
+	if stats.rows != 2000 || stats.pages != float64(file.(*HeapFile).NumPages()) {
+		t.Errorf("expected 2000 rows in %d pages, got %g in %g", file.(*HeapFile).NumPages(), stats.rows, stats.pages)
+	}
+
+	k, s, name := stats.columns["k"], stats.columns["s"], stats.columns["name"]
+	expectNear(t, "distinct k", k.distinct, 2000, 100)
+	expectNear(t, "distinct s", s.distinct, 1001, 50)
+	expectNear(t, "distinct name", name.distinct, 8, 0)
+	expectNear(t, "NULLs of name", name.nullFraction, 0.2, 0)
+	if k.min != (IntField{0}) || k.max != (IntField{1999}) || name.min != (StringField{"name1"}) || name.max != (StringField{"name9"}) {
+		t.Errorf("unexpected bounds %v, %v, %v, %v", k.min, k.max, name.min, name.max)
+	}
+	if len(k.mcvs) != 0 || len(k.histogram) != histogramBuckets+1 {
+		t.Errorf("expected histogram and no most common values of a key, got %v and %v", k.mcvs, k.histogram)
+	}
+	if len(s.mcvs) != 1 || s.mcvs[0] != (IntField{0}) || s.mcvFreqs[0] != 0.5 {
+		t.Errorf("expected most common value 0 of s, got %v, %v", s.mcvs, s.mcvFreqs)
+	}
+	// every name is equally common
+	if len(name.mcvs) != 0 || len(name.histogram) != histogramBuckets+1 {
+		t.Errorf("expected histogram and no most common values of name, got %v and %v", name.mcvs, name.histogram)
+	}
+
+	for _, test := range []struct {
+		what     string
+		got      float64
+		expected float64
+	}{
+		{"k = 7", k.equalSelectivity(IntField{7}), 0.0005},
+		{"k < 500", k.rangeSelectivity(OpLt, IntField{500}), 0.25},
+		{"k >= 1500", k.rangeSelectivity(OpGe, IntField{1500}), 0.25},
+		{"s = 0", s.equalSelectivity(IntField{0}), 0.5},
+		{"s = 7", s.equalSelectivity(IntField{7}), 0.0005},
+		{"s <= 1000", s.rangeSelectivity(OpLe, IntField{1000}), 0.75},
+		{"s > 1000", s.rangeSelectivity(OpGt, IntField{1000}), 0.25},
+		{"name = 'name3'", name.equalSelectivity(StringField{"name3"}), 0.1},
+		{"name < 'name5'", name.rangeSelectivity(OpLt, StringField{"name5"}), 0.4},
+	} {
+		expectNear(t, test.what, test.got, test.expected, 0.02)
+	}
+}
+
+func TestAnalyzeUpdates(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "t (k int, s int, name string)\n")
+	var rows []string
+	for i := 0; i < 100; i++ {
+		s, name := i, fmt.Sprintf("'name%d'", i%10)
+		if i%2 == 0 {
+			s = 0
+		}
+		if i%5 == 0 {
+			name = "null"
+		}
+		rows = append(rows, fmt.Sprintf("(%d, %d, %s)", i, s, name))
+	}
+	mustRunSQL(t, c, bp, "insert into t values "+strings.Join(rows, ", "))
+	mustRunSQL(t, c, bp, "analyze")
+	if err := c.SaveToFile("catalog.txt", c.rootPath); err != nil {
+		t.Fatalf(err.Error())
+	}
+	before := c.statisticsString()
+
+	// the statistics are kept up to date, and written to the catalog file,
+	// as transactions that insert, update and delete tuples commit
+	mustRunSQL(t, c, bp, "insert into t values (100, 100, null), (101, 101, 'other'), (-5, 0, 'name1')")
+	mustRunSQL(t, c, bp, "update t set k = 1000 where k = 100")
+	mustRunSQL(t, c, bp, "delete from t where k < 10")
+
+	// the changes of aborted transactions are discarded
+	committed := c.statisticsString()
+	for _, sql := range []string{
+		"insert into t values (2000, 2000, 'aborted'), (-10, 0, null)",
+		"update t set k = 5000 where k = 1000",
+		"delete from t where k < 50",
+	} {
+		_, op, err := Parse(c, sql)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		tid := NewTID()
+		bp.BeginTransaction(tid)
+		if _, err := runOp(op, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+		bp.AbortTransaction(tid)
+		if c.statisticsString() != committed {
+			t.Errorf("%s: expected statistics to be unchanged by abort, got %q", sql, c.statisticsString())
+		}
+	}
+	c2, err := NewCatalogFromFile("catalog.txt", bp, c.rootPath)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if c2.statisticsString() != c.statisticsString() || c.statisticsString() == before {
+		t.Fatalf("expected updated statistics after reload, got %q", c2.statisticsString())
+	}
+	stats := c2.tableMap["t"].stats
+	k, name := stats.columns["k"], stats.columns["name"]
+	if stats.rows != 92 {
+		t.Errorf("expected 92 rows, got %g", stats.rows)
+	}
+	if k.min != (IntField{-5}) || k.max != (IntField{1000}) || name.max != (StringField{"other"}) {
+		t.Errorf("unexpected bounds %v, %v, %v", k.min, k.max, name.max)
+	}
+	expectNear(t, "distinct k", k.distinct, 92, 5)
+	expectNear(t, "distinct name", name.distinct, 9, 0)
+	expectNear(t, "NULLs of name", name.nullFraction, 19.0/92, 0.0001)
+
+	// deleted values remain in the bounds until the table is analyzed again
+	mustRunSQL(t, c2, bp, "analyze t")
+	stats = c2.tableMap["t"].stats
+	expectNear(t, "NULLs of name", stats.columns["name"].nullFraction, 19.0/92, 0.0001)
+	if min := stats.columns["k"].min; min != (IntField{10}) {
+		t.Errorf("expected smallest k 10, got %v", min)
+	}
+
+	// the statistics of columns follow them when they are renamed
+	mustRunSQL(t, c2, bp, "alter table t rename column name to label")
+	mustRunSQL(t, c2, bp, "alter table t drop column s")
+	if err := c2.SaveToFile("catalog.txt", c2.rootPath); err != nil {
+		t.Fatalf(err.Error())
+	}
+	c3, err := NewCatalogFromFile("catalog.txt", bp, c.rootPath)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	columns := c3.tableMap["t"].stats.columns
+	if len(columns) != 2 || columns["label"] == nil || columns["k"] == nil {
+		t.Errorf("unexpected column statistics %v", columns)
+	}
+}
+
+func TestAnalyzeErrors(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "t (k int, s int, name string)\n")
+	var rows []string
+	for i := 0; i < 10; i++ {
+		s, name := i, fmt.Sprintf("'name%d'", i%10)
+		if i%2 == 0 {
+			s = 0
+		}
+		if i%5 == 0 {
+			name = "null"
+		}
+		rows = append(rows, fmt.Sprintf("(%d, %d, %s)", i, s, name))
+	}
+	mustRunSQL(t, c, bp, "insert into t values "+strings.Join(rows, ", "))
+	for _, sql := range []string{"analyze nosuchtable", "analyze t t", "analyze 5"} {
+		if _, err := runSQL(c, bp, sql); err == nil {
+			t.Errorf("expected error for %s", sql)
+		}
+	}
+	if c.tableMap["t"].stats != nil {
+		t.Errorf("expected no statistics after failed ANALYZE")
+	}
+
+	mustRunSQL(t, c, bp, "create table empty (a int)")
+	mustRunSQL(t, c, bp, "analyze empty")
+	if stats := c.tableMap["empty"].stats; stats.rows != 0 || stats.columns["a"].distinct != 0 {
+		t.Errorf("unexpected statistics of empty table %q", c.statisticsString())
+	}
+	for _, line := range []string{
+		"statistics t rows 10",
+		"statistics nosuchtable rows 1 pages 1",
+		"statistics t.k distinct 1 nulls 0",
+		"statistics t rows 1 pages 1\nstatistics t.nosuch distinct 1 nulls 0",
+		"statistics t rows 1 pages 1\nstatistics t.k distinct 1 nulls 0 sketch 'abc'",
+	} {
+		if _, err := makeCatalogFromText(t, "t (k int)\n"+line+"\n"); err == nil {
+			t.Errorf("expected error for catalog entry %s", line)
+		}
+	}
+}
+
+// Return a catalog read from a catalog file with the given contents
+func makeCatalogFromText(t *testing.T, text string) (*Catalog, error) {
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/catalog.txt", []byte(text), 0644); err != nil {
+		t.Fatalf(err.Error())
+	}
+	return NewCatalogFromFile("catalog.txt", NewBufferPool(10), dir)
+}
+
+func TestHyperLogLog(t *testing.T) {
+	for _, n := range []int{10, 1000, 100000} {
+		ints, strs := newHyperLogLog(), newHyperLogLog()
+		for i := 0; i < n; i++ {
+			// each value is added twice
+			for j := 0; j < 2; j++ {
+				ints.add(IntField{int64(i)})
+				strs.add(StringField{fmt.Sprintf("value %d", i)})
+			}
+		}
+		// within three standard errors
+		for _, s := range []*hyperLogLog{ints, strs} {
+			expectNear(t, "estimate", s.estimate(), float64(n), 0.1*float64(n))
+			parsed, err := parseHyperLogLog(s.String())
+			if err != nil || parsed.estimate() != s.estimate() {
+				t.Errorf("sketch changed by parsing: %v", err)
+			}
+		}
+	}
+}
@@ -33,6 +33,12 @@ type BufferPool struct {
     transactionWriteLocks map[TransactionID](map[any]struct{})
 
     adjacencyList map[TransactionID](map[TransactionID]struct{})
+
+    commitHooks map[TransactionID][]func() // run when the transaction commits
+
+    // the number of calls to GetPage by each live transaction, which
+    // EXPLAIN ANALYZE reports
+    fetchCounts map[TransactionID]int
 }
 
 // Create a new BufferPool with the specified number of pages
@@ -46,6 +52,8 @@ func NewBufferPool(numPages int) *BufferPool {
     ret.transactionWriteLocks = make(map[TransactionID](map[any]struct{}))
 
     ret.adjacencyList = make(map[TransactionID](map[TransactionID]struct{}))
+    ret.commitHooks = make(map[TransactionID][]func())
+    ret.fetchCounts = make(map[TransactionID]int)
 	return ret
 }
 
@@ -59,6 +67,21 @@ func (bp *BufferPool) FlushAllPages() {
     }
 }
 
+// Remove the first numPages pages of the supplied file from the buffer pool
+// without flushing them, e.g., because the file is about to be rewritten or
+// removed.  Locks held on the pages are unaffected.
+func (bp *BufferPool) discardPages(file DBFile, numPages int) {
+    bp.poolLock.Lock()
+    defer bp.poolLock.Unlock()
+    for i := 0; i < numPages; i++ {
+        pageKey := file.pageKey(i)
+        if _, ok := bp.pages[pageKey]; ok {
+            delete(bp.pages, pageKey)
+            bp.size--
+        }
+    }
+}
+
 // Abort the transaction, releasing locks. Because GoDB is FORCE/NO STEAL, none
 // of the pages tid has dirtired will be on disk so it is sufficient to just
 // release locks to abort. You do not need to implement this for lab 1.
@@ -85,6 +108,8 @@ func (bp *BufferPool) AbortTransaction(tid TransactionID) {
     delete(bp.transactionReadLocks, tid)
     delete(bp.transactionWriteLocks, tid)
     delete(bp.adjacencyList, tid)
+    delete(bp.commitHooks, tid)
+    delete(bp.fetchCounts, tid)
     for _, v := range bp.adjacencyList {
         _, ok = v[tid]
         if ok {
@@ -112,16 +137,36 @@ func (bp *BufferPool) CommitTransaction(tid TransactionID) {
             }
         }
     }
+    for _, hook := range bp.commitHooks[tid] {
+        hook()
+    }
 
+    delete(bp.commitHooks, tid)
     delete(bp.aliveTransactions, tid)
     delete(bp.transactionReadLocks, tid)
     delete(bp.transactionWriteLocks, tid)
     delete(bp.adjacencyList, tid)
+    delete(bp.fetchCounts, tid)
     for _, v := range bp.adjacencyList {
         delete(v, tid)
     }
 }
 
+// Run f when tid commits, once its pages have been written to disk.  f is
+// not run if tid aborts.
+func (bp *BufferPool) onCommit(tid TransactionID, f func()) {
+    bp.poolLock.Lock()
+    defer bp.poolLock.Unlock()
+    bp.commitHooks[tid] = append(bp.commitHooks[tid], f)
+}
+
+// Return the number of pages that tid has fetched with GetPage
+func (bp *BufferPool) pagesFetched(tid TransactionID) int {
+    bp.poolLock.Lock()
+    defer bp.poolLock.Unlock()
+    return bp.fetchCounts[tid]
+}
+
 func (bp *BufferPool) BeginTransaction(tid TransactionID) error {
 	// TODO: some code goes here
     bp.poolLock.Lock()
@@ -182,12 +227,56 @@ func (bp *BufferPool) findCycle() bool {
 func (bp *BufferPool) GetPage(file DBFile, pageNo int, tid TransactionID, perm RWPerm) (*Page, error) {
 	// TODO: some code goes here
 
+    err := bp.lockPage(file, pageNo, tid, perm)
+    if err != nil {
+        return nil, err
+    }
+
+    pageKey := file.pageKey(pageNo)
+    bp.poolLock.Lock()
+    defer bp.poolLock.Unlock()
+
+    bp.fetchCounts[tid]++
+    v, ok := bp.pages[pageKey]
+    if ok {
+        return v, nil
+    }
+
+    // page is not in buffer pool
+    page, err := file.readPage(pageNo)
+    if err != nil {
+        return nil, err
+    }
+    if bp.size == bp.numPages {
+        pageEvicted := false
+        for k, v := range bp.pages {
+            if !(*v).isDirty() {
+                delete(bp.pages, k)
+                pageEvicted = true
+                break
+            }
+        }
+        if !pageEvicted {
+            return nil, errors.New("buffer pool is full of dirty pages")
+        }
+    } else {
+        bp.size++
+    }
+    bp.pages[pageKey] = page
+
+	return page, nil
+}
+
+// Lock the specified page of file on behalf of tid with the specified
+// permission, blocking until the lock is available.  Returns an error, having
+// aborted tid, if waiting would deadlock.
+func (bp *BufferPool) lockPage(file DBFile, pageNo int, tid TransactionID, perm RWPerm) error {
     pageKey := file.pageKey(pageNo)
     bp.poolLock.Lock()
     _, ok := bp.aliveTransactions[tid]
     if !ok {
         bp.poolLock.Unlock()
-        return nil, errors.New("transaction is not alive")
+        return errors.New("transaction is not alive")
     }
     bp.poolLock.Unlock()
 
@@ -235,7 +324,7 @@ func (bp *BufferPool) GetPage(file DBFile, pageNo int, tid TransactionID, perm R
             bp.poolLock.Unlock()
             bp.AbortTransaction(tid)
             time.Sleep(time.Duration(15+ randTime) * time.Millisecond)
-            return nil, errors.New("transaction aborted")
+            return errors.New("transaction aborted")
         }
         if (bad) {
             bp.poolLock.Unlock()
@@ -245,41 +334,11 @@ func (bp *BufferPool) GetPage(file DBFile, pageNo int, tid TransactionID, perm R
         }
     }
 
-    defer bp.poolLock.Unlock()
-
     if perm == ReadPerm {
         bp.transactionReadLocks[tid][pageKey] = struct{}{}
     } else if perm == WritePerm {
         bp.transactionWriteLocks[tid][pageKey] = struct{}{}
     }
-
-
-    v, ok := bp.pages[pageKey]
-    if ok {
-        return v, nil
-    }
-
-    // page is not in buffer pool
-    page, err := file.readPage(pageNo)
-    if err != nil {
-        return nil, err
-    }
-    if bp.size == bp.numPages {
-        pageEvicted := false
-        for k, v := range bp.pages {
-            if !(*v).isDirty() {
-                delete(bp.pages, k)
-                pageEvicted = true
-                break
-            }
-        }
-        if !pageEvicted {
-            return nil, errors.New("buffer pool is full of dirty pages")
-        }
-    } else {
-        bp.size++
-    }
-    bp.pages[pageKey] = page
-
-	return page, nil
+    bp.poolLock.Unlock()
+    return nil
 }
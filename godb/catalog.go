@@ -5,45 +5,556 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 )
 
 type Table struct {
-	name string
-	desc TupleDesc
+	name        string
+	desc        TupleDesc
+	constraints []*Constraint
+	defaults    map[string]string // the text of the DEFAULT value of each column that has one
+
+	// columns declared AUTO_INCREMENT or SERIAL in a CREATE TABLE statement,
+	// whose sequences have not yet been created
+	autoIncrement []string
+
+	stats *TableStats // the statistics of the table, or nil if they have not been set
+
+	// whether the table is stored in a ColumnFile, with a file per column,
+	// rather than in a HeapFile
+	columnar bool
 }
 
+// A Catalog is a view of the tables and sequences of a database.  The
+// statements with a WITH clause are planned with views of their own, which
+// share the state of the catalog but also see the CTEs of the statement.
 type Catalog struct {
-	tables    []*Table
-	tableMap  map[string]*Table
-	columnMap map[string][]*Table
-	bp        *BufferPool
-	rootPath  string
+	*catalogState
+	ctes map[string]*cteTable // the CTEs visible to statements planned with this view (see cte.go)
+}
+
+// The state of a catalog, which all of its views share
+type catalogState struct {
+	tables        []*Table
+	tableMap      map[string]*Table
+	columnMap     map[string][]*Table
+	sequences     map[string]*Sequence
+	sequenceMutex sync.Mutex // protects the counters of the sequences
+	persistMutex  sync.Mutex // serializes writes of the catalog file
+	bp            *BufferPool
+	rootPath      string
+	catalogFile   string // the file the catalog was loaded from, if any
 }
 
 func (c *Catalog) SaveToFile(catalogFile string, rootPath string) error {
-	catalogString := c.CatalogString()
-	f, err := os.OpenFile(rootPath+"/"+catalogFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	c.persistMutex.Lock()
+	defer c.persistMutex.Unlock()
+	return writeFileAtomic(rootPath+"/"+catalogFile, []byte(c.CatalogString()+c.statisticsString()))
+}
+
+// Replace the contents of the named file with data, by writing them to a
+// temporary file that is synced and then renamed over the original, so that a
+// crash leaves either the old or the new contents in place.
+func writeFileAtomic(fileName string, data []byte) error {
+	tmpName := fileName + ".tmp"
+	f, err := os.OpenFile(tmpName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 	if err != nil {
 		return err
 	}
-	f.WriteString(catalogString)
-	f.Close()
-	return nil
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return os.Rename(tmpName, fileName)
 }
 
 func (c *Catalog) dropTable(table string) error {
+	for _, ref := range c.referringConstraints(table) {
+		if ref.table.name != table {
+			return GoDBError{IllegalOperationError, fmt.Sprintf("cannot drop table '%s', which is referenced by a foreign key of table '%s'", table, ref.table.name)}
+		}
+	}
 	for i, t := range c.tables {
 		if t.name == table {
+			c.discardCachedPages(t)
 			c.tableMap[table] = nil
-			c.columnMap[table] = nil
+			c.removeColumns(t)
 			c.tables = append(c.tables[:i], c.tables[i+1:]...)
-			os.Remove(c.tableNameToFile(table))
+			c.updateSequenceOwners(table, "", "")
+			for _, name := range c.tableFiles(t) {
+				os.Remove(name)
+			}
 			return nil
 		}
 	}
 	return GoDBError{NoSuchTableError, "couldn't find table to drop"}
 }
 
+// Add the columns of t to the columnMap
+func (c *Catalog) addColumns(t *Table) {
+	for _, f := range t.desc.Fields {
+		c.columnMap[f.Fname] = append(c.columnMap[f.Fname], t)
+	}
+}
+
+// Remove the columns of t from the columnMap
+func (c *Catalog) removeColumns(t *Table) {
+	for _, f := range t.desc.Fields {
+		var mapList []*Table
+		for _, t2 := range c.columnMap[f.Fname] {
+			if t2 != t {
+				mapList = append(mapList, t2)
+			}
+		}
+		c.columnMap[f.Fname] = mapList
+	}
+}
+
+// Remove any pages of the table's file from the buffer pool.  Must be called
+// before the file is removed, renamed, or rewritten, as otherwise stale pages
+// could be returned from the pool for a table that later uses the same file name.
+func (c *Catalog) discardCachedPages(t *Table) error {
+	file, err := c.openTable(t)
+	if err != nil {
+		return err
+	}
+	switch file := file.(type) {
+	case *HeapFile:
+		c.bp.discardPages(file, file.NumPages())
+	case *ColumnFile:
+		c.bp.discardPages(file, file.NumPages())
+	}
+	return nil
+}
+
+func (c *Catalog) getTableForAlter(table string) (*Table, error) {
+	t := c.tableMap[table]
+	if t == nil {
+		return nil, GoDBError{NoSuchTableError, fmt.Sprintf("no table '%s' found", table)}
+	}
+	return t, nil
+}
+
+// Rewrite the heap file backing t so that it contains tuples with descriptor
+// newDesc, where the fields of each new tuple are computed from the
+// corresponding old tuple by transform.  The new file is built next to the old
+// one, without going through the buffer pool, and then renamed over it.  Every
+// page of the old file is write locked for the duration, so the rewrite waits
+// for, and then excludes, transactions using the table.
+func (c *Catalog) rewriteTable(t *Table, newDesc *TupleDesc, transform func(*Tuple) ([]DBValue, error)) error {
+	if t.columnar {
+		return c.rewriteColumnTable(t, newDesc, transform)
+	}
+	fileName := c.tableNameToFile(t.name)
+	oldFile, err := NewHeapFile(fileName, t.desc.copy(), c.bp)
+	if err != nil {
+		return err
+	}
+	tmpName := fileName + ".tmp"
+	os.Remove(tmpName)
+	newFile, err := NewHeapFile(tmpName, newDesc, c.bp)
+	if err != nil {
+		return err
+	}
+
+	tid := NewTID()
+	c.bp.BeginTransaction(tid)
+	err = copyRewrittenTuples(oldFile, newFile, newDesc, transform, tid)
+	if err == nil {
+		c.bp.discardPages(oldFile, oldFile.NumPages())
+		err = os.Rename(tmpName, fileName)
+	}
+	if err != nil {
+		c.bp.AbortTransaction(tid)
+		os.Remove(tmpName)
+		return err
+	}
+	c.bp.CommitTransaction(tid)
+	return nil
+}
+
+// Lock every page of oldFile on behalf of tid, then write the transformed
+// tuples of oldFile directly to the pages of newFile.
+func copyRewrittenTuples(oldFile *HeapFile, newFile *HeapFile, newDesc *TupleDesc, transform func(*Tuple) ([]DBValue, error), tid TransactionID) error {
+	for i := 0; i < oldFile.NumPages(); i++ {
+		if err := oldFile.bufPool.lockPage(oldFile, i, tid, WritePerm); err != nil {
+			return err
+		}
+	}
+	iter, err := oldFile.Iterator(tid)
+	if err != nil {
+		return err
+	}
+	page := newHeapPage(newDesc, 0, newFile)
+	for {
+		tup, err := iter()
+		if err != nil {
+			return err
+		}
+		if tup == nil {
+			break
+		}
+		fields, err := transform(tup)
+		if err != nil {
+			return err
+		}
+		newTup := &Tuple{*newDesc, fields, nil}
+		if _, err := page.insertTuple(newTup); err != nil {
+			var p Page = page
+			if err := newFile.flushPage(&p); err != nil {
+				return err
+			}
+			page = newHeapPage(newDesc, page.pageNo+1, newFile)
+			if _, err := page.insertTuple(newTup); err != nil {
+				return err
+			}
+		}
+	}
+	if page.numUsedSlots > 0 {
+		var p Page = page
+		if err := newFile.flushPage(&p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rewrite the column files backing t, as rewriteTable does the heap file of
+// other tables.  The new files are built next to the old ones and renamed
+// over them, and then the files of columns that no longer exist are removed.
+func (c *Catalog) rewriteColumnTable(t *Table, newDesc *TupleDesc, transform func(*Tuple) ([]DBValue, error)) error {
+	oldNames := c.columnFileNames(t.name, &t.desc)
+	oldFile, err := NewColumnFile(oldNames, *t.desc.copy(), c.bp)
+	if err != nil {
+		return err
+	}
+	newNames := c.columnFileNames(t.name, newDesc)
+	tmpNames := make([]string, len(newNames))
+	for i, name := range newNames {
+		tmpNames[i] = name + ".tmp"
+		os.Remove(tmpNames[i])
+	}
+	newFile, err := NewColumnFile(tmpNames, *newDesc, c.bp)
+	if err != nil {
+		return err
+	}
+
+	tid := NewTID()
+	c.bp.BeginTransaction(tid)
+	err = copyRewrittenColumns(oldFile, newFile, newDesc, transform, tid)
+	if err == nil {
+		c.bp.discardPages(oldFile, oldFile.NumPages())
+		for i, name := range newNames {
+			if err = os.Rename(tmpNames[i], name); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		c.bp.AbortTransaction(tid)
+		for _, name := range tmpNames {
+			os.Remove(name)
+		}
+		return err
+	}
+	c.bp.CommitTransaction(tid)
+	kept := make(map[string]bool)
+	for _, name := range newNames {
+		kept[name] = true
+	}
+	for _, name := range oldNames {
+		if !kept[name] {
+			os.Remove(name)
+		}
+	}
+	return nil
+}
+
+// Lock every page of oldFile on behalf of tid, then write the transformed
+// tuples of oldFile directly to the pages of newFile.
+func copyRewrittenColumns(oldFile *ColumnFile, newFile *ColumnFile, newDesc *TupleDesc, transform func(*Tuple) ([]DBValue, error), tid TransactionID) error {
+	for i := 0; i < oldFile.NumPages(); i++ {
+		if err := oldFile.bufPool.lockPage(oldFile, i, tid, WritePerm); err != nil {
+			return err
+		}
+	}
+	iter, err := oldFile.Iterator(tid)
+	if err != nil {
+		return err
+	}
+	// the pages of the columns are written together once the next tuple
+	// does not fit in one of them, as each holds the same number of values
+	pageNo := 0
+	pages := make([]*columnPage, newFile.numColumns)
+	for k := range pages {
+		pages[k] = newColumnPage(newDesc, k, k, newFile)
+	}
+	flush := func() error {
+		for _, page := range pages {
+			var p Page = page
+			if err := newFile.flushPage(&p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for {
+		tup, err := iter()
+		if err != nil {
+			return err
+		}
+		if tup == nil {
+			break
+		}
+		fields, err := transform(tup)
+		if err != nil {
+			return err
+		}
+		newTup := &Tuple{*newDesc, fields, nil}
+		if !tupleFits(pages, newTup) {
+			if err := flush(); err != nil {
+				return err
+			}
+			pageNo++
+			for k := range pages {
+				pages[k] = newColumnPage(newDesc, k, pageNo*newFile.numColumns+k, newFile)
+			}
+		}
+		for _, page := range pages {
+			if _, err := page.insertTuple(newTup); err != nil {
+				return err
+			}
+		}
+	}
+	if pages[0].numUsedSlots > 0 {
+		return flush()
+	}
+	return nil
+}
+
+// Add a column to the end of the named table, setting it in every existing
+// tuple to the value of defaultExpr, which is evaluated once per tuple, or to
+// NULL if defaultExpr is nil.  The column is constrained to be not NULL if
+// notNull is set.
+func (c *Catalog) addColumn(table string, field FieldType, defaultExpr Expr, notNull bool) error {
+	t, err := c.getTableForAlter(table)
+	if err != nil {
+		return err
+	}
+	if _, err := findFieldInTd(FieldType{field.Fname, "", UnknownType}, &t.desc); err == nil {
+		return GoDBError{DuplicateTableError, fmt.Sprintf("table '%s' already has a column '%s'", table, field.Fname)}
+	}
+	newDesc := t.desc.copy()
+	newDesc.Fields = append(newDesc.Fields, field)
+	err = c.rewriteTable(t, newDesc, func(tup *Tuple) ([]DBValue, error) {
+		var val DBValue
+		if defaultExpr != nil {
+			var err error
+			if val, err = defaultExpr.EvalExpr(nil); err != nil {
+				return nil, err
+			}
+		}
+		if val == nil && notNull {
+			return nil, GoDBError{ConstraintViolationError, fmt.Sprintf("null value in column %s violates not null constraint on table %s", field.Fname, table)}
+		}
+		fields := make([]DBValue, len(tup.Fields), len(tup.Fields)+1)
+		copy(fields, tup.Fields)
+		return append(fields, val), nil
+	})
+	if err != nil {
+		return err
+	}
+	c.removeColumns(t)
+	t.desc = *newDesc
+	c.addColumns(t)
+	if notNull {
+		t.constraints = append(t.constraints, &Constraint{ctype: NotNullConstraint, columns: []string{field.Fname}})
+	}
+	return nil
+}
+
+// Remove a column from the named table, along with its values in every tuple.
+func (c *Catalog) dropColumn(table string, column string) error {
+	t, err := c.getTableForAlter(table)
+	if err != nil {
+		return err
+	}
+	fieldNo, err := findFieldInTd(FieldType{column, "", UnknownType}, &t.desc)
+	if err != nil {
+		return GoDBError{IllegalOperationError, fmt.Sprintf("table '%s' has no column '%s'", table, column)}
+	}
+	if len(t.desc.Fields) == 1 {
+		return GoDBError{IllegalOperationError, fmt.Sprintf("cannot drop '%s', the only column of table '%s'", column, table)}
+	}
+	for _, ref := range c.referringConstraints(table) {
+		for _, col := range ref.con.refColumns {
+			if col == column {
+				return GoDBError{IllegalOperationError, fmt.Sprintf("cannot drop '%s', which is referenced by a foreign key of table '%s'", column, ref.table.name)}
+			}
+		}
+	}
+	newDesc := t.desc.copy()
+	newDesc.Fields = append(newDesc.Fields[:fieldNo], newDesc.Fields[fieldNo+1:]...)
+	err = c.rewriteTable(t, newDesc, func(tup *Tuple) ([]DBValue, error) {
+		fields := make([]DBValue, 0, len(tup.Fields)-1)
+		fields = append(fields, tup.Fields[:fieldNo]...)
+		return append(fields, tup.Fields[fieldNo+1:]...), nil
+	})
+	if err != nil {
+		return err
+	}
+	c.removeColumns(t)
+	t.desc = *newDesc
+	t.updateConstraintColumns(column, "")
+	t.updateStatsColumns(column, "")
+	c.updateSequenceOwners(table, column, "")
+	c.addColumns(t)
+	return nil
+}
+
+// Rename a column of the named table.  Since tuples are stored without field
+// names, the table's file does not need to be rewritten, although that of the
+// column of a columnar table is renamed.
+func (c *Catalog) renameColumn(table string, column string, newName string) error {
+	t, err := c.getTableForAlter(table)
+	if err != nil {
+		return err
+	}
+	fieldNo, err := findFieldInTd(FieldType{column, "", UnknownType}, &t.desc)
+	if err != nil {
+		return GoDBError{IllegalOperationError, fmt.Sprintf("table '%s' has no column '%s'", table, column)}
+	}
+	if _, err := findFieldInTd(FieldType{newName, "", UnknownType}, &t.desc); err == nil {
+		return GoDBError{DuplicateTableError, fmt.Sprintf("table '%s' already has a column '%s'", table, newName)}
+	}
+	newDesc := t.desc.copy()
+	newDesc.Fields[fieldNo].Fname = newName
+	// the files of columnar tables are named after their columns
+	if t.columnar {
+		if err := c.discardCachedPages(t); err != nil {
+			return err
+		}
+		oldFile := c.columnFileNames(table, &t.desc)[fieldNo]
+		if err := os.Rename(oldFile, c.columnFileNames(table, newDesc)[fieldNo]); err != nil {
+			return err
+		}
+	}
+	c.removeColumns(t)
+	t.desc = *newDesc
+	t.updateConstraintColumns(column, newName)
+	t.updateStatsColumns(column, newName)
+	c.updateSequenceOwners(table, column, newName)
+	for _, ref := range c.referringConstraints(table) {
+		refColumns := make([]string, len(ref.con.refColumns))
+		for i, col := range ref.con.refColumns {
+			refColumns[i] = col
+			if col == column {
+				refColumns[i] = newName
+			}
+		}
+		ref.con.refColumns = refColumns
+	}
+	c.addColumns(t)
+	return nil
+}
+
+// Rename a table, along with the files that store it.
+func (c *Catalog) renameTable(table string, newName string) error {
+	t, err := c.getTableForAlter(table)
+	if err != nil {
+		return err
+	}
+	if c.tableMap[newName] != nil {
+		return GoDBError{DuplicateTableError, fmt.Sprintf("a table named '%s' already exists", newName)}
+	}
+	err = c.discardCachedPages(t)
+	if err != nil {
+		return err
+	}
+	newFiles := []string{c.tableNameToFile(newName)}
+	if t.columnar {
+		newFiles = c.columnFileNames(newName, &t.desc)
+	}
+	for i, name := range c.tableFiles(t) {
+		if err := os.Rename(name, newFiles[i]); err != nil {
+			return err
+		}
+	}
+	for _, ref := range c.referringConstraints(table) {
+		ref.con.refTable = newName
+	}
+	c.updateSequenceOwners(table, "", newName)
+	delete(c.tableMap, table)
+	t.name = newName
+	c.tableMap[newName] = t
+	return nil
+}
+
+// Return true if column has a NOT NULL constraint
+func (t *Table) isNotNull(column string) bool {
+	for _, con := range t.constraints {
+		if con.ctype == NotNullConstraint && con.columns[0] == column {
+			return true
+		}
+	}
+	return false
+}
+
+// Update the constraints and defaults of t after column has been dropped from
+// it (if newName is "") or renamed to newName.  Constraints on a dropped
+// column are dropped along with it.
+func (t *Table) updateConstraintColumns(column string, newName string) {
+	if value, ok := t.defaults[column]; ok {
+		delete(t.defaults, column)
+		if newName != "" {
+			t.defaults[newName] = value
+		}
+	}
+	var constraints []*Constraint
+	for _, con := range t.constraints {
+		keep := true
+		for i, col := range con.columns {
+			if col != column {
+				continue
+			}
+			if newName == "" {
+				keep = false
+				break
+			}
+			cols := make([]string, len(con.columns))
+			copy(cols, con.columns)
+			cols[i] = newName
+			newCon := *con
+			newCon.columns = cols
+			if con.ctype == CheckConstraint {
+				newCon.check = renameColumnInExpr(con.check, column, newName)
+			}
+			con = &newCon
+		}
+		if keep {
+			constraints = append(constraints, con)
+		}
+	}
+	t.constraints = constraints
+}
+
+// Return a checker for the constraints of the named table, or nil if it has
+// none.
+func (c *Catalog) getConstraintChecker(table string) (*constraintChecker, error) {
+	t := c.tableMap[table]
+	if t == nil {
+		return nil, GoDBError{NoSuchTableError, fmt.Sprintf("no table '%s' found", table)}
+	}
+	return newConstraintChecker(c, t)
+}
+
 func ImportCatalogFromCSVs(catalogFile string, bp *BufferPool, rootPath string, tableSuffix string, separator string) error {
 	c, err := NewCatalogFromFile(catalogFile, bp, rootPath)
 	if err != nil {
@@ -52,15 +563,11 @@ func ImportCatalogFromCSVs(catalogFile string, bp *BufferPool, rootPath string,
 	for _, t := range c.tables {
 		fmt.Printf("Doing %s\n", t.name)
 		fileName := rootPath + "/" + t.name + "." + tableSuffix
-		hf, err := NewHeapFile(c.tableNameToFile(t.name), t.desc.copy(), c.bp)
-		if err != nil {
-			return err
-		}
 		f, err := os.Open(fileName)
 		if err != nil {
 			return err
 		}
-		err = hf.LoadFromCSV(f, false, separator, true)
+		err = c.LoadTableFromCSV(t.name, f, false, separator, true)
 		if err != nil {
 			return err
 		}
@@ -69,99 +576,220 @@ func ImportCatalogFromCSVs(catalogFile string, bp *BufferPool, rootPath string,
 	return nil
 }
 
-func parseCatalogFile(catalogFile string, rootPath string) ([]TupleDesc, []string, error) {
-	var tables []TupleDesc
-	var names []string
+// Append the tuples of a CSV file to the named table, which may be stored in
+// either a HeapFile or a ColumnFile.  The arguments are as for
+// [HeapFile.LoadFromCSV].
+func (c *Catalog) LoadTableFromCSV(table string, file *os.File, hasHeader bool, sep string, skipLastField bool) error {
+	dbFile, err := c.GetTable(table)
+	if err != nil {
+		return err
+	}
+	switch dbFile := dbFile.(type) {
+	case *HeapFile:
+		return dbFile.LoadFromCSV(file, hasHeader, sep, skipLastField)
+	case *ColumnFile:
+		return dbFile.LoadFromCSV(file, hasHeader, sep, skipLastField)
+	}
+	return GoDBError{IllegalOperationError, fmt.Sprintf("cannot load table '%s' from a CSV file", table)}
+}
+
+// Parse a catalog file, which contains one table definition per line, in the
+// format accepted by CREATE TABLE (without the CREATE TABLE), e.g.:
+//
+//	t (name string, age int not null, primary key (name))
+//
+// or one sequence definition per line, in the format accepted by CREATE
+// SEQUENCE (without the CREATE), e.g.:
+//
+//	sequence t_id_seq start 1 increment 1 next 33 owned by t.id
+//
+// or the statistics of a table or column, as described in
+// [tokenStream.statisticsDefinition], e.g.:
+//
+//	statistics t rows 1000 pages 10
+//	statistics t.age distinct 37 nulls 0.01 min 3 max 90 histogram (3, 20, 35, 90)
+func parseCatalogFile(catalogFile string, rootPath string) ([]*Table, []*Sequence, []*statisticsEntry, error) {
+	var tables []*Table
+	var sequences []*Sequence
+	var statistics []*statisticsEntry
 	f, err := os.Open(rootPath + "/" + catalogFile)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
+	defer f.Close()
 	scanner := bufio.NewScanner(f)
+	// statistics lines include histograms and sketches
+	scanner.Buffer(nil, 1<<20)
 
 	for scanner.Scan() {
-		// code to read each line
-		line := strings.ToLower(scanner.Text())
-		sep := strings.Split(line, "(")
-		if len(sep) != 2 {
-			return nil, nil, GoDBError{ParseError, fmt.Sprintf("expected one paren in catalog entry, got %d (%s)", len(sep), line)}
-		}
-		tableName := strings.TrimSpace(sep[0])
-		rest := strings.Trim(sep[1], "()")
-		fields := strings.Split(rest, ",")
-		var fieldArray []FieldType
-		for _, f := range fields {
-			f := strings.TrimSpace(f)
-			nameType := strings.Split(f, " ")
-			if len(nameType) != 2 {
-				return nil, nil, GoDBError{ParseError, fmt.Sprintf("malformed catalog entry %s (line %s)", nameType, line)}
-			}
-			switch nameType[1] {
-			case "int":
-				fallthrough
-			case "integer":
-				fieldArray = append(fieldArray, FieldType{nameType[0], "", IntType})
-			case "string":
-				fallthrough
-			case "varchar":
-				fallthrough
-			case "text":
-				fieldArray = append(fieldArray, FieldType{nameType[0], "", StringType})
-			default:
-				return nil, nil, GoDBError{ParseError, fmt.Sprintf("unknown type %s (line %s)", nameType[1], line)}
-			}
-		}
-		tables = append(tables, TupleDesc{fieldArray})
-		names = append(names, tableName)
-	}
-	return tables, names, nil
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		ts := newTokenStream(line)
+		if isSequenceDefinition(line) {
+			ts.next()
+			s, err := ts.sequenceDefinition()
+			if err == nil && !ts.atEnd() {
+				err = ts.errorf("unexpected text after sequence definition")
+			}
+			if err != nil {
+				return nil, nil, nil, GoDBError{ParseError, fmt.Sprintf("malformed catalog entry: %s (line %s)", err.(GoDBError).errString, line)}
+			}
+			sequences = append(sequences, s)
+			continue
+		}
+		if isStatisticsDefinition(line) {
+			ts.next()
+			e, err := ts.statisticsDefinition()
+			if err == nil && !ts.atEnd() {
+				err = ts.errorf("unexpected text after statistics")
+			}
+			if err != nil {
+				return nil, nil, nil, GoDBError{ParseError, fmt.Sprintf("malformed catalog entry: %s (line %s)", err.(GoDBError).errString, line)}
+			}
+			statistics = append(statistics, e)
+			continue
+		}
+		t, err := ts.tableDefinition()
+		if err == nil && !ts.atEnd() {
+			err = ts.errorf("unexpected text after table definition")
+		}
+		if err != nil {
+			return nil, nil, nil, GoDBError{ParseError, fmt.Sprintf("malformed catalog entry: %s (line %s)", err.(GoDBError).errString, line)}
+		}
+		tables = append(tables, t)
+	}
+	return tables, sequences, statistics, nil
 
 }
 
 func NewCatalogFromFile(catalogFile string, bp *BufferPool, rootPath string) (*Catalog, error) {
-	tabs, names, err := parseCatalogFile(catalogFile, rootPath)
+	tabs, seqs, statistics, err := parseCatalogFile(catalogFile, rootPath)
 	if err != nil {
 		return nil, err
 	}
-	c := &Catalog{make([]*Table, 0), make(map[string]*Table), make(map[string][]*Table), bp, rootPath}
-	for i, t := range tabs {
-		c.addTable(names[i], t)
+	c := &Catalog{catalogState: &catalogState{tables: make([]*Table, 0), tableMap: make(map[string]*Table), columnMap: make(map[string][]*Table), sequences: make(map[string]*Sequence), bp: bp, rootPath: rootPath, catalogFile: catalogFile}}
+	for _, s := range seqs {
+		if err := c.loadSequenceLimit(s); err != nil {
+			return nil, err
+		}
+		if err := c.addSequence(s); err != nil {
+			return nil, err
+		}
+	}
+	for _, t := range tabs {
+		if err := c.addTable(t); err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range statistics {
+		if err := c.addStatisticsEntry(e); err != nil {
+			return nil, err
+		}
 	}
 
 	return c, nil
 
 }
 
-func (c *Catalog) addTable(named string, desc TupleDesc) error {
-	_, err := c.GetTable(named)
+func (c *Catalog) addTable(t *Table) error {
+	_, err := c.GetTable(t.name)
 	if err != nil {
-		t := &Table{named, desc}
+		if t.defaults == nil {
+			t.defaults = make(map[string]string)
+		}
 		c.tables = append(c.tables, t)
-		c.tableMap[named] = t
-		for _, f := range desc.Fields {
-			mapList := c.columnMap[f.Fname]
-			if mapList == nil {
-				mapList = make([]*Table, 0)
+		c.tableMap[t.name] = t
+		c.addColumns(t)
+		// the default value of an auto increment column is the next value of
+		// a sequence created for it
+		for _, col := range t.autoIncrement {
+			name, err := c.createOwnedSequence(t.name, col)
+			if err != nil {
+				return err
 			}
-			mapList = append(mapList, t)
-			c.columnMap[f.Fname] = mapList
+			t.defaults[col] = fmt.Sprintf("nextval('%s')", name)
 		}
+		t.autoIncrement = nil
 		return nil
 	} else {
-		return GoDBError{DuplicateTableError, fmt.Sprintf("a table named '%s' already exists", named)}
+		return GoDBError{DuplicateTableError, fmt.Sprintf("a table named '%s' already exists", t.name)}
+	}
+}
+
+// Check that the DEFAULT values and CHECK constraints of t compile
+func (c *Catalog) compileTableExprs(t *Table) error {
+	for _, f := range t.desc.Fields {
+		if value, ok := t.defaults[f.Fname]; ok {
+			if _, err := compileDefault(c, value, f.Ftype); err != nil {
+				return err
+			}
+		}
 	}
+	for _, con := range t.constraints {
+		if con.ctype == CheckConstraint {
+			if _, err := compileCheck(c, con.check, &t.desc); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Return an expression for the value given to column of table t when an
+// INSERT does not specify one: its DEFAULT value, if it has one, or NULL.
+func (c *Catalog) getColumnDefault(t *Table, column FieldType) (Expr, error) {
+	value, ok := t.defaults[column.Fname]
+	if !ok {
+		return &ConstExpr{nil, UnknownType}, nil
+	}
+	return compileDefault(c, value, column.Ftype)
 }
 
 func (c *Catalog) tableNameToFile(tableName string) string {
 	return c.rootPath + "/" + tableName + ".dat"
 
 }
+
+// Return the names of the files that store the columns, with fields desc, of
+// a columnar table
+func (c *Catalog) columnFileNames(tableName string, desc *TupleDesc) []string {
+	names := make([]string, len(desc.Fields))
+	for i, f := range desc.Fields {
+		names[i] = c.rootPath + "/" + tableName + "." + f.Fname + ".dat"
+	}
+	return names
+}
+
+// Return the names of the files that store t: its heap file, or the file of
+// each of its columns if it is columnar
+func (c *Catalog) tableFiles(t *Table) []string {
+	if t.columnar {
+		return c.columnFileNames(t.name, &t.desc)
+	}
+	return []string{c.tableNameToFile(t.name)}
+}
+
 func (c *Catalog) GetTable(named string) (DBFile, error) {
 	t := c.tableMap[named]
 	if t == nil {
 		return nil, GoDBError{NoSuchTableError, fmt.Sprintf("no table '%s' found", named)}
 	}
-	return NewHeapFile(c.tableNameToFile(named), t.desc.copy(), c.bp)
+	return c.openTable(t)
+}
 
+// Return the file that stores t, which is a ColumnFile if t is columnar and a
+// HeapFile otherwise
+func (c *Catalog) openTable(t *Table) (DBFile, error) {
+	if t.columnar {
+		cf, err := NewColumnFile(c.columnFileNames(t.name, &t.desc), *t.desc.copy(), c.bp)
+		if err != nil {
+			return nil, err
+		}
+		return cf, nil
+	}
+	return NewHeapFile(c.tableNameToFile(t.name), t.desc.copy(), c.bp)
 }
 
 func (c *Catalog) findTablesWithColumn(named string) []*Table {
@@ -188,8 +816,26 @@ func (c *Catalog) CatalogString() string {
 				fieldStr = fieldStr + ", "
 			}
 			fieldStr = fieldStr + f.Fname + " " + typeNames[f.Ftype]
+			if value, ok := t.defaults[f.Fname]; ok {
+				fieldStr = fieldStr + " default " + value
+			}
+			if t.isNotNull(f.Fname) {
+				fieldStr = fieldStr + " not null"
+			}
 		}
-		outStr = outStr + t.name + " " + fieldStr + ")\n"
+		for _, con := range t.constraints {
+			if con.ctype != NotNullConstraint {
+				fieldStr = fieldStr + ", " + con.String()
+			}
+		}
+		outStr = outStr + t.name + " " + fieldStr + ")"
+		if t.columnar {
+			outStr = outStr + " with (storage = column)"
+		}
+		outStr = outStr + "\n"
+	}
+	for _, name := range c.sequenceNames() {
+		outStr = outStr + c.sequences[name].String() + "\n"
 	}
 	return outStr
 }
@@ -0,0 +1,272 @@
+package godb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAlterTableAddColumn(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "t (name string, age int)\n")
+	mustRunSQL(t, c, bp, "insert into t values ('sam', 25), ('george jones', 999), ('mary', 30)")
+	mustRunSQL(t, c, bp, "alter table t add column city varchar(20) default 'boston', add score int")
+
+	res := mustRunSQL(t, c, bp, "select name, age, city, score from t where name = 'sam'")
+	if len(res) != 1 {
+		t.Fatalf("expected one result, got %d", len(res))
+	}
+	// without a DEFAULT, existing rows get NULL
+	if res[0].Fields[2].(StringField).Value != "boston" || res[0].Fields[3] != nil {
+		t.Errorf("unexpected values for new columns %v", res[0].Fields)
+	}
+	mustRunSQL(t, c, bp, "insert into t values ('ann', 40, 'nyc', 7)")
+	res = mustRunSQL(t, c, bp, "select score from t where name = 'ann'")
+	if len(res) != 1 || res[0].Fields[0].(IntField).Value != 7 {
+		t.Errorf("unexpected value of new column %v", res)
+	}
+	if len(c.findTablesWithColumn("city")) != 1 {
+		t.Errorf("columnMap not updated for new column")
+	}
+}
+
+func TestAlterTableDropColumn(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "t (name string, age int)\n")
+	mustRunSQL(t, c, bp, "insert into t values ('sam', 25), ('george jones', 999), ('mary', 30)")
+	mustRunSQL(t, c, bp, "alter table t drop column name")
+
+	res := mustRunSQL(t, c, bp, "select * from t")
+	if len(res) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(res))
+	}
+	if len(res[0].Fields) != 1 {
+		t.Errorf("expected one field after drop, got %d", len(res[0].Fields))
+	}
+	if _, err := runSQL(c, bp, "select name from t"); err == nil {
+		t.Errorf("expected error selecting dropped column")
+	}
+	if _, err := runSQL(c, bp, "alter table t drop column age"); err == nil {
+		t.Errorf("expected error dropping the only column")
+	}
+}
+
+func TestAlterTableRename(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "t (name string, age int)\n")
+	mustRunSQL(t, c, bp, "insert into t values ('sam', 25), ('george jones', 999), ('mary', 30)")
+	mustRunSQL(t, c, bp, "alter table t rename column age to years")
+	mustRunSQL(t, c, bp, "alter table t rename to people")
+
+	res := mustRunSQL(t, c, bp, "select sum(years) from people")
+	if res[0].Fields[0].(IntField).Value != 25+999+30 {
+		t.Errorf("unexpected sum after rename %v", res[0].Fields[0])
+	}
+	if _, err := runSQL(c, bp, "select * from t"); err == nil {
+		t.Errorf("expected error selecting from old table name")
+	}
+
+	mustRunSQL(t, c, bp, "rename table people to t")
+	if c.CatalogString() != "t (name string, years int)\n" {
+		t.Errorf("unexpected catalog %q", c.CatalogString())
+	}
+}
+
+func TestAlterTableErrors(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "t (name string, age int)\n")
+	mustRunSQL(t, c, bp, "insert into t values ('sam', 25), ('george jones', 999), ('mary', 30)")
+	for _, sql := range []string{
+		"alter table nosuch add column x int",
+		"alter table t add column age int",
+		"alter table t add column x int default 'abc'",
+		"alter table t add column x int not null",
+		"alter table t add column x int default null not null",
+		"alter table t drop column nosuch",
+		"alter table t rename column age to name",
+		"alter table t frobnicate",
+		// the statement is parsed as a whole, so x is not added
+		"alter table t add x int, frobnicate",
+		// every action is checked before any is applied
+		"alter table t add x int, drop column nosuch",
+		"alter table t rename column age to years, add column x int, drop column age",
+		"alter table t add column x int, add column x string",
+		"alter table t drop column age, rename column name to age, drop column age",
+		"alter table t rename to u, add column name int",
+		"alter table t add column x int, rename to t",
+	} {
+		if _, err := runSQL(c, bp, sql); err == nil {
+			t.Errorf("expected error for %s", sql)
+		}
+	}
+	if c.CatalogString() != "t (name string, age int)\n" {
+		t.Errorf("catalog changed by failed statements: %q", c.CatalogString())
+	}
+
+	// names freed by earlier actions may be reused by later ones
+	mustRunSQL(t, c, bp, "alter table t rename column age to years, add column age int, drop column years, rename to u, rename to t")
+	if c.CatalogString() != "t (name string, age int)\n" {
+		t.Errorf("unexpected catalog %q", c.CatalogString())
+	}
+}
+
+func TestAlterTableWaitsForLocks(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "t (name string, age int)\n")
+	mustRunSQL(t, c, bp, "insert into t values ('sam', 25), ('george jones', 999), ('mary', 30)")
+	_, op, err := Parse(c, "select * from t")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	if _, err := runOp(op, tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := runSQL(c, bp, "alter table t add column score int default 5")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("alter table did not wait for the reading transaction (err %v)", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	bp.CommitTransaction(tid)
+	if err := <-done; err != nil {
+		t.Fatalf(err.Error())
+	}
+	res := mustRunSQL(t, c, bp, "select sum(score) from t")
+	if res[0].Fields[0].(IntField).Value != 15 {
+		t.Errorf("unexpected sum of new column %v", res[0].Fields[0])
+	}
+}
+
+func TestCatalogSaveAndLoad(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "t (name string, age int)\n")
+	mustRunSQL(t, c, bp, "insert into t values ('sam', 25)")
+	mustRunSQL(t, c, bp, "alter table t add column score int")
+	if err := c.SaveToFile("catalog.txt", c.rootPath); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := os.Stat(c.rootPath + "/catalog.txt.tmp"); err == nil {
+		t.Errorf("temporary catalog file left behind")
+	}
+	c2, err := NewCatalogFromFile("catalog.txt", bp, c.rootPath)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if c2.CatalogString() != c.CatalogString() {
+		t.Errorf("expected catalog %q, got %q", c.CatalogString(), c2.CatalogString())
+	}
+
+	dir := t.TempDir()
+	os.WriteFile(dir+"/catalog.txt", []byte("t (a int)\nt (b int)\n"), 0644)
+	if _, err := NewCatalogFromFile("catalog.txt", bp, dir); err == nil {
+		t.Errorf("expected error loading a catalog with a duplicate table")
+	}
+}
+
+func TestAlterTableAddNotNullColumn(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "t (name string, age int)\n")
+	mustRunSQL(t, c, bp, "insert into t values ('sam', 25), ('george jones', 999), ('mary', 30)")
+	mustRunSQL(t, c, bp, "alter table t add column score int not null default 5")
+
+	res := mustRunSQL(t, c, bp, "select score from t where name = 'mary'")
+	if len(res) != 1 || res[0].Fields[0].(IntField).Value != 5 {
+		t.Errorf("expected the default in existing rows, got %v", res)
+	}
+	if _, err := runSQL(c, bp, "insert into t values ('ann', 40, null)"); err == nil {
+		t.Errorf("expected error inserting null into a not null column")
+	}
+	if c.CatalogString() != "t (name string, age int, score int default 5 not null)\n" {
+		t.Errorf("unexpected catalog %q", c.CatalogString())
+	}
+}
+
+func TestAlterTableAddColumnVolatileDefault(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "t (name string, age int)\n")
+	mustRunSQL(t, c, bp, "insert into t values ('sam', 25), ('george jones', 999), ('mary', 30)")
+	// the default is evaluated separately for each existing row
+	mustRunSQL(t, c, bp, "alter table t add column r int default rand()")
+
+	res := mustRunSQL(t, c, bp, "select r from t")
+	if len(res) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(res))
+	}
+	if res[0].Fields[0] == res[1].Fields[0] && res[1].Fields[0] == res[2].Fields[0] {
+		t.Errorf("expected a different default in each row, got %v", res[0].Fields[0])
+	}
+}
+
+func TestColumnarTable(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "t (name string, age int)\n")
+	mustRunSQL(t, c, bp, "create table w (id int, label string, score int) with (storage = column)")
+	mustRunSQL(t, c, bp, "insert into w values (1, 'one', 10), (2, 'two', 20), (3, null, 30)")
+	if file, _ := c.GetTable("w"); file == nil {
+		t.Fatalf("no file for columnar table")
+	} else if _, ok := file.(*ColumnFile); !ok {
+		t.Errorf("expected a column file, got %T", file)
+	}
+	if file, _ := c.GetTable("t"); file == nil {
+		t.Fatalf("no file for heap table")
+	} else if _, ok := file.(*HeapFile); !ok {
+		t.Errorf("expected a heap file, got %T", file)
+	}
+
+	// the storage of the table is recorded in the catalog
+	expected := "t (name string, age int)\nw (id int, label string, score int) with (storage = column)\n"
+	if c.CatalogString() != expected {
+		t.Errorf("unexpected catalog %q", c.CatalogString())
+	}
+	if err := c.SaveToFile("catalog.txt", c.rootPath); err != nil {
+		t.Fatalf(err.Error())
+	}
+	c, err := NewCatalogFromFile("catalog.txt", bp, c.rootPath)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if c.CatalogString() != expected {
+		t.Errorf("unexpected catalog after reload %q", c.CatalogString())
+	}
+	expectRows(t, c, bp, "select id, label from w order by id", "1,one", "2,two", "3,null")
+
+	// ALTER TABLE rewrites or renames the files of the columns
+	mustRunSQL(t, c, bp, "alter table w add column city string default 'boston', drop column score")
+	mustRunSQL(t, c, bp, "alter table w rename column label to name, rename to people")
+	expectRows(t, c, bp, "select id, name, city from people order by id", "1,one,boston", "2,two,boston", "3,null,boston")
+	if c.CatalogString() != "t (name string, age int)\npeople (id int, name string, city string default 'boston') with (storage = column)\n" {
+		t.Errorf("unexpected catalog after alter %q", c.CatalogString())
+	}
+	for _, name := range []string{"w.id.dat", "w.score.dat", "people.score.dat", "people.label.dat"} {
+		if _, err := os.Stat(c.rootPath + "/" + name); err == nil {
+			t.Errorf("expected %s to be removed", name)
+		}
+	}
+	if tmpFiles, _ := filepath.Glob(c.rootPath + "/*.tmp"); len(tmpFiles) != 0 {
+		t.Errorf("expected the temporary files of the rewrite to be renamed, found %v", tmpFiles)
+	}
+
+	// tuples are appended to columnar tables from CSV files
+	csv := c.rootPath + "/people.csv"
+	if err := os.WriteFile(csv, []byte("id,name,city\n4,four,nyc\n5,five,sf\n"), 0644); err != nil {
+		t.Fatalf(err.Error())
+	}
+	f, err := os.Open(csv)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer f.Close()
+	if err := c.LoadTableFromCSV("people", f, true, ",", false); err != nil {
+		t.Fatalf(err.Error())
+	}
+	expectRows(t, c, bp, "select count(*), max(city) from people", "5,sf")
+
+	mustRunSQL(t, c, bp, "drop table people")
+	for _, name := range []string{"people.id.dat", "people.name.dat", "people.city.dat"} {
+		if _, err := os.Stat(c.rootPath + "/" + name); err == nil {
+			t.Errorf("expected %s to be removed", name)
+		}
+	}
+	if _, err := runSQL(c, bp, "create table x (a int) with (storage = rows)"); err == nil {
+		t.Errorf("expected error for unknown storage")
+	}
+}
@@ -0,0 +1,409 @@
+package godb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// The encodings of the values of a column page.  The encoding of a page is
+// chosen each time it is written, as the one that takes the fewest bytes of
+// those that apply to its values, and its id is stored in the page header.
+// Pages are filled until their values no longer fit in PageSize bytes in the
+// encoding that takes the fewest bytes (see [columnSizes]), so that columns
+// whose values encode well take fewer pages.  Pages take PageSize bytes in
+// their file whatever their encoding, so that the pages of every column are
+// at the same offsets.
+type columnEncoding int16
+
+const (
+	// each value written in full, as by [Tuple.writeTo]
+	plainEncoding columnEncoding = iota
+	// runs of equal values, each written as a count and the value
+	runLengthEncoding
+	// the distinct values, followed by the index of each value in them,
+	// bit-packed
+	dictionaryEncoding
+	// for ints, the smallest value, followed by the offset of each value
+	// from it, bit-packed (frame of reference)
+	frameOfReferenceEncoding
+)
+
+var columnEncodingNames = []string{"plain", "run length", "dictionary", "frame of reference"}
+
+func (e columnEncoding) String() string {
+	if e < 0 || int(e) >= len(columnEncodingNames) {
+		return fmt.Sprintf("unknown encoding %d", int(e))
+	}
+	return columnEncodingNames[e]
+}
+
+// Write values, which are those of the column field, with the encoding that
+// takes the fewest bytes, returning that encoding
+func encodeColumnValues(b *bytes.Buffer, field FieldType, values []DBValue) (columnEncoding, error) {
+	sizes := newColumnSizes(field)
+	for _, v := range values {
+		sizes.add(v)
+	}
+	best, _ := sizes.smallest(sizes.n, sizes.runs, len(sizes.dictionary), sizes.min, sizes.max)
+	ok, err := encodeColumn(b, best, field, values)
+	if err == nil && !ok {
+		err = GoDBError{MalformedDataError, fmt.Sprintf("%v encoding does not apply to column values", best)}
+	}
+	return best, err
+}
+
+// Write values, which are those of the column field, with the encoding enc,
+// returning false if enc does not apply to them
+func encodeColumn(b *bytes.Buffer, enc columnEncoding, field FieldType, values []DBValue) (bool, error) {
+	switch enc {
+	case plainEncoding:
+		for _, v := range values {
+			if err := writeColumnValue(b, field, v); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+
+	case runLengthEncoding:
+		var runs []int // the index of the first value of each run
+		for i, v := range values {
+			if i == 0 || v != values[i-1] || i-runs[len(runs)-1] == 0xffff {
+				runs = append(runs, i)
+			}
+		}
+		if err := binary.Write(b, binary.LittleEndian, uint16(len(runs))); err != nil {
+			return false, err
+		}
+		for r, start := range runs {
+			end := len(values)
+			if r+1 < len(runs) {
+				end = runs[r+1]
+			}
+			if err := binary.Write(b, binary.LittleEndian, uint16(end-start)); err != nil {
+				return false, err
+			}
+			if err := writeColumnValue(b, field, values[start]); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+
+	case dictionaryEncoding:
+		var dictionary []DBValue
+		indexes := make(map[DBValue]uint64)
+		packed := make([]uint64, len(values))
+		for i, v := range values {
+			index, ok := indexes[v]
+			if !ok {
+				index = uint64(len(dictionary))
+				indexes[v] = index
+				dictionary = append(dictionary, v)
+			}
+			packed[i] = index
+		}
+		if len(dictionary) > 0xffff {
+			return false, nil
+		}
+		if err := binary.Write(b, binary.LittleEndian, uint16(len(dictionary))); err != nil {
+			return false, err
+		}
+		for _, v := range dictionary {
+			if err := writeColumnValue(b, field, v); err != nil {
+				return false, err
+			}
+		}
+		return true, packBits(b, packed, dictionaryWidth(len(dictionary)))
+
+	case frameOfReferenceEncoding:
+		if field.Ftype != IntType {
+			return false, nil
+		}
+		// the offsets are from one less than the smallest value, so that
+		// an offset of 0 is a NULL
+		var min, max int64
+		found := false
+		for _, v := range values {
+			if v, ok := v.(IntField); ok {
+				if !found || v.Value < min {
+					min = v.Value
+				}
+				if !found || v.Value > max {
+					max = v.Value
+				}
+				found = true
+			}
+		}
+		if !frameOfReferenceApplies(min, max) {
+			return false, nil
+		}
+		maxOffset := uint64(max) - uint64(min) + 1
+		packed := make([]uint64, len(values))
+		for i, v := range values {
+			if v, ok := v.(IntField); ok {
+				packed[i] = uint64(v.Value) - uint64(min) + 1
+			}
+		}
+		width := bits.Len64(maxOffset)
+		if err := binary.Write(b, binary.LittleEndian, min); err != nil {
+			return false, err
+		}
+		if err := b.WriteByte(byte(width)); err != nil {
+			return false, err
+		}
+		return true, packBits(b, packed, width)
+	}
+	return false, GoDBError{MalformedDataError, fmt.Sprintf("unknown column encoding %d", int(enc))}
+}
+
+// Read n values of the column field, written with the encoding enc
+func decodeColumn(b *bytes.Buffer, enc columnEncoding, field FieldType, n int) ([]DBValue, error) {
+	values := make([]DBValue, 0, n)
+	switch enc {
+	case plainEncoding:
+		for i := 0; i < n; i++ {
+			v, err := readColumnValue(b, field)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+
+	case runLengthEncoding:
+		var numRuns uint16
+		if err := binary.Read(b, binary.LittleEndian, &numRuns); err != nil {
+			return nil, err
+		}
+		for r := 0; r < int(numRuns); r++ {
+			var count uint16
+			if err := binary.Read(b, binary.LittleEndian, &count); err != nil {
+				return nil, err
+			}
+			v, err := readColumnValue(b, field)
+			if err != nil {
+				return nil, err
+			}
+			for i := 0; i < int(count); i++ {
+				values = append(values, v)
+			}
+		}
+
+	case dictionaryEncoding:
+		var size uint16
+		if err := binary.Read(b, binary.LittleEndian, &size); err != nil {
+			return nil, err
+		}
+		dictionary := make([]DBValue, size)
+		for i := range dictionary {
+			v, err := readColumnValue(b, field)
+			if err != nil {
+				return nil, err
+			}
+			dictionary[i] = v
+		}
+		packed, err := unpackBits(b, n, dictionaryWidth(len(dictionary)))
+		if err != nil {
+			return nil, err
+		}
+		for _, index := range packed {
+			if index >= uint64(len(dictionary)) {
+				return nil, GoDBError{MalformedDataError, "dictionary index out of range"}
+			}
+			values = append(values, dictionary[index])
+		}
+
+	case frameOfReferenceEncoding:
+		var min int64
+		if err := binary.Read(b, binary.LittleEndian, &min); err != nil {
+			return nil, err
+		}
+		width, err := b.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		packed, err := unpackBits(b, n, int(width))
+		if err != nil {
+			return nil, err
+		}
+		for _, offset := range packed {
+			if offset == 0 {
+				values = append(values, nil)
+			} else {
+				values = append(values, IntField{int64(uint64(min) + offset - 1)})
+			}
+		}
+
+	default:
+		return nil, GoDBError{MalformedDataError, fmt.Sprintf("unknown column encoding %d", int(enc))}
+	}
+	if len(values) != n {
+		return nil, GoDBError{MalformedDataError, fmt.Sprintf("expected %d values in column page, found %d", n, len(values))}
+	}
+	return values, nil
+}
+
+// The number of bytes that the values of a column page take in each
+// encoding, kept up to date as values are added in slot order, so that
+// whether another value fits in the page is known without encoding them
+type columnSizes struct {
+	field      FieldType
+	n          int // the number of values
+	runs       int
+	runLength  int // of the last run
+	last       DBValue
+	dictionary map[DBValue]bool
+	min, max   int64 // of the int values, or 0 if there are none
+	found      bool  // whether there are int values
+}
+
+func newColumnSizes(field FieldType) *columnSizes {
+	return &columnSizes{field: field, dictionary: make(map[DBValue]bool)}
+}
+
+// Add v after the values already added
+func (s *columnSizes) add(v DBValue) {
+	if s.n == 0 || v != s.last || s.runLength == 0xffff {
+		s.runs++
+		s.runLength = 0
+	}
+	s.runLength++
+	s.last = v
+	s.n++
+	s.dictionary[v] = true
+	if v, ok := v.(IntField); ok {
+		if !s.found || v.Value < s.min {
+			s.min = v.Value
+		}
+		if !s.found || v.Value > s.max {
+			s.max = v.Value
+		}
+		s.found = true
+	}
+}
+
+// Return the number of bytes the values take in the encoding that takes the
+// fewest, as written by encodeColumnValues
+func (s *columnSizes) size() int {
+	_, size := s.smallest(s.n, s.runs, len(s.dictionary), s.min, s.max)
+	return size
+}
+
+// Return the number of bytes the values would take if v were added
+func (s *columnSizes) sizeWith(v DBValue) int {
+	runs := s.runs
+	if s.n == 0 || v != s.last || s.runLength == 0xffff {
+		runs++
+	}
+	distinct := len(s.dictionary)
+	if !s.dictionary[v] {
+		distinct++
+	}
+	min, max := s.min, s.max
+	if v, ok := v.(IntField); ok {
+		if !s.found || v.Value < min {
+			min = v.Value
+		}
+		if !s.found || v.Value > max {
+			max = v.Value
+		}
+	}
+	_, size := s.smallest(s.n+1, runs, distinct, min, max)
+	return size
+}
+
+// Return the encoding that takes the fewest bytes for n values with the
+// given number of runs and distinct values and, for ints, bounds, and the
+// number of bytes it takes
+func (s *columnSizes) smallest(n int, runs int, distinct int, min int64, max int64) (columnEncoding, int) {
+	// each value written in full is preceded by its NULL bitmap
+	width := nullBitmapSize(1) + 8
+	if s.field.Ftype == StringType {
+		width = nullBitmapSize(1) + StringLength
+	}
+	best, bestSize := plainEncoding, n*width
+	if size := 2 + runs*(2+width); size < bestSize {
+		best, bestSize = runLengthEncoding, size
+	}
+	if distinct <= 0xffff {
+		if size := 2 + distinct*width + (n*dictionaryWidth(distinct)+7)/8; size < bestSize {
+			best, bestSize = dictionaryEncoding, size
+		}
+	}
+	if s.field.Ftype == IntType && frameOfReferenceApplies(min, max) {
+		offsetWidth := bits.Len64(uint64(max) - uint64(min) + 1)
+		if size := 8 + 1 + (n*offsetWidth+7)/8; size < bestSize {
+			best, bestSize = frameOfReferenceEncoding, size
+		}
+	}
+	return best, bestSize
+}
+
+// Return whether the offsets of ints between min and max, and of NULLs, fit in
+// 64 bits, as they must for the frame of reference encoding
+func frameOfReferenceApplies(min int64, max int64) bool {
+	return uint64(max)-uint64(min) < math.MaxUint64
+}
+
+// Write a value of the column field in full
+func writeColumnValue(b *bytes.Buffer, field FieldType, v DBValue) error {
+	t := Tuple{TupleDesc{[]FieldType{field}}, []DBValue{v}, nil}
+	return t.writeTo(b)
+}
+
+// Read a value of the column field written by writeColumnValue
+func readColumnValue(b *bytes.Buffer, field FieldType) (DBValue, error) {
+	t, err := readTupleFrom(b, &TupleDesc{[]FieldType{field}})
+	if err != nil {
+		return nil, err
+	}
+	return t.Fields[0], nil
+}
+
+// Return the number of bits needed for the indexes of a dictionary of size
+// values
+func dictionaryWidth(size int) int {
+	if size <= 1 {
+		return 0
+	}
+	return bits.Len64(uint64(size - 1))
+}
+
+// Write the low width bits of each of values, packed into as few bytes as
+// possible, least significant bit first
+func packBits(b *bytes.Buffer, values []uint64, width int) error {
+	buf := make([]byte, (len(values)*width+7)/8)
+	for i, v := range values {
+		for j := 0; j < width; j++ {
+			if v>>j&1 == 1 {
+				bit := i*width + j
+				buf[bit/8] |= 1 << (bit % 8)
+			}
+		}
+	}
+	_, err := b.Write(buf)
+	return err
+}
+
+// Read n values of width bits written by packBits
+func unpackBits(b *bytes.Buffer, n int, width int) ([]uint64, error) {
+	if width > 64 {
+		return nil, GoDBError{MalformedDataError, fmt.Sprintf("bit width %d is too large", width)}
+	}
+	size := (n*width + 7) / 8
+	if b.Len() < size {
+		return nil, GoDBError{MalformedDataError, "column page is truncated"}
+	}
+	buf := b.Next(size)
+	values := make([]uint64, n)
+	for i := range values {
+		for j := 0; j < width; j++ {
+			bit := i*width + j
+			if buf[bit/8]>>(bit%8)&1 == 1 {
+				values[i] |= 1 << j
+			}
+		}
+	}
+	return values, nil
+}
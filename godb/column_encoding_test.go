@@ -0,0 +1,217 @@
+package godb
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestColumnEncodings(t *testing.T) {
+	intField := FieldType{"a", "", IntType}
+	stringField := FieldType{"b", "", StringType}
+	var (
+		runs, flags, small, unique, extreme, nulls []DBValue
+	)
+	for i := 0; i < 400; i++ {
+		runs = append(runs, StringField{fmt.Sprintf("run%d", i/100)})
+		flags = append(flags, StringField{[]string{"A", "N", "R"}[(i*7)%3]})
+		small = append(small, IntField{int64(1000 + (i*37)%200)})
+		unique = append(unique, StringField{fmt.Sprintf("value%d", i*7919)})
+		nulls = append(nulls, nil)
+	}
+	extreme = []DBValue{IntField{math.MaxInt64}, nil, IntField{math.MinInt64}, IntField{0}}
+	smallest := []DBValue{IntField{math.MinInt64 + 3}, nil, IntField{math.MinInt64}, IntField{math.MinInt64 + 1}}
+	small[10], flags[20] = nil, nil
+
+	for _, test := range []struct {
+		name     string
+		field    FieldType
+		values   []DBValue
+		expected columnEncoding
+	}{
+		{"runs", stringField, runs, runLengthEncoding},
+		{"flags", stringField, flags, dictionaryEncoding},
+		{"small ints", intField, small, frameOfReferenceEncoding},
+		{"unique strings", stringField, unique, plainEncoding},
+		{"extreme ints", intField, extreme, plainEncoding},
+		{"smallest ints", intField, smallest, frameOfReferenceEncoding},
+		{"nulls", intField, nulls, dictionaryEncoding},
+		{"empty", intField, nil, plainEncoding},
+	} {
+		// every encoding that applies to the values reads them back
+		for _, enc := range []columnEncoding{plainEncoding, runLengthEncoding, dictionaryEncoding, frameOfReferenceEncoding} {
+			buf := new(bytes.Buffer)
+			ok, err := encodeColumn(buf, enc, test.field, test.values)
+			if err != nil {
+				t.Fatalf("%s: %s", test.name, err.Error())
+			}
+			if !ok {
+				continue
+			}
+			values, err := decodeColumn(buf, enc, test.field, len(test.values))
+			if err != nil {
+				t.Fatalf("%s with %v encoding: %s", test.name, enc, err.Error())
+			}
+			for i := range values {
+				if values[i] != test.values[i] {
+					t.Errorf("%s with %v encoding: expected %v at %d, got %v", test.name, enc, test.values[i], i, values[i])
+					break
+				}
+			}
+		}
+		buf := new(bytes.Buffer)
+		enc, err := encodeColumnValues(buf, test.field, test.values)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err.Error())
+		}
+		if enc != test.expected {
+			t.Errorf("%s: expected %v encoding, got %v", test.name, test.expected, enc)
+		}
+	}
+
+	if ok, _ := encodeColumn(new(bytes.Buffer), frameOfReferenceEncoding, stringField, flags); ok {
+		t.Errorf("expected frame of reference encoding not to apply to strings")
+	}
+	// the offsets of the smallest and largest ints, and of NULLs, do not
+	// fit in 64 bits
+	if ok, _ := encodeColumn(new(bytes.Buffer), frameOfReferenceEncoding, intField, extreme); ok {
+		t.Errorf("expected frame of reference encoding not to apply to %v", extreme)
+	}
+}
+
+func TestColumnPageEncoding(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "wide (a int, b string, c int, d string) with (storage = column)\n")
+	var rows []string
+	for i := 0; i < 300; i++ {
+		b := fmt.Sprintf("'b%d'", i)
+		if i%7 == 0 {
+			b = "null"
+		}
+		rows = append(rows, fmt.Sprintf("(%d, %s, %d, 'd%d')", i, b, i%10, i%3))
+	}
+	mustRunSQL(t, c, bp, "insert into wide values "+strings.Join(rows, ", "))
+	file, _ := c.GetTable("wide")
+	cf := file.(*ColumnFile)
+	page := newColumnPage(cf.Descriptor(), 3, 3, cf)
+	// the page is filled until its values no longer fit when encoded
+	for i := 0; ; i++ {
+		tup := &Tuple{*cf.Descriptor(), []DBValue{IntField{int64(i)}, nil, nil, StringField{[]string{"A", "N", "R"}[i%3]}}, nil}
+		if _, err := page.insertTuple(tup); err != nil {
+			break
+		}
+	}
+	// the dictionary holds three strings, each with its NULL bitmap
+	dictionarySize := 2 + 3*(nullBitmapSize(1)+StringLength)
+	if numValues := (PageSize - 8 - dictionarySize) * 4; int(page.numUsedSlots) != numValues {
+		t.Errorf("expected %d values of two bits in the page, got %d", numValues, page.numUsedSlots)
+	}
+	page.deleteTuple(5)
+	buf, err := page.toBuffer()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// the header, the dictionary of three strings, and two bits per value
+	if page.encoding != dictionaryEncoding || buf.Len() != 8+dictionarySize+(int(page.numUsedSlots)*2+7)/8 {
+		t.Errorf("expected a dictionary encoded page, got %v encoding of %d bytes", page.encoding, buf.Len())
+	}
+	// the slot of the deleted value is reused, while the values still fit
+	if rid, err := page.insertTuple(&Tuple{*cf.Descriptor(), []DBValue{nil, nil, nil, StringField{"N"}}, nil}); err != nil || rid != 5 {
+		t.Errorf("expected value inserted in slot 5, got %v, %v", rid, err)
+	}
+	if _, err := page.insertTuple(&Tuple{*cf.Descriptor(), []DBValue{nil, nil, nil, StringField{"N"}}, nil}); err == nil {
+		t.Errorf("expected error inserting into full page")
+	}
+	page.deleteTuple(5)
+
+	page2 := newColumnPage(cf.Descriptor(), 3, 3, cf)
+	if err := page2.initFromBuffer(buf); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if page2.encoding != dictionaryEncoding || page2.numUsedSlots != page.numUsedSlots {
+		t.Errorf("expected %d dictionary encoded values, got %d %v encoded values", page.numUsedSlots, page2.numUsedSlots, page2.encoding)
+	}
+	iter, iter2 := page.tupleIter(), page2.tupleIter()
+	for {
+		t1, _ := iter()
+		t2, _ := iter2()
+		if t1 == nil || t2 == nil {
+			if t1 != t2 {
+				t.Errorf("expected pages with the same number of values")
+			}
+			break
+		}
+		if t1.Fields[0] != t2.Fields[0] {
+			t.Errorf("expected %v, got %v", t1.Fields[0], t2.Fields[0])
+		}
+	}
+
+	// the pages of the table are encoded as they are written, and read back
+	// once they have been evicted from the buffer pool
+	bp.FlushAllPages()
+	bp.discardPages(cf, cf.NumPages())
+	expectRows(t, c, bp, "select count(*), sum(a), max(b), min(d) from wide where c = 7", "30,4560,b97,d0")
+	expectRows(t, c, bp, "select count(*) from wide where b is null", "43")
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	encodings := make(map[columnEncoding]bool)
+	for pageNo := 0; pageNo < cf.NumPages(); pageNo++ {
+		p, err := bp.GetPage(cf, pageNo, tid, ReadPerm)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		encodings[(*p).(*columnPage).encoding] = true
+	}
+	bp.CommitTransaction(tid)
+	if !encodings[frameOfReferenceEncoding] || !encodings[dictionaryEncoding] {
+		t.Errorf("expected frame of reference and dictionary encoded pages, got %v", encodings)
+	}
+}
+
+func TestColumnPageSizes(t *testing.T) {
+	// the sizes kept as values are added are those of the encodings
+	intField := FieldType{"a", "", IntType}
+	stringField := FieldType{"b", "", StringType}
+	for _, field := range []FieldType{intField, stringField} {
+		sizes := newColumnSizes(field)
+		var values []DBValue
+		for i := 0; i < 300; i++ {
+			var v DBValue = IntField{int64((i / 10) * (i % 4))}
+			if field.Ftype == StringType {
+				v = StringField{fmt.Sprintf("s%d", (i/10)*(i%4))}
+			}
+			if i%17 == 0 {
+				v = nil
+			}
+			expected := sizes.sizeWith(v)
+			sizes.add(v)
+			values = append(values, v)
+			buf := new(bytes.Buffer)
+			if _, err := encodeColumnValues(buf, field, values); err != nil {
+				t.Fatalf(err.Error())
+			}
+			if sizes.size() != buf.Len() || expected != buf.Len() {
+				t.Fatalf("%v values: expected %d bytes for %d values, got %d and %d", field.Ftype, buf.Len(), i+1, sizes.size(), expected)
+			}
+		}
+	}
+
+	// columns whose values encode well take fewer pages than their values
+	// written in full would
+	c, bp := makeSQLTestCatalog(t, "flags (id int, flag string, n int) with (storage = column)\n")
+	var rows []string
+	for i := 0; i < 2000; i++ {
+		rows = append(rows, fmt.Sprintf("(%d, '%s', %d)", i, []string{"A", "N", "R"}[i/700], i%5))
+	}
+	mustRunSQL(t, c, bp, "insert into flags values "+strings.Join(rows, ", "))
+	file, _ := c.GetTable("flags")
+	cf := file.(*ColumnFile)
+	perPage := (PageSize - 8) / (nullBitmapSize(1) + StringLength)
+	if plainPages := (2000 + perPage - 1) / perPage; cf.numPagesPerColumn != 1 || plainPages != 17 {
+		t.Errorf("expected 1 page per column rather than %d, got %d", plainPages, cf.numPagesPerColumn)
+	}
+	bp.FlushAllPages()
+	bp.discardPages(cf, cf.NumPages())
+	expectRows(t, c, bp, "select count(*), sum(n), max(id), min(flag) from flags where flag = 'N'", "700,1400,1399,N")
+}
@@ -45,9 +45,9 @@ func NewColumnFile(fromFiles []string, td TupleDesc, bp *BufferPool) (*ColumnFil
       return nil, err
     }
 
+    // each file holds the pages of one column
     var size int = (int)(fi.Size())
-    totalPages := (size + PageSize - 1) / PageSize
-    ret.numPagesPerColumn = totalPages / ret.numColumns
+    ret.numPagesPerColumn = (size + PageSize - 1) / PageSize
 
     break
   }
@@ -55,6 +55,19 @@ func NewColumnFile(fromFiles []string, td TupleDesc, bp *BufferPool) (*ColumnFil
   return ret, nil
 }
 
+// Return true if t can be inserted into pages, the pages of each column with
+// the same number.  The values of a tuple are in the same slot of the same
+// page of each column, so a tuple is only inserted once its value fits in
+// the page of every column.
+func tupleFits(pages []*columnPage, t *Tuple) bool {
+  for _, page := range pages {
+    if !page.fits(t) {
+      return false
+    }
+  }
+  return true
+}
+
 func (f *ColumnFile) NumPages() int {
   return f.numPagesPerColumn * f.numColumns
 }
@@ -62,35 +75,29 @@ func (f *ColumnFile) NumPages() int {
 func (f *ColumnFile) insertTuple(t *Tuple, tid TransactionID) error {
   j := 0
 
-  // inserting tuple into first column
+  // inserting tuple into the first pages that it fits in
   pageInserted := false
-  for i := 0; i < f.numPagesPerColumn; i++ {
-    pageNo := i * f.numColumns + j
-    // _, ok := f.bufPool.pages[f.pageKey(pageNo)]
-    // if !ok { // first search through pages in buffer pool
-    //   continue
-    // }
-    page, err := f.bufPool.GetPage(f, pageNo, tid, WritePerm)
-    if err != nil {
-      return err
+  pages := make([]*columnPage, f.numColumns)
+  for i := 0; i < f.numPagesPerColumn && !pageInserted; i++ {
+    for k := range pages {
+      page, err := f.bufPool.GetPage(f, i * f.numColumns + k, tid, WritePerm)
+      if err != nil {
+        return err
+      }
+      pages[k] = (*page).(*columnPage)
     }
-    cp := (*page).(*columnPage)
-    slot, err := cp.insertTuple(t)
-    if err == nil {
-      pageInserted = true
-      t.Rid = RecordID{pageNo : pageNo, slotNo : slot.(int)}
-
-      for k := 1; k < f.numColumns; k++ { // insert into rest of columns
-        pageNo = i * f.numColumns + k
-        page, err := f.bufPool.GetPage(f, pageNo, tid, WritePerm)
-        if err != nil {
-          return err
-        }
-        cp = (*page).(*columnPage)
-        cp.insertTuple(t)
+    if !tupleFits(pages, t) {
+      continue
+    }
+    pageInserted = true
+    for k, cp := range pages {
+      slot, err := cp.insertTuple(t)
+      if err != nil {
+        return err
+      }
+      if k == 0 {
+        t.Rid = RecordID{pageNo : i * f.numColumns + j, slotNo : slot.(int)}
       }
-
-      break
     }
   }
 
@@ -217,9 +224,25 @@ func (f *ColumnFile) Descriptor() *TupleDesc {
   return &(f.td)
 }
 
+// Return an iterator over the values of the given columns of the tuples of
+// the file, which only reads the pages of those columns.  The tuples have
+// the fields of the columns, in the order given, and the record id that
+// deleteTuple expects.
 func (f *ColumnFile) IteratorColumns(columns []int, tid TransactionID) (func() (*Tuple, error), error) {
   pageInColumn := 0
   numColumns := len(columns)
+  desc := &TupleDesc{}
+  for _, i := range columns {
+    if i < 0 || i >= f.numColumns {
+      return nil, GoDBError{IllegalOperationError, fmt.Sprintf("no column %d in column file", i)}
+    }
+    desc.Fields = append(desc.Fields, f.td.Fields[i])
+  }
+  if numColumns == 0 || f.numPagesPerColumn == 0 {
+    return func() (*Tuple, error) {
+      return nil, nil
+    }, nil
+  }
   pages := make([]*columnPage, numColumns)
   for local_idx, i := range columns {
     p, err := f.bufPool.GetPage(f, pageInColumn * f.numColumns + i, tid, ReadPerm)
@@ -235,7 +258,6 @@ func (f *ColumnFile) IteratorColumns(columns []int, tid TransactionID) (func() (
     iters[local_idx] = pages[local_idx].tupleIter()
   }
 
-  fmt.Sprintf("use fmt")
   return func() (*Tuple, error) {
     tuples := make([](*Tuple), numColumns)
     for local_idx, _ := range columns {
@@ -259,11 +281,15 @@ func (f *ColumnFile) IteratorColumns(columns []int, tid TransactionID) (func() (
       }
     }
 
-    var ret *Tuple = nil
-    for _, tup := range tuples {
-      ret = joinTuples(ret, tup)
+    // the tuples of the pages have the descriptors of the files that read
+    // them, so use that of this file, which has the table alias of the
+    // current query
+    fields := make([]DBValue, numColumns)
+    for local_idx, tup := range tuples {
+      fields[local_idx] = tup.Fields[0]
     }
-    return ret, nil
+    slot := tuples[0].Rid.(RecordID).slotNo
+    return &Tuple{*desc, fields, RecordID{pageNo : pageInColumn * f.numColumns, slotNo : slot}}, nil
   }, nil
 }
 
@@ -1,7 +1,6 @@
 package godb
 
 import (
-  "unsafe"
   "errors"
   "fmt"
   "bytes"
@@ -17,12 +16,20 @@ type columnPage struct {
 
   // header
   numSlots int32
-  numUsedSlots int32
+  numUsedSlots int32 // written as an int16
+  encoding columnEncoding // the encoding of the values when last read or written
   // in total, header is 8 bytes
 
-  tuples [](*Tuple)
+  tuples [](*Tuple) // grows as values are inserted, up to numSlots
+  sizes *columnSizes // the sizes of the values in each encoding, or nil if
+                     // they must be recomputed after a delete
 }
 
+// Pages hold as many values as fit in PageSize bytes in the encoding that
+// takes the fewest bytes, up to the most whose number fits in the header
+const maxColumnPageSlots = 0x7fff
+const columnPageHeaderSize = 8
+
 func (c *columnPage) getNumSlots() (int) {
   return (int)(c.numSlots)
 }
@@ -47,59 +54,103 @@ func newColumnPage(desc *TupleDesc, columnNo int, pageNo int, f *ColumnFile) *co
   ret.desc = &TupleDesc{Fields : []FieldType{desc.Fields[columnNo]}}
   ret.dirty = false
 
-  var tupleSize int32 = 0
-  field := desc.Fields[columnNo]
-  switch field.Ftype {
-  case IntType:
-    tupleSize = (int32) (unsafe.Sizeof(int64(0)))
-  case StringType:
-    tupleSize = (int32) (unsafe.Sizeof(byte('a'))) *
-                (int32) (StringLength)
-  }
-
-  headerSize := 8
-  var numSlots int32 = (int32) (PageSize - headerSize) / tupleSize
-  ret.numSlots = numSlots
+  ret.numSlots = maxColumnPageSlots
   ret.numUsedSlots = 0
   ret.columnNo = (int32) (columnNo)
   ret.pageNo = (int32) (pageNo)
-
-  tuples := make([](*Tuple), numSlots)
-  for i, _ := range tuples {
-    tuples[i] = nil
-  }
-  ret.tuples = tuples
+  ret.tuples = nil
+  ret.sizes = newColumnSizes(ret.desc.Fields[0])
 
   return ret
 }
 
-func (c *columnPage) insertTuple(t *Tuple) (recordID, error) {
-  if c.numUsedSlots == c.numSlots {
-    return nil, errors.New("page is full")
+// Return the slot that v would be inserted into, or -1 if the page is full
+// or the values would no longer fit in PageSize bytes.  If the sizes of the
+// values had to be recomputed, they are also returned, with v included.
+func (c *columnPage) placeValue(v DBValue) (int, *columnSizes) {
+  capacity := PageSize - columnPageHeaderSize
+
+  // values are appended unless a deleted value has left an empty slot
+  slot := len(c.tuples)
+  if (int)(c.numUsedSlots) < len(c.tuples) {
+    for i, tup := range c.tuples {
+      if tup == nil {
+        slot = i
+        break
+      }
+    }
+  } else if slot == (int)(c.numSlots) {
+    return -1, nil
+  }
+  if slot == len(c.tuples) && c.sizes != nil {
+    if c.sizes.sizeWith(v) > capacity {
+      return -1, nil
+    }
+    return slot, nil
   }
-  tupleToInsert, _ := t.project(c.desc.Fields)
 
+  // the values are encoded in slot order, so recompute their sizes with
+  // the value in its slot
+  sizes := newColumnSizes(c.desc.Fields[0])
   for i, tup := range c.tuples {
-    if tup == nil {
-      c.tuples[i] = tupleToInsert
-      c.numUsedSlots++
-      c.setDirty(true)
-      return i, nil
+    if i == slot {
+      sizes.add(v)
+    } else if tup != nil {
+      sizes.add(tup.Fields[0])
     }
   }
+  if slot == len(c.tuples) {
+    sizes.add(v)
+  }
+  if sizes.size() > capacity {
+    return -1, nil
+  }
+  return slot, sizes
+}
 
-  return nil, errors.New(fmt.Sprintf("should not reach here %d %d",
-                                      c.numUsedSlots, c.numSlots))
+// Return true if the value of t for the column of the page can be inserted
+func (c *columnPage) fits(t *Tuple) bool {
+  tup, err := t.project(c.desc.Fields)
+  if err != nil {
+    return false
+  }
+  slot, _ := c.placeValue(tup.Fields[0])
+  return slot >= 0
+}
+
+func (c *columnPage) insertTuple(t *Tuple) (recordID, error) {
+  tupleToInsert, err := t.project(c.desc.Fields)
+  if err != nil {
+    return nil, err
+  }
+  slot, sizes := c.placeValue(tupleToInsert.Fields[0])
+  if slot < 0 {
+    return nil, errors.New("page is full")
+  }
+  if sizes != nil {
+    c.sizes = sizes
+  } else {
+    c.sizes.add(tupleToInsert.Fields[0])
+  }
+  if slot == len(c.tuples) {
+    c.tuples = append(c.tuples, tupleToInsert)
+  } else {
+    c.tuples[slot] = tupleToInsert
+  }
+  c.numUsedSlots++
+  c.setDirty(true)
+  return slot, nil
 }
 
 func (c *columnPage) deleteTuple(rid recordID) error {
   switch rid := rid.(type) {
   case int:
-    if c.tuples[rid] == nil {
+    if rid < 0 || rid >= len(c.tuples) || c.tuples[rid] == nil {
       return errors.New("tuple to delete does not exist in page")
     }
     c.tuples[rid] = nil
     c.numUsedSlots--
+    c.sizes = nil
     c.setDirty(true)
     return nil
   default:
@@ -110,13 +161,14 @@ func (c *columnPage) deleteTuple(rid recordID) error {
 func (c *columnPage) tupleIter() func() (*Tuple, error) {
   rid := 0
   return func() (*Tuple, error) {
-    for rid < (int)(c.numSlots) && c.tuples[rid] == nil {
+    for rid < len(c.tuples) && c.tuples[rid] == nil {
       rid++
     }
-    if rid == (int)(c.numSlots) {
+    if rid == len(c.tuples) {
       return nil, nil
     } else {
       ret := c.tuples[rid]
+      ret.Rid = RecordID{pageNo : (int)(c.pageNo), slotNo : rid}
       rid++
       return ret, nil
     }
@@ -129,19 +181,35 @@ func (c *columnPage) toBuffer() (*bytes.Buffer, error) {
   if err != nil {
     return nil, err
   }
-  err = binary.Write(buf, binary.LittleEndian, c.numUsedSlots)
-  if err != nil {
-    return nil, err
-  }
 
+  // the encoding of the values is chosen now, so they are written after
+  // the header that records it
+  var values []DBValue
   for _, t := range c.tuples {
     if t == nil {
       continue
     }
-    err = t.writeTo(buf)
-    if err != nil {
-      return nil, err
-    }
+    values = append(values, t.Fields[0])
+  }
+  valueBuf := new(bytes.Buffer)
+  c.encoding, err = encodeColumnValues(valueBuf, c.desc.Fields[0], values)
+  if err != nil {
+    return nil, err
+  }
+  err = binary.Write(buf, binary.LittleEndian, (int16)(c.numUsedSlots))
+  if err != nil {
+    return nil, err
+  }
+  err = binary.Write(buf, binary.LittleEndian, c.encoding)
+  if err != nil {
+    return nil, err
+  }
+  _, err = buf.Write(valueBuf.Bytes())
+  if err != nil {
+    return nil, err
+  }
+  if buf.Len() > PageSize {
+    return nil, GoDBError{PageFullError, fmt.Sprintf("column page of %d bytes does not fit in a page", buf.Len())}
   }
   return buf, nil
 }
@@ -151,21 +219,24 @@ func (c *columnPage) initFromBuffer(buf *bytes.Buffer) error {
   if err != nil {
     return nil
   }
-  var numUsedSlots int32
+  var numUsedSlots int16
   err = binary.Read(buf, binary.LittleEndian, &numUsedSlots)
   if err != nil {
     return nil
   }
-  c.tuples = make([](*Tuple), c.numSlots)
-  for i, _ := range c.tuples {
-    c.tuples[i] = nil
+  err = binary.Read(buf, binary.LittleEndian, &c.encoding)
+  if err != nil {
+    return nil
   }
-  for i := 0; i < (int)(numUsedSlots); i++ {
-    tup, err := readTupleFrom(buf, c.desc)
-    if err != nil {
-      return nil
-    }
-    c.insertTuple(tup)
+  c.tuples = nil
+  c.sizes = newColumnSizes(c.desc.Fields[0])
+  c.numUsedSlots = 0
+  values, err := decodeColumn(buf, c.encoding, c.desc.Fields[0], (int)(numUsedSlots))
+  if err != nil {
+    return err
+  }
+  for _, v := range values {
+    c.insertTuple(&Tuple{*c.desc, []DBValue{v}, nil})
   }
   return nil
 }
@@ -11,13 +11,11 @@ func TestInsertDeleteColumnPage(t *testing.T) {
   pgName := newColumnPage(&td, 0, 0, cf)
   pgAge := newColumnPage(&td, 1, 0, cf)
 
-  var expectedNameSlots = ((4096 - 8) / (StringLength))
-  var expectedAgeSlots = ((4096 - 8) / 8)
-
-  if pgName.getNumSlots() != expectedNameSlots {
+  // pages hold as many values as fit once encoded, up to a fixed number
+  if pgName.getNumSlots() != maxColumnPageSlots {
     t.Fatalf("incorrect number of slots")
   }
-  if pgAge.getNumSlots() != expectedAgeSlots {
+  if pgAge.getNumSlots() != maxColumnPageSlots {
     t.Fatalf("incorrect number of slots")
   }
 
@@ -56,13 +54,15 @@ func TestInsertDeleteColumnPage(t *testing.T) {
 func TestColumnPageInsertTuple(t *testing.T) {
   td, t1, _, cf, _, _ := makeTestVars()
   page := newColumnPage(&td, 0, 0, cf)
-  free := page.getNumSlots()
+  // distinct names are written in full, so fill the page at the width of
+  // a string and its null bitmap
+  free := (4096 - 8) / (StringLength + 1)
 
   for i := 0; i < free; i++ {
     var addition = Tuple {
       Desc: td,
       Fields: []DBValue{
-        StringField{"sam"},
+        StringField{fmt.Sprintf("sam%d", i)},
         IntField{int64(i)},
       },
     }
@@ -136,13 +136,13 @@ func TestColumnPageSerialization(t *testing.T) {
 
 	td, _, _, cf, _, _ := makeTestVars()
 	page := newColumnPage(&td, 0, 0, cf)
-	free := page.getNumSlots()
+	free := (4096 - 8) / StringLength
 
 	for i := 0; i < free-1; i++ {
 		var addition = Tuple{
 			Desc: td,
 			Fields: []DBValue{
-				StringField{"sam"},
+				StringField{fmt.Sprintf("sam%d", i)},
 				IntField{int64(i)},
 			},
 		}
@@ -0,0 +1,116 @@
+package godb
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// ColumnScan returns some of the columns of the tuples of a ColumnFile,
+// reading only the pages of those columns.  makePhysicalPlan scans the
+// tables that are stored in ColumnFiles with a ColumnScan of the columns that
+// the query refers to, so that a query of a few of the columns of a wide table
+// reads only a few of its files.
+type ColumnScan struct {
+	file    *ColumnFile
+	columns []int      // the indexes of the columns of file to return
+	desc    *TupleDesc // the fields of those columns
+}
+
+// Construct a scan of the columns of file with the given indexes, which must
+// include at least one column
+func NewColumnScan(file *ColumnFile, columns []int) (*ColumnScan, error) {
+	if len(columns) == 0 {
+		return nil, GoDBError{IllegalOperationError, "column scan must read at least one column"}
+	}
+	desc := &TupleDesc{}
+	for _, i := range columns {
+		if i < 0 || i >= len(file.td.Fields) {
+			return nil, GoDBError{IllegalOperationError, fmt.Sprintf("no column %d in column file", i)}
+		}
+		desc.Fields = append(desc.Fields, file.td.Fields[i])
+	}
+	return &ColumnScan{file, columns, desc}, nil
+}
+
+// Return the descriptor of the scan, which contains the fields of its
+// columns, in the order they were given
+func (s *ColumnScan) Descriptor() *TupleDesc {
+	return s.desc
+}
+
+func (s *ColumnScan) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	return s.file.IteratorColumns(s.columns, tid)
+}
+
+// Return the columns that a SELECT statement refers to, including in its
+// subqueries, as a set containing the name of each unqualified column
+// reference, table.name for each qualified one, and * and table.* for the
+// stars of select lists.  COUNT(*) refers to no columns.
+func columnReferences(s *sqlparser.Select) map[string]bool {
+	refs := make(map[string]bool)
+	var visit sqlparser.Visit
+	visit = func(node sqlparser.SQLNode) (bool, error) {
+		switch node := node.(type) {
+		case *sqlparser.ColName:
+			name := strings.ToLower(node.Name.String())
+			if table := strings.ToLower(node.Qualifier.Name.String()); table != "" {
+				name = table + "." + name
+			}
+			refs[name] = true
+		case *sqlparser.StarExpr:
+			name := "*"
+			if table := strings.ToLower(node.TableName.Name.String()); table != "" {
+				name = table + ".*"
+			}
+			refs[name] = true
+		case *sqlparser.FuncExpr:
+			for _, arg := range node.Exprs {
+				if _, ok := arg.(*sqlparser.StarExpr); !ok {
+					sqlparser.Walk(visit, arg)
+				}
+			}
+			return false, nil
+		}
+		return true, nil
+	}
+	sqlparser.Walk(visit, s)
+	return refs
+}
+
+// Return the indexes of the columns of the table t, whose fields are desc,
+// that the statement of the plan refers to, or nil if it may refer to all of
+// them.  At least one column is returned, so that a scan of the columns
+// returns a tuple for each tuple of the table.
+func (p *LogicalPlan) scanColumns(t *LogicalTableNode, desc *TupleDesc) []int {
+	if p.columnRefs == nil || p.columnRefs["*"] {
+		return nil
+	}
+	names := []string{t.tableName}
+	if t.alias != "" {
+		names = append(names, t.alias)
+	}
+	for _, name := range names {
+		if p.columnRefs[name+".*"] {
+			return nil
+		}
+	}
+	var columns []int
+	for i, f := range desc.Fields {
+		referenced := p.columnRefs[f.Fname]
+		for _, name := range names {
+			referenced = referenced || p.columnRefs[name+"."+f.Fname]
+		}
+		if referenced {
+			columns = append(columns, i)
+		}
+	}
+	if len(columns) == len(desc.Fields) {
+		return nil
+	}
+	if len(columns) == 0 {
+		columns = []int{0}
+	}
+	return columns
+}
@@ -0,0 +1,114 @@
+package godb
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// Return the names of the columns read by the scans of the table in the plan
+// of sql
+func scannedColumns(t *testing.T, c *Catalog, sql string) string {
+	t.Helper()
+	_, op, err := Parse(c, sql)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var scanned []string
+	var visit func(op Operator)
+	visit = func(op Operator) {
+		switch op := op.(type) {
+		case *ColumnScan:
+			for _, f := range op.Descriptor().Fields {
+				scanned = append(scanned, f.Fname)
+			}
+		case *ColumnFile:
+			scanned = append(scanned, "all")
+		}
+		for _, child := range planChildren(op) {
+			visit(*child)
+		}
+	}
+	visit(op)
+	return strings.Join(scanned, ",")
+}
+
+func TestColumnScan(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "wide (a int, b string, c int, d string) with (storage = column)\n")
+	// a is i, b is 'b' + i or NULL for every 7th tuple, c is i%10 and d is
+	// 'd' + i%3
+	var rows []string
+	for i := 0; i < 1000; i++ {
+		b := fmt.Sprintf("'b%d'", i)
+		if i%7 == 0 {
+			b = "null"
+		}
+		rows = append(rows, fmt.Sprintf("(%d, %s, %d, 'd%d')", i, b, i%10, i%3))
+	}
+	mustRunSQL(t, c, bp, "insert into wide values "+strings.Join(rows, ", "))
+	file, _ := c.GetTable("wide")
+	if _, ok := file.(*ColumnFile); !ok {
+		t.Fatalf("expected a column file, got %T", file)
+	}
+	// the file is read again with each statement
+	expectRows(t, c, bp, "select count(*), sum(a), max(d) from wide", "1000,499500,d2")
+	expectRows(t, c, bp, "select count(*) from wide where b is null", "143")
+	expectRows(t, c, bp, "select a, b, d from wide where c = 3 and a > 950 order by a", "953,b953,d2", "963,b963,d0", "973,null,d1", "983,b983,d2", "993,b993,d0")
+	expectRows(t, c, bp, "select w.d, count(*) from wide w group by w.d order by w.d", "d0,334", "d1,333", "d2,333")
+
+	for _, test := range []struct{ sql, columns string }{
+		{"select a from wide", "a"},
+		{"select d, a from wide where c > 5 and b is not null order by a", "all"},
+		{"select count(*) from wide", "a"},
+		{"select sum(c) from wide group by d", "c,d"},
+		{"select w.b from wide w where w.a in (select c from wide)", "a,b,c,c"},
+		{"select * from wide", "all"},
+		{"select w.* from wide w", "all"},
+		{"select rank() over (partition by c order by d) from wide", "c,d"},
+	} {
+		if columns := scannedColumns(t, c, test.sql); columns != test.columns {
+			t.Errorf("expected %s to scan %s, got %s", test.sql, test.columns, columns)
+		}
+	}
+
+	// a scan of one column reads a quarter of the pages of a scan of all
+	// of them
+	pages := regexp.MustCompile(`pages=(\d+)\)$`)
+	var counts []int
+	for _, sql := range []string{"explain analyze select a from wide", "explain analyze select * from wide"} {
+		lines := explainLines(t, c, bp, sql)
+		var n int
+		fmt.Sscan(pages.FindStringSubmatch(lines[len(lines)-1])[1], &n)
+		counts = append(counts, n)
+	}
+	if counts[0] == 0 || counts[0]*4 != counts[1] {
+		t.Errorf("expected a quarter of the pages to be read, got %v", counts)
+	}
+}
+
+func TestColumnScanUpdates(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "wide (a int, b string, c int, d string) with (storage = column)\n")
+	var rows []string
+	for i := 0; i < 300; i++ {
+		b := fmt.Sprintf("'b%d'", i)
+		if i%7 == 0 {
+			b = "null"
+		}
+		rows = append(rows, fmt.Sprintf("(%d, %s, %d, 'd%d')", i, b, i%10, i%3))
+	}
+	mustRunSQL(t, c, bp, "insert into wide values "+strings.Join(rows, ", "))
+	mustRunSQL(t, c, bp, "delete from wide where c < 5")
+	mustRunSQL(t, c, bp, "update wide set b = 'x' where a > 290")
+	mustRunSQL(t, c, bp, "insert into wide values (1000, 'new', 0, 'd0')")
+	expectRows(t, c, bp, "select count(*) from wide", "151")
+	expectRows(t, c, bp, "select count(*) from wide where b is null", "21")
+	expectRows(t, c, bp, "select a, b from wide where a > 290 order by a", "295,x", "296,x", "297,x", "298,x", "299,x", "1000,new")
+	expectRows(t, c, bp, "select a from wide where b = 'x' and c = 9", "299")
+
+	// scans of column files can be joined with those of heap files, whose
+	// pages are in the same buffer pool
+	mustRunSQL(t, c, bp, "create table ages (age int, label string)")
+	mustRunSQL(t, c, bp, "insert into ages values (5, 'five'), (6, 'six'), (7, 'seven')")
+	expectRows(t, c, bp, "select w.a, l.label from wide w, ages l where w.c = l.age and w.a < 20 order by w.a", "5,five", "6,six", "7,seven", "15,five", "16,six", "17,seven")
+}
@@ -0,0 +1,368 @@
+package godb
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// ConstraintType is the kind of an integrity constraint on a table
+type ConstraintType int
+
+const (
+	NotNullConstraint    ConstraintType = iota
+	PrimaryKeyConstraint ConstraintType = iota
+	UniqueConstraint     ConstraintType = iota
+	ForeignKeyConstraint ConstraintType = iota
+	CheckConstraint      ConstraintType = iota
+)
+
+var constraintNames map[ConstraintType]string = map[ConstraintType]string{
+	NotNullConstraint:    "not null",
+	PrimaryKeyConstraint: "primary key",
+	UniqueConstraint:     "unique",
+	ForeignKeyConstraint: "foreign key",
+	CheckConstraint:      "check",
+}
+
+// ReferentialAction is what happens to the tuples that refer to a tuple via a
+// foreign key when the referenced tuple is deleted
+type ReferentialAction int
+
+const (
+	RestrictAction ReferentialAction = iota // the delete fails
+	CascadeAction  ReferentialAction = iota // the referring tuples are deleted too
+	SetNullAction  ReferentialAction = iota // the referring columns are set to NULL
+)
+
+var referentialActionNames map[ReferentialAction]string = map[ReferentialAction]string{
+	RestrictAction: "restrict",
+	CascadeAction:  "cascade",
+	SetNullAction:  "set null",
+}
+
+// Constraint is an integrity constraint declared on a table, e.g., a PRIMARY
+// KEY on one or more of its columns.  Constraints are stored in the catalog
+// and enforced by the operators that modify tables (see [InsertOp] and
+// [UpdateOp]).
+type Constraint struct {
+	name    string // may be empty if the constraint was not named
+	ctype   ConstraintType
+	columns []string
+
+	// for foreign keys, the referenced table and columns, which must be its
+	// primary key or have a unique constraint, and the action on delete
+	refTable   string
+	refColumns []string
+	onDelete   ReferentialAction
+
+	// for check constraints, the text of the boolean expression to check; the
+	// columns of the constraint are those the expression refers to
+	check string
+}
+
+func (con *Constraint) String() string {
+	str := constraintNames[con.ctype] + " (" + strings.Join(con.columns, ", ") + ")"
+	if con.ctype == CheckConstraint {
+		str = "check (" + con.check + ")"
+	}
+	if con.ctype == ForeignKeyConstraint {
+		str = str + " references " + con.refTable + " (" + strings.Join(con.refColumns, ", ") + ")"
+		if con.onDelete != RestrictAction {
+			str = str + " on delete " + referentialActionNames[con.onDelete]
+		}
+	}
+	if con.name != "" {
+		str = "constraint " + con.name + " " + str
+	}
+	return str
+}
+
+// Check that the constraints of a table with descriptor desc are well formed:
+// they refer to columns of the table, and there is at most one primary key.
+func validateConstraints(table string, desc *TupleDesc, constraints []*Constraint) error {
+	hasKey := false
+	for _, con := range constraints {
+		if con.ctype == PrimaryKeyConstraint {
+			if hasKey {
+				return GoDBError{ParseError, fmt.Sprintf("multiple primary keys for table %s are not allowed", table)}
+			}
+			hasKey = true
+		}
+		for _, col := range con.columns {
+			if _, err := findFieldInTd(FieldType{col, "", UnknownType}, desc); err != nil {
+				return GoDBError{ParseError, fmt.Sprintf("column %s named in %s constraint does not exist in table %s", col, constraintNames[con.ctype], table)}
+			}
+		}
+	}
+	return nil
+}
+
+// constraintChecker enforces the NOT NULL, PRIMARY KEY and UNIQUE constraints
+// of a table on the tuples that a statement adds to it.  Uniqueness is checked
+// by scanning the table once, when the statement starts, and remembering the
+// keys of its tuples, so a statement can be checked in time proportional to
+// the size of the table plus the number of tuples it adds.
+type constraintChecker struct {
+	c       *Catalog
+	table   string
+	notNull []int    // the field numbers of columns that may not be NULL
+	keys    [][]int  // the field numbers of each primary key or unique constraint
+	keyCons []string // a description of each key constraint, for errors
+	seen    []map[any]bool
+	fks     []*foreignKeyCheck
+	checks  []Expr // the compiled expression of each check constraint
+	chkCons []string
+}
+
+// The state needed to check that the tuples added to a table refer to
+// existing tuples of the table referenced by one of its foreign keys
+type foreignKeyCheck struct {
+	con         *Constraint
+	fieldNos    []int // the referring fields of the table being checked
+	refFieldNos []int // the referenced fields of the referenced table
+	refKeys     map[any]bool
+}
+
+// Return the field numbers of the named columns in desc
+func columnsToFieldNos(columns []string, desc *TupleDesc) ([]int, error) {
+	fieldNos := make([]int, len(columns))
+	for i, col := range columns {
+		fieldNo, err := findFieldInTd(FieldType{col, "", UnknownType}, desc)
+		if err != nil {
+			return nil, err
+		}
+		fieldNos[i] = fieldNo
+	}
+	return fieldNos, nil
+}
+
+// Create a constraintChecker for table t of catalog c, or return nil if t has
+// no constraints to check.
+func newConstraintChecker(c *Catalog, t *Table) (*constraintChecker, error) {
+	if len(t.constraints) == 0 {
+		return nil, nil
+	}
+	cc := &constraintChecker{c: c, table: t.name}
+	for _, con := range t.constraints {
+		fieldNos, err := columnsToFieldNos(con.columns, &t.desc)
+		if err != nil {
+			return nil, err
+		}
+		switch con.ctype {
+		case NotNullConstraint:
+			cc.notNull = append(cc.notNull, fieldNos...)
+		case PrimaryKeyConstraint:
+			// the columns of a primary key are implicitly NOT NULL
+			cc.notNull = append(cc.notNull, fieldNos...)
+			fallthrough
+		case UniqueConstraint:
+			cc.keys = append(cc.keys, fieldNos)
+			cc.keyCons = append(cc.keyCons, con.String())
+		case ForeignKeyConstraint:
+			refTable := c.tableMap[con.refTable]
+			if refTable == nil {
+				return nil, GoDBError{NoSuchTableError, fmt.Sprintf("table '%s' referenced by a foreign key of table '%s' not found", con.refTable, t.name)}
+			}
+			refFieldNos, err := columnsToFieldNos(con.refColumns, &refTable.desc)
+			if err != nil {
+				return nil, err
+			}
+			cc.fks = append(cc.fks, &foreignKeyCheck{con, fieldNos, refFieldNos, nil})
+		case CheckConstraint:
+			check, err := compileCheck(c, con.check, &t.desc)
+			if err != nil {
+				return nil, err
+			}
+			cc.checks = append(cc.checks, check)
+			cc.chkCons = append(cc.chkCons, con.String())
+		}
+	}
+	return cc, nil
+}
+
+// Return the key of t formed by the specified fields, and whether it has one;
+// keys containing NULLs are not considered, since NULL is not equal to
+// anything, including another NULL.
+func keyOfFields(t *Tuple, fieldNos []int) (any, bool) {
+	vals := make([]DBValue, len(fieldNos))
+	for j, fieldNo := range fieldNos {
+		if t.Fields[fieldNo] == nil {
+			return nil, false
+		}
+		vals[j] = t.Fields[fieldNo]
+	}
+	return (&Tuple{Fields: vals}).tupleKey(), true
+}
+
+// Return the values of the specified fields of t, formatted for use in errors
+func formatFields(t *Tuple, fieldNos []int) string {
+	vals := make([]DBValue, len(fieldNos))
+	for j, fieldNo := range fieldNos {
+		vals[j] = t.Fields[fieldNo]
+	}
+	return (&Tuple{Fields: vals}).PrettyPrintString(false)
+}
+
+// Call f on each tuple of file, other than those whose Rids are in skip
+func scanFile(file DBFile, tid TransactionID, skip map[any]bool, f func(t *Tuple) error) error {
+	iter, err := file.Iterator(tid)
+	if err != nil {
+		return err
+	}
+	for {
+		t, err := iter()
+		if err != nil {
+			return err
+		}
+		if t == nil {
+			return nil
+		}
+		if skip[t.Rid] {
+			continue
+		}
+		if err := f(t); err != nil {
+			return err
+		}
+	}
+}
+
+// Prepare to check the tuples added to file by a statement running in
+// transaction tid.  The tuples in excluded (e.g., those that an UPDATE is
+// replacing) are ignored when looking for duplicate or referenced keys.
+func (cc *constraintChecker) start(file DBFile, tid TransactionID, excluded []*Tuple) error {
+	skip := make(map[any]bool)
+	for _, t := range excluded {
+		skip[t.Rid] = true
+	}
+	cc.seen = make([]map[any]bool, len(cc.keys))
+	for i := range cc.seen {
+		cc.seen[i] = make(map[any]bool)
+	}
+	if len(cc.keys) > 0 {
+		err := scanFile(file, tid, skip, func(t *Tuple) error {
+			for i, fieldNos := range cc.keys {
+				if key, ok := keyOfFields(t, fieldNos); ok {
+					cc.seen[i][key] = true
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, fk := range cc.fks {
+		fk.refKeys = make(map[any]bool)
+		refFile := file
+		refSkip := skip
+		if fk.con.refTable != cc.table {
+			var err error
+			refFile, err = cc.c.GetTable(fk.con.refTable)
+			if err != nil {
+				return err
+			}
+			refSkip = nil
+		}
+		err := scanFile(refFile, tid, refSkip, func(t *Tuple) error {
+			if key, ok := keyOfFields(t, fk.refFieldNos); ok {
+				fk.refKeys[key] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check that adding t to the table violates none of its constraints, given
+// the tuples already in the table and those previously passed to check.
+// Returns a ConstraintViolationError if it does.
+func (cc *constraintChecker) check(t *Tuple) error {
+	for _, fieldNo := range cc.notNull {
+		if t.Fields[fieldNo] == nil {
+			return GoDBError{ConstraintViolationError, fmt.Sprintf("null value in column %s violates not null constraint on table %s", t.Desc.Fields[fieldNo].Fname, cc.table)}
+		}
+	}
+	// as in SQL, a check is only violated if it is false, not if it is NULL
+	for i, check := range cc.checks {
+		val, err := check.EvalExpr(t)
+		if err != nil {
+			return err
+		}
+		if val == falseField {
+			return GoDBError{ConstraintViolationError, fmt.Sprintf("tuple (%s) violates %s on table %s", t.PrettyPrintString(false), cc.chkCons[i], cc.table)}
+		}
+	}
+	for i, fieldNos := range cc.keys {
+		key, ok := keyOfFields(t, fieldNos)
+		if !ok {
+			continue
+		}
+		if cc.seen[i][key] {
+			return GoDBError{ConstraintViolationError, fmt.Sprintf("duplicate key (%s) violates %s on table %s", formatFields(t, fieldNos), cc.keyCons[i], cc.table)}
+		}
+		cc.seen[i][key] = true
+	}
+	for _, fk := range cc.fks {
+		// a tuple of a self-referencing table may refer to itself
+		if fk.con.refTable == cc.table {
+			if key, ok := keyOfFields(t, fk.refFieldNos); ok {
+				fk.refKeys[key] = true
+			}
+		}
+		// as in most databases, a reference containing a NULL is not checked
+		key, ok := keyOfFields(t, fk.fieldNos)
+		if ok && !fk.refKeys[key] {
+			return GoDBError{ConstraintViolationError, fmt.Sprintf("key (%s) violates %s on table %s: not present in table %s", formatFields(t, fk.fieldNos), fk.con.String(), cc.table, fk.con.refTable)}
+		}
+	}
+	return nil
+}
+
+// Compile the expression of a check constraint on a table with descriptor
+// desc into a predicate
+func compileCheck(c *Catalog, check string, desc *TupleDesc) (Expr, error) {
+	stmt, err := sqlparser.Parse("select * from dual where " + check)
+	if err != nil {
+		return nil, GoDBError{ParseError, fmt.Sprintf("malformed check expression %s: %s", check, err.Error())}
+	}
+	sel, ok := stmt.(*sqlparser.Select)
+	if !ok || sel.Where == nil {
+		return nil, GoDBError{ParseError, fmt.Sprintf("malformed check expression %s", check)}
+	}
+	tableMap := map[string]*PlanNode{"": {nil, desc}}
+	return parsePredicate(c, sel.Where.Expr, desc, tableMap)
+}
+
+// Compile the DEFAULT value of a column of type colType, which must be an
+// expression that does not refer to any columns
+func compileDefault(c *Catalog, value string, colType DBType) (Expr, error) {
+	stmt, err := sqlparser.Parse("select " + value + " from dual")
+	if err != nil {
+		return nil, GoDBError{ParseError, fmt.Sprintf("malformed default value %s: %s", value, err.Error())}
+	}
+	sel, ok := stmt.(*sqlparser.Select)
+	if !ok || len(sel.SelectExprs) != 1 {
+		return nil, GoDBError{ParseError, fmt.Sprintf("malformed default value %s", value)}
+	}
+	aliased, ok := sel.SelectExprs[0].(*sqlparser.AliasedExpr)
+	if !ok {
+		return nil, GoDBError{ParseError, fmt.Sprintf("malformed default value %s", value)}
+	}
+	node, err := parseExpr(c, aliased.Expr, "")
+	if err != nil {
+		return nil, err
+	}
+	expr, _, err := node.generateExpr(c, nil, nil)
+	if err != nil {
+		return nil, GoDBError{ParseError, fmt.Sprintf("default value %s must not refer to columns", value)}
+	}
+	if t := expr.GetExprType().Ftype; t != colType && t != UnknownType {
+		return nil, GoDBError{TypeMismatchError, fmt.Sprintf("default value %s is not of type %s", value, typeNames[colType])}
+	}
+	return expr, nil
+}
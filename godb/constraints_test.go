@@ -0,0 +1,204 @@
+package godb
+
+import (
+	"math"
+	"testing"
+)
+
+func expectConstraintViolation(t *testing.T, c *Catalog, bp *BufferPool, sql string) {
+	t.Helper()
+	_, err := runSQL(c, bp, sql)
+	if err == nil {
+		t.Fatalf("expected constraint violation for %s", sql)
+	}
+	if gErr, ok := err.(GoDBError); !ok || gErr.code != ConstraintViolationError {
+		t.Fatalf("expected constraint violation for %s, got %s", sql, err.Error())
+	}
+}
+
+func TestPrimaryKeyConstraint(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "")
+	mustRunSQL(t, c, bp, "create table emp (id int primary key, name varchar(20) not null, email string unique, dept int)")
+	mustRunSQL(t, c, bp, "insert into emp values (1, 'sam', 'sam@mit.edu', 10), (2, 'mary', 'mary@mit.edu', 20), (3, 'joe', null, null)")
+	expectConstraintViolation(t, c, bp, "insert into emp values (1, 'ann', 'ann@mit.edu', 10)")
+	// duplicates within a single statement are also rejected
+	expectConstraintViolation(t, c, bp, "insert into emp values (4, 'ann', 'ann@mit.edu', 10), (4, 'bob', 'bob@mit.edu', 10)")
+	expectConstraintViolation(t, c, bp, "insert into emp values (null, 'ann', 'ann@mit.edu', 10)")
+	expectConstraintViolation(t, c, bp, "update emp set id = 2 where id = 1")
+
+	res := mustRunSQL(t, c, bp, "select count(*) from emp")
+	if res[0].Fields[0].(IntField).Value != 3 {
+		t.Fatalf("failed statements changed the table, count is %v", res[0].Fields[0])
+	}
+
+	// keys are checked once the whole statement has been applied
+	mustRunSQL(t, c, bp, "update emp set id = id + 1")
+	res = mustRunSQL(t, c, bp, "select sum(id) from emp")
+	if res[0].Fields[0].(IntField).Value != 2+3+4 {
+		t.Errorf("unexpected sum of keys after update %v", res[0].Fields[0])
+	}
+	mustRunSQL(t, c, bp, "insert into emp values (1, 'ann', 'ann@mit.edu', 10)")
+}
+
+func TestUniqueConstraint(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "")
+	mustRunSQL(t, c, bp, "create table emp (id int primary key, name varchar(20) not null, email string unique, dept int)")
+	mustRunSQL(t, c, bp, "insert into emp values (1, 'sam', 'sam@mit.edu', 10), (2, 'mary', 'mary@mit.edu', 20), (3, 'joe', null, null)")
+	expectConstraintViolation(t, c, bp, "insert into emp values (4, 'ann', 'sam@mit.edu', 10)")
+	expectConstraintViolation(t, c, bp, "update emp set email = 'sam@mit.edu' where id = 2")
+	// unique columns may contain any number of NULLs
+	mustRunSQL(t, c, bp, "insert into emp values (4, 'ann', null, 10), (5, 'bob', null, 10)")
+	// updating a tuple without changing its key is allowed
+	mustRunSQL(t, c, bp, "update emp set dept = 30 where id = 1")
+}
+
+func TestNotNullConstraint(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "")
+	mustRunSQL(t, c, bp, "create table emp (id int primary key, name varchar(20) not null, email string unique, dept int)")
+	mustRunSQL(t, c, bp, "insert into emp values (1, 'sam', 'sam@mit.edu', 10), (2, 'mary', 'mary@mit.edu', 20), (3, 'joe', null, null)")
+	expectConstraintViolation(t, c, bp, "insert into emp values (4, null, 'ann@mit.edu', 10)")
+	expectConstraintViolation(t, c, bp, "update emp set name = null")
+
+	mustRunSQL(t, c, bp, "update emp set dept = null where id = 1")
+	res := mustRunSQL(t, c, bp, "select name, dept from emp where id = 1")
+	if len(res) != 1 || res[0].Fields[1] != nil {
+		t.Fatalf("expected a null dept, got %v", res)
+	}
+	if res[0].PrettyPrintString(false) != "sam,null" {
+		t.Errorf("unexpected printed tuple %s", res[0].PrettyPrintString(false))
+	}
+}
+
+func TestConstraintsInCatalog(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "")
+	mustRunSQL(t, c, bp, "create table t (a int not null, b string, c int, constraint t_pk primary key (a, b), unique key (c))")
+	catString := "t (a int not null, b string, c int, constraint t_pk primary key (a, b), unique (c))\n"
+	if c.CatalogString() != catString {
+		t.Fatalf("unexpected catalog %q", c.CatalogString())
+	}
+
+	// the catalog file format is the same, so constraints survive a restart
+	err := c.SaveToFile("catalog.txt", c.rootPath)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	c2, err := NewCatalogFromFile("catalog.txt", bp, c.rootPath)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if c2.CatalogString() != catString {
+		t.Fatalf("unexpected catalog after reload %q", c2.CatalogString())
+	}
+	mustRunSQL(t, c2, bp, "insert into t values (1, 'x', 1), (1, 'y', 2)")
+	expectConstraintViolation(t, c2, bp, "insert into t values (1, 'x', 3)")
+
+	// constraints follow renamed columns, and are dropped with their columns
+	mustRunSQL(t, c2, bp, "alter table t rename column c to d, drop column b")
+	if c2.CatalogString() != "t (a int not null, d int, unique (d))\n" {
+		t.Errorf("unexpected catalog after alter %q", c2.CatalogString())
+	}
+}
+
+func TestCreateTableErrors(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "t (a int)\n")
+	for _, sql := range []string{
+		"create table t (a int)",
+		"create table u (a int primary key, b int primary key)",
+		"create table u (a int, primary key (b))",
+		"create table u (a int, a string)",
+		"create table u (a float)",
+		"create table u (a int not)",
+		"create table u ()",
+	} {
+		if _, err := runSQL(c, bp, sql); err == nil {
+			t.Errorf("expected error for %s", sql)
+		}
+	}
+	if c.NumTables() != 1 {
+		t.Errorf("failed statements created tables")
+	}
+	mustRunSQL(t, c, bp, "create table if not exists t (b int)")
+}
+
+func TestNullsOnDisk(t *testing.T) {
+	td := TupleDesc{Fields: []FieldType{
+		{Fname: "a", Ftype: IntType},
+		{Fname: "b", Ftype: StringType},
+	}}
+	bp := NewBufferPool(10)
+	fileName := t.TempDir() + "/nulls.dat"
+	hf, err := NewHeapFile(fileName, &td, bp)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// values that were once used to represent NULL must survive a round trip
+	tups := [][]DBValue{
+		{IntField{math.MinInt64}, StringField{"\xff"}},
+		{nil, StringField{"x"}},
+		{IntField{1}, nil},
+	}
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	for _, fields := range tups {
+		if err := hf.insertTuple(&Tuple{td, fields, nil}, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	bp.CommitTransaction(tid)
+
+	hf, err = NewHeapFile(fileName, &td, NewBufferPool(10))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid = NewTID()
+	hf.bufPool.BeginTransaction(tid)
+	res, err := runOp(hf, tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(res) != len(tups) {
+		t.Fatalf("expected %d tuples, got %d", len(tups), len(res))
+	}
+	for i, fields := range tups {
+		for j, f := range fields {
+			if res[i].Fields[j] != f {
+				t.Errorf("tuple %d field %d: expected %v, got %v", i, j, f, res[i].Fields[j])
+			}
+		}
+	}
+}
+
+func TestCheckConstraint(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "")
+	mustRunSQL(t, c, bp, "create table t (id int check (id > 0), lo int, hi int, name string, constraint lo_hi check (lo <= hi and (name is null or name <> 'bad')))")
+	mustRunSQL(t, c, bp, "insert into t values (1, 1, 2, 'sam')")
+	// a check that evaluates to NULL is satisfied
+	mustRunSQL(t, c, bp, "insert into t values (2, null, 2, null)")
+	expectConstraintViolation(t, c, bp, "insert into t values (0, 1, 2, 'sam')")
+	expectConstraintViolation(t, c, bp, "insert into t values (3, 3, 2, 'sam')")
+	expectConstraintViolation(t, c, bp, "insert into t values (3, 1, 2, 'bad')")
+	expectConstraintViolation(t, c, bp, "update t set lo = hi + 1 where id = 1")
+
+	catString := "t (id int, lo int, hi int, name string, check (id > 0), constraint lo_hi check (lo <= hi and (name is null or name <> 'bad')))\n"
+	if c.CatalogString() != catString {
+		t.Fatalf("unexpected catalog %q", c.CatalogString())
+	}
+	mustRunSQL(t, c, bp, "alter table t rename column lo to low, drop column id")
+	catString = "t (low int, hi int, name string, constraint lo_hi check (low <= hi and (name is null or name <> 'bad')))\n"
+	if c.CatalogString() != catString {
+		t.Fatalf("unexpected catalog after alter %q", c.CatalogString())
+	}
+	expectConstraintViolation(t, c, bp, "insert into t values (3, 2, 'sam')")
+	mustRunSQL(t, c, bp, "insert into t values (-1, 2, 'sam')")
+
+	for _, sql := range []string{
+		"create table u (a int check (b > 0))",
+		"create table u (a int check (a > 'x'))",
+		"create table u (a int check ())",
+		"create table u (a int check (a > 0)",
+	} {
+		if _, err := runSQL(c, bp, sql); err == nil {
+			t.Errorf("expected error for %s", sql)
+		}
+	}
+}
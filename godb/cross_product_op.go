@@ -0,0 +1,87 @@
+package godb
+
+// CrossProduct returns every pair of a tuple of its left child and a tuple of
+// its right child, joined into one tuple.  It is a block nested loops join:
+// the right child is loaded into memory maxBufferSize tuples at a time, and
+// the left child is scanned once per batch, so the right child is only
+// iterated over once.  If the right child fits in a single batch, the pairs
+// are returned in the same order as a nested loops join over the left child
+// would return them.
+type CrossProduct struct {
+	left, right   Operator
+	maxBufferSize int
+}
+
+// Construct a cross product of left and right
+func NewCrossProduct(left Operator, right Operator, maxBufferSize int) (*CrossProduct, error) {
+	if maxBufferSize < 1 {
+		return nil, GoDBError{IllegalOperationError, "cross product buffer size must be positive"}
+	}
+	return &CrossProduct{left, right, maxBufferSize}, nil
+}
+
+// Return a TupleDescriptor for this cross product, which contains the fields
+// of the left child followed by those of the right child
+func (cp *CrossProduct) Descriptor() *TupleDesc {
+	return cp.left.Descriptor().merge(cp.right.Descriptor())
+}
+
+func (cp *CrossProduct) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	rightIter, err := cp.right.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	rightDone := false
+	var batch []*Tuple
+
+	// load the next batch of right tuples, returning false if there are none
+	loadBatch := func() (bool, error) {
+		batch = batch[:0]
+		for len(batch) < cp.maxBufferSize {
+			t, err := rightIter()
+			if err != nil {
+				return false, err
+			}
+			if t == nil {
+				rightDone = true
+				break
+			}
+			batch = append(batch, t)
+		}
+		return len(batch) > 0, nil
+	}
+
+	var leftIter func() (*Tuple, error)
+	var leftTuple *Tuple
+	next := 0 // the index in batch of the next tuple to pair with leftTuple
+	return func() (*Tuple, error) {
+		for {
+			if leftTuple != nil && next < len(batch) {
+				next++
+				return joinTuples(leftTuple, batch[next-1]), nil
+			}
+			if leftIter == nil {
+				if rightDone {
+					return nil, nil
+				}
+				found, err := loadBatch()
+				if err != nil || !found {
+					return nil, err
+				}
+				leftIter, err = cp.left.Iterator(tid)
+				if err != nil {
+					return nil, err
+				}
+			}
+			var err error
+			leftTuple, err = leftIter()
+			if err != nil {
+				return nil, err
+			}
+			if leftTuple == nil {
+				leftIter = nil
+			}
+			next = 0
+		}
+	}, nil
+}
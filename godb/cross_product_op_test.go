@@ -0,0 +1,116 @@
+package godb
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestCrossProduct(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "emp (name string, age int, dept int)\ndept (id int, dname string, budget int)\n")
+	mustRunSQL(t, c, bp, "insert into emp values ('sam', 25, 1), ('mary', 30, 2), ('joe', 40, 1), ('ann', null, 3), ('bob', 50, null)")
+	mustRunSQL(t, c, bp, "insert into dept values (1, 'eng', 100), (2, 'sales', 20), (3, 'hr', 60)")
+	emp, _ := c.GetTable("emp")
+	dept, _ := c.GetTable("dept")
+	var expected []string
+	for _, e := range mustRunSQL(t, c, bp, "select * from emp") {
+		for _, d := range mustRunSQL(t, c, bp, "select * from dept") {
+			expected = append(expected, joinTuples(e, d).PrettyPrintString(false))
+		}
+	}
+
+	// with buffers smaller than, equal to and larger than the right child
+	for _, bufferSize := range []int{1, 2, 3, 100} {
+		op, err := NewCrossProduct(emp, dept, bufferSize)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(op.Descriptor().Fields) != 6 {
+			t.Errorf("expected 6 fields, got %v", op.Descriptor())
+		}
+		tid := NewTID()
+		bp.BeginTransaction(tid)
+		iter, err := op.Iterator(tid)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		var got []string
+		for {
+			tup, err := iter()
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if tup == nil {
+				break
+			}
+			got = append(got, tup.PrettyPrintString(false))
+		}
+		bp.CommitTransaction(tid)
+		// the pairs are in nested loops order if the right child fits in
+		// the buffer
+		want := append([]string{}, expected...)
+		if bufferSize < 3 {
+			sort.Strings(got)
+			sort.Strings(want)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("expected %d tuples with buffer size %d, got %d", len(want), bufferSize, len(got))
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Errorf("expected %s with buffer size %d, got %s", want[i], bufferSize, got[i])
+			}
+		}
+	}
+
+	empty, _ := NewCrossProduct(emp, NewValueOp(nil), 10)
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	iter, _ := empty.Iterator(tid)
+	if tup, err := iter(); tup != nil || err != nil {
+		t.Errorf("expected no tuples from cross product with empty input, got %v, %v", tup, err)
+	}
+	bp.CommitTransaction(tid)
+	if _, err := NewCrossProduct(emp, dept, 0); err == nil {
+		t.Errorf("expected error for buffer size 0")
+	}
+}
+
+func TestCrossProductSQL(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "emp (name string, age int, dept int)\ndept (id int, dname string, budget int)\n")
+	mustRunSQL(t, c, bp, "insert into emp values ('sam', 25, 1), ('mary', 30, 2), ('joe', 40, 1), ('ann', null, 3), ('bob', 50, null)")
+	mustRunSQL(t, c, bp, "insert into dept values (1, 'eng', 100), (2, 'sales', 20), (3, 'hr', 60)")
+	expectRows(t, c, bp, "select count(*) from emp, dept", "15")
+	expectRows(t, c, bp, "select name, dname from emp cross join dept where age > budget order by name, dname",
+		"bob,sales", "joe,sales", "mary,sales", "sam,sales")
+	expectRows(t, c, bp, "select e.name, x.name from emp e join emp x where e.age = 25 order by x.name",
+		"sam,ann", "sam,bob", "sam,joe", "sam,mary", "sam,sam")
+
+	// relations that are not joined are crossed with the results of the
+	// joins
+	expectRows(t, c, bp, `select e.name, d.dname, x.name from emp e, dept d, emp x
+		where e.dept = d.id and x.age = 50 order by e.name`,
+		"ann,hr,bob", "joe,eng,bob", "mary,sales,bob", "sam,eng,bob")
+	expectRows(t, c, bp, `select count(*) from emp e, dept d, emp x, dept y
+		where e.dept = d.id and x.dept = y.id and d.budget < y.budget`, "5")
+	lines := explainLines(t, c, bp, "explain select e.name, x.name from emp e, dept d, emp x where e.dept = d.id")
+	if len(lines) < 2 || lines[1] != "  Cross Product" {
+		t.Errorf("expected cross product below the projection, got %q", lines)
+	}
+}
+
+func TestJoinUsing(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "t (a int, b string)\nu (a int, x string)\n")
+	mustRunSQL(t, c, bp, "insert into t values (1, 'one'), (2, 'two')")
+	mustRunSQL(t, c, bp, "insert into u values (1, 'uno'), (2, 'dos'), (3, 'tres')")
+	expectRows(t, c, bp, "select count(*) from t join u using (a)", "2")
+	expectRows(t, c, bp, "select b, x from t join u using (a) order by b", "one,uno", "two,dos")
+	expectRows(t, c, bp, "select t1.b, t2.b from t t1 join t t2 using (a, b) order by t1.b", "one,one", "two,two")
+	for _, sql := range []string{
+		"select * from t join u using (b)",
+		"select * from t join u using (nosuch)",
+	} {
+		if _, err := runSQL(c, bp, sql); err == nil {
+			t.Errorf("expected error for %s", sql)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package godb
+
+import (
+	"fmt"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// Common table expressions (CTEs) name the results of queries for the
+// duration of a statement:
+//
+//	WITH [RECURSIVE] name [(column, ...)] AS (query) [, ...] select
+//
+// The sql parser does not support WITH, so the clause is parsed here, and
+// each CTE is planned before the query that follows it, which may refer to it
+// in its FROM clause as if it were a table (see [Catalog.withCTE]).  A CTE may
+// also refer to the CTEs before it.  Each reference to a CTE runs its query
+// again.
+//
+// In a recursive CTE, a query of the form "base UNION [ALL] recursive" may
+// also refer to itself in the recursive term, and is computed as a fixpoint
+// by a [RecursiveCTE].
+
+// A CTE, which scans of the CTE read tuples from
+type cteTable struct {
+	op   Operator
+	desc *TupleDesc // the descriptor of op, with the names of the CTE and its columns
+	refs int        // the number of scans of the CTE that have been planned
+}
+
+// Return a CTE named name that reads from op, whose columns are renamed
+// to columns if there are any
+func newCTETable(name string, columns []string, op Operator) (*cteTable, error) {
+	desc := op.Descriptor().copy()
+	if len(columns) > 0 && len(columns) != len(desc.Fields) {
+		return nil, GoDBError{ParseError, fmt.Sprintf("WITH query %s has %d columns but %d column names", name, len(desc.Fields), len(columns))}
+	}
+	for i := range desc.Fields {
+		desc.Fields[i].TableQualifier = name
+		if len(columns) > 0 {
+			desc.Fields[i].Fname = columns[i]
+		}
+	}
+	return &cteTable{op: op, desc: desc}, nil
+}
+
+// Return a new scan of the CTE, to plan a reference to it
+func (cte *cteTable) scan() *cteScan {
+	cte.refs++
+	return &cteScan{cte, cte.desc.copy()}
+}
+
+// A reference to a CTE in a FROM clause.  It is a DBFile so that it can be
+// planned like a table, but tuples may not be inserted into or deleted from
+// it.
+type cteScan struct {
+	cte  *cteTable
+	desc *TupleDesc
+}
+
+func (s *cteScan) Descriptor() *TupleDesc {
+	return s.desc
+}
+
+func (s *cteScan) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	iter, err := s.cte.op.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	return func() (*Tuple, error) {
+		t, err := iter()
+		if err != nil || t == nil {
+			return nil, err
+		}
+		return &Tuple{*s.desc, t.Fields, nil}, nil
+	}, nil
+}
+
+func (s *cteScan) insertTuple(t *Tuple, tid TransactionID) error {
+	return GoDBError{IllegalOperationError, "cannot insert into a WITH query"}
+}
+
+func (s *cteScan) deleteTuple(t *Tuple, tid TransactionID) error {
+	return GoDBError{IllegalOperationError, "cannot delete from a WITH query"}
+}
+
+func (s *cteScan) readPage(pageNo int) (*Page, error) {
+	return nil, GoDBError{IllegalOperationError, "WITH queries have no pages"}
+}
+
+func (s *cteScan) flushPage(page *Page) error {
+	return GoDBError{IllegalOperationError, "WITH queries have no pages"}
+}
+
+func (s *cteScan) pageKey(pgNo int) any {
+	return nil
+}
+
+// Plan a SELECT statement, which may begin with a WITH clause and combine
+// several queries with set operations
+func planQuery(c *Catalog, query string) (Operator, error) {
+	if ts := newTokenStream(query); ts.accept("with") {
+		return planWith(c, query)
+	}
+	query, setOps := rewriteSetOperations(query)
+	stmt, err := sqlparser.Parse(query)
+	if err != nil {
+		return nil, err
+	}
+	sel, ok := stmt.(sqlparser.SelectStatement)
+	if !ok {
+		return nil, GoDBError{ParseError, fmt.Sprintf("expected a SELECT statement, got %s", sqlparser.String(stmt))}
+	}
+	if err := checkSetOperations(sel, setOps); err != nil {
+		return nil, err
+	}
+	return parseSetOperation(c, sel, &setOps)
+}
+
+// Return a view of the catalog in which the CTE name is visible, along with
+// those visible in c
+func (c *Catalog) withCTE(name string, cte *cteTable) *Catalog {
+	ctes := make(map[string]*cteTable)
+	for n, cte := range c.ctes {
+		ctes[n] = cte
+	}
+	ctes[name] = cte
+	return &Catalog{c.catalogState, ctes}
+}
+
+// Plan a SELECT statement that begins with a WITH clause.  Each CTE is
+// planned with a view of the catalog in which those before it are visible,
+// and the query with one in which all of them are, so they are only visible
+// to the statement.
+func planWith(c *Catalog, query string) (Operator, error) {
+	ts := newTokenStream(query)
+	if err := ts.expect("with"); err != nil {
+		return nil, err
+	}
+	recursive := ts.accept("recursive")
+
+	for {
+		name, err := ts.ident()
+		if err != nil {
+			return nil, err
+		}
+		var columns []string
+		if ts.acceptChar('(') {
+			for {
+				col, err := ts.ident()
+				if err != nil {
+					return nil, err
+				}
+				columns = append(columns, col)
+				if !ts.acceptChar(',') {
+					break
+				}
+			}
+			if err := ts.expectChar(')'); err != nil {
+				return nil, err
+			}
+		}
+		if err := ts.expect("as"); err != nil {
+			return nil, err
+		}
+		if err := ts.expectChar('('); err != nil {
+			return nil, err
+		}
+		start := ts.prevEnd
+		for depth := 1; ; ts.next() {
+			if ts.typ == 0 {
+				return nil, ts.errorf("expected ')'")
+			}
+			if ts.typ == '(' {
+				depth++
+			} else if ts.typ == ')' {
+				depth--
+				if depth == 0 {
+					break
+				}
+			}
+		}
+		body := query[start : ts.end-1]
+		ts.next()
+
+		var cte *cteTable
+		if recursive {
+			cte, err = planRecursiveCTE(c, name, columns, body)
+		} else {
+			var op Operator
+			if op, err = planQuery(c, body); err == nil {
+				cte, err = newCTETable(name, columns, op)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		c = c.withCTE(name, cte)
+		if !ts.acceptChar(',') {
+			break
+		}
+	}
+	return planQuery(c, query[ts.prevEnd:])
+}
+
+// Plan the CTE name of a WITH RECURSIVE clause.  If its query is a UNION
+// whose right side refers to the CTE, the CTE is computed by a RecursiveCTE
+// that reads the tuples of the previous iteration from a work table;
+// otherwise, it is planned as an ordinary CTE.
+func planRecursiveCTE(c *Catalog, name string, columns []string, body string) (*cteTable, error) {
+	query, setOps := rewriteSetOperations(body)
+	stmt, err := sqlparser.Parse(query)
+	if err != nil {
+		return nil, err
+	}
+	union, ok := stmt.(*sqlparser.Union)
+	if !ok {
+		op, err := planQuery(c, body)
+		if err != nil {
+			return nil, err
+		}
+		return newCTETable(name, columns, op)
+	}
+	if err := checkSetOperations(union, setOps); err != nil {
+		return nil, err
+	}
+
+	base, err := parseSetOperation(c, union.Left, &setOps)
+	if err != nil {
+		return nil, err
+	}
+	op := "union"
+	if len(setOps) > 0 {
+		op, setOps = setOps[0], setOps[1:]
+	}
+	all := union.Type == sqlparser.UnionAllStr
+	baseCTE, err := newCTETable(name, columns, base)
+	if err != nil {
+		return nil, err
+	}
+	work := &workTable{desc: baseCTE.desc}
+	workCTE := &cteTable{op: work, desc: baseCTE.desc}
+	// only the recursive term of a UNION refers to the work table
+	recursiveCatalog := c
+	if op == "union" {
+		recursiveCatalog = c.withCTE(name, workCTE)
+	}
+	right, err := parseSetOperation(recursiveCatalog, union.Right, &setOps)
+	if err != nil {
+		return nil, err
+	}
+
+	var result Operator
+	if workCTE.refs == 0 {
+		setOp, err := NewSetOp(op, all, base, right)
+		if err != nil {
+			return nil, err
+		}
+		result = setOp
+	} else {
+		if len(union.OrderBy) > 0 || union.Limit != nil {
+			return nil, GoDBError{ParseError, fmt.Sprintf("ORDER BY and LIMIT are not supported in recursive WITH query %s", name)}
+		}
+		result, err = NewRecursiveCTE(base, right, work, all)
+		if err != nil {
+			return nil, err
+		}
+	}
+	orderBys, limit, err := parseOrderByLimit(c, union.OrderBy, union.Limit)
+	if err != nil {
+		return nil, err
+	}
+	tableMap := map[string]*PlanNode{"": {result, result.Descriptor()}}
+	if result, err = addOrderByLimit(c, result, orderBys, limit, tableMap); err != nil {
+		return nil, err
+	}
+	return newCTETable(name, columns, result)
+}
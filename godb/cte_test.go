@@ -0,0 +1,118 @@
+package godb
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCTE(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "emp (name string, age int, dept int)\ndept (id int, dname string, budget int)\n")
+	mustRunSQL(t, c, bp, "insert into emp values ('sam', 25, 1), ('mary', 30, 2), ('joe', 40, 1), ('ann', null, 3), ('bob', 50, null)")
+	mustRunSQL(t, c, bp, "insert into dept values (1, 'eng', 100), (2, 'sales', 20), (3, 'hr', 60)")
+	expectNames(t, c, bp, "with old as (select name, dept from emp where age > 28) select name from old where dept = 1", "joe")
+	// a CTE may be referenced several times, and refer to earlier CTEs
+	expectNames(t, c, bp, `with big (id, n) as (select id, dname from dept where budget > 50),
+		staff as (select name, dept from emp, big where dept = big.id)
+		select s1.name from staff s1, staff s2 where s1.dept = s2.dept and s1.name <> s2.name order by s1.name`, "joe", "sam")
+	expectNames(t, c, bp, "with d as (select dname from dept where id = 1 union select dname from dept where id = 3) select dname from d order by dname desc", "hr", "eng")
+	expectNames(t, c, bp, "with e as (select * from emp) select name from e where dept in (select id from dept where budget < 50)", "mary")
+	// a CTE hides a table of the same name
+	expectNames(t, c, bp, "with emp as (select dname as name from dept) select name from emp order by name", "eng", "hr", "sales")
+
+	for _, sql := range []string{
+		"with e (a, b) as (select name from emp) select a from e",
+		"with e as (select name from emp) select name from e2",
+		"with e as (select name from emp select name from e",
+		"with e as (select name from emp) select age from e",
+	} {
+		if _, err := runSQL(c, bp, sql); err == nil {
+			t.Errorf("expected error for %s", sql)
+		}
+	}
+	// CTEs are only visible to their statement
+	if _, err := runSQL(c, bp, "select name from e"); err == nil {
+		t.Errorf("expected error for CTE outside of its statement")
+	}
+
+	// statements are planned with views of the catalog of their own, so
+	// those planned at the same time do not see each other's CTEs
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20 && errs[i] == nil; j++ {
+				_, _, errs[i] = Parse(c, fmt.Sprintf("with e (x%d) as (select name from emp) select x%d from e", i, i))
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("statement %d: %s", i, err.Error())
+		}
+	}
+	if c.ctes != nil {
+		t.Errorf("expected no CTEs in the catalog, got %v", c.ctes)
+	}
+}
+
+func TestRecursiveCTE(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "employees (name string, manager string)\nedges (src int, dst int)\n")
+	mustRunSQL(t, c, bp, `insert into employees values ('ceo', null), ('cto', 'ceo'), ('cfo', 'ceo'),
+		('dev1', 'cto'), ('dev2', 'cto'), ('intern', 'dev1'), ('accountant', 'cfo')`)
+
+	// the hierarchy under the cto
+	expectNames(t, c, bp, `with recursive reports (name, depth) as (
+			select name, 0 from employees where name = 'cto'
+			union all
+			select e.name, r.depth + 1 from employees e, reports r where e.manager = r.name)
+		select name, depth from reports where depth > 0 order by depth, name`, "dev1", "dev2", "intern")
+
+	res := mustRunSQL(t, c, bp, `with recursive chain (name, boss) as (
+			select name, manager from employees where name = 'intern'
+			union
+			select e.name, e.manager from employees e, chain where e.name = chain.boss)
+		select count(*) from chain`)
+	if res[0].Fields[0].(IntField).Value != 4 {
+		t.Errorf("expected 4 managers in chain of intern, got %v", res[0].Fields[0])
+	}
+
+	// reachability in a graph with a cycle, which UNION terminates
+	var edges []string
+	for i := 0; i < 20; i++ {
+		edges = append(edges, fmt.Sprintf("(%d, %d)", i, (i+1)%10))
+	}
+	mustRunSQL(t, c, bp, "insert into edges values "+strings.Join(edges, ", ")+", (3, 15)")
+	res = mustRunSQL(t, c, bp, `with recursive reach (node) as (
+			select src from edges where src = 0
+			union
+			select dst from edges, reach where src = node)
+		select node from reach order by node`)
+	var nodes []string
+	for _, tup := range res {
+		nodes = append(nodes, tup.PrettyPrintString(false))
+	}
+	if strings.Join(nodes, " ") != "0 1 2 3 4 5 6 7 8 9 15" {
+		t.Errorf("unexpected nodes reachable from 0 %v", nodes)
+	}
+
+	// an infinite recursion with UNION ALL stops at the LIMIT of its query
+	res = mustRunSQL(t, c, bp, "with recursive nums (n) as (select 1 from edges where src = 0 union all select n + 1 from nums) select n from nums limit 5")
+	if len(res) != 5 || res[4].Fields[0].(IntField).Value != 5 {
+		t.Errorf("unexpected result of recursive count %v", res)
+	}
+
+	// a recursive CTE that does not refer to itself is not recursive
+	res = mustRunSQL(t, c, bp, "with recursive two (n) as (select src from edges where src = 0 union all select dst from edges where src = 0) select n from two")
+	if len(res) != 2 {
+		t.Errorf("expected 2 tuples, got %v", res)
+	}
+
+	if _, err := runSQL(c, bp, "with recursive r (n) as (select src from edges union select name from r, employees) select n from r"); err == nil {
+		t.Errorf("expected error for recursive term with mismatched types")
+	}
+}
@@ -0,0 +1,904 @@
+package godb
+
+// The sqlparser package only partially parses DDL statements (e.g., it records
+// the table named in an ALTER TABLE statement but not what to do to it, and
+// drops table constraints it does not understand), so those statements are
+// parsed here, directly from the sequence of tokens in the query.
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+type tokenStream struct {
+	sql string
+	tkn *sqlparser.Tokenizer
+	typ int    // the type of the current token; 0 at the end of the input
+	val string // the text of the current token, lower cased if it is a keyword
+
+	end     int // the offset in sql just past the current token
+	prevEnd int // the offset in sql just past the previous token
+}
+
+func newTokenStream(sql string) *tokenStream {
+	// the tokenizer reads one character past the end of each token, so a
+	// trailing space ensures its position is always one past the token
+	ts := &tokenStream{sql: sql, tkn: sqlparser.NewStringTokenizer(sql + " ")}
+	ts.next()
+	return ts
+}
+
+// Advance to the next token in the stream
+func (ts *tokenStream) next() {
+	typ, val := ts.tkn.Scan()
+	ts.typ = typ
+	ts.val = string(val)
+	ts.prevEnd = ts.end
+	ts.end = ts.tkn.Position - 1
+	if typ == 0 {
+		ts.end = len(ts.sql)
+	}
+}
+
+func (ts *tokenStream) atEnd() bool {
+	return ts.typ == 0 || ts.typ == ';'
+}
+
+func (ts *tokenStream) errorf(format string, args ...any) error {
+	near := ts.val
+	if ts.atEnd() {
+		near = "end of statement"
+	}
+	return GoDBError{ParseError, fmt.Sprintf("%s (near '%s')", fmt.Sprintf(format, args...), near)}
+}
+
+// If the current token is the (case insensitive) word kw, consume it and
+// return true; otherwise return false.
+func (ts *tokenStream) accept(kw string) bool {
+	if (ts.typ == sqlparser.ID || ts.typ >= 256) && strings.ToLower(ts.val) == kw {
+		ts.next()
+		return true
+	}
+	return false
+}
+
+func (ts *tokenStream) expect(kw string) error {
+	if !ts.accept(kw) {
+		return ts.errorf("expected %s", strings.ToUpper(kw))
+	}
+	return nil
+}
+
+// If the current token is the single character ch, consume it and return true
+func (ts *tokenStream) acceptChar(ch byte) bool {
+	if ts.typ == int(ch) {
+		ts.next()
+		return true
+	}
+	return false
+}
+
+func (ts *tokenStream) expectChar(ch byte) error {
+	if !ts.acceptChar(ch) {
+		return ts.errorf("expected '%c'", ch)
+	}
+	return nil
+}
+
+// Consume and return an identifier (a table or column name).  Names are
+// lower cased, as they are elsewhere in the parser.
+func (ts *tokenStream) ident() (string, error) {
+	if ts.typ != sqlparser.ID && ts.typ < 256 {
+		return "", ts.errorf("expected a name")
+	}
+	name := strings.ToLower(ts.val)
+	ts.next()
+	return name, nil
+}
+
+// Consume an integer literal, which may be negative
+func (ts *tokenStream) integer() (int64, error) {
+	neg := ts.acceptChar('-')
+	if ts.typ != sqlparser.INTEGRAL {
+		return 0, ts.errorf("expected an integer")
+	}
+	val, err := strconv.ParseInt(ts.val, 10, 64)
+	if err != nil {
+		return 0, ts.errorf("integer out of range")
+	}
+	ts.next()
+	if neg {
+		val = -val
+	}
+	return val, nil
+}
+
+// Consume a column type, e.g., "int" or "varchar(20)"
+func (ts *tokenStream) columnType() (DBType, error) {
+	typeName, err := ts.ident()
+	if err != nil {
+		return UnknownType, err
+	}
+	colType, ok := typeNameToType(typeName)
+	if !ok {
+		return UnknownType, GoDBError{ParseError, fmt.Sprintf("unsupported column type %s", typeName)}
+	}
+	// lengths are accepted but ignored; all strings are StringLength bytes
+	if ts.acceptChar('(') {
+		if ts.typ != sqlparser.INTEGRAL {
+			return UnknownType, ts.errorf("expected a length")
+		}
+		ts.next()
+		if err := ts.expectChar(')'); err != nil {
+			return UnknownType, err
+		}
+	}
+	return colType, nil
+}
+
+// Consume a parenthesized expression, returning the text between the
+// parentheses
+func (ts *tokenStream) parenthesized() (string, error) {
+	if err := ts.expectChar('('); err != nil {
+		return "", err
+	}
+	start := ts.prevEnd
+	for depth := 0; depth > 0 || ts.typ != ')'; ts.next() {
+		switch ts.typ {
+		case 0:
+			return "", ts.errorf("expected ')'")
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+	}
+	text := strings.TrimSpace(ts.sql[start:ts.prevEnd])
+	ts.next()
+	return text, nil
+}
+
+// Consume the value of a DEFAULT clause, returning its text: either a
+// parenthesized expression, or a single (possibly negated) literal, NULL, or
+// function call.
+func (ts *tokenStream) defaultValue() (string, error) {
+	if ts.typ == '(' {
+		return ts.parenthesized()
+	}
+	start := ts.prevEnd
+	ts.acceptChar('-')
+	if ts.atEnd() || ts.typ == ',' || ts.typ == ')' {
+		return "", ts.errorf("expected a default value")
+	}
+	isName := ts.typ == sqlparser.ID
+	ts.next()
+	if isName && ts.typ == '(' {
+		if _, err := ts.parenthesized(); err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimSpace(ts.sql[start:ts.prevEnd]), nil
+}
+
+// Return the columns of desc that are named in the expression text
+func referencedColumns(text string, desc *TupleDesc) []string {
+	var cols []string
+	for ts := newTokenStream(text); ts.typ != 0; ts.next() {
+		if ts.typ != sqlparser.ID {
+			continue
+		}
+		name := strings.ToLower(ts.val)
+		if _, err := findFieldInTd(FieldType{name, "", UnknownType}, desc); err == nil {
+			found := false
+			for _, col := range cols {
+				found = found || col == name
+			}
+			if !found {
+				cols = append(cols, name)
+			}
+		}
+	}
+	return cols
+}
+
+// Return the expression text with references to the column named column
+// replaced by newName
+func renameColumnInExpr(text string, column string, newName string) string {
+	var b strings.Builder
+	last := 0
+	for ts := newTokenStream(text); ts.typ != 0; ts.next() {
+		if ts.typ == sqlparser.ID && strings.ToLower(ts.val) == column && ts.sql[ts.end-len(ts.val):ts.end] == ts.val {
+			b.WriteString(text[last : ts.end-len(ts.val)])
+			b.WriteString(newName)
+			last = ts.end
+		}
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+func typeNameToType(typeName string) (DBType, bool) {
+	switch typeName {
+	case "int", "integer":
+		return IntType, true
+	case "string", "varchar", "text":
+		return StringType, true
+	}
+	return UnknownType, false
+}
+
+// Consume a parenthesized, comma separated list of column names
+func (ts *tokenStream) columnList() ([]string, error) {
+	if err := ts.expectChar('('); err != nil {
+		return nil, err
+	}
+	var cols []string
+	for {
+		col, err := ts.ident()
+		if err != nil {
+			return nil, err
+		}
+		cols = append(cols, col)
+		if !ts.acceptChar(',') {
+			break
+		}
+	}
+	return cols, ts.expectChar(')')
+}
+
+// Consume the REFERENCES clause of a foreign key, filling in con
+//
+//	REFERENCES table [( column [, column ...] )] [ON DELETE action]
+//
+// where action is one of RESTRICT, NO ACTION, CASCADE or SET NULL.  If no
+// columns are given, the key refers to the primary key of the table; this is
+// resolved when the table is created.
+func (ts *tokenStream) references(con *Constraint) error {
+	if err := ts.expect("references"); err != nil {
+		return err
+	}
+	return ts.referencesTarget(con)
+}
+
+// Consume the remainder of a REFERENCES clause, after the REFERENCES keyword
+func (ts *tokenStream) referencesTarget(con *Constraint) error {
+	var err error
+	con.refTable, err = ts.ident()
+	if err != nil {
+		return err
+	}
+	if ts.typ == '(' {
+		con.refColumns, err = ts.columnList()
+		if err != nil {
+			return err
+		}
+	}
+	con.onDelete = RestrictAction
+	if ts.accept("on") {
+		if err := ts.expect("delete"); err != nil {
+			return err
+		}
+		switch {
+		case ts.accept("restrict"):
+		case ts.accept("no"):
+			if err := ts.expect("action"); err != nil {
+				return err
+			}
+		case ts.accept("cascade"):
+			con.onDelete = CascadeAction
+		case ts.accept("set"):
+			if err := ts.expect("null"); err != nil {
+				return err
+			}
+			con.onDelete = SetNullAction
+		default:
+			return ts.errorf("expected RESTRICT, NO ACTION, CASCADE or SET NULL")
+		}
+	}
+	return nil
+}
+
+// Consume a table definition, as it appears in CREATE TABLE statements and in
+// catalog files:
+//
+//	name ( element [, element ...] ) [WITH ( STORAGE = HEAP | COLUMN )]
+//
+// where each element is either a column definition
+//
+//	column type [column_option ...]
+//
+// with column options
+//
+//	NOT NULL | NULL | PRIMARY KEY | UNIQUE [KEY] | DEFAULT value | CHECK ( expr ) | references
+//
+// or a table constraint
+//
+//	[CONSTRAINT name] PRIMARY KEY ( column [, column ...] )
+//	[CONSTRAINT name] UNIQUE [KEY | INDEX] [index_name] ( column [, column ...] )
+//	[CONSTRAINT name] FOREIGN KEY ( column [, column ...] ) references
+//	[CONSTRAINT name] CHECK ( expr )
+//
+// references is as described in [tokenStream.references], and DEFAULT values
+// are as described in [tokenStream.defaultValue].  Expressions are recorded
+// as text, and compiled when they are used.  Tables are stored in a HeapFile
+// unless STORAGE = COLUMN is given, in which case they are stored in a
+// ColumnFile, with a file per column.
+func (ts *tokenStream) tableDefinition() (*Table, error) {
+	tabName, err := ts.ident()
+	if err != nil {
+		return nil, err
+	}
+	if err := ts.expectChar('('); err != nil {
+		return nil, err
+	}
+	desc := &TupleDesc{}
+	var constraints []*Constraint
+	var autoIncrement []string
+	defaults := make(map[string]string)
+	for {
+		conName := ""
+		if ts.accept("constraint") {
+			conName, err = ts.ident()
+			if err != nil {
+				return nil, err
+			}
+		}
+		switch {
+		case ts.accept("primary"):
+			if err := ts.expect("key"); err != nil {
+				return nil, err
+			}
+			cols, err := ts.columnList()
+			if err != nil {
+				return nil, err
+			}
+			constraints = append(constraints, &Constraint{name: conName, ctype: PrimaryKeyConstraint, columns: cols})
+		case ts.accept("unique"):
+			if !ts.accept("key") {
+				ts.accept("index")
+			}
+			if ts.typ != '(' {
+				if _, err := ts.ident(); err != nil {
+					return nil, err
+				}
+			}
+			cols, err := ts.columnList()
+			if err != nil {
+				return nil, err
+			}
+			constraints = append(constraints, &Constraint{name: conName, ctype: UniqueConstraint, columns: cols})
+		case ts.accept("foreign"):
+			if err := ts.expect("key"); err != nil {
+				return nil, err
+			}
+			cols, err := ts.columnList()
+			if err != nil {
+				return nil, err
+			}
+			con := &Constraint{name: conName, ctype: ForeignKeyConstraint, columns: cols}
+			if err := ts.references(con); err != nil {
+				return nil, err
+			}
+			constraints = append(constraints, con)
+		case ts.accept("check"):
+			check, err := ts.parenthesized()
+			if err != nil {
+				return nil, err
+			}
+			constraints = append(constraints, &Constraint{name: conName, ctype: CheckConstraint, check: check})
+		case conName != "":
+			return nil, ts.errorf("expected PRIMARY KEY, UNIQUE, FOREIGN KEY or CHECK")
+		default:
+			colName, err := ts.ident()
+			if err != nil {
+				return nil, err
+			}
+			// SERIAL is shorthand for INT NOT NULL AUTO_INCREMENT
+			serial := ts.accept("serial") || ts.accept("bigserial")
+			colType := IntType
+			if serial {
+				constraints = append(constraints, &Constraint{ctype: NotNullConstraint, columns: []string{colName}})
+				autoIncrement = append(autoIncrement, colName)
+			} else if colType, err = ts.columnType(); err != nil {
+				return nil, err
+			}
+			desc.Fields = append(desc.Fields, FieldType{colName, "", colType})
+			for done := false; !done; {
+				switch {
+				case ts.accept("auto_increment") || ts.accept("autoincrement"):
+					if colType != IntType {
+						return nil, GoDBError{ParseError, fmt.Sprintf("auto increment column %s must be an int", colName)}
+					}
+					if !serial {
+						autoIncrement = append(autoIncrement, colName)
+					}
+				case ts.accept("not"):
+					if err := ts.expect("null"); err != nil {
+						return nil, err
+					}
+					constraints = append(constraints, &Constraint{ctype: NotNullConstraint, columns: []string{colName}})
+				case ts.accept("null"):
+				case ts.accept("primary"):
+					if err := ts.expect("key"); err != nil {
+						return nil, err
+					}
+					constraints = append(constraints, &Constraint{ctype: PrimaryKeyConstraint, columns: []string{colName}})
+				case ts.accept("unique"):
+					ts.accept("key")
+					constraints = append(constraints, &Constraint{ctype: UniqueConstraint, columns: []string{colName}})
+				case ts.accept("default"):
+					defaults[colName], err = ts.defaultValue()
+					if err != nil {
+						return nil, err
+					}
+				case ts.accept("check"):
+					check, err := ts.parenthesized()
+					if err != nil {
+						return nil, err
+					}
+					constraints = append(constraints, &Constraint{ctype: CheckConstraint, check: check})
+				case ts.accept("references"):
+					con := &Constraint{ctype: ForeignKeyConstraint, columns: []string{colName}}
+					if err := ts.referencesTarget(con); err != nil {
+						return nil, err
+					}
+					constraints = append(constraints, con)
+				default:
+					done = true
+				}
+			}
+		}
+		if !ts.acceptChar(',') {
+			break
+		}
+	}
+	if err := ts.expectChar(')'); err != nil {
+		return nil, err
+	}
+	columnar := false
+	if ts.accept("with") {
+		if err := ts.expectChar('('); err != nil {
+			return nil, err
+		}
+		if err := ts.expect("storage"); err != nil {
+			return nil, err
+		}
+		if err := ts.expectChar('='); err != nil {
+			return nil, err
+		}
+		switch {
+		case ts.accept("column"):
+			columnar = true
+		case ts.accept("heap"):
+		default:
+			return nil, ts.errorf("expected HEAP or COLUMN")
+		}
+		if err := ts.expectChar(')'); err != nil {
+			return nil, err
+		}
+	}
+	if len(desc.Fields) == 0 {
+		return nil, GoDBError{ParseError, fmt.Sprintf("table %s has no columns", tabName)}
+	}
+	for i, f := range desc.Fields {
+		for _, f2 := range desc.Fields[:i] {
+			if f.Fname == f2.Fname {
+				return nil, GoDBError{ParseError, fmt.Sprintf("duplicate column %s in table %s", f.Fname, tabName)}
+			}
+		}
+	}
+	for _, con := range constraints {
+		if con.ctype == CheckConstraint {
+			con.columns = referencedColumns(con.check, desc)
+		}
+	}
+	for _, col := range autoIncrement {
+		if _, ok := defaults[col]; ok {
+			return nil, GoDBError{ParseError, fmt.Sprintf("auto increment column %s cannot have a default value", col)}
+		}
+	}
+	if err := validateConstraints(tabName, desc, constraints); err != nil {
+		return nil, err
+	}
+	return &Table{tabName, *desc, constraints, defaults, autoIncrement, nil, columnar}, nil
+}
+
+// Parse and execute a CREATE TABLE statement
+//
+//	CREATE TABLE [IF NOT EXISTS] table_definition
+//
+// where table_definition is as described in [tokenStream.tableDefinition].
+func processCreateTable(c *Catalog, query string) (QueryType, error) {
+	ts := newTokenStream(query)
+	if err := ts.expect("create"); err != nil {
+		return UnknownQueryType, err
+	}
+	if err := ts.expect("table"); err != nil {
+		return UnknownQueryType, err
+	}
+	ifNotExists := false
+	if ts.accept("if") {
+		if err := ts.expect("not"); err != nil {
+			return UnknownQueryType, err
+		}
+		if err := ts.expect("exists"); err != nil {
+			return UnknownQueryType, err
+		}
+		ifNotExists = true
+	}
+	t, err := ts.tableDefinition()
+	if err != nil {
+		return UnknownQueryType, err
+	}
+	if !ts.atEnd() {
+		return UnknownQueryType, ts.errorf("unexpected text after CREATE TABLE")
+	}
+	if existing, _ := c.GetTable(t.name); existing != nil {
+		if ifNotExists {
+			return CreateTableQueryType, nil
+		}
+		return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("table %s already exists", t.name)}
+	}
+	err = c.resolveForeignKeys(t.name, &t.desc, t.constraints)
+	if err != nil {
+		return UnknownQueryType, err
+	}
+	err = c.compileTableExprs(t)
+	if err != nil {
+		return UnknownQueryType, err
+	}
+	err = c.addTable(t)
+	if err != nil {
+		return UnknownQueryType, err
+	}
+	return CreateTableQueryType, nil
+}
+
+// Return true if a line of a catalog file defines a sequence rather than a
+// table (which may itself be named sequence)
+func isSequenceDefinition(line string) bool {
+	ts := newTokenStream(line)
+	return ts.accept("sequence") && ts.typ != '('
+}
+
+// Consume the definition of a sequence, following the SEQUENCE keyword:
+//
+//	name [START [WITH] n] [INCREMENT [BY] n] [NEXT n] [OWNED BY table.column]
+//
+// The sequence starts at 1 and increments by 1 unless otherwise specified;
+// NEXT, which is recorded in the catalog, is the next value it returns.
+func (ts *tokenStream) sequenceDefinition() (*Sequence, error) {
+	name, err := ts.ident()
+	if err != nil {
+		return nil, err
+	}
+	s := &Sequence{name: name, start: 1, increment: 1}
+	hasNext := false
+	for !ts.atEnd() {
+		switch {
+		case ts.accept("start"):
+			ts.accept("with")
+			s.start, err = ts.integer()
+		case ts.accept("increment"):
+			ts.accept("by")
+			s.increment, err = ts.integer()
+		case ts.accept("next"):
+			s.next, err = ts.integer()
+			hasNext = true
+		case ts.accept("owned"):
+			if err := ts.expect("by"); err != nil {
+				return nil, err
+			}
+			if s.ownerTable, err = ts.ident(); err != nil {
+				return nil, err
+			}
+			if err := ts.expectChar('.'); err != nil {
+				return nil, err
+			}
+			s.ownerColumn, err = ts.ident()
+		default:
+			return nil, ts.errorf("expected START, INCREMENT, NEXT or OWNED BY")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if s.increment == 0 {
+		return nil, GoDBError{ParseError, fmt.Sprintf("increment of sequence %s must not be zero", name)}
+	}
+	if !hasNext {
+		s.next = s.start
+	}
+	return s, nil
+}
+
+// Parse and execute a CREATE SEQUENCE statement
+//
+//	CREATE SEQUENCE [IF NOT EXISTS] name [START [WITH] n] [INCREMENT [BY] n]
+func processCreateSequence(c *Catalog, query string) (QueryType, error) {
+	ts := newTokenStream(query)
+	if err := ts.expect("create"); err != nil {
+		return UnknownQueryType, err
+	}
+	if err := ts.expect("sequence"); err != nil {
+		return UnknownQueryType, err
+	}
+	ifNotExists := false
+	if ts.accept("if") {
+		if err := ts.expect("not"); err != nil {
+			return UnknownQueryType, err
+		}
+		if err := ts.expect("exists"); err != nil {
+			return UnknownQueryType, err
+		}
+		ifNotExists = true
+	}
+	s, err := ts.sequenceDefinition()
+	if err != nil {
+		return UnknownQueryType, err
+	}
+	if s.ownerTable != "" {
+		return UnknownQueryType, GoDBError{ParseError, "OWNED BY is not supported in CREATE SEQUENCE"}
+	}
+	if c.sequences[s.name] != nil && ifNotExists {
+		return CreateSequenceQueryType, nil
+	}
+	if err := c.addSequence(s); err != nil {
+		return UnknownQueryType, err
+	}
+	return CreateSequenceQueryType, nil
+}
+
+// Parse and execute a DROP SEQUENCE statement
+//
+//	DROP SEQUENCE [IF EXISTS] name
+func processDropSequence(c *Catalog, query string) (QueryType, error) {
+	ts := newTokenStream(query)
+	if err := ts.expect("drop"); err != nil {
+		return UnknownQueryType, err
+	}
+	if err := ts.expect("sequence"); err != nil {
+		return UnknownQueryType, err
+	}
+	ifExists := false
+	if ts.accept("if") {
+		if err := ts.expect("exists"); err != nil {
+			return UnknownQueryType, err
+		}
+		ifExists = true
+	}
+	name, err := ts.ident()
+	if err != nil {
+		return UnknownQueryType, err
+	}
+	if !ts.atEnd() {
+		return UnknownQueryType, ts.errorf("unexpected text after DROP SEQUENCE")
+	}
+	if c.sequences[name] == nil && ifExists {
+		return DropSequenceQueryType, nil
+	}
+	if err := c.dropSequence(name); err != nil {
+		return UnknownQueryType, err
+	}
+	return DropSequenceQueryType, nil
+}
+
+// Parse and execute an ALTER TABLE statement, which is one of
+//
+//	ALTER TABLE t ADD [COLUMN] name type [DEFAULT value] [[NOT] NULL]
+//	ALTER TABLE t DROP [COLUMN] name
+//	ALTER TABLE t RENAME [COLUMN] name TO new_name
+//	ALTER TABLE t RENAME [TO | AS] new_table_name
+//
+// Several comma separated actions may be supplied; the whole statement is
+// parsed, and every action checked against the schema left by those before
+// it, before any of them are applied, in order.  Like other DDL statements
+// in GoDB, ALTER TABLE is not transactional.
+func processAlterTable(c *Catalog, query string) (QueryType, error) {
+	ts := newTokenStream(query)
+	if err := ts.expect("alter"); err != nil {
+		return UnknownQueryType, err
+	}
+	if err := ts.expect("table"); err != nil {
+		return UnknownQueryType, err
+	}
+	tabName, err := ts.ident()
+	if err != nil {
+		return UnknownQueryType, err
+	}
+	var checks []func(s *alterSchema) error
+	var actions []func(tabName string) (string, error)
+	for {
+		switch {
+		case ts.accept("add"):
+			ts.accept("column")
+			colName, err := ts.ident()
+			if err != nil {
+				return UnknownQueryType, err
+			}
+			colType, err := ts.columnType()
+			if err != nil {
+				return UnknownQueryType, err
+			}
+			// existing rows get the default, evaluated separately for each
+			// row, which is NULL unless one is given
+			var defaultExpr Expr
+			defaultText := ""
+			notNull := false
+			for done := false; !done; {
+				switch {
+				case ts.accept("default"):
+					defaultText, err = ts.defaultValue()
+					if err != nil {
+						return UnknownQueryType, err
+					}
+					defaultExpr, err = compileDefault(c, defaultText, colType)
+					if err != nil {
+						return UnknownQueryType, err
+					}
+				case ts.accept("not"):
+					if err := ts.expect("null"); err != nil {
+						return UnknownQueryType, err
+					}
+					notNull = true
+				case ts.accept("null"):
+				default:
+					done = true
+				}
+			}
+			if notNull && defaultExpr == nil {
+				return UnknownQueryType, GoDBError{IllegalOperationError, fmt.Sprintf("column '%s' is NOT NULL, so must have a DEFAULT for existing rows", colName)}
+			}
+			checks = append(checks, func(s *alterSchema) error {
+				if s.column(colName) >= 0 {
+					return GoDBError{DuplicateTableError, fmt.Sprintf("table '%s' already has a column '%s'", s.table, colName)}
+				}
+				s.columns = append(s.columns, colName)
+				return nil
+			})
+			actions = append(actions, func(tabName string) (string, error) {
+				err := c.addColumn(tabName, FieldType{colName, "", colType}, defaultExpr, notNull)
+				if err == nil && defaultText != "" {
+					c.tableMap[tabName].defaults[colName] = defaultText
+				}
+				return tabName, err
+			})
+		case ts.accept("drop"):
+			ts.accept("column")
+			colName, err := ts.ident()
+			if err != nil {
+				return UnknownQueryType, err
+			}
+			checks = append(checks, func(s *alterSchema) error {
+				i := s.column(colName)
+				if i < 0 {
+					return GoDBError{IllegalOperationError, fmt.Sprintf("table '%s' has no column '%s'", s.table, colName)}
+				}
+				if len(s.columns) == 1 {
+					return GoDBError{IllegalOperationError, fmt.Sprintf("cannot drop '%s', the only column of table '%s'", colName, s.table)}
+				}
+				if referrer, ok := s.referenced[colName]; ok {
+					return GoDBError{IllegalOperationError, fmt.Sprintf("cannot drop '%s', which is referenced by a foreign key of table '%s'", colName, referrer)}
+				}
+				s.columns = append(s.columns[:i:i], s.columns[i+1:]...)
+				return nil
+			})
+			actions = append(actions, func(tabName string) (string, error) {
+				return tabName, c.dropColumn(tabName, colName)
+			})
+		case ts.accept("rename"):
+			// "RENAME [COLUMN] a TO b" renames a column, while
+			// "RENAME [TO | AS] b" renames the table
+			column := ts.accept("column")
+			table := !column && (ts.accept("to") || ts.accept("as"))
+			name, err := ts.ident()
+			if err != nil {
+				return UnknownQueryType, err
+			}
+			if !table && ts.accept("to") {
+				newName, err := ts.ident()
+				if err != nil {
+					return UnknownQueryType, err
+				}
+				checks = append(checks, func(s *alterSchema) error {
+					i := s.column(name)
+					if i < 0 {
+						return GoDBError{IllegalOperationError, fmt.Sprintf("table '%s' has no column '%s'", s.table, name)}
+					}
+					if s.column(newName) >= 0 {
+						return GoDBError{DuplicateTableError, fmt.Sprintf("table '%s' already has a column '%s'", s.table, newName)}
+					}
+					s.columns[i] = newName
+					if referrer, ok := s.referenced[name]; ok {
+						delete(s.referenced, name)
+						s.referenced[newName] = referrer
+					}
+					return nil
+				})
+				actions = append(actions, func(tabName string) (string, error) {
+					return tabName, c.renameColumn(tabName, name, newName)
+				})
+			} else if column {
+				return UnknownQueryType, ts.errorf("expected TO")
+			} else {
+				checks = append(checks, func(s *alterSchema) error {
+					// the table's own name is free once it has been renamed
+					if c.tableMap[name] != nil && (name != s.original || s.table == s.original) {
+						return GoDBError{DuplicateTableError, fmt.Sprintf("a table named '%s' already exists", name)}
+					}
+					s.table = name
+					return nil
+				})
+				actions = append(actions, func(tabName string) (string, error) {
+					return name, c.renameTable(tabName, name)
+				})
+			}
+		default:
+			return UnknownQueryType, ts.errorf("expected ADD, DROP or RENAME")
+		}
+		if !ts.acceptChar(',') {
+			break
+		}
+	}
+	if !ts.atEnd() {
+		return UnknownQueryType, ts.errorf("unexpected text after ALTER TABLE")
+	}
+	schema, err := c.alterSchema(tabName)
+	if err != nil {
+		return UnknownQueryType, err
+	}
+	for _, check := range checks {
+		if err := check(schema); err != nil {
+			return UnknownQueryType, err
+		}
+	}
+	for _, action := range actions {
+		tabName, err = action(tabName)
+		if err != nil {
+			return UnknownQueryType, err
+		}
+	}
+	return AlterTableQueryType, nil
+}
+
+// The name and columns that the actions of an ALTER TABLE statement leave a
+// table with, as they are checked
+type alterSchema struct {
+	original   string // the name of the table before it is altered
+	table      string
+	columns    []string
+	referenced map[string]string // the columns referenced by foreign keys, and a table referring to each
+}
+
+// Return the schema of the named table, before it is altered
+func (c *Catalog) alterSchema(table string) (*alterSchema, error) {
+	t, err := c.getTableForAlter(table)
+	if err != nil {
+		return nil, err
+	}
+	s := &alterSchema{table, table, nil, make(map[string]string)}
+	for _, f := range t.desc.Fields {
+		s.columns = append(s.columns, f.Fname)
+	}
+	for _, ref := range c.referringConstraints(table) {
+		for _, col := range ref.con.refColumns {
+			if _, ok := s.referenced[col]; !ok {
+				s.referenced[col] = ref.table.name
+			}
+		}
+	}
+	return s, nil
+}
+
+// Return the index of the named column, or -1 if there is none
+func (s *alterSchema) column(name string) int {
+	for i, col := range s.columns {
+		if col == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,297 @@
+package godb
+
+import (
+	"fmt"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// A subquery is correlated if its WHERE clause refers to columns of the
+// query that encloses it.  Rather than running such a subquery once for every
+// tuple of the enclosing query, decorrelation rewrites it into a join with
+// the enclosing query that computes the subquery's results for all of the
+// values of the correlated columns at once:
+//
+//   - a correlated [NOT] IN or [NOT] EXISTS subquery also returns the
+//     columns it is correlated on, which become additional keys of its
+//     semi-join (see [SemiJoin]), and
+//   - a correlated scalar subquery that is compared with another expression
+//     and computes an aggregate is grouped by the columns it is correlated
+//     on and becomes a derived table that is joined with the enclosing query
+//     on them.
+//
+// For example,
+//
+//	select * from part where p_size < (select avg(l_quantity) from lineitem where l_partkey = p_partkey)
+//
+// becomes
+//
+//	select part.* from part, (select avg(l_quantity) as __value, l_partkey as __key0 from lineitem group by l_partkey) __subquery0
+//	where p_partkey = __subquery0.__key0 and p_size < __subquery0.__value
+//
+// The correlated predicates must be conjuncts of the subquery's WHERE clause
+// that equate a column of the subquery's tables with an expression over the
+// enclosing query's tables.  Correlated scalar subqueries that cannot be
+// decorrelated, and correlated subqueries that are not conjuncts of the
+// WHERE clause, are instead run for each tuple (see
+// [CorrelatedSubqueryExpr]).
+
+// Unnest the correlated subqueries of the WHERE clause of p, which are the
+// subqueries of its semi-joins and the scalar subqueries of its filters
+func (p *LogicalPlan) decorrelate(c *Catalog) error {
+	for _, semiJoin := range p.semiJoins {
+		if err := p.decorrelateSemiJoin(c, semiJoin); err != nil {
+			return err
+		}
+	}
+	for _, f := range p.filters {
+		if err := p.decorrelateScalarSubqueries(c, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *LogicalPlan) decorrelateSemiJoin(c *Catalog, semiJoin *LogicalSemiJoinNode) error {
+	inner := semiJoin.subplan
+	innerKeys, outerKeys, err := p.correlation(c, inner)
+	if err != nil || len(innerKeys) == 0 {
+		return err
+	}
+	if inner.limit != nil {
+		return GoDBError{ParseError, "correlated subqueries with LIMIT are not supported"}
+	}
+	// without GROUP BY, an aggregate returns a tuple even for correlated
+	// values that match no tuples, which the semi-join would not see
+	if len(inner.aggs) > 0 && len(inner.groupByFields) == 0 {
+		return GoDBError{ParseError, "correlated IN and EXISTS subqueries with aggregates but no GROUP BY are not supported"}
+	}
+	var selects []*LogicalSelectNode
+	if semiJoin.left != nil {
+		selects = []*LogicalSelectNode{inner.selects[0]}
+	}
+	inner.addKeys(selects, innerKeys)
+	semiJoin.outerKeys = outerKeys
+	return nil
+}
+
+// Replace each correlated scalar subquery of the operands of the filter f of
+// p with the value column of a derived table that is joined with the tables
+// of p.  The join drops the tuples of p for which the subquery finds no
+// tuples, so this is only done when f is a comparison, which is then NULL
+// anyway, and the subquery's aggregate is not COUNT, which is 0 rather than
+// NULL for such tuples.  Other correlated subqueries are evaluated for each
+// tuple instead (see [CorrelatedSubqueryExpr]).
+func (p *LogicalPlan) decorrelateScalarSubqueries(c *Catalog, f *LogicalFilterNode) error {
+	cmp, ok := f.pred.(*sqlparser.ComparisonExpr)
+	if !ok {
+		return nil
+	}
+	if _, ok := BoolOpMap[cmp.Operator]; !ok {
+		return nil
+	}
+	var subqueries []*sqlparser.Subquery
+	sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if subquery, ok := node.(*sqlparser.Subquery); ok {
+			subqueries = append(subqueries, subquery)
+			return false, nil
+		}
+		return true, nil
+	}, cmp.Left, cmp.Right)
+
+	for _, subquery := range subqueries {
+		sel, ok := subquery.Select.(*sqlparser.Select)
+		if !ok {
+			continue // reported when the filter is planned
+		}
+		inner, err := parseStatement(c, sel)
+		if err != nil {
+			return err
+		}
+		if len(inner.selects) != 1 || len(inner.aggs) == 0 || len(inner.groupByFields) > 0 || inner.limit != nil {
+			continue
+		}
+		hasCount := false
+		for _, agg := range inner.aggs {
+			hasCount = hasCount || *agg.funcOp == "count"
+		}
+		if hasCount {
+			continue
+		}
+		innerKeys, outerKeys, err := p.correlation(c, inner)
+		if err != nil || len(innerKeys) == 0 {
+			continue
+		}
+
+		inner.alias = fmt.Sprintf("__subquery%d", len(p.subqueries))
+		inner.hidden = true
+		value := inner.selects[0]
+		value.alias = "__value"
+		inner.addKeys([]*LogicalSelectNode{value}, innerKeys)
+		p.subqueries = append(p.subqueries, inner)
+		for i, outerKey := range outerKeys {
+			innerKey := NewFieldSelectNode(inner.alias, keyName(i), "")
+			p.joins = append(p.joins, &LogicalJoinNode{outerKey, &innerKey, OpEq})
+		}
+		col := &sqlparser.ColName{Name: sqlparser.NewColIdent(value.alias), Qualifier: sqlparser.TableName{Name: sqlparser.NewTableIdent(inner.alias)}}
+		f.pred = sqlparser.ReplaceExpr(f.pred, subquery, col)
+	}
+	return nil
+}
+
+// Return the name of the i'th correlated column returned by a decorrelated
+// subquery
+func keyName(i int) string {
+	return fmt.Sprintf("__key%d", i)
+}
+
+// Make the select list of the subquery p the expressions selects followed by
+// the correlated columns keys, named by keyName, and if p is grouped, add
+// keys to its GROUP BY list
+func (p *LogicalPlan) addKeys(selects []*LogicalSelectNode, keys []*LogicalSelectNode) {
+	grouped := len(p.aggs) > 0 || len(p.groupByFields) > 0
+	for i, key := range keys {
+		sel := *key
+		sel.alias = keyName(i)
+		selects = append(selects, &sel)
+		if grouped {
+			p.groupByFields = append(p.groupByFields, &GroupBy{key})
+		}
+	}
+	p.selects = selects
+}
+
+// Remove the correlated predicates from the WHERE clause of the subquery
+// inner of p, returning the columns of inner and the expressions over p that
+// they equate.  It is an error for inner to refer to p anywhere else.
+func (p *LogicalPlan) correlation(c *Catalog, inner *LogicalPlan) ([]*LogicalSelectNode, []*LogicalSelectNode, error) {
+	unsupported := GoDBError{ParseError, "correlated subqueries may only refer to the enclosing query in equalities between one of its expressions and a column of the subquery"}
+	var innerKeys, outerKeys []*LogicalSelectNode
+	var joins []*LogicalJoinNode
+	for _, j := range inner.joins {
+		lInner, lOuter := p.columnScope(c, inner, j.left)
+		rInner, rOuter := p.columnScope(c, inner, j.right)
+		switch {
+		case lInner && rOuter && j.left.exprType == ExprField:
+			innerKeys = append(innerKeys, j.left)
+			outerKeys = append(outerKeys, j.right)
+		case lOuter && rInner && j.right.exprType == ExprField:
+			innerKeys = append(innerKeys, j.right)
+			outerKeys = append(outerKeys, j.left)
+		case p.isCorrelated(c, inner, selectColumns(j.left)) || p.isCorrelated(c, inner, selectColumns(j.right)):
+			return nil, nil, unsupported
+		default:
+			joins = append(joins, j)
+		}
+	}
+
+	var cols []*LogicalSelectNode
+	for _, f := range inner.filters {
+		predCols, err := predicateColumns(c, f.pred)
+		if err != nil {
+			return nil, nil, err
+		}
+		cols = append(cols, predCols...)
+	}
+	if inner.having != nil {
+		havingCols, err := predicateColumns(c, inner.having)
+		if err != nil {
+			return nil, nil, err
+		}
+		cols = append(cols, havingCols...)
+	}
+	for _, semiJoin := range inner.semiJoins {
+		if semiJoin.left != nil {
+			leftCols, err := predicateColumns(c, semiJoin.left)
+			if err != nil {
+				return nil, nil, err
+			}
+			cols = append(cols, leftCols...)
+		}
+		for _, key := range semiJoin.outerKeys {
+			cols = append(cols, selectColumns(key)...)
+		}
+	}
+	for _, sel := range inner.selects {
+		cols = append(cols, selectColumns(sel)...)
+	}
+	for _, gby := range inner.groupByFields {
+		cols = append(cols, selectColumns(gby.expr)...)
+	}
+	if p.isCorrelated(c, inner, cols) {
+		return nil, nil, unsupported
+	}
+	inner.joins = joins
+	return innerKeys, outerKeys, nil
+}
+
+// Return whether every column of lsn is a column of the subquery inner, and
+// whether every column of lsn is instead a column of p, the query enclosing
+// inner.  Both are false if lsn has no columns.
+func (p *LogicalPlan) columnScope(c *Catalog, inner *LogicalPlan, lsn *LogicalSelectNode) (bool, bool) {
+	cols := selectColumns(lsn)
+	isInner, isOuter := len(cols) > 0, len(cols) > 0
+	for _, col := range cols {
+		local := inner.hasColumn(c, col)
+		isInner = isInner && local
+		isOuter = isOuter && !local && p.hasColumn(c, col)
+	}
+	return isInner, isOuter
+}
+
+// Return whether any of cols is a column of p rather than of the subquery
+// inner
+func (p *LogicalPlan) isCorrelated(c *Catalog, inner *LogicalPlan, cols []*LogicalSelectNode) bool {
+	for _, col := range cols {
+		if !inner.hasColumn(c, col) && p.hasColumn(c, col) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return whether col is a column of one of the tables or derived tables of p
+func (p *LogicalPlan) hasColumn(c *Catalog, col *LogicalSelectNode) bool {
+	for _, t := range p.tables {
+		name := t.tableName
+		if t.alias != "" {
+			name = t.alias
+		}
+		if col.table != "" && col.table != name {
+			continue
+		}
+		for _, f := range (*t.file).Descriptor().Fields {
+			if f.Fname == col.field {
+				return true
+			}
+		}
+	}
+	for _, sp := range p.subqueries {
+		if col.table != "" && col.table != sp.alias {
+			continue
+		}
+		for _, f := range sp.getSubplanFields(c) {
+			if f.Fname == col.field {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Return the columns that a select list expression refers to
+func selectColumns(lsn *LogicalSelectNode) []*LogicalSelectNode {
+	switch lsn.exprType {
+	case ExprField:
+		if lsn.field != "*" {
+			return []*LogicalSelectNode{lsn}
+		}
+	case ExprFunc, ExprAggr, ExprPred:
+		var cols []*LogicalSelectNode
+		for _, arg := range lsn.args {
+			cols = append(cols, selectColumns(arg)...)
+		}
+		return cols
+	}
+	return nil
+}
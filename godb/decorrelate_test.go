@@ -0,0 +1,272 @@
+package godb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCorrelatedExists(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "emp (name string, age int, dept int)\ndept (id int, dname string, budget int)\n")
+	mustRunSQL(t, c, bp, "insert into emp values ('sam', 25, 1), ('mary', 30, 2), ('joe', 40, 1), ('ann', null, 3), ('bob', 50, null)")
+	mustRunSQL(t, c, bp, "insert into dept values (1, 'eng', 100), (2, 'sales', 20), (3, 'hr', 60)")
+	mustRunSQL(t, c, bp, "insert into dept values (4, 'ops', 10)")
+	expectNames(t, c, bp, "select name from emp where exists (select * from dept where id = emp.dept and budget > 50) order by name", "ann", "joe", "sam")
+	expectNames(t, c, bp, "select name from emp e where not exists (select * from dept d where d.id = e.dept and d.budget > 50) order by name", "bob", "mary")
+	expectNames(t, c, bp, "select dname from dept where not exists (select name from emp where emp.dept = dept.id)", "ops")
+	// the correlated and uncorrelated predicates of the subquery may be mixed
+	expectNames(t, c, bp, "select dname from dept where exists (select name from emp where age > 35 and dept = id and name <> 'bob')", "eng")
+}
+
+func TestCorrelatedIn(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "emp (name string, age int, dept int)\ndept (id int, dname string, budget int)\n")
+	mustRunSQL(t, c, bp, "insert into emp values ('sam', 25, 1), ('mary', 30, 2), ('joe', 40, 1), ('ann', null, 3), ('bob', 50, null)")
+	mustRunSQL(t, c, bp, "insert into dept values (1, 'eng', 100), (2, 'sales', 20), (3, 'hr', 60)")
+	mustRunSQL(t, c, bp, "insert into dept values (4, 'ops', 10)")
+	expectNames(t, c, bp, "select dname from dept d where 40 in (select age from emp where emp.dept = d.id)", "eng")
+	// NOT IN only sees the tuples of the subquery for the same department, so
+	// ann's NULL age only affects hr, and ops has no tuples at all
+	expectNames(t, c, bp, "select dname from dept d where 40 not in (select age from emp where emp.dept = d.id) order by dname", "ops", "sales")
+	if _, err := runSQL(c, bp, "select name from emp e where age in (select e2.age from emp e2 where e2.dept = e.dept and e2.name <> e.name)"); err == nil {
+		t.Errorf("expected error for correlated inequality")
+	}
+	expectNames(t, c, bp, "select dname from dept where budget in (select max(age) + 60 from emp where emp.dept = dept.id group by dept)", "eng")
+}
+
+func TestCorrelatedScalarSubquery(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "emp (name string, age int, dept int)\ndept (id int, dname string, budget int)\n")
+	mustRunSQL(t, c, bp, "insert into emp values ('sam', 25, 1), ('mary', 30, 2), ('joe', 40, 1), ('ann', null, 3), ('bob', 50, null)")
+	mustRunSQL(t, c, bp, "insert into dept values (1, 'eng', 100), (2, 'sales', 20), (3, 'hr', 60)")
+	mustRunSQL(t, c, bp, "insert into emp values ('tim', 20, 1), ('liz', 60, 2)")
+	// employees older than the average of their department
+	expectNames(t, c, bp, "select name from emp where age > (select avg(age) from emp e2 where e2.dept = emp.dept) order by name", "joe", "liz")
+	expectNames(t, c, bp, "select name from emp e where age * 2 < (select max(age) from emp where dept = e.dept) + 1 order by name", "mary", "tim")
+	expectNames(t, c, bp, "select dname from dept where budget < (select sum(age) from emp where dept = id) * 2 order by dname", "eng", "sales")
+
+	// SELECT * does not include the columns of the decorrelated subquery
+	res := mustRunSQL(t, c, bp, "select * from emp where age = (select min(age) from emp e2 where e2.dept = emp.dept)")
+	if len(res) != 2 || len(res[0].Fields) != 3 {
+		t.Errorf("unexpected result of select * %v", res)
+	}
+
+	// subqueries that cannot be decorrelated are run for each tuple; COUNT is
+	// 0 for bob, whose dept matches no tuples
+	expectNames(t, c, bp, "select name from emp e where age > (select count(*) from emp where dept = e.dept) order by name", "bob", "joe", "liz", "mary", "sam", "tim")
+	expectNames(t, c, bp, "select name from emp e where age > (select max(age) from emp e2 where e2.age < e.age) order by name", "bob", "joe", "liz", "mary", "sam")
+
+	for _, sql := range []string{
+		"select name from emp e where age > (select age from emp e2 where e2.dept = e.dept)",
+		"select name from emp e where age > (select max(age) from emp e2 where e2.dept = e.dept group by e2.name)",
+		"select name from emp e where age > (select max(age), min(age) from emp e2 where e2.dept = e.dept)",
+	} {
+		if _, err := runSQL(c, bp, sql); err == nil {
+			t.Errorf("expected error for %s", sql)
+		}
+	}
+}
+
+func TestCorrelatedSubqueriesPerTuple(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "t (a int, b string)\nu (a int, c int)\nv (a int, d int)\n")
+	mustRunSQL(t, c, bp, "insert into t values (1, 'x'), (2, 'y'), (3, 'z')")
+	mustRunSQL(t, c, bp, "insert into u values (1, 5), (3, 1)")
+	mustRunSQL(t, c, bp, "insert into v values (1, 9), (2, 0), (3, 1)")
+
+	// the subquery is NULL, rather than dropping the tuple, when it finds no
+	// tuples
+	expectNames(t, c, bp, "select b from t where (select max(c) from u where u.a = t.a) is null", "y")
+	expectNames(t, c, bp, "select b from t where b = 'y' or a < (select max(c) from u where u.a = t.a) order by b", "x", "y")
+	expectNames(t, c, bp, "select b from t where b = 'z' or exists (select * from u where u.a = t.a and c > 2) order by b", "x", "z")
+	expectNames(t, c, bp, "select b from t where b = 'y' or not exists (select * from u where u.a = t.a) order by b", "y")
+	expectNames(t, c, bp, "select b from t where b = 'x' or 1 in (select c from u where u.a = t.a) order by b", "x", "z")
+	expectNames(t, c, bp, "select b from t where b = 'y' or a not in (select c - 2 from u where u.a <= t.a) order by b", "x", "y")
+
+	// a subquery may refer to any of the tables of the enclosing query
+	expectNames(t, c, bp, "select b from t, v where t.a = v.a and (d = 0 or exists (select * from u where u.a = t.a and c < v.d)) order by b", "x", "y")
+}
+
+func TestDecorrelatedPlan(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "emp (name string, age int, dept int)\ndept (id int, dname string, budget int)\n")
+	mustRunSQL(t, c, bp, "insert into emp values ('sam', 25, 1), ('mary', 30, 2), ('joe', 40, 1), ('ann', null, 3), ('bob', 50, null)")
+	mustRunSQL(t, c, bp, "insert into dept values (1, 'eng', 100), (2, 'sales', 20), (3, 'hr', 60)")
+	_, op, err := Parse(c, "select name from emp where age > (select avg(age) from emp e2 where e2.dept = emp.dept) and exists (select * from dept where id = emp.dept)")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// the scalar subquery is joined with emp, and the EXISTS subquery is
+	// applied to emp as a semi-join keyed on its department
+	var filter *PredicateFilter
+	var join *EqualityJoin[int64]
+	var semiJoin *SemiJoin
+	var visit func(o Operator)
+	visit = func(o Operator) {
+		switch node := o.(type) {
+		case *Project:
+			visit(node.child)
+		case *PredicateFilter:
+			filter = node
+			visit(node.child)
+		case *EqualityJoin[int64]:
+			join = node
+			visit(*node.left)
+			visit(*node.right)
+		case *SemiJoin:
+			semiJoin = node
+			visit(node.left)
+		}
+	}
+	visit(op)
+	if filter == nil || join == nil || semiJoin == nil || len(semiJoin.leftKeys) != 1 || len(predicateSubqueries(filter.pred)) != 0 {
+		t.Errorf("unexpected plan for decorrelated subqueries")
+		PrintPhysicalPlan(op, "")
+	}
+}
+
+type tpchRow struct {
+	a, b, c, d int64
+}
+
+func tpchTable(t *testing.T, c *Catalog, bp *BufferPool, sql string) []tpchRow {
+	var rows []tpchRow
+	for _, tup := range mustRunSQL(t, c, bp, sql) {
+		rows = append(rows, tpchRow{tup.Fields[0].(IntField).Value, tup.Fields[1].(IntField).Value, tup.Fields[2].(IntField).Value, tup.Fields[3].(IntField).Value})
+	}
+	return rows
+}
+
+func TestTPCHCorrelatedSubqueries(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "")
+	mustRunSQL(t, c, bp, "create table part (p_partkey int, p_name string, p_brand string, p_size int)")
+	mustRunSQL(t, c, bp, "create table supplier (s_suppkey int, s_name string, s_nation string)")
+	mustRunSQL(t, c, bp, "create table partsupp (ps_partkey int, ps_suppkey int, ps_availqty int, ps_supplycost int)")
+	mustRunSQL(t, c, bp, "create table lineitem (l_partkey int, l_suppkey int, l_quantity int, l_extendedprice int)")
+
+	var rows []string
+	for p := 0; p < 100; p++ {
+		name := []string{"forest green", "lace blush", "forest pink", "navy ivory"}[p%4]
+		rows = append(rows, fmt.Sprintf("(%d, '%s %d', 'brand#%d', %d)", p, name, p, p%5, p%7))
+	}
+	mustRunSQL(t, c, bp, "insert into part values "+strings.Join(rows, ", "))
+	rows = nil
+	for s := 0; s < 20; s++ {
+		rows = append(rows, fmt.Sprintf("(%d, 'supplier#%02d', '%s')", s, s, []string{"france", "peru"}[s%2]))
+	}
+	mustRunSQL(t, c, bp, "insert into supplier values "+strings.Join(rows, ", "))
+	rows = nil
+	for p := 0; p < 100; p++ {
+		for i := 0; i < 4; i++ {
+			rows = append(rows, fmt.Sprintf("(%d, %d, %d, %d)", p, (p+i*5)%20, (p*7+i*13)%50, (p*31+i*17)%100))
+		}
+	}
+	mustRunSQL(t, c, bp, "insert into partsupp values "+strings.Join(rows, ", "))
+	rows = nil
+	for l := 0; l < 2000; l++ {
+		p := (l * 7) % 100
+		rows = append(rows, fmt.Sprintf("(%d, %d, %d, %d)", p, (p+(l%4)*5)%20, (l*13)%50+1, l))
+	}
+	mustRunSQL(t, c, bp, "insert into lineitem values "+strings.Join(rows, ", "))
+	parts := tpchTable(t, c, bp, "select p_partkey, p_size, p_size, p_size from part")
+	partsupps := tpchTable(t, c, bp, "select * from partsupp")
+	lineitems := tpchTable(t, c, bp, "select * from lineitem")
+
+	// Q17: the revenue from small orders of parts of a brand
+	res := mustRunSQL(t, c, bp, `select sum(l_extendedprice) from lineitem, part
+		where p_partkey = l_partkey and p_brand = 'brand#3'
+		and l_quantity * 5 < (select avg(l_quantity) from lineitem where l_partkey = p_partkey)`)
+	var expected int64
+	found := false
+	for _, p := range parts {
+		if p.a%5 != 3 {
+			continue
+		}
+		var sum, count int64
+		for _, l := range lineitems {
+			if l.a == p.a {
+				sum, count = sum+l.c, count+1
+			}
+		}
+		for _, l := range lineitems {
+			if l.a == p.a && l.c*5 < sum/count {
+				expected += l.d
+				found = true
+			}
+		}
+	}
+	// the sum of no rows is NULL
+	var want DBValue
+	if found {
+		want = IntField{expected}
+	}
+	if len(res) != 1 || res[0].Fields[0] != want {
+		t.Errorf("unexpected result for Q17 %v, expected %v", res, want)
+	}
+
+	// Q2: the suppliers of each part that have its minimum cost, among the
+	// suppliers of a nation
+	res = mustRunSQL(t, c, bp, `select p_partkey, s_suppkey from part, supplier, partsupp
+		where p_partkey = ps_partkey and s_suppkey = ps_suppkey and p_size = 3 and s_nation = 'peru'
+		and ps_supplycost = (select min(ps_supplycost) from partsupp, supplier
+			where p_partkey = ps_partkey and s_suppkey = ps_suppkey and s_nation = 'peru')
+		order by p_partkey, s_suppkey`)
+	var q2 []string
+	for _, p := range parts {
+		if p.b != 3 {
+			continue
+		}
+		min := int64(-1)
+		for _, ps := range partsupps {
+			if ps.a == p.a && ps.b%2 == 1 && (min == -1 || ps.d < min) {
+				min = ps.d
+			}
+		}
+		var supps []int
+		for _, ps := range partsupps {
+			if ps.a == p.a && ps.b%2 == 1 && ps.d == min {
+				supps = append(supps, int(ps.b))
+			}
+		}
+		sort.Ints(supps)
+		for _, s := range supps {
+			q2 = append(q2, fmt.Sprintf("%d,%d", p.a, s))
+		}
+	}
+	if len(res) != len(q2) || len(q2) == 0 {
+		t.Fatalf("expected %d tuples for Q2, got %d", len(q2), len(res))
+	}
+	for i, tup := range res {
+		if tup.PrettyPrintString(false) != q2[i] {
+			t.Errorf("expected %s for Q2, got %s", q2[i], tup.PrettyPrintString(false))
+		}
+	}
+
+	// Q20: the suppliers with an excess of forest parts, where the nested
+	// subquery is correlated on two columns
+	var q20 []string
+	for s := int64(0); s < 20; s++ {
+		found := false
+		for _, ps := range partsupps {
+			if ps.b != s || ps.a%2 != 0 {
+				continue
+			}
+			var sum int64
+			var any bool
+			for _, l := range lineitems {
+				if l.a == ps.a && l.b == ps.b {
+					sum, any = sum+l.c, true
+				}
+			}
+			found = found || (any && ps.c*4 > sum)
+		}
+		if found {
+			q20 = append(q20, fmt.Sprintf("supplier#%02d", s))
+		}
+	}
+	if len(q20) == 0 || len(q20) == 20 {
+		t.Fatalf("Q20 test data selects %d suppliers", len(q20))
+	}
+	expectNames(t, c, bp, `select s_name from supplier
+		where s_suppkey in (select ps_suppkey from partsupp
+			where ps_partkey in (select p_partkey from part where p_name like 'forest%')
+			and ps_availqty * 4 > (select sum(l_quantity) from lineitem where l_partkey = ps_partkey and l_suppkey = ps_suppkey))
+		order by s_name`, q20...)
+}
@@ -4,13 +4,15 @@ type DeleteOp struct {
 	// TODO: some code goes here
     file DBFile
     child Operator
+    references *referenceEnforcer // may be nil, if no foreign keys refer to the table
+    stats *statsUpdater // may be nil, if the table has not been analyzed
 }
 
 // Construtor.  The delete operator deletes the records in the child
 // Operator from the specified DBFile.
 func NewDeleteOp(deleteFile DBFile, child Operator) *DeleteOp {
 	// TODO: some code goes here
-    return &DeleteOp{deleteFile, child}
+    return &DeleteOp{deleteFile, child, nil, nil}
 }
 
 // The delete TupleDesc is a one column descriptor with an integer field named "count"
@@ -34,16 +36,43 @@ func (dop *DeleteOp) Iterator(tid TransactionID) (func() (*Tuple, error), error)
     if err != nil {
         return nil, err
     }
+    var stats *statsDelta
+    if dop.stats != nil {
+        stats = dop.stats.newDelta()
+    }
     count := 0;
+    var deleted []*Tuple
     for t, err := childIter(); t != nil || err != nil; t, err = childIter() {
         if err != nil {
             return nil, err
         }
         dop.file.deleteTuple(t, tid)
+        if dop.references != nil {
+            deleted = append(deleted, t)
+        }
+        if stats != nil {
+            stats.add(t, -1)
+        }
         count++
     }
+    if stats != nil && count > 0 {
+        dop.stats.applyAtCommit(tid, stats)
+    }
+    // foreign keys are enforced once all of the tuples have been deleted, so
+    // that references among the deleted tuples themselves are allowed
+    if dop.references != nil {
+        err = dop.references.deleted(tid, deleted)
+        if err != nil {
+            return nil, err
+        }
+    }
 
+    done := false
     return func() (*Tuple, error) {
+        if done {
+            return nil, nil
+        }
+        done = true
         ret := Tuple{}
         ret.Desc = *dop.Descriptor()
         ret.Fields = []DBValue{}
@@ -0,0 +1,202 @@
+package godb
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// EXPLAIN returns the plan of a query as rows, one per operator, in the
+// format of [PrintPhysicalPlan].  EXPLAIN ANALYZE also runs the query
+// (including any changes made by INSERT, UPDATE and DELETE statements),
+// discarding its results, and reports for each operator the number of tuples
+// it returned, and the time spent and pages fetched from the buffer pool
+// while it was running, including in its children.
+
+// Parse an EXPLAIN statement
+//
+//	EXPLAIN [ANALYZE] statement
+//
+// where statement is a query, or an INSERT, UPDATE or DELETE statement
+func parseExplain(c *Catalog, query string) (Operator, error) {
+	ts := newTokenStream(query)
+	if err := ts.expect("explain"); err != nil {
+		return nil, err
+	}
+	analyze := ts.accept("analyze")
+	switch strings.ToLower(ts.val) {
+	case "select", "with", "insert", "update", "delete", "(":
+	default:
+		return nil, ts.errorf("EXPLAIN is only supported for queries and INSERT, UPDATE and DELETE statements")
+	}
+	_, op, err := Parse(c, query[ts.prevEnd:])
+	if err != nil {
+		return nil, err
+	}
+	return NewExplain(op, analyze, c.bp), nil
+}
+
+// An operator that returns the lines of the description of the plan of child
+type Explain struct {
+	child   Operator
+	analyze bool              // if true, child is instrumented, and run before its plan is returned
+	nodes   []*instrumentedOp // the instrumented operators of child
+}
+
+// Construct an EXPLAIN of the plan child, or, if analyze is true, an EXPLAIN
+// ANALYZE of it, whose operators are instrumented to report what they do
+// with the buffer pool bp
+func NewExplain(child Operator, analyze bool, bp *BufferPool) *Explain {
+	var nodes []*instrumentedOp
+	if analyze {
+		child, nodes = instrument(child, bp)
+	}
+	return &Explain{child, analyze, nodes}
+}
+
+// The explain TupleDesc is a one column descriptor with a string field named
+// "plan"
+func (e *Explain) Descriptor() *TupleDesc {
+	return &TupleDesc{[]FieldType{{"plan", "", StringType}}}
+}
+
+func (e *Explain) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	if e.analyze {
+		for _, node := range e.nodes {
+			node.rows, node.elapsed, node.pages = 0, 0, 0
+		}
+		iter, err := e.child.Iterator(tid)
+		if err != nil {
+			return nil, err
+		}
+		for {
+			t, err := iter()
+			if err != nil {
+				return nil, err
+			}
+			if t == nil {
+				break
+			}
+		}
+	}
+	var buf strings.Builder
+	writePhysicalPlan(&buf, e.child, "")
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	desc := e.Descriptor()
+	return func() (*Tuple, error) {
+		if len(lines) == 0 {
+			return nil, nil
+		}
+		// indent with spaces rather than tabs, which do not line up in
+		// printed results
+		line := lines[0]
+		trimmed := strings.TrimLeft(line, "\t")
+		line = strings.Repeat("  ", len(line)-len(trimmed)) + trimmed
+		lines = lines[1:]
+		return &Tuple{*desc, []DBValue{StringField{line}}, nil}, nil
+	}, nil
+}
+
+// An operator that counts the tuples returned by child, and the time spent and
+// pages fetched from the buffer pool while it runs
+type instrumentedOp struct {
+	child   Operator
+	bp      *BufferPool
+	rows    int
+	elapsed time.Duration
+	pages   int
+}
+
+// Return the plan op with each of its operators wrapped in an
+// instrumentedOp, and the wrappers.  Operators that appear more than once in
+// the plan are wrapped once.
+func instrument(op Operator, bp *BufferPool) (Operator, []*instrumentedOp) {
+	wrapped := make(map[Operator]*instrumentedOp)
+	var nodes []*instrumentedOp
+	var wrap func(op Operator) Operator
+	wrap = func(op Operator) Operator {
+		if w, ok := wrapped[op]; ok {
+			return w
+		}
+		w := &instrumentedOp{child: op, bp: bp}
+		wrapped[op] = w
+		nodes = append(nodes, w)
+		for _, child := range planChildren(op) {
+			*child = wrap(*child)
+		}
+		return w
+	}
+	return wrap(op), nodes
+}
+
+// Return pointers to the fields of op that hold its child operators
+func planChildren(o Operator) []*Operator {
+	switch op := o.(type) {
+	case *EqualityJoin[int64]:
+		return []*Operator{op.left, op.right}
+	case *EqualityJoin[string]:
+		return []*Operator{op.left, op.right}
+	case *SemiJoin:
+		return []*Operator{&op.left, &op.right}
+	case *CrossProduct:
+		return []*Operator{&op.left, &op.right}
+	case *SetOp:
+		return []*Operator{&op.left, &op.right}
+	case *RecursiveCTE:
+		return []*Operator{&op.base, &op.recursive}
+	case *Window:
+		return []*Operator{&op.child}
+	case *Project:
+		return []*Operator{&op.child}
+	case *Filter[int64]:
+		return []*Operator{&op.child}
+	case *Filter[string]:
+		return []*Operator{&op.child}
+	case *PredicateFilter:
+		return []*Operator{&op.child}
+	case *OrderBy:
+		return []*Operator{&op.child}
+	case *LimitOp:
+		return []*Operator{&op.child}
+	case *TopN:
+		return []*Operator{&op.child}
+	case *Aggregator:
+		return []*Operator{&op.child}
+	case *InsertOp:
+		return []*Operator{&op.child}
+	case *DeleteOp:
+		return []*Operator{&op.child}
+	case *UpdateOp:
+		return []*Operator{&op.child}
+	}
+	return nil
+}
+
+func (o *instrumentedOp) Descriptor() *TupleDesc {
+	return o.child.Descriptor()
+}
+
+func (o *instrumentedOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	start, pages := time.Now(), o.bp.pagesFetched(tid)
+	iter, err := o.child.Iterator(tid)
+	o.elapsed += time.Since(start)
+	o.pages += o.bp.pagesFetched(tid) - pages
+	if err != nil {
+		return nil, err
+	}
+	return func() (*Tuple, error) {
+		start, pages := time.Now(), o.bp.pagesFetched(tid)
+		t, err := iter()
+		o.elapsed += time.Since(start)
+		o.pages += o.bp.pagesFetched(tid) - pages
+		if t != nil {
+			o.rows++
+		}
+		return t, err
+	}, nil
+}
+
+// Return a description of the counters of the operator
+func (o *instrumentedOp) counters() string {
+	return fmt.Sprintf("(rows=%d time=%.3fms pages=%d)", o.rows, float64(o.elapsed.Microseconds())/1000, o.pages)
+}
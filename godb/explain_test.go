@@ -0,0 +1,92 @@
+package godb
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Return the lines of the plan returned by an EXPLAIN statement
+func explainLines(t *testing.T, c *Catalog, bp *BufferPool, sql string) []string {
+	t.Helper()
+	var lines []string
+	for _, tup := range mustRunSQL(t, c, bp, sql) {
+		lines = append(lines, tup.Fields[0].(StringField).Value)
+	}
+	return lines
+}
+
+func TestExplain(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "emp (name string, age int, dept int)\ndept (id int, dname string, budget int)\n")
+	mustRunSQL(t, c, bp, "insert into emp values ('sam', 25, 1), ('mary', 30, 2), ('joe', 40, 1), ('ann', null, 3), ('bob', 50, null)")
+	mustRunSQL(t, c, bp, "insert into dept values (1, 'eng', 100), (2, 'sales', 20), (3, 'hr', 60)")
+	lines := explainLines(t, c, bp, "explain select name, dname from emp, dept where emp.dept = dept.id and age > 25 order by name")
+	// the filtered emp is expected to be the smaller side, so it is built
+	expected := []string{"Order By emp.name", "  Project", "    Join, dept.id == emp.dept", "      Heap Scan", "      Filter emp.age", "        Heap Scan"}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d lines, got %q", len(expected), lines)
+	}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, expected[i]) || strings.Contains(line, "rows=") {
+			t.Errorf("expected line starting with %q, got %q", expected[i], line)
+		}
+	}
+
+	// EXPLAIN does not run the statement
+	explainLines(t, c, bp, "explain insert into emp values ('x', 1, 1)")
+	explainLines(t, c, bp, "explain delete from emp")
+	expectRows(t, c, bp, "select count(*) from emp", "5")
+
+	for _, sql := range []string{"explain create table u (a int)", "explain analyze", "explain select * from nosuchtable", "explain explain select * from emp"} {
+		if _, err := runSQL(c, bp, sql); err == nil {
+			t.Errorf("expected error for %s", sql)
+		}
+	}
+	if _, err := c.GetTable("u"); err == nil {
+		t.Errorf("expected EXPLAIN not to create table")
+	}
+}
+
+var explainCounters = regexp.MustCompile(`\(rows=(\d+) time=[0-9.]+ms pages=(\d+)\)$`)
+
+func TestExplainAnalyze(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "emp (name string, age int, dept int)\ndept (id int, dname string, budget int)\n")
+	mustRunSQL(t, c, bp, "insert into emp values ('sam', 25, 1), ('mary', 30, 2), ('joe', 40, 1), ('ann', null, 3), ('bob', 50, null)")
+	mustRunSQL(t, c, bp, "insert into dept values (1, 'eng', 100), (2, 'sales', 20), (3, 'hr', 60)")
+	sql := "explain analyze select name, dname from emp, dept where emp.dept = dept.id and age > 25 order by name limit 2"
+	// the counters are reset each time the plan is run
+	for i := 0; i < 2; i++ {
+		lines := explainLines(t, c, bp, sql)
+		expected := []struct {
+			prefix string
+			rows   int
+		}{{"Top", 2}, {"  Project", 2}, {"    Join", 2}, {"      Heap Scan", 3}, {"      Filter", 3}, {"        Heap Scan", 5}}
+		if len(lines) != len(expected) {
+			t.Fatalf("expected %d lines, got %q", len(expected), lines)
+		}
+		for i, line := range lines {
+			m := explainCounters.FindStringSubmatch(line)
+			if !strings.HasPrefix(line, expected[i].prefix) || m == nil {
+				t.Errorf("expected line starting with %q with counters, got %q", expected[i].prefix, line)
+				continue
+			}
+			if rows, _ := strconv.Atoi(m[1]); rows != expected[i].rows {
+				t.Errorf("expected %d rows from %q", expected[i].rows, line)
+			}
+			// each table has one page; the counts of each operator include
+			// the pages fetched by its children
+			pages, _ := strconv.Atoi(m[2])
+			if (i < 3 && pages != 2) || (i >= 3 && pages != 1) {
+				t.Errorf("unexpected pages fetched by %q", line)
+			}
+		}
+	}
+
+	// EXPLAIN ANALYZE runs the statement
+	lines := explainLines(t, c, bp, "explain analyze insert into emp values ('x', 1, 1), ('y', 2, 2)")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "Insert") || !strings.Contains(lines[1], "rows=2") {
+		t.Errorf("unexpected plan %q", lines)
+	}
+	expectRows(t, c, bp, "select count(*) from emp", "7")
+}
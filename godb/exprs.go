@@ -3,6 +3,7 @@ package godb
 import (
 	"fmt"
 	"math/rand"
+	"strings"
 	"time"
 )
 
@@ -48,9 +49,120 @@ func (c *ConstExpr) EvalExpr(_ *Tuple) (DBValue, error) {
 	return c.val, nil
 }
 
+// Predicates are expressions that evaluate to true (IntField{1}) or false
+// (IntField{0}) or, when their outcome depends on a NULL, to NULL (nil), as in
+// SQL's three-valued logic.
+
+var trueField DBValue = IntField{1}
+var falseField DBValue = IntField{0}
+
+func boolField(b bool) DBValue {
+	if b {
+		return trueField
+	}
+	return falseField
+}
+
+// CompareExpr compares the results of two expressions of the same type
+type CompareExpr struct {
+	op          BoolOp
+	left, right Expr
+}
+
+func (e *CompareExpr) GetExprType() FieldType {
+	return FieldType{"predicate", "", IntType}
+}
+
+func (e *CompareExpr) EvalExpr(t *Tuple) (DBValue, error) {
+	left, err := e.left.EvalExpr(t)
+	if err != nil {
+		return nil, err
+	}
+	right, err := e.right.EvalExpr(t)
+	if err != nil {
+		return nil, err
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	switch left := left.(type) {
+	case IntField:
+		if right, ok := right.(IntField); ok {
+			return boolField(evalPred(left.Value, right.Value, e.op)), nil
+		}
+	case StringField:
+		if right, ok := right.(StringField); ok {
+			return boolField(evalPred(left.Value, right.Value, e.op)), nil
+		}
+	}
+	return nil, GoDBError{TypeMismatchError, "cannot compare values of different types"}
+}
+
+// LogicExpr combines the results of predicates with "and", "or", or "not"
+type LogicExpr struct {
+	op   string
+	args []Expr
+}
+
+func (e *LogicExpr) GetExprType() FieldType {
+	return FieldType{"predicate", "", IntType}
+}
+
+func (e *LogicExpr) EvalExpr(t *Tuple) (DBValue, error) {
+	// the result if any argument is true (for "or") or false (for "and")
+	var decided DBValue
+	switch e.op {
+	case "and":
+		decided = falseField
+	case "or":
+		decided = trueField
+	case "not":
+		val, err := e.args[0].EvalExpr(t)
+		if err != nil || val == nil {
+			return nil, err
+		}
+		return boolField(val == falseField), nil
+	default:
+		return nil, GoDBError{ParseError, fmt.Sprintf("unknown logical operator %s", e.op)}
+	}
+	result := boolField(decided == falseField)
+	for _, arg := range e.args {
+		val, err := arg.EvalExpr(t)
+		if err != nil {
+			return nil, err
+		}
+		if val == nil {
+			result = nil
+		} else if val == decided {
+			return decided, nil
+		}
+	}
+	return result, nil
+}
+
+// IsNullExpr tests whether the result of an expression is (or, if not is
+// true, is not) NULL
+type IsNullExpr struct {
+	expr Expr
+	not  bool
+}
+
+func (e *IsNullExpr) GetExprType() FieldType {
+	return FieldType{"predicate", "", IntType}
+}
+
+func (e *IsNullExpr) EvalExpr(t *Tuple) (DBValue, error) {
+	val, err := e.expr.EvalExpr(t)
+	if err != nil {
+		return nil, err
+	}
+	return boolField((val == nil) != e.not), nil
+}
+
 type FuncExpr struct {
 	op   string
 	args []*Expr
+	c    *Catalog // the catalog, for functions of database objects such as sequences
 }
 
 func (f *FuncExpr) GetExprType() FieldType {
@@ -74,24 +186,29 @@ type FuncType struct {
 	argTypes []DBType
 	outType  DBType
 	f        func([]any) any
+
+	// set instead of f for functions that need the catalog, and may fail
+	catalogF func(*Catalog, []any) (any, error)
 }
 
 var funcs = map[string]FuncType{
 	//note should all be lower case
-	"+":                     {[]DBType{IntType, IntType}, IntType, addFunc},
-	"-":                     {[]DBType{IntType, IntType}, IntType, minusFunc},
-	"*":                     {[]DBType{IntType, IntType}, IntType, timesFunc},
-	"/":                     {[]DBType{IntType, IntType}, IntType, divFunc},
-	"mod":                   {[]DBType{IntType, IntType}, IntType, modFunc},
-	"rand":                  {[]DBType{}, IntType, randIntFunc},
-	"sq":                    {[]DBType{IntType}, IntType, sqFunc},
-	"getsubstr":             {[]DBType{StringType, IntType, IntType}, StringType, subStrFunc},
-	"epoch":                 {[]DBType{}, IntType, epoch},
-	"datetimestringtoepoch": {[]DBType{StringType}, IntType, dateTimeToEpoch},
-	"datestringtoepoch":     {[]DBType{StringType}, IntType, dateToEpoch},
-	"epochtodatetimestring": {[]DBType{IntType}, StringType, dateString},
-	"imin":                  {[]DBType{IntType, IntType}, IntType, minFunc},
-	"imax":                  {[]DBType{IntType, IntType}, IntType, maxFunc},
+	"+":                     {[]DBType{IntType, IntType}, IntType, addFunc, nil},
+	"-":                     {[]DBType{IntType, IntType}, IntType, minusFunc, nil},
+	"*":                     {[]DBType{IntType, IntType}, IntType, timesFunc, nil},
+	"/":                     {[]DBType{IntType, IntType}, IntType, divFunc, nil},
+	"mod":                   {[]DBType{IntType, IntType}, IntType, modFunc, nil},
+	"rand":                  {[]DBType{}, IntType, randIntFunc, nil},
+	"sq":                    {[]DBType{IntType}, IntType, sqFunc, nil},
+	"getsubstr":             {[]DBType{StringType, IntType, IntType}, StringType, subStrFunc, nil},
+	"epoch":                 {[]DBType{}, IntType, epoch, nil},
+	"datetimestringtoepoch": {[]DBType{StringType}, IntType, dateTimeToEpoch, nil},
+	"datestringtoepoch":     {[]DBType{StringType}, IntType, dateToEpoch, nil},
+	"epochtodatetimestring": {[]DBType{IntType}, StringType, dateString, nil},
+	"imin":                  {[]DBType{IntType, IntType}, IntType, minFunc, nil},
+	"imax":                  {[]DBType{IntType, IntType}, IntType, maxFunc, nil},
+	"nextval":               {[]DBType{StringType}, IntType, nil, nextvalFunc},
+	"currval":               {[]DBType{StringType}, IntType, nil, currvalFunc},
 }
 
 func ListOfFunctions() string {
@@ -117,6 +234,14 @@ func ListOfFunctions() string {
 	}
 	return fList
 }
+func nextvalFunc(c *Catalog, args []any) (any, error) {
+	return c.nextval(strings.ToLower(args[0].(string)))
+}
+
+func currvalFunc(c *Catalog, args []any) (any, error) {
+	return c.currval(strings.ToLower(args[0].(string)))
+}
+
 func minFunc(args []any) any {
 	first := args[0].(int64)
 	second := args[1].(int64)
@@ -233,6 +358,10 @@ func (f *FuncExpr) EvalExpr(t *Tuple) (DBValue, error) {
 		if err != nil {
 			return nil, err
 		}
+		// functions of NULL are NULL
+		if val == nil {
+			return nil, nil
+		}
 		switch argType {
 		case IntType:
 			argvals[i] = val.(IntField).Value
@@ -240,7 +369,19 @@ func (f *FuncExpr) EvalExpr(t *Tuple) (DBValue, error) {
 			argvals[i] = val.(StringField).Value
 		}
 	}
-	result := fType.f(argvals)
+	var result any
+	if fType.catalogF != nil {
+		if f.c == nil {
+			return nil, GoDBError{IllegalOperationError, fmt.Sprintf("function %s cannot be used here", f.op)}
+		}
+		var err error
+		result, err = fType.catalogF(f.c, argvals)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		result = fType.f(argvals)
+	}
 	switch fType.outType {
 	case IntType:
 		return IntField{result.(int64)}, nil
@@ -85,6 +85,10 @@ func (f *Filter[T]) Iterator(tid TransactionID) (func() (*Tuple, error), error)
                 return nil, err
             }
 
+            // comparisons involving NULL are never true
+            if left_eval == nil || right_eval == nil {
+                continue
+            }
             left_val := f.getter(left_eval)
             right_val := f.getter(right_eval)
             if evalPred(left_val, right_val, f.op) {
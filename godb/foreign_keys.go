@@ -0,0 +1,238 @@
+package godb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Fill in and check the foreign keys among the constraints of a new table
+// named table, with descriptor desc.  Each foreign key must refer to an
+// existing table (or to the new table itself), and to columns of that table
+// that form its primary key or have a unique constraint; if no columns were
+// given, the primary key is used.  The referring and referenced columns must
+// have the same types.
+func (c *Catalog) resolveForeignKeys(table string, desc *TupleDesc, constraints []*Constraint) error {
+	for _, con := range constraints {
+		if con.ctype != ForeignKeyConstraint {
+			continue
+		}
+		refDesc, refConstraints := desc, constraints
+		if con.refTable != table {
+			refTable := c.tableMap[con.refTable]
+			if refTable == nil {
+				return GoDBError{NoSuchTableError, fmt.Sprintf("table '%s' referenced by foreign key not found", con.refTable)}
+			}
+			refDesc, refConstraints = &refTable.desc, refTable.constraints
+		}
+		if con.refColumns == nil {
+			for _, refCon := range refConstraints {
+				if refCon.ctype == PrimaryKeyConstraint {
+					con.refColumns = make([]string, len(refCon.columns))
+					copy(con.refColumns, refCon.columns)
+				}
+			}
+			if con.refColumns == nil {
+				return GoDBError{ParseError, fmt.Sprintf("table %s referenced by foreign key has no primary key", con.refTable)}
+			}
+		}
+		if len(con.refColumns) != len(con.columns) {
+			return GoDBError{ParseError, fmt.Sprintf("foreign key on (%s) has a different number of columns than the key it references", strings.Join(con.columns, ", "))}
+		}
+		for i, col := range con.refColumns {
+			refFieldNo, err := findFieldInTd(FieldType{col, "", UnknownType}, refDesc)
+			if err != nil {
+				return GoDBError{ParseError, fmt.Sprintf("column %s referenced by foreign key does not exist in table %s", col, con.refTable)}
+			}
+			fieldNo, err := findFieldInTd(FieldType{con.columns[i], "", UnknownType}, desc)
+			if err != nil {
+				return err
+			}
+			if refDesc.Fields[refFieldNo].Ftype != desc.Fields[fieldNo].Ftype {
+				return GoDBError{TypeMismatchError, fmt.Sprintf("foreign key column %s has a different type than the column %s it references", con.columns[i], col)}
+			}
+		}
+		isKey := false
+		for _, refCon := range refConstraints {
+			if (refCon.ctype == PrimaryKeyConstraint || refCon.ctype == UniqueConstraint) && sameColumns(refCon.columns, con.refColumns) {
+				isKey = true
+			}
+		}
+		if !isKey {
+			return GoDBError{ParseError, fmt.Sprintf("columns (%s) referenced by foreign key are not a primary key or unique in table %s", strings.Join(con.refColumns, ", "), con.refTable)}
+		}
+	}
+	return nil
+}
+
+// Return true if cols1 and cols2 contain the same columns, in any order
+func sameColumns(cols1 []string, cols2 []string) bool {
+	if len(cols1) != len(cols2) {
+		return false
+	}
+	for _, col := range cols1 {
+		found := false
+		for _, col2 := range cols2 {
+			found = found || col == col2
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// A foreign key constraint, along with the table it is declared on
+type referringConstraint struct {
+	table *Table
+	con   *Constraint
+}
+
+// Return the foreign keys, of any table, that refer to the named table
+func (c *Catalog) referringConstraints(table string) []referringConstraint {
+	var refs []referringConstraint
+	for _, t := range c.tables {
+		for _, con := range t.constraints {
+			if con.ctype == ForeignKeyConstraint && con.refTable == table {
+				refs = append(refs, referringConstraint{t, con})
+			}
+		}
+	}
+	return refs
+}
+
+// referenceEnforcer enforces the foreign keys that refer to a table when
+// tuples are removed from it, carrying out their ON DELETE actions on behalf
+// of the transaction that removed them.
+type referenceEnforcer struct {
+	c     *Catalog
+	table string
+}
+
+// Return a referenceEnforcer for the named table, or nil if no foreign keys
+// refer to it.
+func (c *Catalog) getReferenceEnforcer(table string) *referenceEnforcer {
+	if len(c.referringConstraints(table)) == 0 {
+		return nil
+	}
+	return &referenceEnforcer{c, table}
+}
+
+// Carry out the ON DELETE actions of the foreign keys that refer to the
+// deleted tuples, which must already have been removed from the table.
+func (re *referenceEnforcer) deleted(tid TransactionID, deleted []*Tuple) error {
+	return re.c.enforceReferences(tid, re.table, deleted, nil, true)
+}
+
+// Check that an update that replaced oldTuples with newTuples did not change
+// or remove any key that is still referred to.  Updates of referenced keys
+// are always restricted.
+func (re *referenceEnforcer) updated(tid TransactionID, oldTuples []*Tuple, newTuples []*Tuple) error {
+	return re.c.enforceReferences(tid, re.table, oldTuples, newTuples, false)
+}
+
+// Enforce the foreign keys that refer to the keys of the removed tuples of
+// table that are not also keys of the added tuples.  If onDelete is true,
+// the ON DELETE action of each foreign key is carried out; otherwise, any
+// remaining reference to a removed key is an error.
+func (c *Catalog) enforceReferences(tid TransactionID, table string, removed []*Tuple, added []*Tuple, onDelete bool) error {
+	t := c.tableMap[table]
+	if t == nil {
+		return GoDBError{NoSuchTableError, fmt.Sprintf("no table '%s' found", table)}
+	}
+	for _, ref := range c.referringConstraints(table) {
+		refFieldNos, err := columnsToFieldNos(ref.con.refColumns, &t.desc)
+		if err != nil {
+			return err
+		}
+		keys := make(map[any]bool)
+		for _, tup := range removed {
+			if key, ok := keyOfFields(tup, refFieldNos); ok {
+				keys[key] = true
+			}
+		}
+		for _, tup := range added {
+			if key, ok := keyOfFields(tup, refFieldNos); ok {
+				delete(keys, key)
+			}
+		}
+		if len(keys) == 0 {
+			continue
+		}
+
+		file, err := c.GetTable(ref.table.name)
+		if err != nil {
+			return err
+		}
+		fieldNos, err := columnsToFieldNos(ref.con.columns, &ref.table.desc)
+		if err != nil {
+			return err
+		}
+		var matches []*Tuple
+		err = scanFile(file, tid, nil, func(tup *Tuple) error {
+			if key, ok := keyOfFields(tup, fieldNos); ok && keys[key] {
+				matches = append(matches, tup)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(matches) == 0 {
+			continue
+		}
+
+		action := ref.con.onDelete
+		if !onDelete {
+			action = RestrictAction
+		}
+		switch action {
+		case RestrictAction:
+			return GoDBError{ConstraintViolationError, fmt.Sprintf("key (%s) of table %s is still referenced from table %s by %s", formatFields(matches[0], fieldNos), table, ref.table.name, ref.con.String())}
+		case CascadeAction:
+			for _, tup := range matches {
+				if err := file.deleteTuple(tup, tid); err != nil {
+					return err
+				}
+			}
+			if err := c.enforceReferences(tid, ref.table.name, matches, nil, true); err != nil {
+				return err
+			}
+		case SetNullAction:
+			newTuples := make([]*Tuple, len(matches))
+			for i, tup := range matches {
+				fields := make([]DBValue, len(tup.Fields))
+				copy(fields, tup.Fields)
+				for _, fieldNo := range fieldNos {
+					fields[fieldNo] = nil
+				}
+				newTuples[i] = &Tuple{*file.Descriptor(), fields, nil}
+			}
+			checker, err := c.getConstraintChecker(ref.table.name)
+			if err != nil {
+				return err
+			}
+			if checker != nil {
+				if err := checker.start(file, tid, matches); err != nil {
+					return err
+				}
+				for _, tup := range newTuples {
+					if err := checker.check(tup); err != nil {
+						return err
+					}
+				}
+			}
+			for i, tup := range matches {
+				if err := file.deleteTuple(tup, tid); err != nil {
+					return err
+				}
+				if err := file.insertTuple(newTuples[i], tid); err != nil {
+					return err
+				}
+			}
+			if err := c.enforceReferences(tid, ref.table.name, matches, newTuples, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
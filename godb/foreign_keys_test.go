@@ -0,0 +1,146 @@
+package godb
+
+import (
+	"testing"
+)
+
+func countRows(t *testing.T, c *Catalog, bp *BufferPool, table string) int64 {
+	t.Helper()
+	res := mustRunSQL(t, c, bp, "select count(*) from "+table)
+	if len(res) == 0 {
+		return 0
+	}
+	return res[0].Fields[0].(IntField).Value
+}
+
+func TestForeignKeyInsert(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "")
+	mustRunSQL(t, c, bp, "create table orders (o_orderkey int primary key, o_custname string)")
+	mustRunSQL(t, c, bp, "create table lineitem (l_orderkey int references orders, l_linenumber int, l_quantity int, primary key (l_orderkey, l_linenumber))")
+	mustRunSQL(t, c, bp, "insert into orders values (1, 'sam'), (2, 'mary'), (3, 'joe')")
+	mustRunSQL(t, c, bp, "insert into lineitem values (1, 1, 10), (1, 2, 20), (2, 1, 30)")
+	expectConstraintViolation(t, c, bp, "insert into lineitem values (4, 1, 10)")
+	expectConstraintViolation(t, c, bp, "update lineitem set l_orderkey = 4 where l_orderkey = 2")
+	mustRunSQL(t, c, bp, "insert into lineitem values (3, 2, 10)")
+	mustRunSQL(t, c, bp, "update lineitem set l_orderkey = 3 where l_orderkey = 2")
+	if countRows(t, c, bp, "lineitem") != 4 {
+		t.Errorf("unexpected number of line items")
+	}
+}
+
+func TestForeignKeyRestrict(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "")
+	mustRunSQL(t, c, bp, "create table orders (o_orderkey int primary key, o_custname string)")
+	mustRunSQL(t, c, bp, "create table lineitem (l_orderkey int references orders on delete restrict, l_linenumber int, l_quantity int, primary key (l_orderkey, l_linenumber))")
+	mustRunSQL(t, c, bp, "insert into orders values (1, 'sam'), (2, 'mary'), (3, 'joe')")
+	mustRunSQL(t, c, bp, "insert into lineitem values (1, 1, 10), (1, 2, 20), (2, 1, 30)")
+	expectConstraintViolation(t, c, bp, "delete from orders where o_orderkey = 1")
+	expectConstraintViolation(t, c, bp, "update orders set o_orderkey = 5 where o_orderkey = 2")
+	if countRows(t, c, bp, "orders") != 3 {
+		t.Fatalf("failed delete removed orders")
+	}
+	mustRunSQL(t, c, bp, "delete from orders where o_orderkey = 3")
+	mustRunSQL(t, c, bp, "update orders set o_custname = 'samuel' where o_orderkey = 1")
+	if _, err := runSQL(c, bp, "drop table orders"); err == nil {
+		t.Errorf("expected error dropping referenced table")
+	}
+}
+
+func TestForeignKeyCascade(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "")
+	mustRunSQL(t, c, bp, "create table orders (o_orderkey int primary key, o_custname string)")
+	mustRunSQL(t, c, bp, "create table lineitem (l_orderkey int references orders on delete cascade, l_linenumber int, l_quantity int, primary key (l_orderkey, l_linenumber))")
+	mustRunSQL(t, c, bp, "insert into orders values (1, 'sam'), (2, 'mary'), (3, 'joe')")
+	mustRunSQL(t, c, bp, "insert into lineitem values (1, 1, 10), (1, 2, 20), (2, 1, 30)")
+	mustRunSQL(t, c, bp, "delete from orders where o_orderkey = 1")
+	if countRows(t, c, bp, "lineitem") != 1 {
+		t.Errorf("expected one line item after cascading delete")
+	}
+
+	// the cascaded deletes are part of the deleting transaction
+	_, op, err := Parse(c, "delete from orders")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	if _, err := runOp(op, tid); err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp.AbortTransaction(tid)
+	if countRows(t, c, bp, "lineitem") != 1 || countRows(t, c, bp, "orders") != 2 {
+		t.Errorf("aborted cascading delete was not rolled back")
+	}
+}
+
+func TestForeignKeySetNull(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "")
+	mustRunSQL(t, c, bp, "create table emp (id int primary key, name string, manager int, foreign key (manager) references emp (id) on delete set null)")
+	// a NULL reference is not checked, and tuples may refer to tuples inserted
+	// earlier in the same statement
+	mustRunSQL(t, c, bp, "insert into emp values (1, 'boss', null), (2, 'sam', 1), (3, 'mary', 2)")
+	mustRunSQL(t, c, bp, "delete from emp where id = 1")
+	res := mustRunSQL(t, c, bp, "select name, manager from emp where id = 2")
+	if len(res) != 1 || res[0].Fields[1] != nil {
+		t.Fatalf("expected manager to be set to null, got %v", res)
+	}
+	res = mustRunSQL(t, c, bp, "select manager from emp where id = 3")
+	if len(res) != 1 || res[0].Fields[0].(IntField).Value != 2 {
+		t.Errorf("unrelated reference changed, got %v", res)
+	}
+}
+
+func TestForeignKeysInCatalog(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "")
+	mustRunSQL(t, c, bp, "create table orders (o_orderkey int primary key, o_custname string)")
+	mustRunSQL(t, c, bp, "create table lineitem (l_orderkey int references orders on delete cascade, l_linenumber int, l_quantity int, primary key (l_orderkey, l_linenumber))")
+	mustRunSQL(t, c, bp, "insert into orders values (1, 'sam'), (2, 'mary'), (3, 'joe')")
+	mustRunSQL(t, c, bp, "insert into lineitem values (1, 1, 10), (1, 2, 20), (2, 1, 30)")
+	// the renamed column is still referenced, so the statement is rejected
+	// before the rename is applied
+	if _, err := runSQL(c, bp, "alter table orders rename column o_orderkey to o_key, drop column o_key"); err == nil {
+		t.Errorf("expected error dropping a referenced column")
+	}
+	mustRunSQL(t, c, bp, "alter table orders rename column o_orderkey to o_key")
+	mustRunSQL(t, c, bp, "alter table orders rename to ord")
+	catString := "ord (o_key int, o_custname string, primary key (o_key))\n" +
+		"lineitem (l_orderkey int, l_linenumber int, l_quantity int, foreign key (l_orderkey) references ord (o_key) on delete cascade, primary key (l_orderkey, l_linenumber))\n"
+	if c.CatalogString() != catString {
+		t.Fatalf("unexpected catalog %q", c.CatalogString())
+	}
+	err := c.SaveToFile("catalog.txt", c.rootPath)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	c2, err := NewCatalogFromFile("catalog.txt", bp, c.rootPath)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if c2.CatalogString() != catString {
+		t.Fatalf("unexpected catalog after reload %q", c2.CatalogString())
+	}
+	mustRunSQL(t, c2, bp, "delete from ord where o_key = 2")
+	if countRows(t, c2, bp, "lineitem") != 2 {
+		t.Errorf("expected cascading delete after reload")
+	}
+}
+
+func TestForeignKeyErrors(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "p (a int not null, b string, primary key (a))\n")
+	for _, sql := range []string{
+		"create table ch (x int references nosuch)",
+		"create table ch (x string references p)",
+		"create table ch (x int references p (b))",
+		"create table ch (x int, y int, foreign key (x, y) references p)",
+		"create table ch (x int references p on delete frobnicate)",
+		"create table ch (x int references p on update cascade)",
+	} {
+		if _, err := runSQL(c, bp, sql); err == nil {
+			t.Errorf("expected error for %s", sql)
+		}
+	}
+	mustRunSQL(t, c, bp, "create table ch (x int references p)")
+	if _, err := runSQL(c, bp, "alter table p drop column a"); err == nil {
+		t.Errorf("expected error dropping referenced column")
+	}
+}
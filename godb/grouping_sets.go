@@ -0,0 +1,270 @@
+package godb
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// The most arguments of CUBE, which groups by every subset of them
+const maxCubeArgs = 12
+
+// The sql parser parses ROLLUP(...), CUBE(...) and GROUPING(...) as function
+// calls, but not GROUPING SETS, or the empty grouping set (), so before a
+// query is parsed
+//
+//	GROUPING SETS ((a, b), a, ())
+//
+// is rewritten into a call of the pseudo function __grouping_sets, whose empty
+// sets are calls of __empty:
+//
+//	__grouping_sets((a, b), a, __empty())
+func rewriteGroupingSets(query string) string {
+	toks := tokenizeQuery(query)
+	var rewritten strings.Builder
+	last := 0
+	for i := 0; i+2 < len(toks); i++ {
+		if !toks[i].is(query, "grouping") || !toks[i+1].is(query, "sets") || toks[i+2].typ != '(' {
+			continue
+		}
+		end := matchingParen(toks, i+2)
+		if end < 0 {
+			return query // let the parser report the error
+		}
+		rewritten.WriteString(query[last:toks[i].start])
+		rewritten.WriteString("__grouping_sets")
+		last = toks[i+1].end
+		for j := i + 3; j < end; j++ {
+			if toks[j].typ == '(' && toks[j+1].typ == ')' && toks[j-1].typ < 256 {
+				rewritten.WriteString(query[last:toks[j].start])
+				rewritten.WriteString("__empty()")
+				last = toks[j+1].end
+			}
+		}
+		i = end
+	}
+	if last == 0 {
+		return query
+	}
+	rewritten.WriteString(query[last:])
+	return rewritten.String()
+}
+
+// Return an error if s has ROLLUP, CUBE or GROUPING SETS anywhere but as an
+// element of its GROUP BY clause
+func checkGroupingSetsPlacement(s *sqlparser.Select) error {
+	return sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch node := node.(type) {
+		case sqlparser.GroupBy:
+			return false, nil
+		case *sqlparser.FuncExpr:
+			switch node.Name.Lowered() {
+			case "rollup", "cube", "__grouping_sets", "__empty":
+				return false, GoDBError{ParseError, "ROLLUP, CUBE and GROUPING SETS are only supported in GROUP BY"}
+			}
+		case *sqlparser.Subquery:
+			return false, nil
+		}
+		return true, nil
+	}, s)
+}
+
+// Parse a GROUP BY clause.  Return its distinct expressions, and, if it has
+// ROLLUP, CUBE or GROUPING SETS, the sets of them (as indices) to group by;
+// otherwise the sets are nil.  As in SQL, the sets of a clause with several
+// elements are the concatenations of a set of each element, so that GROUP BY
+// a, ROLLUP(b, c) groups by (a, b, c), (a, b) and (a).
+func parseGroupBy(c *Catalog, groupBy sqlparser.GroupBy) ([]*GroupBy, [][]int, error) {
+	var groupBys []*GroupBy
+	indices := make(map[string]int)
+	index := func(expr sqlparser.Expr) (int, error) {
+		for {
+			paren, ok := expr.(*sqlparser.ParenExpr)
+			if !ok {
+				break
+			}
+			expr = paren.Expr
+		}
+		key := sqlparser.String(expr)
+		if i, ok := indices[key]; ok {
+			return i, nil
+		}
+		node, err := parseExpr(c, expr, "")
+		if err != nil {
+			return 0, err
+		}
+		indices[key] = len(groupBys)
+		groupBys = append(groupBys, &GroupBy{node})
+		return indices[key], nil
+	}
+	// the sets of indices of the arguments of f; an argument that is a
+	// parenthesized list of expressions is a single set
+	args := func(f *sqlparser.FuncExpr) ([][]int, error) {
+		var units [][]int
+		for _, arg := range f.Exprs {
+			aliased, ok := arg.(*sqlparser.AliasedExpr)
+			if !ok {
+				return nil, GoDBError{ParseError, fmt.Sprintf("unexpected %s in GROUP BY", sqlparser.String(arg))}
+			}
+			exprs := sqlparser.Exprs{aliased.Expr}
+			if tuple, ok := aliased.Expr.(sqlparser.ValTuple); ok {
+				exprs = sqlparser.Exprs(tuple)
+			}
+			var unit []int
+			for _, expr := range exprs {
+				i, err := index(expr)
+				if err != nil {
+					return nil, err
+				}
+				unit = append(unit, i)
+			}
+			units = append(units, unit)
+		}
+		return units, nil
+	}
+	concat := func(units [][]int) []int {
+		set := []int{}
+		for _, unit := range units {
+			set = append(set, unit...)
+		}
+		return set
+	}
+
+	// the sets of an element of the clause, or of GROUPING SETS
+	var elementSets func(expr sqlparser.Expr) ([][]int, error)
+	elementSets = func(expr sqlparser.Expr) ([][]int, error) {
+		f, ok := expr.(*sqlparser.FuncExpr)
+		if !ok {
+			if tuple, ok := expr.(sqlparser.ValTuple); ok {
+				units, err := args(&sqlparser.FuncExpr{Exprs: sqlparser.SelectExprs{&sqlparser.AliasedExpr{Expr: tuple}}})
+				if err != nil {
+					return nil, err
+				}
+				return [][]int{concat(units)}, nil
+			}
+			i, err := index(expr)
+			return [][]int{{i}}, err
+		}
+		switch strings.ToLower(f.Name.String()) {
+		case "rollup":
+			units, err := args(f)
+			if err != nil {
+				return nil, err
+			}
+			var sets [][]int
+			for n := len(units); n >= 0; n-- {
+				sets = append(sets, concat(units[:n]))
+			}
+			return sets, nil
+		case "cube":
+			units, err := args(f)
+			if err != nil {
+				return nil, err
+			}
+			if len(units) > maxCubeArgs {
+				return nil, GoDBError{ParseError, fmt.Sprintf("CUBE is limited to %d elements", maxCubeArgs)}
+			}
+			// each subset, in the order of the bits of a decreasing mask
+			var sets [][]int
+			for mask := 1<<len(units) - 1; mask >= 0; mask-- {
+				var subset [][]int
+				for j, unit := range units {
+					if mask&(1<<(len(units)-1-j)) != 0 {
+						subset = append(subset, unit)
+					}
+				}
+				sets = append(sets, concat(subset))
+			}
+			return sets, nil
+		case "__empty":
+			return [][]int{{}}, nil
+		case "__grouping_sets":
+			var sets [][]int
+			for _, arg := range f.Exprs {
+				aliased, ok := arg.(*sqlparser.AliasedExpr)
+				if !ok {
+					return nil, GoDBError{ParseError, fmt.Sprintf("unexpected %s in GROUPING SETS", sqlparser.String(arg))}
+				}
+				argSets, err := elementSets(aliased.Expr)
+				if err != nil {
+					return nil, err
+				}
+				sets = append(sets, argSets...)
+			}
+			return sets, nil
+		}
+		i, err := index(expr)
+		return [][]int{{i}}, err
+	}
+
+	sets := [][]int{{}}
+	hasSets := false
+	for _, expr := range groupBy {
+		if f, ok := expr.(*sqlparser.FuncExpr); ok {
+			switch strings.ToLower(f.Name.String()) {
+			case "rollup", "cube", "__grouping_sets":
+				hasSets = true
+			}
+		}
+		exprSets, err := elementSets(expr)
+		if err != nil {
+			return nil, nil, err
+		}
+		var product [][]int
+		for _, set := range sets {
+			for _, exprSet := range exprSets {
+				product = append(product, append(append([]int{}, set...), exprSet...))
+			}
+		}
+		sets = product
+	}
+	if !hasSets {
+		return groupBys, nil, nil
+	}
+	return groupBys, sets, nil
+}
+
+// Return the GROUPING() calls of a select list expression
+func extractGroupings(s *LogicalSelectNode) []*LogicalSelectNode {
+	if s.exprType != ExprFunc {
+		return nil
+	}
+	if *s.funcOp == "grouping" {
+		return []*LogicalSelectNode{s}
+	}
+	var groupings []*LogicalSelectNode
+	for _, arg := range s.args {
+		groupings = append(groupings, extractGroupings(arg)...)
+	}
+	return groupings
+}
+
+// Return, for each of the GROUPING() calls groupings, the indices in gbys of
+// its arguments, whose expressions are generated over the input desc of the
+// aggregation
+func groupingArgs(c *Catalog, groupings []*LogicalSelectNode, gbys []Expr, desc *TupleDesc, tableMap map[string]*PlanNode) ([][]int, error) {
+	var args [][]int
+	for _, g := range groupings {
+		if len(g.args) == 0 || len(g.args) > 63 {
+			return nil, GoDBError{ParseError, "GROUPING must have between 1 and 63 arguments"}
+		}
+		var indices []int
+	argLoop:
+		for _, arg := range g.args {
+			expr, _, err := arg.generateExpr(c, desc, tableMap)
+			if err != nil {
+				return nil, err
+			}
+			for i, gby := range gbys {
+				if exprToStr(gby) == exprToStr(expr) {
+					indices = append(indices, i)
+					continue argLoop
+				}
+			}
+			return nil, GoDBError{ParseError, fmt.Sprintf("argument %s of GROUPING is not a GROUP BY expression", exprToStr(expr))}
+		}
+		args = append(args, indices)
+	}
+	return args, nil
+}
@@ -0,0 +1,58 @@
+package godb
+
+import (
+	"testing"
+)
+
+func TestRollupCube(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "sales (region string, product string, amount int)\n")
+	mustRunSQL(t, c, bp, "insert into sales values ('east', 'a', 10), ('east', 'b', 20), ('west', 'a', 30), ('west', 'a', 5), ('west', 'b', 40)")
+	expectRows(t, c, bp, "select region, product, sum(amount), grouping(region, product) as g from sales group by rollup(region, product) order by g, region, product",
+		"east,a,10,0", "east,b,20,0", "west,a,35,0", "west,b,40,0", "east,null,30,1", "west,null,75,1", "null,null,105,3")
+	expectRows(t, c, bp, "select region, product, count(*), grouping(product), grouping(region) from sales group by cube(region, product) order by region, product",
+		"null,null,5,1,1", "null,a,3,0,1", "null,b,2,0,1", "east,null,2,1,0", "east,a,1,0,0", "east,b,1,0,0", "west,null,3,1,0", "west,a,2,0,0", "west,b,1,0,0")
+}
+
+func TestGroupingSets(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "sales (region string, product string, amount int)\n")
+	mustRunSQL(t, c, bp, "insert into sales values ('east', 'a', 10), ('east', 'b', 20), ('west', 'a', 30), ('west', 'a', 5), ('west', 'b', 40)")
+	expectRows(t, c, bp, "select region, product, sum(amount), grouping(region, product) as g from sales group by grouping sets ((region, product), (product), ()) order by g, region, product",
+		"east,a,10,0", "east,b,20,0", "west,a,35,0", "west,b,40,0", "null,a,45,2", "null,b,60,2", "null,null,105,3")
+	// the sets of several elements are concatenated
+	expectRows(t, c, bp, "select region, product, max(amount) from sales group by region, rollup(product) order by region, product",
+		"east,null,20", "east,a,10", "east,b,20", "west,null,40", "west,a,30", "west,b,40")
+	// a parenthesized list is a single element of ROLLUP
+	expectRows(t, c, bp, "select region, product, count(*) from sales group by rollup((region, product)) order by region, product",
+		"null,null,5", "east,a,1", "east,b,1", "west,a,2", "west,b,1")
+	// HAVING applies to the groups of every set
+	expectRows(t, c, bp, "select region, sum(amount) as s from sales group by rollup(region) having sum(amount) > 50 order by s",
+		"west,75", "null,105")
+	// GROUPING SETS in a string literal is not a grouping
+	expectRows(t, c, bp, "select product, count(*) from sales where region <> 'grouping sets (()' group by grouping sets ((product)) order by product", "a,3", "b,2")
+	// GROUPING is 0 for an ordinary GROUP BY
+	expectRows(t, c, bp, "select region, grouping(region) from sales group by region order by region", "east,0", "west,0")
+}
+
+func TestGroupingSetsNulls(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "sales (region string, product string, amount int)\n")
+	mustRunSQL(t, c, bp, "insert into sales values ('east', 'a', 10), ('east', 'b', 20), ('west', 'a', 30), ('west', 'a', 5), ('west', 'b', 40)")
+	// the grand total of an empty input is a single group
+	expectRows(t, c, bp, "select region, count(*), grouping(region) from sales where amount > 100 group by rollup(region)", "null,0,1")
+	// a NULL region is a different group than the total of all regions
+	mustRunSQL(t, c, bp, "insert into sales values (null, 'a', 1)")
+	expectRows(t, c, bp, "select region, sum(amount), grouping(region) as g from sales group by rollup(region) order by g, region",
+		"null,1,0", "east,30,0", "west,75,0", "null,106,1")
+
+	for _, sql := range []string{
+		"select product, grouping(region) from sales group by rollup(product)",
+		"select grouping(region) from sales",
+		"select region from sales group by grouping sets ((region), (amount, )",
+		"select region from sales where grouping sets ((region)) = 1 group by region",
+		"select rollup(region) from sales group by region",
+		"select region from sales group by region order by cube(region)",
+	} {
+		if _, err := runSQL(c, bp, sql); err == nil {
+			t.Errorf("expected error for %s", sql)
+		}
+	}
+}
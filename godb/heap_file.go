@@ -326,6 +326,11 @@ func (f *HeapFile) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 
 	// TODO: some code goes here
     pageNo := 0
+    if f.numPages == 0 {
+        return func() (*Tuple, error) {
+            return nil, nil
+        }, nil
+    }
     p, err := f.bufPool.GetPage(f, pageNo, tid, ReadPerm)
     if err != nil {
         return func() (*Tuple, error) {
@@ -350,7 +355,13 @@ func (f *HeapFile) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
                 t, err = iter()
             }
         }
-        return t, err
+        if err != nil {
+            return nil, err
+        }
+        // the tuples cached in pages keep the descriptor they were read or
+        // inserted with; label them with the file's, whose table qualifier
+        // is the name the query refers to the table by
+        return &Tuple{*f.td, t.Fields, t.Rid}, nil
 	}, nil
 
 }
@@ -27,7 +27,8 @@ unsafe.Sizeof() to determine the size in bytes of an object.  So, a GoDB integer
 (represented as an int64) requires unsafe.Sizeof(int64(0)) bytes.  For strings,
 we encode them as byte arrays of StringLength, so they are size
 ((int)(unsafe.Sizeof(byte('a')))) * StringLength bytes.  The size in bytes  of a
-tuple is just the sum of the size in bytes of its fields.
+tuple is the sum of the size in bytes of its fields, plus a bitmap with one bit
+per field recording which fields are NULL.
 
 Once you have figured out how big a record is, you can determine the number of
 slots on on the page as:
@@ -73,6 +74,7 @@ func newHeapPage(desc *TupleDesc, pageNo int, f *HeapFile) *heapPage {
             tupleSize += ((int32)(unsafe.Sizeof(byte('a')))) * (int32)(StringLength)
         }
     }
+    tupleSize += (int32)(nullBitmapSize(len(desc.Fields)))
     var numSlots int32 = (int32)(PageSize - 8) / tupleSize
     tuples := make([](*Tuple), numSlots)
     for i, _ := range tuples {
@@ -219,6 +221,7 @@ func (p *heapPage) tupleIter() func() (*Tuple, error) {
             return nil, nil
         } else {
             ret := p.tuples[rid]
+            ret.Rid = RecordID{pageNo: p.pageNo, slotNo: rid}
             rid++
             return ret, nil
         }
@@ -0,0 +1,101 @@
+package godb
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// A HyperLogLog sketch estimates the number of distinct values added to it in
+// a fixed amount of space (Flajolet et al., "HyperLogLog: the analysis of a
+// near-optimal cardinality estimation algorithm", 2007).  The first
+// hllPrecision bits of the hash of each value choose one of its registers,
+// which records the largest position of the first 1 bit in the remaining
+// bits of the hashes it has seen.  The standard error of the estimate is
+// 1.04 / sqrt(hllRegisters), about 3%.
+type hyperLogLog struct {
+	registers []uint8
+}
+
+const (
+	hllPrecision = 10
+	hllRegisters = 1 << hllPrecision
+)
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{make([]uint8, hllRegisters)}
+}
+
+// Return a 64 bit hash of the non-NULL value v
+func hashValue(v DBValue) uint64 {
+	h := fnv.New64a()
+	switch v := v.(type) {
+	case IntField:
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], uint64(v.Value))
+		h.Write(buf[:])
+	case StringField:
+		h.Write([]byte(v.Value))
+	}
+	// FNV does not mix its low bits into its high bits well enough for
+	// consecutive integers, so finish with the mixer of SplitMix64
+	x := h.Sum64()
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// Add the non-NULL value v to the sketch
+func (s *hyperLogLog) add(v DBValue) {
+	h := hashValue(v)
+	register := h >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(h<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	if rank > s.registers[register] {
+		s.registers[register] = rank
+	}
+}
+
+// Add the values that have been added to o to the sketch
+func (s *hyperLogLog) merge(o *hyperLogLog) {
+	for i, rank := range o.registers {
+		if rank > s.registers[i] {
+			s.registers[i] = rank
+		}
+	}
+}
+
+// Return the estimated number of distinct values added to the sketch
+func (s *hyperLogLog) estimate() float64 {
+	sum := 0.0
+	zeros := 0
+	for _, r := range s.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	m := float64(hllRegisters)
+	e := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// small cardinalities are estimated better by counting empty registers
+	if e <= 2.5*m && zeros > 0 {
+		e = m * math.Log(m/float64(zeros))
+	}
+	return e
+}
+
+// Return the registers of the sketch as a hexadecimal string
+func (s *hyperLogLog) String() string {
+	return hex.EncodeToString(s.registers)
+}
+
+// Return the sketch whose registers are encoded by str, as returned by
+// [hyperLogLog.String]
+func parseHyperLogLog(str string) (*hyperLogLog, error) {
+	registers, err := hex.DecodeString(str)
+	if err != nil || len(registers) != hllRegisters {
+		return nil, GoDBError{ParseError, "malformed distinct value sketch"}
+	}
+	return &hyperLogLog{registers}, nil
+}
@@ -5,13 +5,15 @@ type InsertOp struct {
 	// TODO: some code goes here
     file DBFile
     child Operator
+    constraints *constraintChecker // may be nil, if the table has no constraints
+    stats *statsUpdater // may be nil, if the table has not been analyzed
 }
 
 // Construtor.  The insert operator insert the records in the child
 // Operator into the specified DBFile.
 func NewInsertOp(insertFile DBFile, child Operator) *InsertOp {
 	// TODO: some code goes here
-    return &InsertOp{insertFile, child}
+    return &InsertOp{insertFile, child, nil, nil}
 }
 
 // The insert TupleDesc is a one column descriptor with an integer field named "count"
@@ -35,19 +37,52 @@ func (iop *InsertOp) Iterator(tid TransactionID) (func() (*Tuple, error), error)
     if err != nil {
         return nil, err
     }
+    if iop.constraints != nil {
+        err = iop.constraints.start(iop.file, tid, nil)
+        if err != nil {
+            return nil, err
+        }
+    }
+    var stats *statsDelta
+    if iop.stats != nil {
+        stats = iop.stats.newDelta()
+    }
     count := 0
     for t, err := childIter(); t != nil || err != nil; t, err = childIter() {
         if err != nil {
             return nil, err
         }
-        err = iop.file.insertTuple(t, tid)
+        // the child's tuples (e.g., from a ValueOp) may not carry the names
+        // of the file's columns, so store them with the file's descriptor
+        if len(t.Fields) != len(iop.file.Descriptor().Fields) {
+            return nil, GoDBError{MalformedDataError, "number of fields does not match table"}
+        }
+        newT := &Tuple{*iop.file.Descriptor(), t.Fields, nil}
+        if iop.constraints != nil {
+            err = iop.constraints.check(newT)
+            if err != nil {
+                return nil, err
+            }
+        }
+        err = iop.file.insertTuple(newT, tid)
         if err != nil {
             return nil, err
         }
+        if stats != nil {
+            stats.add(newT, 1)
+        }
         count++
     }
+    if stats != nil && count > 0 {
+        iop.stats.applyAtCommit(tid, stats)
+    }
 
+    done := false
     return func() (*Tuple, error) {
+        if done {
+            return nil, nil
+        }
+        done = true
         ret := Tuple{}
         ret.Desc = *iop.Descriptor()
         ret.Fields = []DBValue{}
@@ -0,0 +1,59 @@
+package godb
+
+import (
+	"testing"
+)
+
+func TestInsertDefaults(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "")
+	mustRunSQL(t, c, bp, "create table t (id int, name varchar(20) default 'anon', age int default -1, score int default (10 * 3), note string)")
+	mustRunSQL(t, c, bp, "insert into t (id) values (1)")
+	mustRunSQL(t, c, bp, "insert into t (note, id, age) values ('hi', 2, 40)")
+	mustRunSQL(t, c, bp, "insert into t values (3, default, 50, default, null)")
+
+	res := mustRunSQL(t, c, bp, "select id, name, age, score, note from t order by id")
+	expected := []string{"1,anon,-1,30,null", "2,anon,40,30,hi", "3,anon,50,30,null"}
+	if len(res) != len(expected) {
+		t.Fatalf("expected %d tuples, got %d", len(expected), len(res))
+	}
+	for i, tup := range res {
+		if tup.PrettyPrintString(false) != expected[i] {
+			t.Errorf("expected %s, got %s", expected[i], tup.PrettyPrintString(false))
+		}
+	}
+
+	// defaults are recorded in the catalog
+	catString := "t (id int, name string default 'anon', age int default -1, score int default 10 * 3, note string)\n"
+	if c.CatalogString() != catString {
+		t.Errorf("unexpected catalog %q", c.CatalogString())
+	}
+}
+
+func TestInsertSelectColumnList(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "t (name string, age int)\n")
+	mustRunSQL(t, c, bp, "insert into t values ('sam', 25), ('george jones', 999), ('mary', 30)")
+	mustRunSQL(t, c, bp, "create table u (age int, name string default 'x', id int default 7)")
+	mustRunSQL(t, c, bp, "insert into u (name, age) select name, age from t")
+	res := mustRunSQL(t, c, bp, "select sum(age), sum(id) from u")
+	if res[0].Fields[0].(IntField).Value != 25+999+30 || res[0].Fields[1].(IntField).Value != 21 {
+		t.Errorf("unexpected sums %v", res[0].Fields)
+	}
+}
+
+func TestInsertColumnListErrors(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "")
+	mustRunSQL(t, c, bp, "create table t (id int, name string)")
+	for _, sql := range []string{
+		"insert into t (id, nosuch) values (1, 'a')",
+		"insert into t (id, id) values (1, 2)",
+		"insert into t (id) values (1, 'a')",
+		"insert into t values (1)",
+		"create table u (id int default 'a')",
+		"create table u (id int default id)",
+		"create table u (id int default)",
+	} {
+		if _, err := runSQL(c, bp, sql); err == nil {
+			t.Errorf("expected error for %s", sql)
+		}
+	}
+}
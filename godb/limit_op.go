@@ -1,44 +1,82 @@
 package godb
 
+import "fmt"
+
 type LimitOp struct {
 	child     Operator //required fields for parser
 	limitTups Expr
 	//add additional fields here, if needed
+	offsetTups Expr // the number of tuples to skip first; nil for none
 }
 
 // Limit constructor -- should save how many tuples to return and the child op.
 // lim is how many tuples to return and child is the child op.
 func NewLimitOp(lim Expr, child Operator) *LimitOp {
-	// TODO: some code goes here
-    return &LimitOp{child, lim}
+	return &LimitOp{child, lim, nil}
+}
+
+// Constructor for a limit that skips the first offset tuples of child, if
+// offset is not nil, and returns the next lim
+func NewLimitOffsetOp(lim Expr, offset Expr, child Operator) *LimitOp {
+	return &LimitOp{child, lim, offset}
 }
 
 // Return a TupleDescriptor for this limit
 func (l *LimitOp) Descriptor() *TupleDesc {
-	// TODO: some code goes here
-    return l.child.Descriptor()
+	return l.child.Descriptor()
+}
+
+// Return the value of the LIMIT or OFFSET expression e, which must be a
+// non-negative integer, or 0 if e is nil
+func evalLimit(e Expr, clause string) (int64, error) {
+	if e == nil {
+		return 0, nil
+	}
+	v, err := e.EvalExpr(nil)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := v.(IntField)
+	if !ok || n.Value < 0 {
+		return 0, GoDBError{TypeMismatchError, fmt.Sprintf("%s must be a non-negative integer", clause)}
+	}
+	return n.Value, nil
 }
 
 // Limit operator implementation. This function should iterate over the
 // results of the child iterator, and limit the result set to the first
-// [lim] tuples it sees (where lim is specified in the constructor).
+// [lim] tuples it sees (where lim is specified in the constructor), after
+// skipping the first offset tuples.
 func (l *LimitOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
-	// TODO: some code goes here
-    childIter, err := l.child.Iterator(tid)
-    if err != nil {
-        return nil, err
-    }
-
-    var count int64 = 0
-    return func() (*Tuple, error) {
-        for t, err := childIter(); t != nil || err != nil; t, err = childIter() {
-            limit, _ := l.limitTups.EvalExpr(t)
-            if count == limit.(IntField).Value {
-                break
-            }
-            count++
-            return t, nil
-        }
-        return nil, nil
-    }, nil
+	limit, err := evalLimit(l.limitTups, "LIMIT")
+	if err != nil {
+		return nil, err
+	}
+	offset, err := evalLimit(l.offsetTups, "OFFSET")
+	if err != nil {
+		return nil, err
+	}
+	childIter, err := l.child.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+
+	var count int64 = 0
+	return func() (*Tuple, error) {
+		for ; offset > 0; offset-- {
+			t, err := childIter()
+			if err != nil || t == nil {
+				return nil, err
+			}
+		}
+		if count == limit {
+			return nil, nil
+		}
+		t, err := childIter()
+		if err != nil || t == nil {
+			return nil, err
+		}
+		count++
+		return t, nil
+	}, nil
 }
@@ -0,0 +1,93 @@
+package godb
+
+import (
+	"testing"
+)
+
+func TestNullComparisons(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "")
+	mustRunSQL(t, c, bp, "create table emp (id int, name string, dept int)")
+	mustRunSQL(t, c, bp, "insert into emp values (1, 'sam', 10), (2, 'mary', 20), (3, 'joe', null), (4, null, 10)")
+
+	// comparisons involving NULL are never true
+	res := mustRunSQL(t, c, bp, "select id from emp where dept < 100")
+	if len(res) != 3 {
+		t.Errorf("expected three tuples with a non-null dept, got %d", len(res))
+	}
+	res = mustRunSQL(t, c, bp, "select id from emp where name <> 'sam'")
+	if len(res) != 2 {
+		t.Errorf("expected two tuples with a name other than sam, got %d", len(res))
+	}
+
+	// NULLs sort before all other values
+	res = mustRunSQL(t, c, bp, "select dept, id from emp order by dept, id")
+	var ids []int64
+	for _, tup := range res {
+		ids = append(ids, tup.Fields[1].(IntField).Value)
+	}
+	if len(ids) != 4 || ids[0] != 3 || ids[1] != 1 || ids[2] != 4 || ids[3] != 2 {
+		t.Errorf("unexpected order %v", ids)
+	}
+	res = mustRunSQL(t, c, bp, "select dept, id from emp order by dept desc, id")
+	if len(res) != 4 || res[3].Fields[1].(IntField).Value != 3 {
+		t.Errorf("expected the null dept last in descending order, got %v", res)
+	}
+}
+
+func TestNullJoins(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "")
+	mustRunSQL(t, c, bp, "create table emp (id int, dept int)")
+	mustRunSQL(t, c, bp, "create table dept (d_id int, d_name string)")
+	mustRunSQL(t, c, bp, "insert into emp values (1, 10), (2, null), (3, 20)")
+	mustRunSQL(t, c, bp, "insert into dept values (10, 'eecs'), (null, 'none'), (20, 'math')")
+
+	// NULLs are not equal to anything, including other NULLs
+	res := mustRunSQL(t, c, bp, "select id, d_name from emp, dept where dept = d_id")
+	if len(res) != 2 {
+		t.Errorf("expected two joined tuples, got %d", len(res))
+	}
+	for _, tup := range res {
+		if tup.Fields[0].(IntField).Value == 2 {
+			t.Errorf("tuple with a null key was joined: %v", tup.Fields)
+		}
+	}
+}
+
+func TestNullAggregates(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "")
+	mustRunSQL(t, c, bp, "create table emp (id int, dept int, age int)")
+	mustRunSQL(t, c, bp, "insert into emp values (1, 1, 20), (2, 1, null), (3, 2, 40), (4, 3, null)")
+
+	// COUNT(expr), SUM, AVG, MAX and MIN skip NULLs, while COUNT(*) counts
+	// every tuple
+	res := mustRunSQL(t, c, bp, "select count(*), count(age), sum(age), avg(age), max(age), min(age) from emp")
+	if res[0].PrettyPrintString(false) != "4,2,60,30,40,20" {
+		t.Errorf("unexpected aggregates %s", res[0].PrettyPrintString(false))
+	}
+
+	// aggregates other than COUNT of only NULLs, or of no values, are NULL
+	res = mustRunSQL(t, c, bp, "select count(age), sum(age), avg(age), max(age), min(age) from emp where dept = 3")
+	if res[0].PrettyPrintString(false) != "0,null,null,null,null" {
+		t.Errorf("unexpected aggregates of nulls %s", res[0].PrettyPrintString(false))
+	}
+	res = mustRunSQL(t, c, bp, "select dept, count(*), count(age), sum(age) from emp group by dept order by dept")
+	var got []string
+	for _, tup := range res {
+		got = append(got, tup.PrettyPrintString(false))
+	}
+	if len(got) != 3 || got[0] != "1,2,1,20" || got[1] != "2,1,1,40" || got[2] != "3,1,0,null" {
+		t.Errorf("unexpected grouped aggregates %v", got)
+	}
+}
+
+func TestNullFunctions(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "")
+	mustRunSQL(t, c, bp, "create table emp (id int, age int)")
+	mustRunSQL(t, c, bp, "insert into emp values (1, 20), (2, null)")
+
+	// functions of NULL are NULL
+	res := mustRunSQL(t, c, bp, "select id, age + 1 from emp order by id")
+	if len(res) != 2 || res[0].Fields[1].(IntField).Value != 21 || res[1].Fields[1] != nil {
+		t.Errorf("unexpected function results %v", res)
+	}
+}
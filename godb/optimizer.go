@@ -0,0 +1,393 @@
+package godb
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// The optimizer chooses the order in which the tables and subqueries of a
+// query (its relations) are joined, and, for each join, which of its inputs
+// is the build side of the hash join (the right child of an EqualityJoin,
+// which is loaded into memory JoinBufferSize tuples at a time) and which the
+// probe side (the left child, which is scanned once per batch of the build
+// side).  Every equality join is a hash join, so the build side is the only
+// choice of how a join is carried out.
+//
+// It estimates the number of tuples of each relation from the statistics of
+// its table (see table_stats.go) and the selectivities of the filters pushed
+// down to it, and the number of tuples of a join as the product of those of
+// its inputs and the selectivities of its join predicates, which are
+// 1 / max(distinct values of either side).  The cost of a plan is the number
+// of tuples that its operators read, build into hash tables and produce.
+//
+// Plans are enumerated as in System R: for each set of relations, in order of
+// size, the cheapest plan that joins the set is found by joining the
+// cheapest plan for a subset with one more relation, on either side.  Only
+// relations connected by join predicates are joined.  Cross products are
+// placed as late as possible: each set of relations connected by join
+// predicates is joined first, and the results of the sets are then crossed,
+// largest first, so that the smaller results are the buffered right children
+// of the CrossProducts.
+
+// The most relations whose join order is optimized; the joins and cross
+// products of queries with more are applied in the order of the query
+const maxJoinRelations = 12
+
+// A relation of a query, with the filters pushed down to it
+type joinRelation struct {
+	name  string // the name or alias of its table or subquery
+	op    Operator
+	stats *TableStats // the statistics of its table, or nil for a subquery
+	cost  float64     // the cost of scanning it
+	rows  float64     // the estimated number of tuples after its filters
+}
+
+// A join predicate of a query, between relations left and right
+type joinEdge struct {
+	join        *LogicalJoinNode
+	left, right int
+	selectivity float64
+}
+
+// The cheapest plan found for a set of relations
+type joinPlan struct {
+	cost, rows float64
+	rest       int  // the set of relations joined before the last one, or 0 for a single relation
+	last       int  // the relation joined last
+	lastBuild  bool // whether the last relation is the build side of its join
+	edge       *joinEdge
+}
+
+// Return the join predicates of plan, in the order in which makePhysicalPlan
+// should apply them, with the sides of each predicate swapped as needed so
+// that its left side is the probe side of the join, and the names of the
+// relations of plan, in the order in which the results of the joins should
+// be crossed.  Predicates between relations that have already been joined
+// become filters.  The filters of plan must have been pushed down to the
+// relations of tableMap.
+func orderJoins(c *Catalog, plan *LogicalPlan, tableMap map[string]*PlanNode) ([]*LogicalJoinNode, []string, error) {
+	rels, relIndex, err := joinRelations(c, plan, tableMap)
+	if err != nil {
+		return nil, nil, err
+	}
+	var names []string
+	for _, rel := range rels {
+		names = append(names, rel.name)
+	}
+	if len(rels) > maxJoinRelations {
+		return plan.joins, names, nil
+	}
+	var edges []*joinEdge
+	var local []*LogicalJoinNode // predicates within a single relation
+	for _, j := range plan.joins {
+		var ends [2]int
+		for i, side := range []*LogicalSelectNode{j.left, j.right} {
+			tabName, fieldName, err := side.getTableField(c, plan.subqueries, plan.tables)
+			if err != nil {
+				return nil, nil, err
+			}
+			node, err := fieldToOp(tabName, fieldName, tableMap)
+			if err != nil {
+				return nil, nil, err
+			}
+			ends[i] = relIndex[node.op]
+		}
+		if ends[0] == ends[1] {
+			local = append(local, j)
+			continue
+		}
+		left, right := rels[ends[0]], rels[ends[1]]
+		ndv := math.Max(columnDistinct(left, j.left), columnDistinct(right, j.right))
+		edges = append(edges, &joinEdge{j, ends[0], ends[1], 1 / math.Max(ndv, 1)})
+	}
+
+	plans := make([]*joinPlan, 1<<len(rels))
+	for i, rel := range rels {
+		plans[1<<i] = &joinPlan{cost: rel.cost, rows: rel.rows, last: i}
+	}
+	for set := 1; set < len(plans); set++ {
+		if bits.OnesCount(uint(set)) < 2 {
+			continue
+		}
+		for r := range rels {
+			rest := set &^ (1 << r)
+			if rest == set || plans[rest] == nil {
+				continue
+			}
+			// the predicates between rest and r
+			var first *joinEdge
+			rows := plans[rest].rows * rels[r].rows
+			for _, e := range edges {
+				if (e.left == r && rest&(1<<e.right) != 0) || (e.right == r && rest&(1<<e.left) != 0) {
+					if first == nil {
+						first = e
+					}
+					rows *= e.selectivity
+				}
+			}
+			if first == nil {
+				continue
+			}
+			single := plans[1<<r]
+			for _, build := range []bool{true, false} {
+				var cost float64
+				if build {
+					cost = hashJoinCost(plans[rest], single, rows)
+				} else {
+					cost = hashJoinCost(single, plans[rest], rows)
+				}
+				if plans[set] == nil || cost < plans[set].cost {
+					plans[set] = &joinPlan{cost, rows, rest, r, build, first}
+				}
+			}
+		}
+	}
+
+	// the sets of relations connected by join predicates, largest first
+	component := make([]int, len(rels))
+	for i := range rels {
+		component[i] = 1 << i
+	}
+	for _, e := range edges {
+		merged := component[e.left] | component[e.right]
+		for i := range rels {
+			if merged&(1<<i) != 0 {
+				component[i] = merged
+			}
+		}
+	}
+	var components []int
+	for i, set := range component {
+		if bits.TrailingZeros(uint(set)) == i {
+			components = append(components, set)
+		}
+	}
+	sort.SliceStable(components, func(i, j int) bool {
+		return plans[components[i]].rows > plans[components[j]].rows
+	})
+
+	var joins []*LogicalJoinNode
+	var addJoins func(set int)
+	addJoins = func(set int) {
+		p := plans[set]
+		if p.rest == 0 {
+			return
+		}
+		addJoins(p.rest)
+		// the left side of the predicate is the probe side
+		j := p.edge.join
+		if (p.edge.left == p.last) == p.lastBuild {
+			j = &LogicalJoinNode{j.right, j.left, j.predOp}
+		}
+		joins = append(joins, j)
+		for _, e := range edges {
+			if e != p.edge && (e.left == p.last || e.right == p.last) && set&(1<<e.left) != 0 && set&(1<<e.right) != 0 {
+				joins = append(joins, e.join)
+			}
+		}
+	}
+	names = names[:0]
+	for _, set := range components {
+		addJoins(set)
+		names = append(names, rels[bits.TrailingZeros(uint(set))].name)
+	}
+	return append(joins, local...), names, nil
+}
+
+// The cost of adding a tuple to the hash table of a join, relative to that of
+// reading or probing with one
+const hashBuildCost = 2
+
+// Return the cost of a hash join of probe and build that produces rows
+// tuples.  The probe side is scanned once per batch of JoinBufferSize tuples
+// of the build side.
+func hashJoinCost(probe, build *joinPlan, rows float64) float64 {
+	batches := math.Max(math.Ceil(build.rows/float64(JoinBufferSize)), 1)
+	return build.cost + hashBuildCost*build.rows + batches*(probe.cost+probe.rows) + rows
+}
+
+// Return the relations of tableMap, in the order of the tables and
+// subqueries of plan, with the index of the operator of each
+func joinRelations(c *Catalog, plan *LogicalPlan, tableMap map[string]*PlanNode) ([]*joinRelation, map[Operator]int, error) {
+	var rels []*joinRelation
+	relIndex := make(map[Operator]int)
+	add := func(name string, stats *TableStats) {
+		node := tableMap[name]
+		if _, ok := relIndex[node.op]; ok {
+			return
+		}
+		rel := &joinRelation{name: name, op: node.op, stats: stats, cost: defaultRelationRows, rows: defaultRelationRows}
+		if stats != nil {
+			rel.cost, rel.rows = stats.rows, stats.rows
+		}
+		relIndex[node.op] = len(rels)
+		rels = append(rels, rel)
+	}
+	for _, t := range plan.tables {
+		name := t.tableName
+		if t.alias != "" {
+			name = t.alias
+		}
+		add(name, c.tableStats(t.tableName, *t.file))
+	}
+	for _, p := range plan.subqueries {
+		add(p.alias, nil)
+	}
+
+	for _, f := range plan.filters {
+		nodes, err := exprNodes(c, plan, f.pred, tableMap)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(nodes) == 1 {
+			rel := rels[relIndex[nodes[0].op]]
+			rel.rows *= rel.selectivity(f.pred)
+		}
+	}
+	for _, rel := range rels {
+		rel.rows = math.Max(rel.rows, 1)
+	}
+	return rels, relIndex, nil
+}
+
+// Return the estimated number of distinct values of the join key expression
+// key of rel: that of its column if it is a column with statistics, and
+// otherwise the number of tuples of its table, as if it were a key
+func columnDistinct(rel *joinRelation, key *LogicalSelectNode) float64 {
+	ndv := rel.cost
+	if col := rel.column(key.field); key.exprType == ExprField && col != nil && col.distinct > 0 {
+		ndv = col.distinct
+	}
+	return math.Min(ndv, rel.rows)
+}
+
+// Return the statistics of the column named name of the relation, or nil if
+// there are none
+func (rel *joinRelation) column(name string) *ColumnStats {
+	if rel.stats == nil {
+		return nil
+	}
+	return rel.stats.columns[name]
+}
+
+// Return the estimated fraction of the tuples of the relation that satisfy
+// the WHERE clause expression expr
+func (rel *joinRelation) selectivity(expr sqlparser.Expr) float64 {
+	switch expr := expr.(type) {
+	case *sqlparser.AndExpr:
+		return rel.selectivity(expr.Left) * rel.selectivity(expr.Right)
+	case *sqlparser.OrExpr:
+		l, r := rel.selectivity(expr.Left), rel.selectivity(expr.Right)
+		return l + r - l*r
+	case *sqlparser.NotExpr:
+		return 1 - rel.selectivity(expr.Expr)
+	case *sqlparser.ParenExpr:
+		return rel.selectivity(expr.Expr)
+	case *sqlparser.IsExpr:
+		sel := defaultNullSelectivity
+		if col, ok := expr.Expr.(*sqlparser.ColName); ok {
+			if stats := rel.column(strings.ToLower(col.Name.String())); stats != nil {
+				sel = stats.nullFraction
+			}
+		}
+		switch expr.Operator {
+		case sqlparser.IsNullStr:
+			return sel
+		case sqlparser.IsNotNullStr:
+			return 1 - sel
+		}
+	case *sqlparser.RangeCond:
+		col, v1, v2 := rel.comparison(expr.Left, expr.From)
+		_, _, v3 := rel.comparison(expr.Left, expr.To)
+		sel := defaultRangeSelectivity / 2
+		if col != nil && v1 != nil && v3 != nil {
+			sel = col.rangeSelectivity(OpGe, v2) + col.rangeSelectivity(OpLe, v3) - (1 - col.nullFraction)
+			sel = math.Max(sel, 0)
+		}
+		if expr.Operator == sqlparser.NotBetweenStr {
+			return 1 - sel
+		}
+		return sel
+	case *sqlparser.ComparisonExpr:
+		col, v, value := rel.comparison(expr.Left, expr.Right)
+		swapped := false
+		if v == nil {
+			col, v, value = rel.comparison(expr.Right, expr.Left)
+			swapped = true
+		}
+		switch expr.Operator {
+		case sqlparser.EqualStr, sqlparser.NullSafeEqualStr:
+			if v != nil {
+				return col.equalSelectivity(value)
+			}
+			return defaultEqualitySelectivity
+		case sqlparser.NotEqualStr:
+			if v != nil {
+				return 1 - col.equalSelectivity(value)
+			}
+			return 1 - defaultEqualitySelectivity
+		case sqlparser.LessThanStr, sqlparser.LessEqualStr, sqlparser.GreaterThanStr, sqlparser.GreaterEqualStr:
+			if v == nil {
+				return defaultRangeSelectivity
+			}
+			op := BoolOpMap[expr.Operator]
+			if swapped {
+				op = map[BoolOp]BoolOp{OpLt: OpGt, OpLe: OpGe, OpGt: OpLt, OpGe: OpLe}[op]
+			}
+			return col.rangeSelectivity(op, value)
+		case sqlparser.LikeStr:
+			return defaultLikeSelectivity
+		case sqlparser.NotLikeStr:
+			return 1 - defaultLikeSelectivity
+		case sqlparser.InStr, sqlparser.NotInStr:
+			sel := defaultRangeSelectivity
+			if tuple, ok := expr.Right.(sqlparser.ValTuple); ok {
+				sel = 0
+				for _, e := range tuple {
+					col, v, value := rel.comparison(expr.Left, e)
+					if v != nil {
+						sel += col.equalSelectivity(value)
+					} else {
+						sel += defaultEqualitySelectivity
+					}
+				}
+				sel = math.Min(sel, 1)
+			}
+			if expr.Operator == sqlparser.NotInStr {
+				return 1 - sel
+			}
+			return sel
+		}
+	}
+	return defaultRangeSelectivity
+}
+
+// If left is a column of the relation and right a constant, return the
+// statistics of the column (which may be nil), right, and its value;
+// otherwise return a nil right
+func (rel *joinRelation) comparison(left, right sqlparser.Expr) (*ColumnStats, *sqlparser.SQLVal, DBValue) {
+	col, ok := left.(*sqlparser.ColName)
+	val, ok2 := right.(*sqlparser.SQLVal)
+	if !ok || !ok2 {
+		return nil, nil, nil
+	}
+	var value DBValue
+	switch val.Type {
+	case sqlparser.IntVal:
+		n, err := strconv.ParseInt(string(val.Val), 10, 64)
+		if err != nil {
+			return nil, nil, nil
+		}
+		value = IntField{n}
+	case sqlparser.StrVal:
+		value = StringField{string(val.Val)}
+	default:
+		return nil, nil, nil
+	}
+	return rel.column(strings.ToLower(col.Name.String())), val, value
+}
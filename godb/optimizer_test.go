@@ -0,0 +1,291 @@
+package godb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// Return the joins of the plan op, as (probe build), with the tables at the
+// leaves
+func joinTree(op Operator) string {
+	switch op := op.(type) {
+	case *EqualityJoin[int64]:
+		return fmt.Sprintf("(%s %s)", joinTree(*op.left), joinTree(*op.right))
+	case *EqualityJoin[string]:
+		return fmt.Sprintf("(%s %s)", joinTree(*op.left), joinTree(*op.right))
+	case *CrossProduct:
+		return fmt.Sprintf("[%s x %s]", joinTree(op.left), joinTree(op.right))
+	case *Project:
+		return joinTree(op.child)
+	case *Filter[int64]:
+		return joinTree(op.child)
+	case *Filter[string]:
+		return joinTree(op.child)
+	case *PredicateFilter:
+		return joinTree(op.child)
+	case *Aggregator:
+		return joinTree(op.child)
+	case *OrderBy:
+		return joinTree(op.child)
+	case *TopN:
+		return joinTree(op.child)
+	}
+	return op.Descriptor().Fields[0].TableQualifier
+}
+
+// The join order of queries over the tables of TPC-H, with the statistics
+// of the tables at scale factor 1.  Dates are numbers of days since
+// 1992-01-01.
+func TestJoinOrderTPCH(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "")
+	for _, sql := range []string{
+		"create table region (r_regionkey int, r_name string)",
+		"create table nation (n_nationkey int, n_name string, n_regionkey int)",
+		"create table supplier (s_suppkey int, s_name string, s_nationkey int)",
+		"create table customer (c_custkey int, c_name string, c_nationkey int, c_mktsegment string)",
+		"create table part (p_partkey int, p_name string, p_type string, p_size int)",
+		"create table partsupp (ps_partkey int, ps_suppkey int, ps_supplycost int)",
+		"create table orders (o_orderkey int, o_custkey int, o_orderdate int, o_shippriority int)",
+		"create table lineitem (l_orderkey int, l_partkey int, l_suppkey int, l_extendedprice int, l_discount int, l_shipdate int)",
+	} {
+		mustRunSQL(t, c, bp, sql)
+	}
+	setStats := func(table string, rows int, columns map[string][3]int) {
+		stats := NewTableStats(rows, rows/50)
+		for name, col := range columns {
+			stats.SetColumnStats(name, col[0], 0, IntField{int64(col[1])}, IntField{int64(col[2])})
+		}
+		if err := c.SetTableStats(table, stats); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	// the distinct values, minimum and maximum of each column
+	setStats("region", 5, map[string][3]int{"r_regionkey": {5, 0, 4}})
+	setStats("nation", 25, map[string][3]int{"n_nationkey": {25, 0, 24}, "n_regionkey": {5, 0, 4}})
+	setStats("supplier", 10000, map[string][3]int{"s_suppkey": {10000, 1, 10000}, "s_nationkey": {25, 0, 24}})
+	setStats("customer", 150000, map[string][3]int{"c_custkey": {150000, 1, 150000}, "c_nationkey": {25, 0, 24}})
+	setStats("part", 200000, map[string][3]int{"p_partkey": {200000, 1, 200000}, "p_size": {50, 1, 50}})
+	setStats("partsupp", 800000, map[string][3]int{"ps_partkey": {200000, 1, 200000}, "ps_suppkey": {10000, 1, 10000}})
+	setStats("orders", 1500000, map[string][3]int{
+		"o_orderkey": {1500000, 1, 6000000}, "o_custkey": {100000, 1, 150000}, "o_orderdate": {2406, 0, 2405},
+	})
+	setStats("lineitem", 6000000, map[string][3]int{
+		"l_orderkey": {1500000, 1, 6000000}, "l_partkey": {200000, 1, 200000}, "l_suppkey": {10000, 1, 10000},
+		"l_shipdate": {2526, 1, 2526},
+	})
+	// string columns only have their number of distinct values
+	for _, col := range []struct {
+		table, column string
+		distinct      int
+	}{{"region", "r_name", 5}, {"nation", "n_name", 25}, {"customer", "c_mktsegment", 5}, {"part", "p_type", 150}} {
+		c.tableMap[col.table].stats.SetColumnStats(col.column, col.distinct, 0, nil, nil)
+	}
+	for _, test := range []struct {
+		name, sql, tree string
+	}{
+		{
+			// the filtered customers and orders are joined first, and
+			// lineitem, the largest table, is only scanned once
+			"q3",
+			`select l_orderkey, o_orderdate, o_shippriority from customer, orders, lineitem
+			where c_mktsegment = 'BUILDING' and c_custkey = o_custkey and l_orderkey = o_orderkey
+			and o_orderdate < 1169 and l_shipdate > 1169`,
+			"(lineitem (orders customer))",
+		},
+		{
+			// lineitem, the largest table, is the probe side of every
+			// join, and the region filter is applied to the smallest
+			// build side
+			"q5",
+			`select n_name from customer, orders, lineitem, supplier, nation, region
+			where c_custkey = o_custkey and l_orderkey = o_orderkey and l_suppkey = s_suppkey
+			and c_nationkey = s_nationkey and s_nationkey = n_nationkey and n_regionkey = r_regionkey
+			and r_name = 'ASIA' and o_orderdate >= 731 and o_orderdate < 1096`,
+			"(((lineitem (supplier (nation region))) orders) customer)",
+		},
+		{
+			// a selective filter on the table that is last in the query
+			"selective customer",
+			`select l_orderkey from lineitem, orders, customer
+			where l_orderkey = o_orderkey and o_custkey = c_custkey and c_custkey = 42`,
+			"(lineitem (orders customer))",
+		},
+		{
+			// the part filter makes the join of lineitem and part small
+			// enough to be the build side of the joins with partsupp
+			// and orders
+			"q9 shape",
+			`select n_name from part, supplier, lineitem, partsupp, orders, nation
+			where s_suppkey = l_suppkey and ps_suppkey = l_suppkey and ps_partkey = l_partkey
+			and p_partkey = l_partkey and o_orderkey = l_orderkey and s_nationkey = n_nationkey
+			and p_size = 15`,
+			"(orders ((supplier (partsupp (lineitem part))) nation))",
+		},
+		{
+			// the build side of a single join is chosen too, whichever
+			// side of its predicate each table is on
+			"single join",
+			"select o_orderdate from customer, orders where c_custkey = o_custkey and c_nationkey = 7",
+			"(orders customer)",
+		},
+		{
+			"single join reversed",
+			"select o_orderdate from customer, orders where o_custkey = c_custkey and c_nationkey = 7",
+			"(orders customer)",
+		},
+		{
+			// the relations that are joined are joined before they are
+			// crossed, with the smaller result on the buffered side
+			"cross product",
+			`select n_name, o_orderdate from region, lineitem, nation, orders
+			where l_orderkey = o_orderkey and n_regionkey = r_regionkey`,
+			"[(lineitem orders) x (nation region)]",
+		},
+	} {
+		_, op, err := Parse(c, test.sql)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err.Error())
+		}
+		if tree := joinTree(op); tree != test.tree {
+			t.Errorf("%s: expected join tree %s, got %s", test.name, test.tree, tree)
+		}
+	}
+}
+
+// The order of joins does not change the results of a query
+func TestJoinOrderResults(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "")
+	mustRunSQL(t, c, bp, "create table part (p_partkey int, p_name string, p_brand string, p_size int)")
+	mustRunSQL(t, c, bp, "create table supplier (s_suppkey int, s_name string, s_nation string)")
+	mustRunSQL(t, c, bp, "create table partsupp (ps_partkey int, ps_suppkey int, ps_availqty int, ps_supplycost int)")
+	mustRunSQL(t, c, bp, "create table lineitem (l_partkey int, l_suppkey int, l_quantity int, l_extendedprice int)")
+
+	var rows []string
+	for p := 0; p < 100; p++ {
+		name := []string{"forest green", "lace blush", "forest pink", "navy ivory"}[p%4]
+		rows = append(rows, fmt.Sprintf("(%d, '%s %d', 'brand#%d', %d)", p, name, p, p%5, p%7))
+	}
+	mustRunSQL(t, c, bp, "insert into part values "+strings.Join(rows, ", "))
+	rows = nil
+	for s := 0; s < 20; s++ {
+		rows = append(rows, fmt.Sprintf("(%d, 'supplier#%02d', '%s')", s, s, []string{"france", "peru"}[s%2]))
+	}
+	mustRunSQL(t, c, bp, "insert into supplier values "+strings.Join(rows, ", "))
+	rows = nil
+	for p := 0; p < 100; p++ {
+		for i := 0; i < 4; i++ {
+			rows = append(rows, fmt.Sprintf("(%d, %d, %d, %d)", p, (p+i*5)%20, (p*7+i*13)%50, (p*31+i*17)%100))
+		}
+	}
+	mustRunSQL(t, c, bp, "insert into partsupp values "+strings.Join(rows, ", "))
+	rows = nil
+	for l := 0; l < 2000; l++ {
+		p := (l * 7) % 100
+		rows = append(rows, fmt.Sprintf("(%d, %d, %d, %d)", p, (p+(l%4)*5)%20, (l*13)%50+1, l))
+	}
+	mustRunSQL(t, c, bp, "insert into lineitem values "+strings.Join(rows, ", "))
+	sql := `select p_partkey, s_name, l_quantity from lineitem, part, supplier, partsupp
+		where l_partkey = p_partkey and l_suppkey = s_suppkey and ps_partkey = p_partkey
+		and ps_suppkey = s_suppkey and p_size < 3 and s_nation = 'france'`
+	results := func() []string {
+		var rows []string
+		for _, tup := range mustRunSQL(t, c, bp, sql) {
+			rows = append(rows, tup.PrettyPrintString(false))
+		}
+		sort.Strings(rows)
+		return rows
+	}
+	expected := results()
+	if len(expected) == 0 {
+		t.Fatalf("expected results")
+	}
+
+	var trees []string
+	for _, rows := range []int{1, 1000000} {
+		stats := NewTableStats(rows, 1)
+		stats.SetColumnStats("s_suppkey", rows, 0, nil, nil)
+		if err := c.SetTableStats("supplier", stats); err != nil {
+			t.Fatalf(err.Error())
+		}
+		_, op, err := Parse(c, sql)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		trees = append(trees, joinTree(op))
+		res := results()
+		if fmt.Sprint(res) != fmt.Sprint(expected) {
+			t.Errorf("expected %v with %d suppliers, got %v", expected, rows, res)
+		}
+	}
+	if trees[0] == trees[1] {
+		t.Errorf("expected the size of supplier to change the plan %s", trees[0])
+	}
+	if err := c.SetTableStats("nosuchtable", NewTableStats(1, 1)); err == nil {
+		t.Errorf("expected error setting statistics of a missing table")
+	}
+}
+
+// Columns of aliased tables with the same names are told apart whichever
+// side of a join their table is on
+func TestJoinOrderAliases(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "employees (name string, manager string)\nr (name string, depth int)\n")
+	mustRunSQL(t, c, bp, "insert into employees values ('ceo', null), ('cto', 'ceo'), ('dev1', 'cto')")
+	mustRunSQL(t, c, bp, "insert into r values ('cto', 0)")
+	for _, sql := range []string{
+		"select e.name, r.depth + 1 from employees e, r where e.manager = r.name",
+		"select e.name, r.depth + 1 from r, employees e where r.name = e.manager",
+	} {
+		expectRows(t, c, bp, sql, "dev1,1")
+	}
+}
+
+func TestSelectivityEstimates(t *testing.T) {
+	// the statistics of the orders table of TPC-H at scale factor 1
+	stats := NewTableStats(1500000, 30000)
+	stats.SetColumnStats("o_orderkey", 1500000, 0, IntField{1}, IntField{6000000})
+	stats.SetColumnStats("o_custkey", 100000, 0, IntField{1}, IntField{150000})
+	stats.SetColumnStats("o_orderdate", 2406, 0, IntField{0}, IntField{2405})
+	rel := &joinRelation{stats: stats, cost: stats.rows, rows: stats.rows}
+	for _, test := range []struct {
+		where string
+		min   float64
+		max   float64
+	}{
+		{"o_custkey = 7", 0.000009, 0.000011},
+		{"o_custkey = -7", 0, 0},
+		{"o_custkey != 7", 0.99, 1},
+		{"o_orderdate < 0", 0, 0},
+		{"o_orderdate >= 0", 1, 1},
+		{"o_orderdate between 731 and 1095", 0.15, 0.16},
+		{"731 > o_orderdate", 0.30, 0.31},
+		{"o_custkey in (1, 2, 3, 4)", 0.00003, 0.00005},
+		{"o_custkey = 7 or o_custkey = 8", 0.000019, 0.000021},
+		{"o_custkey = 7 and o_orderdate < 1096", 0.000004, 0.000005},
+		{"not o_orderdate < 0", 1, 1},
+		{"O_CUSTKEY is null", 0, 0},
+		{"o_custkey is not null", 1, 1},
+		{"o_shippriority = 3", defaultEqualitySelectivity, defaultEqualitySelectivity},
+		{"o_shippriority + 1 = o_custkey", defaultEqualitySelectivity, defaultEqualitySelectivity},
+	} {
+		expr, err := parseWhereExpr(test.where)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if sel := rel.selectivity(expr); sel < test.min || sel > test.max {
+			t.Errorf("%s: expected selectivity in [%g, %g], got %g", test.where, test.min, test.max, sel)
+		}
+	}
+}
+
+// Return the parsed WHERE clause expression where
+func parseWhereExpr(where string) (sqlparser.Expr, error) {
+	stmt, err := sqlparser.Parse("select * from t where " + where)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.(*sqlparser.Select).Where.Expr, nil
+}
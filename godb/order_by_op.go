@@ -1,93 +1,306 @@
 package godb
 
 import (
-    "sort"
+	"container/heap"
+	"sort"
 )
 
-// TODO: some code goes here
+// OrderBy sorts the tuples of its child.  Tuples that compare equal are
+// returned in the order of the child.  If the child has more than the tuple
+// limit of the operator ([SpillTupleLimit] by default), it is sorted with
+// an external merge sort: sorted runs of tuples are written to temporary
+// spill files (see spill.go), which are then merged, at most mergeFanout at
+// a time.
 type OrderBy struct {
 	orderBy []Expr // OrderBy should include these two fields (used by parser)
 	child   Operator
 	//add additional fields here
-    ascending []bool
+	ascending []bool
+
+	// The maximum number of tuples sorted in memory; 0 for SpillTupleLimit
+	tupleLimit int
 }
 
+// The maximum number of sorted runs that are merged at once.  If there are
+// more, they are merged in several passes.
+const mergeFanout = 16
+
 // Order by constructor -- should save the list of field, child, and ascending
 // values for use in the Iterator() method. Here, orderByFields is a list of
 // expressions that can be extacted from the child operator's tuples, and the
 // ascending bitmap indicates whether the ith field in the orderByFields
 // list should be in ascending (true) or descending (false) order.
 func NewOrderBy(orderByFields []Expr, child Operator, ascending []bool) (*OrderBy, error) {
-	// TODO: some code goes here
-    if len(orderByFields) != len(ascending) {
-        return nil, GoDBError{MalformedDataError, "field lengths not equal"}
-    }
-    return &OrderBy{orderByFields, child, ascending}, nil
+	if len(orderByFields) != len(ascending) {
+		return nil, GoDBError{MalformedDataError, "field lengths not equal"}
+	}
+	return &OrderBy{orderByFields, child, ascending, 0}, nil
 }
 
 func (o *OrderBy) Descriptor() *TupleDesc {
-	// TODO: some code goes here
-    return o.child.Descriptor()
-}
-
-// Return a function that iterators through the results of the child iterator in
-// ascending/descending order, as specified in the construtor.  This sort is
-// "blocking" -- it should first construct an in-memory sorted list of results
-// to return, and then iterate through them one by one on each subsequent
-// invocation of the iterator function.
-//
-// Although you are free to implement your own sorting logic, you may wish to
-// leverage the go sort pacakge and the [sort.Sort] method for this purpose.  To
-// use this you will need to implement three methods:  Len, Swap, and Less that
-// the sort algorithm will invoke to preduce a sorted list. See the first
-// example, example of SortMultiKeys, and documentation at: https://pkg.go.dev/sort
+	return o.child.Descriptor()
+}
+
+// Set the maximum number of tuples that the operator sorts in memory, or, if
+// n is 0, use [SpillTupleLimit]
+func (o *OrderBy) SetTupleLimit(n int) {
+	o.tupleLimit = n
+}
+
+// A tuple to sort, with the values of its ORDER BY expressions.  NULLs sort
+// before all other values in ascending order, and after them in descending
+// order.
+type sortRow struct {
+	tuple *Tuple
+	keys  []DBValue
+}
+
+// Return the row of t sorted by the expressions orderBy
+func newSortRow(orderBy []Expr, t *Tuple) (*sortRow, error) {
+	keys := make([]DBValue, len(orderBy))
+	for i, expr := range orderBy {
+		v, err := expr.EvalExpr(t)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = v
+	}
+	return &sortRow{t, keys}, nil
+}
+
+func (o *OrderBy) sortRows(rows []*sortRow) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		return compareRows(rows[i].keys, rows[j].keys, o.ascending) < 0
+	})
+}
+
+// Return a function that iterates through the results of the child iterator
+// in ascending/descending order, as specified in the constructor.  The sort
+// is blocking: the first call reads every tuple of the child, writing sorted
+// runs to spill files whenever the tuple limit is reached.
 func (o *OrderBy) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
-	// TODO: some code goes here
-    childIter, err := o.child.Iterator(tid)
-    if err != nil {
-        return nil, err
-    }
-    var tuples []*Tuple
-    for t, err := childIter(); t != nil || err != nil; t, err = childIter() {
-        if err != nil {
-            return nil, err
-        }
-        tuples = append(tuples, t)
-    }
-
-    sort.Slice(tuples, func(i, j int) bool {
-        for k, expr := range o.orderBy {
-            eval_i, _ := expr.EvalExpr(tuples[i])
-            eval_j, _ := expr.EvalExpr(tuples[j])
-            switch expr.GetExprType().Ftype {
-            case IntType:
-                val_i := eval_i.(IntField).Value
-                val_j := eval_j.(IntField).Value
-                if val_i == val_j {continue}
-                if o.ascending[k] {
-                    return val_i < val_j
-                } else {
-                    return val_i > val_j
-                }
-            case StringType:
-                val_i := eval_i.(StringField).Value
-                val_j := eval_j.(StringField).Value
-                if val_i == val_j {continue}
-                if o.ascending[k] {
-                    return val_i < val_j
-                } else {
-                    return val_i > val_j
-                }
-            }
-        }
-        return true
-    })
-    ind := 0
-    return func() (*Tuple, error) {
-        if ind == len(tuples) {
-            return nil, err
-        }
-        ind++
-        return tuples[ind-1], nil
-    }, nil
+	childIter, err := o.child.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	limit := o.tupleLimit
+	if limit <= 0 {
+		limit = SpillTupleLimit
+	}
+
+	var runs []*spillFile
+	removeRuns := func() {
+		for _, run := range runs {
+			run.remove()
+		}
+		runs = nil
+	}
+	var rows []*sortRow
+	for {
+		t, err := childIter()
+		if err != nil {
+			removeRuns()
+			return nil, err
+		}
+		if t == nil {
+			break
+		}
+		row, err := newSortRow(o.orderBy, t)
+		if err != nil {
+			removeRuns()
+			return nil, err
+		}
+		rows = append(rows, row)
+		if len(rows) >= limit {
+			run, err := o.writeRun(rows)
+			if err != nil {
+				removeRuns()
+				return nil, err
+			}
+			runs = append(runs, run)
+			rows = nil
+		}
+	}
+	o.sortRows(rows)
+	if len(runs) == 0 {
+		return func() (*Tuple, error) {
+			if len(rows) == 0 {
+				return nil, nil
+			}
+			t := rows[0].tuple
+			rows = rows[1:]
+			return t, nil
+		}, nil
+	}
+
+	// merge runs until they and the tuples in memory can be merged at once
+	for len(runs) >= mergeFanout {
+		run, err := o.mergeRuns(runs[:mergeFanout])
+		if err != nil {
+			removeRuns()
+			return nil, err
+		}
+		for _, r := range runs[:mergeFanout] {
+			r.remove()
+		}
+		runs = append([]*spillFile{run}, runs[mergeFanout:]...)
+	}
+	inputs, err := o.runIterators(runs)
+	if err != nil {
+		removeRuns()
+		return nil, err
+	}
+	inputs = append(inputs, func() (*sortRow, error) {
+		if len(rows) == 0 {
+			return nil, nil
+		}
+		row := rows[0]
+		rows = rows[1:]
+		return row, nil
+	})
+	next := o.merge(inputs)
+	return func() (*Tuple, error) {
+		if runs == nil {
+			return nil, nil
+		}
+		row, err := next()
+		if err != nil || row == nil {
+			removeRuns()
+			return nil, err
+		}
+		return row.tuple, nil
+	}, nil
+}
+
+// Sort rows and write them to a new spill file
+func (o *OrderBy) writeRun(rows []*sortRow) (*spillFile, error) {
+	o.sortRows(rows)
+	run, err := newSpillFile(o.child.Descriptor())
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if err := run.add(row.tuple); err != nil {
+			run.remove()
+			return nil, err
+		}
+	}
+	return run, nil
+}
+
+// Merge runs into a new spill file
+func (o *OrderBy) mergeRuns(runs []*spillFile) (*spillFile, error) {
+	inputs, err := o.runIterators(runs)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := newSpillFile(o.child.Descriptor())
+	if err != nil {
+		return nil, err
+	}
+	next := o.merge(inputs)
+	for {
+		row, err := next()
+		if err == nil && row != nil {
+			err = merged.add(row.tuple)
+		}
+		if err != nil {
+			merged.remove()
+			return nil, err
+		}
+		if row == nil {
+			return merged, nil
+		}
+	}
+}
+
+// Return iterators through the rows of runs
+func (o *OrderBy) runIterators(runs []*spillFile) ([]func() (*sortRow, error), error) {
+	inputs := make([]func() (*sortRow, error), len(runs))
+	for i, run := range runs {
+		iter, err := run.iterator()
+		if err != nil {
+			return nil, err
+		}
+		inputs[i] = func() (*sortRow, error) {
+			t, err := iter()
+			if err != nil || t == nil {
+				return nil, err
+			}
+			return newSortRow(o.orderBy, t)
+		}
+	}
+	return inputs, nil
+}
+
+// The next row of each input of a merge, ordered by the keys of the rows
+// and then by input, so that the merge is stable
+type mergeHeap struct {
+	rows      []*sortRow
+	inputs    []int
+	ascending []bool
+}
+
+func (h *mergeHeap) Len() int { return len(h.rows) }
+
+func (h *mergeHeap) Less(i, j int) bool {
+	if c := compareRows(h.rows[i].keys, h.rows[j].keys, h.ascending); c != 0 {
+		return c < 0
+	}
+	return h.inputs[i] < h.inputs[j]
+}
+
+func (h *mergeHeap) Swap(i, j int) {
+	h.rows[i], h.rows[j] = h.rows[j], h.rows[i]
+	h.inputs[i], h.inputs[j] = h.inputs[j], h.inputs[i]
+}
+
+func (h *mergeHeap) Push(x any) {
+	head := x.(mergeHead)
+	h.rows = append(h.rows, head.row)
+	h.inputs = append(h.inputs, head.input)
+}
+
+func (h *mergeHeap) Pop() any {
+	n := len(h.rows) - 1
+	head := mergeHead{h.rows[n], h.inputs[n]}
+	h.rows, h.inputs = h.rows[:n], h.inputs[:n]
+	return head
+}
+
+type mergeHead struct {
+	row   *sortRow
+	input int
+}
+
+// Return an iterator that merges the sorted rows of inputs
+func (o *OrderBy) merge(inputs []func() (*sortRow, error)) func() (*sortRow, error) {
+	h := &mergeHeap{ascending: o.ascending}
+	started := false
+	return func() (*sortRow, error) {
+		if !started {
+			started = true
+			for i, input := range inputs {
+				row, err := input()
+				if err != nil {
+					return nil, err
+				}
+				if row != nil {
+					heap.Push(h, mergeHead{row, i})
+				}
+			}
+		}
+		if h.Len() == 0 {
+			return nil, nil
+		}
+		head := heap.Pop(h).(mergeHead)
+		row, err := inputs[head.input]()
+		if err != nil {
+			return nil, err
+		}
+		if row != nil {
+			heap.Push(h, mergeHead{row, head.input})
+		}
+		return head.row, nil
+	}
 }
@@ -0,0 +1,143 @@
+package godb
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// An expression that fails to evaluate
+type errorExpr struct{}
+
+func (e *errorExpr) EvalExpr(t *Tuple) (DBValue, error) {
+	return nil, GoDBError{TypeMismatchError, "cannot evaluate expression"}
+}
+
+func (e *errorExpr) GetExprType() FieldType {
+	return FieldType{"err", "", IntType}
+}
+
+func expectNoSpillFiles(t *testing.T, dir string) {
+	t.Helper()
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(files) != 0 {
+		t.Errorf("expected spill files to be removed, found %d", len(files))
+	}
+}
+
+func TestOrderByExternalSort(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("TMPDIR", tmpDir)
+	c, bp := makeSQLTestCatalog(t, "t (k int, g string, v int)\n")
+	var rows []string
+	for i := 0; i < 1000; i++ {
+		rows = append(rows, fmt.Sprintf("(%d, 'g%d', %d)", i%97, i%3, i))
+	}
+	mustRunSQL(t, c, bp, "insert into t values "+strings.Join(rows, ", "))
+	file, err := c.GetTable("t")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// 334 runs of 3 tuples, which take more than one merge pass
+	k := &FieldExpr{FieldType{"k", "t", IntType}}
+	g := &FieldExpr{FieldType{"g", "t", StringType}}
+	op, err := NewOrderBy([]Expr{g, k}, file, []bool{false, true})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	op.SetTupleLimit(3)
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	res, err := runOp(op, tid)
+	bp.CommitTransaction(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(res) != 1000 {
+		t.Fatalf("expected 1000 tuples, got %d", len(res))
+	}
+	for i := 1; i < len(res); i++ {
+		prev, cur := res[i-1].Fields, res[i].Fields
+		gCmp := compareValues(prev[1], cur[1])
+		kCmp := compareValues(prev[0], cur[0])
+		// tuples with equal keys stay in the order of the table, by v
+		if gCmp < 0 || (gCmp == 0 && (kCmp > 0 || (kCmp == 0 && compareValues(prev[2], cur[2]) >= 0))) {
+			t.Fatalf("tuples %v and %v out of order", res[i-1], res[i])
+		}
+	}
+	expectNoSpillFiles(t, tmpDir)
+}
+
+func TestOrderByExternalSortSQL(t *testing.T) {
+	defer func(limit int) { SpillTupleLimit = limit }(SpillTupleLimit)
+	c, bp := makeSQLTestCatalog(t, "t (k int, g string, v int)\n")
+	var rows []string
+	for i := 0; i < 500; i++ {
+		rows = append(rows, fmt.Sprintf("(%d, 'g%d', %d)", i%97, i%3, i))
+	}
+	mustRunSQL(t, c, bp, "insert into t values "+strings.Join(rows, ", "))
+	mustRunSQL(t, c, bp, "insert into t values (null, null, 1000), (5, null, 1001), (null, 'g1', 1002)")
+
+	queries := []string{
+		"select k, g, v from t order by k, v desc",
+		"select k, g, v from t order by g desc, k desc, v",
+		"select k, g, v from t order by k limit 20",
+	}
+	var expected [][]string
+	for _, sql := range queries {
+		var rows []string
+		for _, tup := range mustRunSQL(t, c, bp, sql) {
+			rows = append(rows, tup.PrettyPrintString(false))
+		}
+		expected = append(expected, rows)
+	}
+	// NULLs are first in ascending order and last in descending order
+	if last := expected[1][len(expected[1])-1]; expected[0][0] != "null,g1,1002" || last != "null,null,1000" {
+		t.Errorf("unexpected order of NULLs %s, %s", expected[0][0], last)
+	}
+	SpillTupleLimit = 7
+	for i, sql := range queries {
+		expectRows(t, c, bp, sql, expected[i]...)
+	}
+}
+
+func TestOrderByErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("TMPDIR", tmpDir)
+	c, bp := makeSQLTestCatalog(t, "t (k int, g string, v int)\n")
+	var rows []string
+	for i := 0; i < 100; i++ {
+		rows = append(rows, fmt.Sprintf("(%d, 'g%d', %d)", i%97, i%3, i))
+	}
+	mustRunSQL(t, c, bp, "insert into t values "+strings.Join(rows, ", "))
+	file, err := c.GetTable("t")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	k := &FieldExpr{FieldType{"k", "t", IntType}}
+	for _, test := range []struct {
+		expr  Expr
+		child Operator
+	}{
+		{&errorExpr{}, file},
+		{k, &errorAfterOp{file, 50}},
+	} {
+		op, err := NewOrderBy([]Expr{test.expr}, test.child, []bool{true})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		op.SetTupleLimit(4)
+		tid := NewTID()
+		bp.BeginTransaction(tid)
+		if _, err := runOp(op, tid); err == nil {
+			t.Errorf("expected error sorting by %v", test.expr)
+		}
+		bp.AbortTransaction(tid)
+	}
+	expectNoSpillFiles(t, tmpDir)
+}
@@ -2,6 +2,8 @@ package godb
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"reflect"
 	"strconv"
 	"strings"
@@ -10,10 +12,23 @@ import (
 	"github.com/xwb1989/sqlparser"
 )
 
+// A conjunct of the WHERE clause, which is applied to the single table it
+// refers to, or once all of the tables it refers to have been joined
 type LogicalFilterNode struct {
-	fieldExpr LogicalSelectNode
-	constExpr LogicalSelectNode
-	predOp    BoolOp
+	pred sqlparser.Expr
+}
+
+// A semi-join (or anti-join) that keeps the tuples whose value of left is (or
+// is not) among the values returned by a subquery, for a top level
+// [NOT] IN (subquery) conjunct of the WHERE clause, or that keeps every tuple
+// if the subquery returns any (or no) tuples, for [NOT] EXISTS (subquery).
+// If the subquery was correlated, it also returns the columns it was
+// correlated on, which must equal outerKeys (see [LogicalPlan.decorrelate]).
+type LogicalSemiJoinNode struct {
+	left      sqlparser.Expr // nil for EXISTS
+	subplan   *LogicalPlan
+	anti      bool
+	outerKeys []*LogicalSelectNode
 }
 
 type LogicalJoinNode struct {
@@ -29,6 +44,7 @@ const (
 	ExprFunc  SelectExprType = iota
 	ExprStar  SelectExprType = iota
 	ExprAggr  SelectExprType = iota
+	ExprPred  SelectExprType = iota
 )
 
 type LogicalSelectNode struct {
@@ -40,6 +56,9 @@ type LogicalSelectNode struct {
 	value       string
 	args        []*LogicalSelectNode //for functions other than aggregates
 	cachedField *FieldType
+	null        bool           //for constants, whether the constant is NULL
+	distinct    bool           //for aggregates, whether only distinct values are aggregated
+	pred        sqlparser.Expr //for predicates, the boolean expression, whose columns are in args
 }
 
 func NewFieldSelectNode(table string, field string, alias string) LogicalSelectNode {
@@ -57,6 +76,11 @@ func NewConstSelectNode(value string, alias string) LogicalSelectNode {
 	lsn.alias = alias
 	return lsn
 }
+func NewNullSelectNode(alias string) LogicalSelectNode {
+	lsn := NewConstSelectNode("null", alias)
+	lsn.null = true
+	return lsn
+}
 func NewStarSelectNode(table string) LogicalSelectNode {
 	lsn := LogicalSelectNode{}
 	lsn.exprType = ExprStar
@@ -74,6 +98,28 @@ func NewAggrSelectNode(op string, arg *LogicalSelectNode, alias string) LogicalS
 	return lsn
 }
 
+// Return a node for the boolean expression pred, such as the argument of
+// bool_and(age > 40), which is compiled by parsePredicate
+func NewPredSelectNode(pred sqlparser.Expr, alias string) LogicalSelectNode {
+	lsn := LogicalSelectNode{}
+	lsn.exprType = ExprPred
+	lsn.pred = pred
+	lsn.alias = alias
+	sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch node := node.(type) {
+		case *sqlparser.ColName:
+			col, err := parseExpr(nil, node, "")
+			if err == nil {
+				lsn.args = append(lsn.args, col)
+			}
+		case *sqlparser.Subquery:
+			return false, nil
+		}
+		return true, nil
+	}, pred)
+	return lsn
+}
+
 func NewFuncSelectNode(op string, args []*LogicalSelectNode, alias string) LogicalSelectNode {
 	lsn := LogicalSelectNode{}
 	lsn.exprType = ExprFunc
@@ -98,14 +144,16 @@ func checkNameInTablesOrSubqueries(table string, field string, c *Catalog, subqu
 		}
 	}
 	if table == "" && c != nil && ts != nil {
-		catTs := c.findTablesWithColumn(field)
-		for _, t := range catTs {
-			for _, t2 := range ts {
-				if t.name == t2.tableName {
+		for _, t := range ts {
+			for _, f := range (*t.file).Descriptor().Fields {
+				if f.Fname == field {
 					if table != "" {
 						return "", GoDBError{AmbiguousNameError, fmt.Sprintf("multiple possible table names for field %s in select expression", field)}
 					}
-					table = t.name
+					table = t.tableName
+					if t.alias != "" {
+						table = t.alias
+					}
 				}
 			}
 		}
@@ -120,7 +168,7 @@ func (lsn *LogicalSelectNode) getTableField(c *Catalog, subqueries []*LogicalPla
 	if lsn.exprType == ExprConst {
 		return "", "", nil
 	}
-	if lsn.exprType == ExprFunc || lsn.exprType == ExprAggr {
+	if lsn.exprType == ExprFunc || lsn.exprType == ExprAggr || lsn.exprType == ExprPred {
 		tabName := ""
 		fieldName := ""
 		for _, subLsn := range lsn.args {
@@ -171,78 +219,485 @@ type OrderByNode struct {
 	ascending bool
 }
 
+type LimitNode struct {
+	count  *LogicalSelectNode
+	offset *LogicalSelectNode // nil if there is no OFFSET
+}
+
 type LogicalPlan struct {
 	filters       []*LogicalFilterNode
 	joins         []*LogicalJoinNode
+	semiJoins     []*LogicalSemiJoinNode
 	selects       []*LogicalSelectNode
 	aggs          []*LogicalSelectNode
 	tables        []*LogicalTableNode
 	subqueries    []*LogicalPlan
 	groupByFields []*GroupBy
+	groupingSets  [][]int        // for ROLLUP, CUBE and GROUPING SETS, the sets of groupByFields to group by; otherwise nil
+	having        sqlparser.Expr // the HAVING clause, whose aggregates are replaced by references to aggs
+	windows       []*LogicalWindowNode
 	orderByFields []*OrderByNode
-	limit         *LogicalSelectNode
+	limit         *LimitNode
 	distinct      bool
 	alias         string
+	hidden        bool            // a derived table added by decorrelation, whose columns SELECT * omits
+	columnRefs    map[string]bool // the columns the statement refers to (see [columnReferences]), or nil if they are not known
 }
 
 func (p *LogicalPlan) getSubplanFields(c *Catalog) []*FieldType {
 	var nodes []*FieldType
 	for _, s := range p.selects {
 		_, field, _ := s.getTableField(c, p.subqueries, p.tables)
+		if s.alias != "" {
+			field = s.alias
+		}
 		nodes = append(nodes, &FieldType{field, p.alias, UnknownType})
 	}
 	return nodes
 }
 
-func parseWhere(c *Catalog, subqueries []*LogicalPlan, ts []*LogicalTableNode, expr sqlparser.Expr) ([]*LogicalFilterNode, []*LogicalJoinNode, error) {
+// Split a WHERE clause into its conjuncts.  Equality comparisons between
+// expressions over two different tables become joins, [NOT] IN and [NOT]
+// EXISTS subqueries become semi-joins, and the other conjuncts become filters.
+func parseWhere(c *Catalog, subqueries []*LogicalPlan, ts []*LogicalTableNode, expr sqlparser.Expr) ([]*LogicalFilterNode, []*LogicalJoinNode, []*LogicalSemiJoinNode, error) {
 	switch expr := expr.(type) {
 	case *sqlparser.AndExpr:
-		//print("got and")
-		filterListLeft, joinListLeft, _ := parseWhere(c, subqueries, ts, expr.Left)
-		filterListRight, joinListRight, _ := parseWhere(c, subqueries, ts, expr.Right)
+		filterListLeft, joinListLeft, semiJoinListLeft, err := parseWhere(c, subqueries, ts, expr.Left)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		filterListRight, joinListRight, semiJoinListRight, err := parseWhere(c, subqueries, ts, expr.Right)
+		if err != nil {
+			return nil, nil, nil, err
+		}
 		filterExprs := append(filterListLeft, filterListRight...)
 		joinExprs := append(joinListLeft, joinListRight...)
-		return filterExprs, joinExprs, nil
+		semiJoinExprs := append(semiJoinListLeft, semiJoinListRight...)
+		return filterExprs, joinExprs, semiJoinExprs, nil
+	case *sqlparser.ParenExpr:
+		if _, ok := expr.Expr.(*sqlparser.AndExpr); ok {
+			return parseWhere(c, subqueries, ts, expr.Expr)
+		}
+	case *sqlparser.ExistsExpr, *sqlparser.NotExpr:
+		semiJoin, err := parseSemiJoin(c, expr)
+		if err != nil || semiJoin != nil {
+			return nil, nil, []*LogicalSemiJoinNode{semiJoin}, err
+		}
+	case *sqlparser.ComparisonExpr:
+		if expr.Operator == sqlparser.InStr || expr.Operator == sqlparser.NotInStr {
+			semiJoin, err := parseSemiJoin(c, expr)
+			if err != nil || semiJoin != nil {
+				return nil, nil, []*LogicalSemiJoinNode{semiJoin}, err
+			}
+		}
+		if expr.Operator != sqlparser.EqualStr {
+			break
+		}
+		lTables, err := predicateTables(c, subqueries, ts, expr.Left)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		rTables, err := predicateTables(c, subqueries, ts, expr.Right)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if len(lTables) == 1 && len(rTables) == 1 && lTables[0] != rTables[0] { //join
+			left, err := parseExpr(c, expr.Left, "")
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			right, err := parseExpr(c, expr.Right, "")
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			join := LogicalJoinNode{left, right, OpEq}
+			return nil, []*LogicalJoinNode{&join}, nil, nil
+		}
+	}
+	return []*LogicalFilterNode{{expr}}, nil, nil, nil
+}
+
+// If expr is [NOT] EXISTS (subquery) or x [NOT] IN (subquery), return a
+// semi-join node for it; otherwise return nil
+func parseSemiJoin(c *Catalog, expr sqlparser.Expr) (*LogicalSemiJoinNode, error) {
+	semiJoin := &LogicalSemiJoinNode{}
+	if not, ok := expr.(*sqlparser.NotExpr); ok {
+		semiJoin.anti = true
+		expr = not.Expr
+		if paren, ok := expr.(*sqlparser.ParenExpr); ok {
+			expr = paren.Expr
+		}
+	}
+	var subquery *sqlparser.Subquery
+	switch expr := expr.(type) {
+	case *sqlparser.ExistsExpr:
+		subquery = expr.Subquery
 	case *sqlparser.ComparisonExpr:
-		op := BoolOpMap[expr.Operator]
-		//print(op)
-		//print("got compare")
+		var ok bool
+		subquery, ok = expr.Right.(*sqlparser.Subquery)
+		if !ok || semiJoin.anti || (expr.Operator != sqlparser.InStr && expr.Operator != sqlparser.NotInStr) {
+			return nil, nil
+		}
+		semiJoin.left = expr.Left
+		semiJoin.anti = expr.Operator == sqlparser.NotInStr
+	default:
+		return nil, nil
+	}
+	sel, ok := subquery.Select.(*sqlparser.Select)
+	if !ok {
+		return nil, GoDBError{ParseError, fmt.Sprintf("unsupported subquery %s", sqlparser.String(subquery))}
+	}
+	var err error
+	semiJoin.subplan, err = parseStatement(c, sel)
+	if err != nil {
+		return nil, err
+	}
+	if semiJoin.left != nil && len(semiJoin.subplan.selects) != 1 {
+		return nil, GoDBError{ParseError, fmt.Sprintf("subquery %s must return a single column", sqlparser.String(subquery))}
+	}
+	return semiJoin, nil
+}
 
-		left, err := parseExpr(c, expr.Left, "")
+// Return the columns that a WHERE clause expression refers to
+func predicateColumns(c *Catalog, expr sqlparser.Expr) ([]*LogicalSelectNode, error) {
+	var cols []*LogicalSelectNode
+	err := sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch node := node.(type) {
+		case *sqlparser.ColName:
+			field, err := parseExpr(c, node, "")
+			if err != nil {
+				return false, err
+			}
+			cols = append(cols, field)
+		case *sqlparser.Subquery:
+			// the columns of a subquery refer to its own tables
+			return false, nil
+		}
+		return true, nil
+	}, expr)
+	return cols, err
+}
+
+// Return the distinct tables that a WHERE clause expression refers to
+func predicateTables(c *Catalog, subqueries []*LogicalPlan, ts []*LogicalTableNode, expr sqlparser.Expr) ([]string, error) {
+	cols, err := predicateColumns(c, expr)
+	if err != nil {
+		return nil, err
+	}
+	var tables []string
+	for _, col := range cols {
+		table, _, err := col.getTableField(c, subqueries, ts)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
-		right, err := parseExpr(c, expr.Right, "")
+		found := false
+		for _, t := range tables {
+			found = found || t == table
+		}
+		if !found {
+			tables = append(tables, table)
+		}
+	}
+	return tables, nil
+}
+
+// Return the distinct nodes of tableMap whose tables a WHERE clause
+// expression, or its correlated subqueries, refer to
+func exprNodes(c *Catalog, plan *LogicalPlan, expr sqlparser.Expr, tableMap map[string]*PlanNode) ([]*PlanNode, error) {
+	cols, err := predicateColumns(c, expr)
+	if err != nil {
+		return nil, err
+	}
+	outerCols, err := correlatedColumns(c, expr)
+	if err != nil {
+		return nil, err
+	}
+	return columnNodes(c, plan, append(cols, outerCols...), tableMap)
+}
+
+// Return the distinct nodes of tableMap whose tables cols refer to
+func columnNodes(c *Catalog, plan *LogicalPlan, cols []*LogicalSelectNode, tableMap map[string]*PlanNode) ([]*PlanNode, error) {
+	var nodes []*PlanNode
+	for _, col := range cols {
+		tabName, fieldName, err := col.getTableField(c, plan.subqueries, plan.tables)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
-		//here we want to search the catalog for the table id, if it's not specified
-		lTable, _, err := left.getTableField(c, subqueries, ts)
+		node, err := fieldToOp(tabName, fieldName, tableMap)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
+		}
+		found := false
+		for _, n := range nodes {
+			found = found || n.op == node.op
 		}
-		rTable, _, err := right.getTableField(c, subqueries, ts)
+		if !found {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, nil
+}
+
+// Apply the conjunction of preds to the tuples of node, as a single filter,
+// and replace node with the filter in tableMap
+func addFilter(c *Catalog, node *PlanNode, preds []sqlparser.Expr, tableMap map[string]*PlanNode) (*PlanNode, error) {
+	exprs := make([]Expr, len(preds))
+	for i, p := range preds {
+		expr, err := parsePredicate(c, p, node.desc, tableMap)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
-		if lTable != "" && rTable != "" && lTable != rTable { //join
+		exprs[i] = expr
+	}
+	pred := exprs[0]
+	if len(exprs) > 1 {
+		pred = &LogicExpr{"and", exprs}
+	}
+	newNode := &PlanNode{NewPredicateFilter(pred, node.op), node.desc}
+	replaceNode(tableMap, node, newNode)
+	return newNode, nil
+}
+
+// Replace node, which may be the node of several tables, with newNode
+func replaceNode(tableMap map[string]*PlanNode, node *PlanNode, newNode *PlanNode) {
+	for key, n := range tableMap {
+		if n.op == node.op {
+			tableMap[key] = newNode
+		}
+	}
+}
+
+// Apply a semi-join to the tuples of node, and replace node with it in
+// tableMap
+func addSemiJoin(c *Catalog, node *PlanNode, semiJoin *LogicalSemiJoinNode, tableMap map[string]*PlanNode) (*PlanNode, error) {
+	right, err := makePhysicalPlan(c, semiJoin.subplan)
+	if err != nil {
+		return nil, err
+	}
+	var leftKeys, rightKeys []Expr
+	if semiJoin.left != nil {
+		left, err := parseOperand(c, semiJoin.left, node.desc, tableMap)
+		if err != nil {
+			return nil, err
+		}
+		leftKeys = []Expr{left}
+	}
+	for _, key := range semiJoin.outerKeys {
+		left, _, err := key.generateExpr(c, node.desc, tableMap)
+		if err != nil {
+			return nil, err
+		}
+		leftKeys = append(leftKeys, left)
+	}
+	for _, f := range right.Descriptor().Fields[:len(leftKeys)] {
+		rightKeys = append(rightKeys, &FieldExpr{f})
+	}
+	// NOT IN is a null-aware anti-join, while NOT EXISTS is not
+	op, err := NewSemiJoin(node.op, leftKeys, right, rightKeys, semiJoin.anti, semiJoin.anti && semiJoin.left != nil)
+	if err != nil {
+		return nil, err
+	}
+	newNode := &PlanNode{op, node.desc}
+	replaceNode(tableMap, node, newNode)
+	return newNode, nil
+}
 
-			if op != OpEq {
-				return nil, nil, GoDBError{IllegalOperationError, "only equality joins are supported"}
+// Apply each of the semi-joins whose left operand and outer keys refer to the
+// tables of a single node of tableMap to that node.  The semi-joins that could not be
+// applied yet are returned.
+func pushDownSemiJoins(c *Catalog, plan *LogicalPlan, semiJoins []*LogicalSemiJoinNode, tableMap map[string]*PlanNode) ([]*LogicalSemiJoinNode, error) {
+	var remaining []*LogicalSemiJoinNode
+	for _, semiJoin := range semiJoins {
+		var cols []*LogicalSelectNode
+		if semiJoin.left != nil {
+			var err error
+			cols, err = predicateColumns(c, semiJoin.left)
+			if err != nil {
+				return nil, err
 			}
-			join := LogicalJoinNode{left, right, op}
-			lj := make([]*LogicalJoinNode, 1)
-			lj[0] = &join
-			return nil, lj, nil
-		} else {
-			filter := LogicalFilterNode{*left, *right, op}
-			lf := make([]*LogicalFilterNode, 1)
-			lf[0] = &filter
-			return lf, nil, nil
 		}
+		for _, key := range semiJoin.outerKeys {
+			cols = append(cols, selectColumns(key)...)
+		}
+		nodes, err := columnNodes(c, plan, cols, tableMap)
+		if err != nil {
+			return nil, err
+		}
+		if len(nodes) != 1 {
+			remaining = append(remaining, semiJoin)
+			continue
+		}
+		if _, err := addSemiJoin(c, nodes[0], semiJoin, tableMap); err != nil {
+			return nil, err
+		}
+	}
+	return remaining, nil
+}
+
+// Apply each of the filters that refers to the tables of a single node of
+// tableMap to that node, combining the filters on each node into one.  The
+// filters that could not be applied yet are returned.
+func pushDownFilters(c *Catalog, plan *LogicalPlan, filters []*LogicalFilterNode, tableMap map[string]*PlanNode) ([]*LogicalFilterNode, error) {
+	var remaining []*LogicalFilterNode
+	var nodes []*PlanNode
+	preds := make(map[Operator][]sqlparser.Expr)
+	for _, f := range filters {
+		fNodes, err := exprNodes(c, plan, f.pred, tableMap)
+		if err != nil {
+			return nil, err
+		}
+		if len(fNodes) != 1 {
+			remaining = append(remaining, f)
+			continue
+		}
+		op := fNodes[0].op
+		if preds[op] == nil {
+			nodes = append(nodes, fNodes[0])
+		}
+		preds[op] = append(preds[op], f.pred)
+	}
+	for _, node := range nodes {
+		if _, err := addFilter(c, node, preds[node.op], tableMap); err != nil {
+			return nil, err
+		}
+	}
+	return remaining, nil
+}
+
+// Compile a boolean SQL expression into a predicate [Expr] over tuples with
+// descriptor desc.  Comparisons, [NOT] LIKE, [NOT] BETWEEN, [NOT] IN lists
+// and subqueries, EXISTS, IS [NOT] NULL, AND, OR, NOT and parentheses are
+// supported; operands may be any expression supported by parseExpr, or scalar
+// subqueries.
+func parsePredicate(c *Catalog, expr sqlparser.Expr, desc *TupleDesc, tableMap map[string]*PlanNode) (Expr, error) {
+	switch expr := expr.(type) {
+	case *sqlparser.AndExpr:
+		return parseLogicExpr(c, "and", desc, tableMap, expr.Left, expr.Right)
+	case *sqlparser.OrExpr:
+		return parseLogicExpr(c, "or", desc, tableMap, expr.Left, expr.Right)
+	case *sqlparser.NotExpr:
+		return parseLogicExpr(c, "not", desc, tableMap, expr.Expr)
+	case *sqlparser.ParenExpr:
+		return parsePredicate(c, expr.Expr, desc, tableMap)
+	case *sqlparser.ExistsExpr:
+		exists, _, err := compileSubquery(c, expr.Subquery, desc, tableMap, func(op Operator) subqueryExpr {
+			return &ExistsExpr{op: op}
+		})
+		return exists, err
+	case *sqlparser.IsExpr:
+		if expr.Operator != sqlparser.IsNullStr && expr.Operator != sqlparser.IsNotNullStr {
+			return nil, GoDBError{ParseError, fmt.Sprintf("unsupported predicate %s", expr.Operator)}
+		}
+		operand, err := parseOperand(c, expr.Expr, desc, tableMap)
+		if err != nil {
+			return nil, err
+		}
+		return &IsNullExpr{operand, expr.Operator == sqlparser.IsNotNullStr}, nil
+	case *sqlparser.RangeCond:
+		// a BETWEEN b AND c is a >= b AND a <= c
+		between := &sqlparser.AndExpr{
+			Left:  &sqlparser.ComparisonExpr{Operator: sqlparser.GreaterEqualStr, Left: expr.Left, Right: expr.From},
+			Right: &sqlparser.ComparisonExpr{Operator: sqlparser.LessEqualStr, Left: expr.Left, Right: expr.To},
+		}
+		if expr.Operator == sqlparser.NotBetweenStr {
+			return parsePredicate(c, &sqlparser.NotExpr{Expr: between}, desc, tableMap)
+		}
+		return parsePredicate(c, between, desc, tableMap)
+	case *sqlparser.ComparisonExpr:
+		switch expr.Operator {
+		case sqlparser.InStr, sqlparser.NotInStr:
+			return parseInList(c, expr, desc, tableMap)
+		case sqlparser.NotLikeStr:
+			like := &sqlparser.ComparisonExpr{Operator: sqlparser.LikeStr, Left: expr.Left, Right: expr.Right}
+			return parsePredicate(c, &sqlparser.NotExpr{Expr: like}, desc, tableMap)
+		}
+		op, ok := BoolOpMap[expr.Operator]
+		if !ok {
+			return nil, GoDBError{ParseError, fmt.Sprintf("unsupported comparison %s", expr.Operator)}
+		}
+		left, err := parseOperand(c, expr.Left, desc, tableMap)
+		if err != nil {
+			return nil, err
+		}
+		right, err := parseOperand(c, expr.Right, desc, tableMap)
+		if err != nil {
+			return nil, err
+		}
+		lType, rType := left.GetExprType().Ftype, right.GetExprType().Ftype
+		if lType != rType && lType != UnknownType && rType != UnknownType {
+			return nil, GoDBError{TypeMismatchError, fmt.Sprintf("cannot compare %s and %s values", typeNames[lType], typeNames[rType])}
+		}
+		return &CompareExpr{op, left, right}, nil
 	default:
-		return nil, nil, GoDBError{ParseError, "where expression with non value or column on RHS (disjunctions and nested where expressions are not supported)"}
+		return nil, GoDBError{ParseError, fmt.Sprintf("unsupported predicate %s", sqlparser.String(expr))}
+	}
+}
+
+// Compile an IN (or NOT IN) list, e.g., a IN (1, 2, 3), into a disjunction of
+// equality comparisons (or its negation), which gives the same result when
+// the operand or some of the values are NULL.  An IN subquery is compiled
+// into an [InSubqueryExpr].
+func parseInList(c *Catalog, expr *sqlparser.ComparisonExpr, desc *TupleDesc, tableMap map[string]*PlanNode) (Expr, error) {
+	if subquery, ok := expr.Right.(*sqlparser.Subquery); ok {
+		left, err := parseOperand(c, expr.Left, desc, tableMap)
+		if err != nil {
+			return nil, err
+		}
+		in, op, err := compileColumnSubquery(c, subquery, desc, tableMap, func(op Operator) subqueryExpr {
+			return &InSubqueryExpr{left: left, op: op}
+		})
+		if err != nil {
+			return nil, err
+		}
+		lType, rType := left.GetExprType().Ftype, op.Descriptor().Fields[0].Ftype
+		if lType != rType && lType != UnknownType && rType != UnknownType {
+			return nil, GoDBError{TypeMismatchError, fmt.Sprintf("cannot compare %s and %s values", typeNames[lType], typeNames[rType])}
+		}
+		if expr.Operator == sqlparser.NotInStr {
+			in = &LogicExpr{"not", []Expr{in}}
+		}
+		return in, nil
+	}
+	values, ok := expr.Right.(sqlparser.ValTuple)
+	if !ok {
+		return nil, GoDBError{ParseError, fmt.Sprintf("unsupported %s operand %s", expr.Operator, sqlparser.String(expr.Right))}
+	}
+	args := make([]sqlparser.Expr, len(values))
+	for i, val := range values {
+		args[i] = &sqlparser.ComparisonExpr{Operator: sqlparser.EqualStr, Left: expr.Left, Right: val}
+	}
+	in, err := parseLogicExpr(c, "or", desc, tableMap, args...)
+	if err != nil || expr.Operator == sqlparser.InStr {
+		return in, err
+	}
+	return &LogicExpr{"not", []Expr{in}}, nil
+}
+
+func parseLogicExpr(c *Catalog, op string, desc *TupleDesc, tableMap map[string]*PlanNode, args ...sqlparser.Expr) (Expr, error) {
+	exprs := make([]Expr, len(args))
+	for i, arg := range args {
+		expr, err := parsePredicate(c, arg, desc, tableMap)
+		if err != nil {
+			return nil, err
+		}
+		exprs[i] = expr
+	}
+	return &LogicExpr{op, exprs}, nil
+}
+
+func parseOperand(c *Catalog, expr sqlparser.Expr, desc *TupleDesc, tableMap map[string]*PlanNode) (Expr, error) {
+	if subquery, ok := expr.(*sqlparser.Subquery); ok {
+		scalar, _, err := compileColumnSubquery(c, subquery, desc, tableMap, func(op Operator) subqueryExpr {
+			return &ScalarSubqueryExpr{op: op}
+		})
+		return scalar, err
 	}
+	node, err := parseExpr(c, expr, "")
+	if err != nil {
+		return nil, err
+	}
+	operand, _, err := node.generateExpr(c, desc, tableMap)
+	return operand, err
 }
 
 func parseFrom(c *Catalog, t sqlparser.TableExpr) ([]*LogicalTableNode, []*LogicalPlan, []*LogicalJoinNode, error) {
@@ -266,9 +721,14 @@ func parseFrom(c *Catalog, t sqlparser.TableExpr) ([]*LogicalTableNode, []*Logic
 		case sqlparser.SimpleTableExpr:
 			tableName := strings.ToLower(sqlparser.GetTableName(tableEx.Expr).CompliantName())
 			//fmt.Printf("got simple table, name %s\n", tableName)
-			dbFile, err := c.GetTable(tableName)
-			if err != nil {
-				return nil, nil, nil, err
+			var dbFile DBFile
+			if cte := c.ctes[tableName]; cte != nil {
+				dbFile = cte.scan()
+			} else {
+				var err error
+				if dbFile, err = c.GetTable(tableName); err != nil {
+					return nil, nil, nil, err
+				}
 			}
 			table := LogicalTableNode{tableName,
 				strings.ToLower(sqlparser.String(tableEx.As)),
@@ -309,24 +769,88 @@ func parseFrom(c *Catalog, t sqlparser.TableExpr) ([]*LogicalTableNode, []*Logic
 		}
 		tabList := append(leftTables, rightTables...)
 		subPlanList := append(leftSubplans, rightSubplans...)
-		_, joins, err := parseWhere(c, subPlanList, tabList, joinTable.Condition.On)
+		on := joinTable.Condition.On
+		if len(joinTable.Condition.Using) > 0 {
+			on, err = usingCondition(c, leftTables, leftSubplans, rightTables, rightSubplans, joinTable.Condition.Using)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		if on == nil {
+			//CROSS JOIN, or JOIN without a condition
+			return tabList, subPlanList, append(leftJoins, rightJoins...), nil
+		}
+		filters, joins, semiJoins, err := parseWhere(c, subPlanList, tabList, on)
 		if err != nil {
 			return nil, nil, nil, err
 		}
+		if len(filters) > 0 || len(semiJoins) > 0 {
+			return nil, nil, nil, GoDBError{ParseError, "only equality comparisons between tables are supported in join conditions; use WHERE for other predicates"}
+		}
 		return tabList, subPlanList, append(leftJoins, append(rightJoins, joins...)...), nil
 
 	}
 	return nil, nil, nil, GoDBError{ParseError, "unknown query type in parseFrom"}
 }
 
-func isAgg(funcName string) bool {
-	aggs := []string{"count", "sum", "avg", "min", "max"}
-	for _, s := range aggs {
-		if s == funcName {
-			return true
+// Return the condition of a JOIN ... USING (columns) between relations with
+// the given tables and subplans on its left and right: an equality between
+// the column of the left relation and that of the right relation with each of
+// the names.  Each column must be in exactly one relation on either side.
+func usingCondition(c *Catalog, leftTables []*LogicalTableNode, leftSubplans []*LogicalPlan, rightTables []*LogicalTableNode, rightSubplans []*LogicalPlan, columns sqlparser.Columns) (sqlparser.Expr, error) {
+	// return the name of the relation with the column
+	relationWith := func(column string, tables []*LogicalTableNode, subplans []*LogicalPlan) (string, error) {
+		var names []string
+		for _, t := range tables {
+			for _, f := range (*t.file).Descriptor().Fields {
+				if f.Fname == column {
+					name := t.tableName
+					if t.alias != "" {
+						name = t.alias
+					}
+					names = append(names, name)
+					break
+				}
+			}
+		}
+		for _, p := range subplans {
+			for _, f := range p.getSubplanFields(c) {
+				if f.Fname == column {
+					names = append(names, p.alias)
+					break
+				}
+			}
 		}
+		switch len(names) {
+		case 0:
+			return "", GoDBError{ParseError, fmt.Sprintf("column %s in USING clause is not in both joined relations", column)}
+		case 1:
+			return names[0], nil
+		}
+		return "", GoDBError{ParseError, fmt.Sprintf("column %s in USING clause is ambiguous", column)}
 	}
-	return false
+	var cond sqlparser.Expr
+	for _, col := range columns {
+		column := strings.ToLower(col.String())
+		left, err := relationWith(column, leftTables, leftSubplans)
+		if err != nil {
+			return nil, err
+		}
+		right, err := relationWith(column, rightTables, rightSubplans)
+		if err != nil {
+			return nil, err
+		}
+		var eq sqlparser.Expr = &sqlparser.ComparisonExpr{
+			Operator: sqlparser.EqualStr,
+			Left:     &sqlparser.ColName{Name: col, Qualifier: sqlparser.TableName{Name: sqlparser.NewTableIdent(left)}},
+			Right:    &sqlparser.ColName{Name: col, Qualifier: sqlparser.TableName{Name: sqlparser.NewTableIdent(right)}},
+		}
+		if cond != nil {
+			eq = &sqlparser.AndExpr{Left: cond, Right: eq}
+		}
+		cond = eq
+	}
+	return cond, nil
 }
 
 func parseExpr(c *Catalog, expr sqlparser.Expr, alias string) (*LogicalSelectNode, error) {
@@ -334,23 +858,36 @@ func parseExpr(c *Catalog, expr sqlparser.Expr, alias string) (*LogicalSelectNod
 	case *sqlparser.FuncExpr:
 		funName := strings.ToLower(sqlparser.String(expr.Name))
 		if isAgg(funName) {
-			if len(expr.Exprs) != 1 {
-				return nil, GoDBError{ParseError, fmt.Sprintf("expected one argument to aggregate %s in select list", sqlparser.String(expr.Name))}
+			if len(expr.Exprs) != aggregates[funName].params+1 {
+				return nil, GoDBError{ParseError, fmt.Sprintf("expected %d arguments to aggregate %s in select list", aggregates[funName].params+1, sqlparser.String(expr.Name))}
 			}
 			star, ok := expr.Exprs[0].(*sqlparser.StarExpr)
 			if ok {
-				if funName != "count" {
+				if funName != "count" || expr.Distinct {
 					return nil, GoDBError{ParseError, "got * in non-count aggregate"}
 				}
 				subField := NewFieldSelectNode(strings.ToLower(sqlparser.String(star.TableName)), "*", "")
 				field := NewAggrSelectNode(funName, &subField, alias)
 				return &field, nil
 			}
-			field, err := parseSelect(c, expr.Exprs[0])
+			field, err := parseAggArg(c, expr.Exprs[0])
 			if err != nil {
 				return nil, err
 			}
 			outer := NewAggrSelectNode(funName, field, alias)
+			outer.distinct = expr.Distinct
+			// the remaining arguments are constants, which follow the
+			// aggregated expression in args
+			for _, param := range expr.Exprs[1:] {
+				node, err := parseSelect(c, param)
+				if err != nil {
+					return nil, err
+				}
+				if node.exprType != ExprConst || node.null {
+					return nil, GoDBError{ParseError, fmt.Sprintf("arguments of aggregate %s after the first must be constants", funName)}
+				}
+				outer.args = append(outer.args, node)
+			}
 			return &outer, nil
 		} else {
 			funName := strings.ToLower(sqlparser.String(expr.Name))
@@ -403,11 +940,47 @@ func parseExpr(c *Catalog, expr sqlparser.Expr, alias string) (*LogicalSelectNod
 		}
 		field := NewConstSelectNode(str, alias)
 		return &field, nil
+	case *sqlparser.NullVal:
+		field := NewNullSelectNode(alias)
+		return &field, nil
 	default:
 		return nil, GoDBError{ParseError, fmt.Sprintf("unsupported expression type %s in select list", reflect.TypeOf(expr))}
 	}
 
 }
+
+// Parse the aggregated argument of an aggregate, which may be a predicate,
+// as in bool_and(age > 40), as well as any expression of a select list
+func parseAggArg(c *Catalog, arg sqlparser.SelectExpr) (*LogicalSelectNode, error) {
+	if aliased, ok := arg.(*sqlparser.AliasedExpr); ok && isPredicate(aliased.Expr) {
+		node := NewPredSelectNode(aliased.Expr, "")
+		return &node, nil
+	}
+	return parseSelect(c, arg)
+}
+
+// Return true if expr is a boolean expression, which parsePredicate rather
+// than parseExpr compiles
+func isPredicate(expr sqlparser.Expr) bool {
+	switch expr := expr.(type) {
+	case *sqlparser.ParenExpr:
+		return isPredicate(expr.Expr)
+	case *sqlparser.ComparisonExpr, *sqlparser.AndExpr, *sqlparser.OrExpr, *sqlparser.NotExpr,
+		*sqlparser.IsExpr, *sqlparser.RangeCond, *sqlparser.ExistsExpr:
+		return true
+	}
+	return false
+}
+
+// Return the values of the constant arguments of an aggregate
+func aggParams(args []*LogicalSelectNode) []string {
+	params := make([]string, len(args))
+	for i, arg := range args {
+		params[i] = arg.value
+	}
+	return params
+}
+
 func parseSelect(c *Catalog, stmt sqlparser.SelectExpr) (*LogicalSelectNode, error) {
 	star, ok := stmt.(*sqlparser.StarExpr)
 	if ok {
@@ -440,45 +1013,115 @@ func extractAggs(s *LogicalSelectNode) []*LogicalSelectNode {
 	return nil
 }
 
-func parseStatement(c *Catalog, s *sqlparser.Select) (*LogicalPlan, error) {
-	from := s.From
-	var (
-		tables   []*LogicalTableNode
-		subplans []*LogicalPlan
-		joins    []*LogicalJoinNode
-		filters  []*LogicalFilterNode
-		aggs     []*LogicalSelectNode
-		selects  []*LogicalSelectNode
-		groupBys []*GroupBy
-		orderBys []*OrderByNode
-	)
-
-	for _, t := range from {
-		newTables, newSubplans, newJoins, err := parseFrom(c, t)
+// Add the aggregates of a HAVING clause to aggs, under the names __having0,
+// __having1, ..., and replace them in the clause with references to those
+// names, so that it can be evaluated over the output of the aggregation
+func parseHaving(c *Catalog, having sqlparser.Expr, aggs []*LogicalSelectNode) (sqlparser.Expr, []*LogicalSelectNode, error) {
+	var funcs []*sqlparser.FuncExpr
+	sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch node := node.(type) {
+		case *sqlparser.FuncExpr:
+			if isAgg(strings.ToLower(sqlparser.String(node.Name))) {
+				funcs = append(funcs, node)
+				return false, nil
+			}
+		case *sqlparser.Subquery:
+			return false, nil
+		}
+		return true, nil
+	}, having)
+	for i, f := range funcs {
+		alias := fmt.Sprintf("__having%d", i)
+		agg, err := parseExpr(c, f, alias)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		tables = append(tables, newTables...)
-		subplans = append(subplans, newSubplans...)
-		joins = append(joins, newJoins...)
+		aggs = append(aggs, agg)
+		having = sqlparser.ReplaceExpr(having, f, &sqlparser.ColName{Name: sqlparser.NewColIdent(alias)})
 	}
-	where := s.Where
-	if where != nil {
-		//var newTs []*LogicalTableNode
-		//for _, s := range subplans {
-		//newTs = append(newTs, s.getTableNodes(c)...)
-		/*			for _, f := range s.selects {
+	return having, aggs, nil
+}
+
+func parseOrderByLimit(c *Catalog, orderBy sqlparser.OrderBy, lim *sqlparser.Limit) ([]*OrderByNode, *LimitNode, error) {
+	var orderBys []*OrderByNode
+	for _, oby := range orderBy {
+		expr, err := parseExpr(c, oby.Expr, "")
+		if err != nil {
+			return nil, nil, err
+		}
+		orderBys = append(orderBys, &OrderByNode{expr, oby.Direction == sqlparser.AscScr})
+
+	}
+
+	var limit *LimitNode
+	if lim != nil {
+		count, err := parseExpr(c, lim.Rowcount, "")
+		if err != nil {
+			return nil, nil, err
+		}
+		limit = &LimitNode{count, nil}
+		if lim.Offset != nil {
+			if limit.offset, err = parseExpr(c, lim.Offset, ""); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return orderBys, limit, nil
+}
+
+func parseStatement(c *Catalog, s *sqlparser.Select) (*LogicalPlan, error) {
+	from := s.From
+	var (
+		tables    []*LogicalTableNode
+		subplans  []*LogicalPlan
+		joins     []*LogicalJoinNode
+		filters   []*LogicalFilterNode
+		semiJoins []*LogicalSemiJoinNode
+		aggs      []*LogicalSelectNode
+		selects   []*LogicalSelectNode
+		orderBys  []*OrderByNode
+	)
+	//the window functions of the select list are replaced below, so find
+	//the columns the statement refers to first
+	columnRefs := columnReferences(s)
+
+	for _, t := range from {
+		newTables, newSubplans, newJoins, err := parseFrom(c, t)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, newTables...)
+		subplans = append(subplans, newSubplans...)
+		joins = append(joins, newJoins...)
+	}
+	where := s.Where
+	if where != nil {
+		//var newTs []*LogicalTableNode
+		//for _, s := range subplans {
+		//newTs = append(newTs, s.getTableNodes(c)...)
+		/*			for _, f := range s.selects {
 						field, tab, _ := f.getTableField(c, s.tables)
 						fmt.Printf("%s.%s (%s)\n", field, s.alias, f.alias)
 					}
 		*/
 		//}
-		newFilters, newJoins, err := parseWhere(c, subplans, tables, where.Expr)
+		newFilters, newJoins, newSemiJoins, err := parseWhere(c, subplans, tables, where.Expr)
 		if err != nil {
 			return nil, err
 		}
 		joins = append(joins, newJoins...)
 		filters = append(filters, newFilters...)
+		semiJoins = append(semiJoins, newSemiJoins...)
+	}
+	windows, err := parseWindows(c, s.SelectExprs)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkWindowPlacement(s); err != nil {
+		return nil, err
+	}
+	for _, w := range windows {
+		aggs = append(aggs, w.aggs()...)
 	}
 	//extract select list
 	for _, stmt := range s.SelectExprs {
@@ -490,35 +1133,32 @@ func parseStatement(c *Catalog, s *sqlparser.Select) (*LogicalPlan, error) {
 		aggs = append(aggs, extractAggs(sel)...)
 	}
 
-	for _, gby := range s.GroupBy {
-		expr, err := parseExpr(c, gby, "")
-		if err != nil {
-			return nil, err
-		}
-		groupBys = append(groupBys, &GroupBy{expr})
+	if err := checkGroupingSetsPlacement(s); err != nil {
+		return nil, err
 	}
-
-	for _, oby := range s.OrderBy {
-		expr, err := parseExpr(c, oby.Expr, "")
-		if err != nil {
-			return nil, err
-		}
-		orderBys = append(orderBys, &OrderByNode{expr, oby.Direction == sqlparser.AscScr})
-
+	groupBys, groupingSets, err := parseGroupBy(c, s.GroupBy)
+	if err != nil {
+		return nil, err
 	}
 
-	lim := s.Limit
-	var limExpr *LogicalSelectNode
-	if lim != nil {
+	var having sqlparser.Expr
+	if s.Having != nil {
 		var err error
-		limExpr, err = parseExpr(c, lim.Rowcount, "")
+		having, aggs, err = parseHaving(c, s.Having.Expr, aggs)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	p := LogicalPlan{filters, joins, selects, aggs, tables, subplans, groupBys, orderBys, limExpr, s.Distinct != "", ""}
+	orderBys, limExpr, err := parseOrderByLimit(c, s.OrderBy, s.Limit)
+	if err != nil {
+		return nil, err
+	}
 
+	p := LogicalPlan{filters, joins, semiJoins, selects, aggs, tables, subplans, groupBys, groupingSets, having, windows, orderBys, limExpr, s.Distinct != "", "", false, columnRefs}
+	if err := p.decorrelate(c); err != nil {
+		return nil, err
+	}
 	return &p, nil
 }
 
@@ -633,7 +1273,9 @@ func (s *LogicalSelectNode) generateExpr(c *Catalog, inputDesc *TupleDesc, table
 		var fval any
 		constType := StringType
 		intFval, e := strconv.Atoi(s.value)
-		if e == nil {
+		if s.null {
+			constType = UnknownType
+		} else if e == nil {
 			constType = IntType
 			fval = IntField{int64(intFval)}
 		} else {
@@ -659,8 +1301,18 @@ func (s *LogicalSelectNode) generateExpr(c *Catalog, inputDesc *TupleDesc, table
 			exprs[i] = &newExpr
 		}
 
-		fe := FuncExpr{*s.funcOp, exprs}
+		fe := FuncExpr{*s.funcOp, exprs, c}
 		return &fe, fieldName, nil
+	case ExprPred:
+		fieldName := sqlparser.String(s.pred)
+		if s.alias != "" {
+			fieldName = s.alias
+		}
+		pred, err := parsePredicate(c, s.pred, inputDesc, tableMap)
+		if err != nil {
+			return nil, "", err
+		}
+		return pred, fieldName, nil
 	}
 	return nil, "", GoDBError{ParseError, "unhandled expression type in select list"}
 
@@ -684,6 +1336,30 @@ func exprToStr(e Expr) string {
 			argStr += fmt.Sprintf("%s,", exprToStr(*arg))
 		}
 		return fmt.Sprintf("%s(%s)", ex.op, argStr)
+	case *CompareExpr:
+		return fmt.Sprintf("%s %s %s", exprToStr(ex.left), opToStr(ex.op), exprToStr(ex.right))
+	case *LogicExpr:
+		if ex.op == "not" {
+			return fmt.Sprintf("not (%s)", exprToStr(ex.args[0]))
+		}
+		argStrs := make([]string, len(ex.args))
+		for i, arg := range ex.args {
+			argStrs[i] = "(" + exprToStr(arg) + ")"
+		}
+		return strings.Join(argStrs, " "+ex.op+" ")
+	case *ScalarSubqueryExpr:
+		return "(subquery)"
+	case *InSubqueryExpr:
+		return fmt.Sprintf("%s in (subquery)", exprToStr(ex.left))
+	case *ExistsExpr:
+		return "exists (subquery)"
+	case *CorrelatedSubqueryExpr:
+		return "(correlated subquery)"
+	case *IsNullExpr:
+		if ex.not {
+			return fmt.Sprintf("%s is not null", exprToStr(ex.expr))
+		}
+		return fmt.Sprintf("%s is null", exprToStr(ex.expr))
 	default:
 		return fmt.Sprintf("%+v, ", e)
 	}
@@ -738,48 +1414,139 @@ func getStrFromObj(obj any) string {
 }
 
 func PrintPhysicalPlan(o Operator, indent string) {
+	writePhysicalPlan(os.Stdout, o, indent)
+}
+
+// Write a description of the plan o to w, one operator per line, with the
+// children of each operator following it, indented by a further tab
+func writePhysicalPlan(w io.Writer, o Operator, indent string) {
 	switch op := o.(type) {
 	case *EqualityJoin[int64]:
-		fmt.Printf("%sJoin, %+v == %+v\n", indent, exprToStr(op.leftField), exprToStr(op.rightField))
+		fmt.Fprintf(w, "%sJoin, %+v == %+v\n", indent, exprToStr(op.leftField), exprToStr(op.rightField))
 		indent = indent + "\t"
-		PrintPhysicalPlan(*op.left, indent)
-		PrintPhysicalPlan(*op.right, indent)
+		writePhysicalPlan(w, *op.left, indent)
+		writePhysicalPlan(w, *op.right, indent)
 	case *EqualityJoin[string]:
-		fmt.Printf("%sJoin, %+v == %+v\n", indent, exprToStr(op.leftField), exprToStr(op.rightField))
+		fmt.Fprintf(w, "%sJoin, %+v == %+v\n", indent, exprToStr(op.leftField), exprToStr(op.rightField))
 		indent = indent + "\t"
-		PrintPhysicalPlan(*op.left, indent)
-		PrintPhysicalPlan(*op.right, indent)
+		writePhysicalPlan(w, *op.left, indent)
+		writePhysicalPlan(w, *op.right, indent)
 
+	case *CrossProduct:
+		fmt.Fprintf(w, "%sCross Product\n", indent)
+		indent = indent + "\t"
+		writePhysicalPlan(w, op.left, indent)
+		writePhysicalPlan(w, op.right, indent)
+
+	case *Window:
+		var funcs []string
+		for _, f := range op.funcs {
+			funcs = append(funcs, f.name)
+		}
+		var keys []string
+		for _, e := range op.partitionBy {
+			keys = append(keys, exprToStr(e))
+		}
+		fmt.Fprintf(w, "%sWindow %s partition by %s order by %d fields\n", indent, strings.Join(funcs, ","), strings.Join(keys, ","), len(op.orderBy))
+		indent = indent + "\t"
+		writePhysicalPlan(w, op.child, indent)
+	case *SetOp:
+		all := ""
+		if op.all {
+			all = " All"
+		}
+		fmt.Fprintf(w, "%s%s%s\n", indent, strings.ToUpper(op.op[:1])+op.op[1:], all)
+		indent = indent + "\t"
+		writePhysicalPlan(w, op.left, indent)
+		writePhysicalPlan(w, op.right, indent)
 	case *Project:
 		selectStr := ""
 		for _, ex := range op.selectFields {
 			selectStr += exprToStr(ex) + ","
 		}
-		fmt.Printf("%sProject %+v -> %+v\n", indent, selectStr, op.outputNames)
+		fmt.Fprintf(w, "%sProject %+v -> %+v\n", indent, selectStr, op.outputNames)
 		indent = indent + "\t"
-		PrintPhysicalPlan(op.child, indent)
+		writePhysicalPlan(w, op.child, indent)
 	case *Filter[int64]:
-		fmt.Printf("%sFilter %s %s %s\n", indent, exprToStr(op.left), opToStr(op.op), exprToStr(op.right))
+		fmt.Fprintf(w, "%sFilter %s %s %s\n", indent, exprToStr(op.left), opToStr(op.op), exprToStr(op.right))
 		indent = indent + "\t"
-		PrintPhysicalPlan(op.child, indent)
+		writePhysicalPlan(w, op.child, indent)
 	case *Filter[string]:
-		fmt.Printf("%sFilter %s %s %s\n", indent, exprToStr(op.left), opToStr(op.op), exprToStr(op.right))
+		fmt.Fprintf(w, "%sFilter %s %s %s\n", indent, exprToStr(op.left), opToStr(op.op), exprToStr(op.right))
+		indent = indent + "\t"
+		writePhysicalPlan(w, op.child, indent)
+	case *PredicateFilter:
+		fmt.Fprintf(w, "%sFilter %s\n", indent, exprToStr(op.pred))
 		indent = indent + "\t"
-		PrintPhysicalPlan(op.child, indent)
+		writePhysicalPlan(w, op.child, indent)
+	case *SemiJoin:
+		name := "Semi Join"
+		if op.anti {
+			name = "Anti Join"
+		}
+		keyStrs := make([]string, len(op.leftKeys))
+		for i, key := range op.leftKeys {
+			keyStrs[i] = exprToStr(key) + " == " + exprToStr(op.rightKeys[i])
+		}
+		fmt.Fprintf(w, "%s%s, %s\n", indent, name, strings.Join(keyStrs, ", "))
+		indent = indent + "\t"
+		writePhysicalPlan(w, op.left, indent)
+		writePhysicalPlan(w, op.right, indent)
 	case *HeapFile:
-		fmt.Printf("%sHeap Scan %v\n", indent, getStrFromObj(op))
+		fmt.Fprintf(w, "%sHeap Scan %v\n", indent, getStrFromObj(op))
+	case *ColumnFile:
+		fmt.Fprintf(w, "%sColumn Scan %v\n", indent, strings.Join(op.filenames, ", "))
+	case *ColumnScan:
+		var files []string
+		for _, i := range op.columns {
+			files = append(files, op.file.filenames[i])
+		}
+		fmt.Fprintf(w, "%sColumn Scan %v\n", indent, strings.Join(files, ", "))
+	case *ValueOp:
+		fmt.Fprintf(w, "%sValues, %d rows\n", indent, len(op.exprs))
+	case *InsertOp:
+		fmt.Fprintf(w, "%sInsert %v\n", indent, getStrFromObj(op.file))
+		writePhysicalPlan(w, op.child, indent+"\t")
+	case *DeleteOp:
+		fmt.Fprintf(w, "%sDelete %v\n", indent, getStrFromObj(op.file))
+		writePhysicalPlan(w, op.child, indent+"\t")
+	case *UpdateOp:
+		fmt.Fprintf(w, "%sUpdate %v\n", indent, getStrFromObj(op.file))
+		writePhysicalPlan(w, op.child, indent+"\t")
+	case *instrumentedOp:
+		// the counters follow the line of the operator
+		var buf strings.Builder
+		writePhysicalPlan(&buf, op.child, indent)
+		line, rest, _ := strings.Cut(buf.String(), "\n")
+		fmt.Fprintf(w, "%s %s\n%s", line, op.counters(), rest)
 	case *OrderBy:
 		orderStr := ""
 		for _, ex := range op.orderBy {
 			orderStr += exprToStr(ex) + ","
 		}
-		fmt.Printf("%sOrder By %s\n", indent, orderStr)
+		fmt.Fprintf(w, "%sOrder By %s\n", indent, orderStr)
 		indent = indent + "\t"
-		PrintPhysicalPlan(op.child, indent)
+		writePhysicalPlan(w, op.child, indent)
 	case *LimitOp:
-		fmt.Printf("%sLimit %s\n", indent, exprToStr(op.limitTups))
+		offsetStr := ""
+		if op.offsetTups != nil {
+			offsetStr = " Offset " + exprToStr(op.offsetTups)
+		}
+		fmt.Fprintf(w, "%sLimit %s%s\n", indent, exprToStr(op.limitTups), offsetStr)
 		indent = indent + "\t"
-		PrintPhysicalPlan(op.child, indent)
+		writePhysicalPlan(w, op.child, indent)
+	case *TopN:
+		orderStr := ""
+		for _, ex := range op.orderBy {
+			orderStr += exprToStr(ex) + ","
+		}
+		offsetStr := ""
+		if op.offset != nil {
+			offsetStr = " Offset " + exprToStr(op.offset)
+		}
+		fmt.Fprintf(w, "%sTop %s%s Order By %s\n", indent, exprToStr(op.limit), offsetStr, orderStr)
+		indent = indent + "\t"
+		writePhysicalPlan(w, op.child, indent)
 	case *Aggregator:
 		gbyStr := ""
 		if len(op.groupByFields) > 0 {
@@ -795,11 +1562,15 @@ func PrintPhysicalPlan(o Operator, indent string) {
 			aggStr += fmt.Sprintf("%s(%s),", reflect.TypeOf(ex), ex.GetTupleDesc().HeaderString(false))
 		}
 
-		fmt.Printf("%sAggregate, %s %s\n", indent, aggStr, gbyStr)
+		if op.groupingSets != nil {
+			gbyStr += fmt.Sprintf(" Grouping Sets %v", op.groupingSets)
+		}
+
+		fmt.Fprintf(w, "%sAggregate, %s %s\n", indent, aggStr, gbyStr)
 		indent = indent + "\t"
-		PrintPhysicalPlan(op.child, indent)
+		writePhysicalPlan(w, op.child, indent)
 	default:
-		fmt.Printf("%sUnknown op, %s\n", indent, reflect.TypeOf(op))
+		fmt.Fprintf(w, "%sUnknown op, %s\n", indent, reflect.TypeOf(op))
 	}
 }
 
@@ -807,12 +1578,16 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (Operator, error) {
 	//build mapping from table names / aliases to operators
 
 	tableMap := make(map[string]*PlanNode)
+	var hiddenFields []FieldType
 
 	for _, p := range plan.subqueries {
 		subPhysP, err := makePhysicalPlan(c, p)
 		if err != nil {
 			return nil, err
 		}
+		if p.hidden {
+			hiddenFields = append(hiddenFields, subPhysP.Descriptor().Fields...)
+		}
 		var td *TupleDesc = subPhysP.Descriptor()
 		td.setTableAlias(p.alias)
 		//td = td.setTableAlias(p.alias)
@@ -826,49 +1601,36 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (Operator, error) {
 		var td *TupleDesc = (*t.file).Descriptor()
 		td.setTableAlias(name)
 		//td = td.setTableAlias(name)
-		tableMap[name] = &PlanNode{*t.file, td}
-	}
-
-	//now apply each filter to appropriate table
-	for _, f := range plan.filters {
-		tabName, fieldName, err := f.fieldExpr.getTableField(c, plan.subqueries, plan.tables)
-		if err != nil {
-			return nil, err
-		}
-		node, err := fieldToOp(tabName, fieldName, tableMap)
-		if err != nil {
-			return nil, err
-		}
-		leftExpr, _, err := f.fieldExpr.generateExpr(c, node.desc, tableMap)
-		if err != nil {
-			return nil, err
-		}
-		rightExpr, _, err := f.constExpr.generateExpr(c, node.desc, tableMap)
-		if err != nil {
-			return nil, err
-		}
-
-		op := node.op
-		desc := *op.Descriptor()
-		desc.setTableAlias(tabName)
-
-		switch leftExpr.GetExprType().Ftype {
-		case IntType:
-			newOp, err := NewIntFilter(rightExpr, f.predOp, leftExpr, op)
-			if err != nil {
-				return nil, err
-			}
-			tableMap[leftExpr.GetExprType().TableQualifier] = &PlanNode{newOp, &desc}
-		case StringType:
-			newOp, err := NewStringFilter(rightExpr, f.predOp, leftExpr, op)
-			if err != nil {
-				return nil, err
+		var op Operator = *t.file
+		//only read the columns of column files that the query refers to
+		if cf, ok := op.(*ColumnFile); ok {
+			if columns := plan.scanColumns(t, td); columns != nil {
+				scan, err := NewColumnScan(cf, columns)
+				if err != nil {
+					return nil, err
+				}
+				op, td = scan, scan.Descriptor()
 			}
-			tableMap[leftExpr.GetExprType().TableQualifier] = &PlanNode{newOp, &desc}
 		}
+		tableMap[name] = &PlanNode{op, td}
+	}
+
+	//now apply each filter to the table it refers to; filters over several
+	//tables are applied once those tables have been joined
+	filters, err := pushDownFilters(c, plan, plan.filters, tableMap)
+	if err != nil {
+		return nil, err
 	}
-	//finally apply joins
-	for _, j := range plan.joins {
+	semiJoins, err := pushDownSemiJoins(c, plan, plan.semiJoins, tableMap)
+	if err != nil {
+		return nil, err
+	}
+	//finally apply joins, in the order chosen by the optimizer
+	joins, crosses, err := orderJoins(c, plan, tableMap)
+	if err != nil {
+		return nil, err
+	}
+	for _, j := range joins {
 		lTabName, lFieldName, err := j.left.getTableField(c, plan.subqueries, plan.tables)
 		if err != nil {
 			return nil, err
@@ -909,6 +1671,13 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (Operator, error) {
 		if err != nil {
 			return nil, err
 		}
+		if op1 == op2 {
+			//both sides have already been joined by an earlier join, so
+			//this one only filters the result
+			filter := NewPredicateFilter(&CompareExpr{OpEq, leftExpr, rightExpr}, op1)
+			replaceNode(tableMap, node1, &PlanNode{filter, node1.desc})
+			continue
+		}
 
 		var (
 			newOp Operator
@@ -934,28 +1703,79 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (Operator, error) {
 		tableMap[lTabName] = newNode
 		tableMap[rTabName] = newNode
 		//&PlanNode{newOp, newOp.Descriptor()}
+		filters, err = pushDownFilters(c, plan, filters, tableMap)
+		if err != nil {
+			return nil, err
+		}
+		semiJoins, err = pushDownSemiJoins(c, plan, semiJoins, tableMap)
+		if err != nil {
+			return nil, err
+		}
 
 	}
 
-	//check that all tables have the same op (all tables are joined)
-	first := true
-	var curOp Operator
-	for _, node := range tableMap {
-		if first {
-			curOp = node.op
-			first = false
-		} else {
-			if curOp != node.op {
-				return nil, GoDBError{ParseError, "not all tables are joined, cross products are not supported in GoDB"}
-			}
+	//then cross the results of the joins that are not connected by join
+	//predicates, in the order chosen by the optimizer
+	var curNode *PlanNode
+	for _, name := range crosses {
+		node := tableMap[name]
+		if curNode == nil {
+			curNode = node
+			continue
+		}
+		if node.op == curNode.op {
+			continue
+		}
+		newOp, err := NewCrossProduct(curNode.op, node.op, JoinBufferSize)
+		if err != nil {
+			return nil, err
+		}
+		newNode := &PlanNode{newOp, newOp.Descriptor()}
+		replaceNode(tableMap, curNode, newNode)
+		replaceNode(tableMap, node, newNode)
+		curNode = newNode
+		filters, err = pushDownFilters(c, plan, filters, tableMap)
+		if err != nil {
+			return nil, err
 		}
+		semiJoins, err = pushDownSemiJoins(c, plan, semiJoins, tableMap)
+		if err != nil {
+			return nil, err
+		}
+		curNode = tableMap[name]
 	}
 
-	topOp := curOp
+	//filters and semi-joins that refer to no tables are applied to the
+	//result of the joins
+	if len(filters) > 0 {
+		preds := make([]sqlparser.Expr, len(filters))
+		for i, f := range filters {
+			preds[i] = f.pred
+		}
+		curNode, err = addFilter(c, curNode, preds, tableMap)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, semiJoin := range semiJoins {
+		curNode, err = addSemiJoin(c, curNode, semiJoin, tableMap)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	topOp := curNode.op
 
 	//var fieldList []FieldType
 	var fieldNames []string
-	hasAgg := len(plan.aggs) > 0
+	var groupings []*LogicalSelectNode
+	for _, s := range plan.selects {
+		groupings = append(groupings, extractGroupings(s)...)
+	}
+	if len(groupings) > 0 && len(plan.groupByFields) == 0 {
+		return nil, GoDBError{ParseError, "GROUPING requires a GROUP BY"}
+	}
+	hasAgg := len(plan.aggs) > 0 || plan.groupingSets != nil || len(groupings) > 0
 	selectAll := false
 
 	/*
@@ -984,10 +1804,7 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (Operator, error) {
 				}
 			*/
 
-			var getter func(DBValue) any
 			if s.exprType == ExprAggr {
-				var as AggState
-
 				tabName, fieldName, err := s.args[0].getTableField(c, plan.subqueries, plan.tables)
 				if err != nil {
 					return nil, err
@@ -1001,35 +1818,9 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (Operator, error) {
 					return nil, err
 				}
 
-				switch aggExpr.GetExprType().Ftype {
-				case IntType:
-					getter = intAggGetter
-				case StringType:
-					getter = stringAggGetter
-				}
-
-				switch *s.funcOp {
-				case "max":
-					if aggExpr.GetExprType().Ftype == StringType {
-						as = &MaxAggState[string]{}
-					} else {
-						as = &MaxAggState[int64]{}
-					}
-
-				case "min":
-					if aggExpr.GetExprType().Ftype == StringType {
-						as = &MinAggState[string]{}
-					} else {
-						as = &MinAggState[int64]{}
-					}
-				case "avg":
-					as = &AvgAggState[int64]{}
-				case "sum":
-					as = &SumAggState[int64]{}
-				case "count":
-					as = &CountAggState{}
-				default:
-					return nil, GoDBError{IllegalOperationError, fmt.Sprintf("unknown aggregate function %s", *s.funcOp)}
+				as, getter, err := newAggState(*s.funcOp, aggExpr.GetExprType().Ftype, s.distinct, aggParams(s.args[1:]))
+				if err != nil {
+					return nil, err
 				}
 				//make sure name has unique id
 				name := fmt.Sprintf("%s(%s.%s)%d", *s.funcOp, tabName, fieldName, aggCnt)
@@ -1037,7 +1828,13 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (Operator, error) {
 				if s.alias != "" {
 					name = s.alias
 				}
-				as.Init(name, aggExpr, getter)
+				// COUNT(*) counts every tuple, so has no expression
+				if s.args[0].field == "*" && s.args[0].funcOp == nil {
+					aggExpr = nil
+				}
+				if err := as.Init(name, aggExpr, getter); err != nil {
+					return nil, err
+				}
 				aggs = append(aggs, as)
 				s.cachedField = &as.GetTupleDesc().Fields[0] //track aggregates by reference rather than name
 			}
@@ -1051,12 +1848,39 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (Operator, error) {
 			gbys = append(gbys, expr)
 		}
 
-		if len(gbys) == 0 {
+		if plan.groupingSets != nil || len(groupings) > 0 {
+			args, err := groupingArgs(c, groupings, gbys, topOp.Descriptor(), tableMap)
+			if err != nil {
+				return nil, err
+			}
+			topOp = NewGroupingSetsAggregator(aggs, gbys, plan.groupingSets, args, topOp)
+			//the GROUPING() calls select the fields of the aggregator that
+			//compute them
+			desc := topOp.Descriptor()
+			for i, g := range groupings {
+				g.exprType = ExprAggr
+				g.cachedField = &desc.Fields[len(desc.Fields)-len(groupings)+i]
+			}
+		} else if len(gbys) == 0 {
 			topOp = NewAggregator(aggs, topOp)
 		} else {
 			topOp = NewGroupedAggregator(aggs, gbys, topOp)
 		}
 	}
+	if plan.having != nil {
+		pred, err := parsePredicate(c, plan.having, topOp.Descriptor(), tableMap)
+		if err != nil {
+			return nil, err
+		}
+		topOp = NewPredicateFilter(pred, topOp)
+	}
+	if len(plan.windows) > 0 {
+		var err error
+		topOp, err = addWindows(c, topOp, plan.windows, tableMap)
+		if err != nil {
+			return nil, err
+		}
+	}
 	exprList := make([]Expr, len(plan.selects))
 	for i, s := range plan.selects {
 		switch s.exprType {
@@ -1073,6 +1897,22 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (Operator, error) {
 			fieldNames = append(fieldNames, field)
 		}
 	}
+	if selectAll && len(hiddenFields) > 0 {
+		//SELECT * omits the columns of derived tables added by
+		//decorrelation
+		exprList, fieldNames = nil, nil
+	fields:
+		for _, f := range topOp.Descriptor().Fields {
+			for _, hidden := range hiddenFields {
+				if f == hidden {
+					continue fields
+				}
+			}
+			exprList = append(exprList, &FieldExpr{f})
+			fieldNames = append(fieldNames, f.Fname)
+		}
+		selectAll = false
+	}
 	if !selectAll {
 		projOp, err := NewProjectOp(exprList, fieldNames, plan.distinct, topOp)
 		if err != nil {
@@ -1081,12 +1921,31 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (Operator, error) {
 		topOp = projOp
 	}
 
-	if len(plan.orderByFields) > 0 {
+	return addOrderByLimit(c, topOp, plan.orderByFields, plan.limit, tableMap)
+}
+
+// Apply ORDER BY and LIMIT clauses, if there are any, to the result of op.
+// ORDER BY with LIMIT is a TopN, which only keeps the tuples it returns.
+func addOrderByLimit(c *Catalog, op Operator, orderByFields []*OrderByNode, limit *LimitNode, tableMap map[string]*PlanNode) (Operator, error) {
+	var limitExpr, offsetExpr Expr
+	if limit != nil {
+		var err error
+		if limitExpr, _, err = limit.count.generateExpr(c, op.Descriptor(), tableMap); err != nil {
+			return nil, err
+		}
+		if limit.offset != nil {
+			if offsetExpr, _, err = limit.offset.generateExpr(c, op.Descriptor(), tableMap); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(orderByFields) > 0 {
 		var ascs []bool
 
-		exprs := make([]Expr, len(plan.orderByFields))
-		for i, oby := range plan.orderByFields {
-			expr, _, err := oby.expr.generateExpr(c, topOp.Descriptor(), tableMap)
+		exprs := make([]Expr, len(orderByFields))
+		for i, oby := range orderByFields {
+			expr, _, err := oby.expr.generateExpr(c, op.Descriptor(), tableMap)
 			if err != nil {
 				return nil, err
 			}
@@ -1094,41 +1953,90 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (Operator, error) {
 			ascs = append(ascs, oby.ascending)
 
 		}
+		if limitExpr != nil {
+			return NewTopN(exprs, ascs, limitExpr, offsetExpr, op)
+		}
 		var err error
-		topOp, err = NewOrderBy(exprs, topOp, ascs)
+		op, err = NewOrderBy(exprs, op, ascs)
 		if err != nil {
 			return nil, err
 		}
 
 	}
 
-	if plan.limit != nil {
-		expr, _, err := plan.limit.generateExpr(c, topOp.Descriptor(), tableMap)
+	if limitExpr != nil {
+		op = NewLimitOffsetOp(limitExpr, offsetExpr, op)
+	}
+	return op, nil
+}
+
+// Return, for each column of a table with descriptor desc, the position of
+// its value in the tuples inserted by an INSERT with the specified column
+// list, or -1 if the column is not in the list.  If there is no column list,
+// the inserted tuples must include every column, in order.
+func insertColumnPositions(desc *TupleDesc, columns sqlparser.Columns) ([]int, error) {
+	positions := make([]int, len(desc.Fields))
+	for i := range positions {
+		positions[i] = i
+		if columns != nil {
+			positions[i] = -1
+		}
+	}
+	for pos, col := range columns {
+		colName := strings.ToLower(col.String())
+		fieldNo, err := findFieldInTd(FieldType{colName, "", UnknownType}, desc)
 		if err != nil {
-			return nil, err
+			return nil, GoDBError{ParseError, fmt.Sprintf("no column %s in table to insert into", colName)}
+		}
+		if positions[fieldNo] != -1 {
+			return nil, GoDBError{ParseError, fmt.Sprintf("column %s specified more than once", colName)}
 		}
-		topOp = NewLimitOp(expr, topOp)
+		positions[fieldNo] = pos
 	}
-	return topOp, nil
+	return positions, nil
 }
 
 func parseInsert(c *Catalog, insStmt *sqlparser.Insert) (Operator, error) {
-	if insStmt.Columns != nil {
-		return nil, GoDBError{ParseError, "GoDB doesn't support inserts of incomplete tuples"}
-	}
 	tab := insStmt.Table.Name
 	file, err := c.GetTable(sqlparser.String(tab))
 	if err != nil {
 		return nil, err
 	}
+	table := c.tableMap[sqlparser.String(tab)]
+	desc := file.Descriptor()
+	positions, err := insertColumnPositions(desc, insStmt.Columns)
+	if err != nil {
+		return nil, err
+	}
+	numValues := len(desc.Fields)
+	if insStmt.Columns != nil {
+		numValues = len(insStmt.Columns)
+	}
 
+	var child Operator
 	switch stmt := insStmt.Rows.(type) {
 	case sqlparser.Values:
 		var exprAr []([]Expr)
 		for _, t := range stmt {
-			var tupAr []Expr
-			for _, e := range t {
-				expr, err := parseExpr(c, e, "")
+			if len(t) != numValues {
+				return nil, GoDBError{ParseError, fmt.Sprintf("expected %d values to insert, got %d", numValues, len(t))}
+			}
+			tupAr := make([]Expr, len(desc.Fields))
+			for i, pos := range positions {
+				// omitted columns, and those whose value is DEFAULT, are
+				// given their default values
+				isDefault := false
+				if pos != -1 {
+					_, isDefault = t[pos].(*sqlparser.Default)
+				}
+				if pos == -1 || isDefault {
+					tupAr[i], err = c.getColumnDefault(table, desc.Fields[i])
+					if err != nil {
+						return nil, err
+					}
+					continue
+				}
+				expr, err := parseExpr(c, t[pos], "")
 				if err != nil {
 					return nil, err
 				}
@@ -1136,142 +2044,171 @@ func parseInsert(c *Catalog, insStmt *sqlparser.Insert) (Operator, error) {
 				if err != nil {
 					return nil, err
 				}
-				tupAr = append(tupAr, exprOp)
+				tupAr[i] = exprOp
 			}
 			exprAr = append(exprAr, tupAr)
 		}
-		iterOp := NewValueOp(exprAr)
-		insertOp := NewInsertOp(file, iterOp)
-		return insertOp, nil
+		child = NewValueOp(exprAr)
 
 	case *sqlparser.Select:
 		plan, err := parseStatement(c, stmt)
 		if err != nil {
 			return nil, err
 		}
-		op, err := makePhysicalPlan(c, plan)
+		child, err = makePhysicalPlan(c, plan)
 		if err != nil {
 			return nil, err
 		}
+		if insStmt.Columns != nil {
+			// reorder the selected columns to match the table, adding the
+			// default values of the columns that are not selected
+			childDesc := child.Descriptor()
+			if len(childDesc.Fields) != numValues {
+				return nil, GoDBError{ParseError, fmt.Sprintf("expected %d values to insert, got %d", numValues, len(childDesc.Fields))}
+			}
+			exprs := make([]Expr, len(desc.Fields))
+			names := make([]string, len(desc.Fields))
+			for i, pos := range positions {
+				names[i] = desc.Fields[i].Fname
+				if pos == -1 {
+					exprs[i], err = c.getColumnDefault(table, desc.Fields[i])
+					if err != nil {
+						return nil, err
+					}
+				} else {
+					exprs[i] = &FieldExpr{childDesc.Fields[pos]}
+				}
+			}
+			child, err = NewProjectOp(exprs, names, false, child)
+			if err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, GoDBError{ParseError, "unsupported insert statement"}
+	}
 
-		insertOp := NewInsertOp(file, op)
-		return insertOp, nil
+	insertOp := NewInsertOp(file, child)
+	insertOp.constraints, err = c.getConstraintChecker(sqlparser.String(tab))
+	if err != nil {
+		return nil, err
 	}
-	return nil, nil
+	insertOp.stats = c.getStatsUpdater(sqlparser.String(tab))
+	return insertOp, nil
 }
 
-func parseDelete(c *Catalog, delStmt *sqlparser.Delete) (Operator, error) {
-	if len(delStmt.TableExprs) > 1 {
-		return nil, GoDBError{ParseError, "godb does not supporting deleting from multiple tables"}
+// Resolve the single table targeted by a DELETE or UPDATE statement, and
+// return its DBFile along with an operator that scans the tuples of that file
+// that satisfy the statement's WHERE clause (if any), and the table's name.  verb is used in error
+// messages, e.g., "deleting from".
+func parseDMLTarget(c *Catalog, tableExprs sqlparser.TableExprs, where *sqlparser.Where, verb string) (DBFile, Operator, string, error) {
+	if len(tableExprs) > 1 {
+		return nil, nil, "", GoDBError{ParseError, fmt.Sprintf("godb does not supporting %s multiple tables", verb)}
 	}
-	tables, subplans, joins, err := parseFrom(c, delStmt.TableExprs[0])
+	tables, subplans, joins, err := parseFrom(c, tableExprs[0])
 	if err != nil {
-		return nil, err
+		return nil, nil, "", err
 	}
 	if len(tables) > 1 {
-		return nil, GoDBError{ParseError, "godb does not supporting deleting from multiple tables"}
+		return nil, nil, "", GoDBError{ParseError, fmt.Sprintf("godb does not supporting %s multiple tables", verb)}
 	}
 	if subplans != nil || joins != nil {
-		return nil, GoDBError{ParseError, "godb does not supporting deleting from multiple tables"}
+		return nil, nil, "", GoDBError{ParseError, fmt.Sprintf("godb does not supporting %s multiple tables", verb)}
 	}
 
 	tableMap := make(map[string]*PlanNode)
 	tableMap[tables[0].tableName] = &PlanNode{*tables[0].file, (*tables[0].file).Descriptor()}
 
-	var filters []*LogicalFilterNode = make([]*LogicalFilterNode, 0)
-	if delStmt.Where != nil {
-		filters, joins, err = parseWhere(c, subplans, tables, delStmt.Where.Expr)
-		if err != nil {
-			return nil, err
-		}
-		if joins != nil {
-			return nil, GoDBError{ParseError, "godb does not supporting deleting from multiple tables"}
-		}
-	}
 	var newOp Operator
 	newOp = *tables[0].file
-	for _, f := range filters {
-		tabName, fieldName, err := f.fieldExpr.getTableField(c, subplans, tables)
+	if where != nil {
+		pred, err := parsePredicate(c, where.Expr, tableMap[tables[0].tableName].desc, tableMap)
 		if err != nil {
-			return nil, err
+			return nil, nil, "", err
 		}
-		node, err := fieldToOp(tabName, fieldName, tableMap)
+		newOp = NewPredicateFilter(pred, newOp)
+	}
+	return *tables[0].file, newOp, tables[0].tableName, nil
+}
+
+func parseDelete(c *Catalog, delStmt *sqlparser.Delete) (Operator, error) {
+	file, child, tabName, err := parseDMLTarget(c, delStmt.TableExprs, delStmt.Where, "deleting from")
+	if err != nil {
+		return nil, err
+	}
+	deleteOp := NewDeleteOp(file, child)
+	deleteOp.references = c.getReferenceEnforcer(tabName)
+	deleteOp.stats = c.getStatsUpdater(tabName)
+	return deleteOp, nil
+
+}
+
+func parseUpdate(c *Catalog, updStmt *sqlparser.Update) (Operator, error) {
+	if updStmt.OrderBy != nil || updStmt.Limit != nil {
+		return nil, GoDBError{ParseError, "godb does not support ORDER BY or LIMIT in updates"}
+	}
+	file, child, tabName, err := parseDMLTarget(c, updStmt.TableExprs, updStmt.Where, "updating")
+	if err != nil {
+		return nil, err
+	}
+	desc := file.Descriptor()
+	tableMap := map[string]*PlanNode{"": {file, desc}}
+
+	var fields []FieldType
+	var exprs []Expr
+	for _, upd := range updStmt.Exprs {
+		colName := strings.ToLower(sqlparser.String(upd.Name.Name))
+		fieldNo, err := findFieldInTd(FieldType{colName, "", UnknownType}, desc)
 		if err != nil {
-			return nil, err
+			return nil, GoDBError{ParseError, fmt.Sprintf("no column %s in table to update", colName)}
+		}
+		for _, f := range fields {
+			if f.Fname == colName {
+				return nil, GoDBError{ParseError, fmt.Sprintf("column %s assigned more than once", colName)}
+			}
 		}
-		leftExpr, _, err := f.fieldExpr.generateExpr(c, node.desc, tableMap)
+		node, err := parseExpr(c, upd.Expr, "")
 		if err != nil {
 			return nil, err
 		}
-		rightExpr, _, err := f.constExpr.generateExpr(c, node.desc, tableMap)
+		expr, _, err := node.generateExpr(c, desc, tableMap)
 		if err != nil {
 			return nil, err
 		}
-
-		//op := node.op
-		//dbField, _ := fieldNameToField(f.table, f.field, &PlanNode{op, &desc})
-
-		switch leftExpr.GetExprType().Ftype {
-		case IntType:
-			//newInt, _ := strconv.Atoi(f.constVal)
-			newOp, err = NewIntFilter(rightExpr, f.predOp, leftExpr, newOp)
-			if err != nil {
-				return nil, err
-			}
-		case StringType:
-			newOp, err = NewStringFilter(rightExpr, f.predOp, leftExpr, newOp)
-			if err != nil {
-				return nil, err
-			}
-		}
+		fields = append(fields, desc.Fields[fieldNo])
+		exprs = append(exprs, expr)
 	}
-	return NewDeleteOp(*tables[0].file, newOp), nil
-
+	updateOp, err := NewUpdateOp(file, fields, exprs, child)
+	if err != nil {
+		return nil, err
+	}
+	updateOp.constraints, err = c.getConstraintChecker(tabName)
+	if err != nil {
+		return nil, err
+	}
+	updateOp.references = c.getReferenceEnforcer(tabName)
+	updateOp.stats = c.getStatsUpdater(tabName)
+	return updateOp, nil
 }
 
 type QueryType int
 
 const (
-	IteratorType         QueryType = iota
-	BeginXactionType     QueryType = iota
-	CommitXactionType    QueryType = iota
-	AbortXactionType     QueryType = iota
-	CreateTableQueryType QueryType = iota
-	DropTableQueryType   QueryType = iota
-	UnknownQueryType     QueryType = iota
+	IteratorType            QueryType = iota
+	BeginXactionType        QueryType = iota
+	CommitXactionType       QueryType = iota
+	AbortXactionType        QueryType = iota
+	CreateTableQueryType    QueryType = iota
+	DropTableQueryType      QueryType = iota
+	UnknownQueryType        QueryType = iota
+	AlterTableQueryType     QueryType = iota
+	CreateSequenceQueryType QueryType = iota
+	DropSequenceQueryType   QueryType = iota
+	AnalyzeQueryType        QueryType = iota
 )
 
 func processDDL(c *Catalog, ddl *sqlparser.DDL) (QueryType, error) {
 	switch ddl.Action {
-	case "create":
-		fields := make([]FieldType, len(ddl.TableSpec.Columns))
-		tabName := sqlparser.String(ddl.NewName.Name)
-		t, _ := c.GetTable(tabName)
-		if t != nil {
-			return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("table %s already exists", tabName)}
-		}
-		for i, col := range ddl.TableSpec.Columns {
-			var colType DBType
-			colName := sqlparser.String(col.Name)
-			switch col.Type.Type {
-			case "int":
-				colType = IntType
-			case "string":
-				fallthrough
-			case "text":
-				fallthrough
-			case "varchar":
-				colType = StringType
-			default:
-				return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("unsupported column type %s", col.Type.Type)}
-
-			}
-			fields[i] = FieldType{colName, "", colType}
-		}
-
-		c.addTable(tabName, TupleDesc{fields})
-		return CreateTableQueryType, nil
-
 	case "drop":
 		tabName := sqlparser.String(ddl.Table.Name)
 		err := c.dropTable(tabName)
@@ -1279,16 +2216,208 @@ func processDDL(c *Catalog, ddl *sqlparser.DDL) (QueryType, error) {
 			return UnknownQueryType, err
 		}
 		return DropTableQueryType, nil
+	case "rename":
+		err := c.renameTable(sqlparser.String(ddl.Table.Name), sqlparser.String(ddl.NewName.Name))
+		if err != nil {
+			return UnknownQueryType, err
+		}
+		return AlterTableQueryType, nil
 	default:
 		return UnknownQueryType, GoDBError{ParseError, fmt.Sprintf("unsupported ddl statement %s", ddl.Action)}
 	}
 }
 
+// The sql parser only supports UNION, so INTERSECT and EXCEPT are replaced
+// with UNION in query before it is parsed.  Returns the rewritten query and
+// the set operations of query, in the order they appear.
+func rewriteSetOperations(query string) (string, []string) {
+	var ops []string
+	var rewritten strings.Builder
+	last := 0
+	for ts := newTokenStream(query); ts.typ != 0; ts.next() {
+		start := ts.end - len(ts.val)
+		// a quoted identifier is not an operator
+		isWord := ts.typ >= 256 && start >= 0 && strings.EqualFold(query[start:ts.end], ts.val)
+		switch {
+		case isWord && strings.EqualFold(ts.val, "union"):
+			ops = append(ops, "union")
+		case isWord && (strings.EqualFold(ts.val, "intersect") || strings.EqualFold(ts.val, "except")):
+			ops = append(ops, strings.ToLower(ts.val))
+			rewritten.WriteString(query[last:start])
+			rewritten.WriteString("union")
+			last = ts.end
+		}
+	}
+	rewritten.WriteString(query[last:])
+	for _, op := range ops {
+		if op != "union" {
+			return rewritten.String(), ops
+		}
+	}
+	return query, nil
+}
+
+// Check that the INTERSECT and EXCEPT operations that rewriteSetOperations
+// found, if any, are the set operations of the statement stmt, rather than
+// of a subquery
+func checkSetOperations(stmt sqlparser.Statement, setOps []string) error {
+	if len(setOps) == 0 {
+		return nil
+	}
+	if union, ok := stmt.(*sqlparser.Union); !ok || len(setOps) != countUnions(union) {
+		return GoDBError{ParseError, "INTERSECT and EXCEPT are only supported at the top level of a query"}
+	}
+	return nil
+}
+
+// Return the number of set operations in the tree of unions u
+func countUnions(u sqlparser.SelectStatement) int {
+	switch u := u.(type) {
+	case *sqlparser.Union:
+		return countUnions(u.Left) + 1 + countUnions(u.Right)
+	case *sqlparser.ParenSelect:
+		return countUnions(u.Select)
+	}
+	return 0
+}
+
+// Generate a physical plan for a SELECT statement that may combine the
+// results of several SELECTs with set operations.  ops is the remaining set
+// operations returned by rewriteSetOperations, if any; otherwise every
+// operation is a union.  As in standard SQL, INTERSECT binds more tightly
+// than UNION and EXCEPT, which are left associative.
+func parseSetOperation(c *Catalog, stmt sqlparser.SelectStatement, ops *[]string) (Operator, error) {
+	switch stmt := stmt.(type) {
+	case *sqlparser.Select:
+		plan, err := parseStatement(c, stmt)
+		if err != nil {
+			return nil, err
+		}
+		return makePhysicalPlan(c, plan)
+	case *sqlparser.ParenSelect:
+		return parseSetOperation(c, stmt.Select, ops)
+	case *sqlparser.Union:
+		// the sql parser makes the unions of a statement a left deep tree,
+		// so flatten it into its operands and the operations between them,
+		// in the order they appear
+		var operands []Operator
+		var opNames []string
+		var all []bool
+		var flatten func(s sqlparser.SelectStatement) error
+		flatten = func(s sqlparser.SelectStatement) error {
+			u, ok := s.(*sqlparser.Union)
+			if !ok {
+				operand, err := parseSetOperation(c, s, ops)
+				if err != nil {
+					return err
+				}
+				operands = append(operands, operand)
+				return nil
+			}
+			if err := flatten(u.Left); err != nil {
+				return err
+			}
+			op := "union"
+			if len(*ops) > 0 {
+				op, *ops = (*ops)[0], (*ops)[1:]
+			}
+			opNames = append(opNames, op)
+			all = append(all, u.Type == sqlparser.UnionAllStr)
+			return flatten(u.Right)
+		}
+		if err := flatten(stmt); err != nil {
+			return nil, err
+		}
+
+		// apply the intersections first, and then the other operations
+		// to their results, from left to right
+		terms := []Operator{operands[0]}
+		var termOps []int // the index in opNames of the operation before each term after the first
+		for i, op := range opNames {
+			if op != "intersect" {
+				terms = append(terms, operands[i+1])
+				termOps = append(termOps, i)
+				continue
+			}
+			setOp, err := NewSetOp(op, all[i], terms[len(terms)-1], operands[i+1])
+			if err != nil {
+				return nil, err
+			}
+			terms[len(terms)-1] = setOp
+		}
+		result := terms[0]
+		for j, i := range termOps {
+			setOp, err := NewSetOp(opNames[i], all[i], result, terms[j+1])
+			if err != nil {
+				return nil, err
+			}
+			result = setOp
+		}
+
+		orderBys, limit, err := parseOrderByLimit(c, stmt.OrderBy, stmt.Limit)
+		if err != nil {
+			return nil, err
+		}
+		tableMap := map[string]*PlanNode{"": {result, result.Descriptor()}}
+		return addOrderByLimit(c, result, orderBys, limit, tableMap)
+	}
+	return nil, GoDBError{ParseError, fmt.Sprintf("unsupported statement %s", sqlparser.String(stmt))}
+}
+
 func Parse(c *Catalog, query string) (QueryType, Operator, error) {
+	query, err := rewriteWindowFunctions(query)
+	if err != nil {
+		return UnknownQueryType, nil, err
+	}
+	query = rewriteGroupingSets(query)
+
+	// statements that the sql parser does not fully parse
+	var processDDLStatement func(c *Catalog, query string) (QueryType, error)
+	ts := newTokenStream(query)
+	switch {
+	case ts.accept("alter"):
+		processDDLStatement = processAlterTable
+	case ts.accept("create"):
+		if ts.accept("table") {
+			processDDLStatement = processCreateTable
+		} else if ts.accept("sequence") {
+			processDDLStatement = processCreateSequence
+		}
+	case ts.accept("drop"):
+		if ts.accept("sequence") {
+			processDDLStatement = processDropSequence
+		}
+	case ts.accept("analyze"):
+		processDDLStatement = processAnalyze
+	case ts.accept("explain"):
+		op, err := parseExplain(c, query)
+		if err != nil {
+			return UnknownQueryType, nil, err
+		}
+		return IteratorType, op, nil
+	case ts.accept("with"):
+		op, err := planWith(c, query)
+		if err != nil {
+			return UnknownQueryType, nil, err
+		}
+		return IteratorType, op, nil
+	}
+	if processDDLStatement != nil {
+		qtype, err := processDDLStatement(c, query)
+		if err != nil {
+			return UnknownQueryType, nil, err
+		}
+		return qtype, nil, nil
+	}
+
+	query, setOps := rewriteSetOperations(query)
 	stmt, err := sqlparser.Parse(query)
 	if err != nil {
 		return UnknownQueryType, nil, err
 	}
+	if err := checkSetOperations(stmt, setOps); err != nil {
+		return UnknownQueryType, nil, err
+	}
 	switch stmt := stmt.(type) {
 	case *sqlparser.Select:
 		plan, err := parseStatement(c, stmt)
@@ -1302,6 +2431,12 @@ func Parse(c *Catalog, query string) (QueryType, Operator, error) {
 			return UnknownQueryType, nil, err
 		}
 		return IteratorType, op, nil
+	case *sqlparser.Union:
+		op, err := parseSetOperation(c, stmt, &setOps)
+		if err != nil {
+			return UnknownQueryType, nil, err
+		}
+		return IteratorType, op, nil
 	case *sqlparser.Insert:
 		op, err := parseInsert(c, stmt)
 		if err != nil {
@@ -1314,6 +2449,12 @@ func Parse(c *Catalog, query string) (QueryType, Operator, error) {
 			return UnknownQueryType, nil, err
 		}
 		return IteratorType, op, nil
+	case *sqlparser.Update:
+		op, err := parseUpdate(c, stmt)
+		if err != nil {
+			return UnknownQueryType, nil, err
+		}
+		return IteratorType, op, nil
 	case *sqlparser.Begin:
 		return BeginXactionType, nil, nil
 	case *sqlparser.Commit:
@@ -0,0 +1,48 @@
+package godb
+
+// PredicateFilter is a filter operator that returns the tuples of its child
+// for which an arbitrary predicate (see [CompareExpr], [LogicExpr] and
+// [IsNullExpr]) is true.  Tuples for which the predicate is false or NULL are
+// skipped.
+type PredicateFilter struct {
+	pred       Expr
+	child      Operator
+	subqueries []subqueryExpr // the subqueries of pred, which are run when the filter starts
+}
+
+// Construct a filter that applies the predicate pred to the tuples of child
+func NewPredicateFilter(pred Expr, child Operator) *PredicateFilter {
+	return &PredicateFilter{pred, child, predicateSubqueries(pred)}
+}
+
+// Return a TupleDescriptor for this filter, which is that of its child
+func (f *PredicateFilter) Descriptor() *TupleDesc {
+	return f.child.Descriptor()
+}
+
+func (f *PredicateFilter) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	for _, subquery := range f.subqueries {
+		if err := subquery.load(tid); err != nil {
+			return nil, err
+		}
+	}
+	childIter, err := f.child.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	return func() (*Tuple, error) {
+		for {
+			t, err := childIter()
+			if err != nil || t == nil {
+				return nil, err
+			}
+			val, err := f.pred.EvalExpr(t)
+			if err != nil {
+				return nil, err
+			}
+			if val == trueField {
+				return t, nil
+			}
+		}
+	}, nil
+}
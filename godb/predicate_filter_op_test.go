@@ -0,0 +1,137 @@
+package godb
+
+import (
+	"testing"
+)
+
+func expectNames(t *testing.T, c *Catalog, bp *BufferPool, sql string, expected ...string) {
+	t.Helper()
+	res := mustRunSQL(t, c, bp, sql)
+	if len(res) != len(expected) {
+		t.Errorf("expected %d tuples from %s, got %d", len(expected), sql, len(res))
+		return
+	}
+	for i, tup := range res {
+		if tup.Fields[0].(StringField).Value != expected[i] {
+			t.Errorf("expected %s from %s, got %s", expected[i], sql, tup.Fields[0].(StringField).Value)
+		}
+	}
+}
+
+func TestPredicateFilter(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "emp (name string, age int, dept int)\ndept (id int, dname string, budget int)\n")
+	mustRunSQL(t, c, bp, "insert into emp values ('sam', 25, 1), ('mary', 30, 2), ('joe', 40, 1), ('ann', null, 3), ('bob', 50, null)")
+	mustRunSQL(t, c, bp, "insert into dept values (1, 'eng', 100), (2, 'sales', 20), (3, 'hr', 60)")
+	expectNames(t, c, bp, "select name from emp where age < 30 or name = 'bob' order by name", "bob", "sam")
+	expectNames(t, c, bp, "select name from emp where not (age < 30 or dept = 2) order by name", "joe")
+	expectNames(t, c, bp, "select name from emp where (age > 26 and dept = 1) or (age < 26 and dept = 1) order by name", "joe", "sam")
+	expectNames(t, c, bp, "select name from emp where age between 30 and 40 order by name", "joe", "mary")
+	expectNames(t, c, bp, "select name from emp where age not between 30 and 40 order by name", "bob", "sam")
+	expectNames(t, c, bp, "select name from emp where dept in (2, 3) order by name", "ann", "mary")
+	expectNames(t, c, bp, "select name from emp where name not in ('sam', 'joe') and age is not null order by name", "bob", "mary")
+	expectNames(t, c, bp, "select name from emp where name like '%a%' and name not like 'm%' order by name", "ann", "sam")
+	expectNames(t, c, bp, "select name from emp where 1 = 1 and age > 45", "bob")
+
+	// NOT IN a list containing NULL is never true
+	expectNames(t, c, bp, "select name from emp where dept not in (1, null)")
+	// nor are comparisons with NULL, or their negations
+	expectNames(t, c, bp, "select name from emp where not (age < 100) or not (dept < 100)")
+
+	for _, sql := range []string{
+		"select name from emp where age = 'x' or dept = 1",
+		"select name from emp where nosuch = 1 or dept = 1",
+	} {
+		if _, err := runSQL(c, bp, sql); err == nil {
+			t.Errorf("expected error for %s", sql)
+		}
+	}
+}
+
+func TestPredicatePushdown(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "emp (name string, age int, dept int)\ndept (id int, dname string, budget int)\n")
+	mustRunSQL(t, c, bp, "insert into emp values ('sam', 25, 1), ('mary', 30, 2), ('joe', 40, 1), ('ann', null, 3), ('bob', 50, null)")
+	mustRunSQL(t, c, bp, "insert into dept values (1, 'eng', 100), (2, 'sales', 20), (3, 'hr', 60)")
+	sql := "select name, dname from emp, dept where dept = id and (age < 30 or age > 45) and budget > 50 and age > 20 and (budget > 80 or name = 'ann')"
+	_, op, err := Parse(c, sql)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// the conjunct over both tables is applied above the join, and the
+	// conjuncts over each table are combined into one filter below it
+	proj, ok := op.(*Project)
+	if !ok {
+		t.Fatalf("expected a projection, got %T", op)
+	}
+	filter, ok := proj.child.(*PredicateFilter)
+	if !ok {
+		t.Fatalf("expected a filter above the join, got %T", proj.child)
+	}
+	join, ok := filter.child.(*EqualityJoin[int64])
+	if !ok {
+		t.Fatalf("expected a join below the filter, got %T", filter.child)
+	}
+	for _, child := range []Operator{*join.left, *join.right} {
+		filter, ok := child.(*PredicateFilter)
+		if !ok {
+			t.Fatalf("expected filters on both sides of the join, got %T", child)
+		}
+		if _, ok := filter.child.(*HeapFile); !ok {
+			t.Errorf("expected a single filter on each table, got %T", filter.child)
+		}
+	}
+	res := mustRunSQL(t, c, bp, sql)
+	if len(res) != 1 || res[0].PrettyPrintString(false) != "sam,eng" {
+		t.Errorf("unexpected result %v", res)
+	}
+
+	// non-equality comparisons between tables are filters, too
+	expectNames(t, c, bp, "select name from emp join dept on dept = id where age > budget - 10 order by name", "mary")
+}
+
+func TestPredicateDeleteUpdate(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "emp (name string, age int, dept int)\ndept (id int, dname string, budget int)\n")
+	mustRunSQL(t, c, bp, "insert into emp values ('sam', 25, 1), ('mary', 30, 2), ('joe', 40, 1), ('ann', null, 3), ('bob', 50, null)")
+	mustRunSQL(t, c, bp, "insert into dept values (1, 'eng', 100), (2, 'sales', 20), (3, 'hr', 60)")
+	mustRunSQL(t, c, bp, "update emp set dept = 4 where age is null or age between 45 and 55")
+	expectNames(t, c, bp, "select name from emp where dept = 4 order by name", "ann", "bob")
+	mustRunSQL(t, c, bp, "delete from emp where not (dept in (1, 4))")
+	expectNames(t, c, bp, "select name from emp order by name", "ann", "bob", "joe", "sam")
+}
+
+func TestHaving(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "emp (name string, age int, dept int)\ndept (id int, dname string, budget int)\n")
+	mustRunSQL(t, c, bp, "insert into emp values ('sam', 25, 1), ('mary', 30, 2), ('joe', 40, 1), ('ann', null, 3), ('bob', 50, null)")
+	mustRunSQL(t, c, bp, "insert into dept values (1, 'eng', 100), (2, 'sales', 20), (3, 'hr', 60)")
+	res := mustRunSQL(t, c, bp, "select dept, count(*) from emp group by dept having count(*) > 1")
+	if len(res) != 1 || res[0].PrettyPrintString(false) != "1,2" {
+		t.Errorf("unexpected result of having %v", res)
+	}
+	// aggregates that are not in the select list, grouping columns and
+	// subqueries may all be used
+	expectNames(t, c, bp, "select dname from dept, emp where dept = id group by dname having max(age) > 35 or min(age) = (select min(age) from emp where dept = 2) order by dname", "eng", "sales")
+	expectNames(t, c, bp, "select dname from dept, emp where dept = id group by dname having avg(age) is null or dname = 'sales' order by dname", "hr", "sales")
+	// without GROUP BY, HAVING applies to the single group
+	res = mustRunSQL(t, c, bp, "select count(*) from emp having sum(age) > 100")
+	if len(res) != 1 || res[0].Fields[0].(IntField).Value != 5 {
+		t.Errorf("unexpected result of having without group by %v", res)
+	}
+	if res = mustRunSQL(t, c, bp, "select count(*) from emp having sum(age) > 1000"); len(res) != 0 {
+		t.Errorf("expected no tuples, got %v", res)
+	}
+
+	_, op, err := Parse(c, "select dept from emp group by dept having avg(age) > 30")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	filter, ok := op.(*Project).child.(*PredicateFilter)
+	if !ok {
+		t.Fatalf("expected a filter below the projection, got %T", op.(*Project).child)
+	}
+	if _, ok := filter.child.(*Aggregator); !ok {
+		t.Errorf("expected the filter to be above the aggregation, got %T", filter.child)
+	}
+
+	if _, err := runSQL(c, bp, "select dept, count(*) from emp group by dept having age > 30"); err == nil {
+		t.Errorf("expected error for having on a column that is not grouped")
+	}
+}
@@ -0,0 +1,104 @@
+package godb
+
+// RecursiveCTE computes a recursive common table expression "base UNION
+// [ALL] recursive" as a fixpoint.  It first returns the tuples of base, then
+// repeatedly runs recursive with its work table holding the tuples returned
+// by the previous iteration, until an iteration returns no tuples.  Unless
+// all is true, tuples that were already returned are discarded, so the
+// iteration ends once no new tuples are found; with UNION ALL, a recursive
+// term that always finds tuples never terminates, unless the query that
+// uses the CTE has a LIMIT.
+type RecursiveCTE struct {
+	base, recursive Operator
+	work            *workTable
+	all             bool
+	desc            *TupleDesc
+}
+
+// Construct a recursive CTE, checking that base and recursive have the same
+// types of fields.  recursive must read the previous iteration's tuples from
+// work.
+func NewRecursiveCTE(base Operator, recursive Operator, work *workTable, all bool) (*RecursiveCTE, error) {
+	desc, err := setOpDescriptor("union", base.Descriptor(), recursive.Descriptor())
+	if err != nil {
+		return nil, err
+	}
+	return &RecursiveCTE{base, recursive, work, all, desc}, nil
+}
+
+func (r *RecursiveCTE) Descriptor() *TupleDesc {
+	return r.desc
+}
+
+// Run op with the work table holding work, returning its tuples that have
+// not already been seen.  Each iteration is run to completion before any of
+// its tuples are returned, so that several iterators over r do not see each
+// other's work tables.
+func (r *RecursiveCTE) iterate(op Operator, work []*Tuple, seen map[any]bool, tid TransactionID) ([]*Tuple, error) {
+	r.work.tuples = work
+	iter, err := op.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	var tuples []*Tuple
+	for {
+		t, err := iter()
+		if err != nil || t == nil {
+			return tuples, err
+		}
+		if !r.all {
+			key := (&Tuple{Fields: t.Fields}).tupleKey()
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		tuples = append(tuples, &Tuple{*r.desc, t.Fields, nil})
+	}
+}
+
+func (r *RecursiveCTE) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	seen := make(map[any]bool)
+	tuples, err := r.iterate(r.base, nil, seen, tid)
+	if err != nil {
+		return nil, err
+	}
+	i := 0
+	return func() (*Tuple, error) {
+		for i == len(tuples) {
+			if len(tuples) == 0 {
+				return nil, nil
+			}
+			next, err := r.iterate(r.recursive, tuples, seen, tid)
+			if err != nil {
+				return nil, err
+			}
+			tuples, i = next, 0
+		}
+		i++
+		return tuples[i-1], nil
+	}, nil
+}
+
+// The tuples found by the previous iteration of a RecursiveCTE, which its
+// recursive term reads
+type workTable struct {
+	desc   *TupleDesc
+	tuples []*Tuple
+}
+
+func (w *workTable) Descriptor() *TupleDesc {
+	return w.desc
+}
+
+func (w *workTable) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	tuples := w.tuples
+	i := 0
+	return func() (*Tuple, error) {
+		if i == len(tuples) {
+			return nil, nil
+		}
+		i++
+		return tuples[i-1], nil
+	}, nil
+}
@@ -0,0 +1,139 @@
+package godb
+
+// SemiJoin returns the tuples of its left child for which there is (or, for
+// an anti-join, is not) a tuple of its right child with the same key, where
+// the keys are the values of leftKeys and rightKeys, respectively.  Neither
+// child's tuples are returned more than once, and only the left child's
+// fields are returned.  The keys of the right child are loaded into an
+// in-memory hash table before any tuples are returned.
+//
+// Keys that contain NULL never match.  A null-aware anti-join implements NOT
+// IN, where the first key is the IN operand and any others are the columns of
+// a decorrelated subquery (see [LogicalPlan.decorrelate]).  Each left tuple is
+// compared with the right tuples whose other keys match it, and is kept if
+// there are none; otherwise it is dropped if any of their first keys is NULL,
+// if its own first key is NULL, or if its first key is among theirs.
+type SemiJoin struct {
+	left      Operator
+	leftKeys  []Expr
+	right     Operator
+	rightKeys []Expr
+	anti      bool
+	nullAware bool
+}
+
+// Construct a semi-join, or if anti is true, an anti-join
+func NewSemiJoin(left Operator, leftKeys []Expr, right Operator, rightKeys []Expr, anti bool, nullAware bool) (*SemiJoin, error) {
+	if len(leftKeys) != len(rightKeys) {
+		return nil, GoDBError{IllegalOperationError, "semi-join must have the same number of left and right keys"}
+	}
+	if nullAware && (!anti || len(leftKeys) == 0) {
+		return nil, GoDBError{IllegalOperationError, "only anti-joins with keys can be null-aware"}
+	}
+	for i, key := range leftKeys {
+		lType, rType := key.GetExprType().Ftype, rightKeys[i].GetExprType().Ftype
+		if lType != rType && lType != UnknownType && rType != UnknownType {
+			return nil, GoDBError{TypeMismatchError, "cannot semi-join keys of different types"}
+		}
+	}
+	return &SemiJoin{left, leftKeys, right, rightKeys, anti, nullAware}, nil
+}
+
+// Return a TupleDescriptor for this semi-join, which is that of its left child
+func (j *SemiJoin) Descriptor() *TupleDesc {
+	return j.left.Descriptor()
+}
+
+// Return a key for the values of keys for tuple t, and whether any of them
+// was NULL
+func semiJoinKey(keys []Expr, t *Tuple) (any, bool, error) {
+	vals := make([]DBValue, len(keys))
+	for i, key := range keys {
+		val, err := key.EvalExpr(t)
+		if err != nil {
+			return nil, false, err
+		}
+		if val == nil {
+			return nil, true, nil
+		}
+		vals[i] = val
+	}
+	return (&Tuple{Fields: vals}).tupleKey(), false, nil
+}
+
+// The right tuples that a left tuple of a semi-join is compared with
+type semiJoinGroup struct {
+	values  map[any]bool // for a null-aware anti-join, the non-NULL first keys
+	hasNull bool         // whether any of the first keys is NULL
+}
+
+// Return the keys that a left tuple must match exactly, which for a
+// null-aware anti-join excludes the first key
+func (j *SemiJoin) groupKeys(keys []Expr) []Expr {
+	if j.nullAware {
+		return keys[1:]
+	}
+	return keys
+}
+
+func (j *SemiJoin) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	groups := make(map[any]*semiJoinGroup)
+	err := runSubquery(j.right, tid, func(t *Tuple) error {
+		key, null, err := semiJoinKey(j.groupKeys(j.rightKeys), t)
+		if err != nil || null {
+			return err
+		}
+		g := groups[key]
+		if g == nil {
+			g = &semiJoinGroup{values: make(map[any]bool)}
+			groups[key] = g
+		}
+		if j.nullAware {
+			val, err := j.rightKeys[0].EvalExpr(t)
+			if err != nil {
+				return err
+			}
+			if val == nil {
+				g.hasNull = true
+			} else {
+				g.values[(&Tuple{Fields: []DBValue{val}}).tupleKey()] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	leftIter, err := j.left.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	return func() (*Tuple, error) {
+		for {
+			t, err := leftIter()
+			if err != nil || t == nil {
+				return nil, err
+			}
+			key, null, err := semiJoinKey(j.groupKeys(j.leftKeys), t)
+			if err != nil {
+				return nil, err
+			}
+			var g *semiJoinGroup
+			if !null {
+				g = groups[key]
+			}
+			keep := (g != nil) != j.anti
+			if j.nullAware && g != nil {
+				val, err := j.leftKeys[0].EvalExpr(t)
+				if err != nil {
+					return nil, err
+				}
+				keep = val != nil && !g.hasNull && !g.values[(&Tuple{Fields: []DBValue{val}}).tupleKey()]
+			}
+			if keep {
+				return t, nil
+			}
+		}
+	}, nil
+}
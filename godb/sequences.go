@@ -0,0 +1,175 @@
+package godb
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The number of values a sequence hands out between updates of its
+// high-water mark, which is kept in a file of its own, name.seq, in the
+// database directory.  The high-water mark is always past every value that
+// has been handed out, so values are never reused, but up to this many values
+// may be skipped if the database is restarted.
+const sequenceCacheSize = 32
+
+// A Sequence generates a series of integers, typically used as surrogate
+// keys.  Like in most databases, sequences are not transactional: a value
+// returned by nextval is never returned again, even if the transaction that
+// asked for it aborts.
+type Sequence struct {
+	name      string
+	start     int64
+	increment int64
+	next      int64 // the value the next call to nextval returns
+	remaining int64 // the number of values from next on that are reserved by the high-water mark
+	current   int64 // the value last returned by nextval, if called is true
+	called    bool
+
+	// the table and column that own the sequence, if it was created for an
+	// AUTO_INCREMENT or SERIAL column; it is dropped along with them
+	ownerTable  string
+	ownerColumn string
+}
+
+// Return the first value of the sequence that is not reserved, which is its
+// high-water mark
+func (s *Sequence) limit() int64 {
+	return s.next + s.remaining*s.increment
+}
+
+func (s *Sequence) String() string {
+	str := fmt.Sprintf("sequence %s start %d increment %d next %d", s.name, s.start, s.increment, s.limit())
+	if s.ownerTable != "" {
+		str = str + fmt.Sprintf(" owned by %s.%s", s.ownerTable, s.ownerColumn)
+	}
+	return str
+}
+
+func (c *Catalog) addSequence(s *Sequence) error {
+	if c.sequences[s.name] != nil {
+		return GoDBError{DuplicateTableError, fmt.Sprintf("a sequence named '%s' already exists", s.name)}
+	}
+	c.sequences[s.name] = s
+	return nil
+}
+
+func (c *Catalog) dropSequence(name string) error {
+	s := c.sequences[name]
+	if s == nil {
+		return GoDBError{NoSuchTableError, fmt.Sprintf("no sequence '%s' found", name)}
+	}
+	if s.ownerTable != "" {
+		return GoDBError{IllegalOperationError, fmt.Sprintf("cannot drop sequence '%s', which is owned by column %s of table %s", name, s.ownerColumn, s.ownerTable)}
+	}
+	delete(c.sequences, name)
+	os.Remove(c.sequenceFile(name))
+	return nil
+}
+
+// Return the names of the sequences of the catalog, in sorted order
+func (c *Catalog) sequenceNames() []string {
+	names := make([]string, 0, len(c.sequences))
+	for name := range c.sequences {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Create the sequence that generates the values of an AUTO_INCREMENT or
+// SERIAL column of table, returning its name.  The sequence is named
+// table_column_seq, with a number appended if that name is taken.
+func (c *Catalog) createOwnedSequence(table string, column string) (string, error) {
+	name := fmt.Sprintf("%s_%s_seq", table, column)
+	for i := 1; c.sequences[name] != nil; i++ {
+		name = fmt.Sprintf("%s_%s_seq%d", table, column, i)
+	}
+	s := &Sequence{name: name, start: 1, increment: 1, next: 1, ownerTable: table, ownerColumn: column}
+	return name, c.addSequence(s)
+}
+
+// Update the owners of sequences after a column of table has been dropped (if
+// newName is "") or renamed to newName.  Sequences owned by a dropped column
+// are dropped along with it.
+func (c *Catalog) updateSequenceOwners(table string, column string, newName string) {
+	for name, s := range c.sequences {
+		if s.ownerTable != table || (column != "" && s.ownerColumn != column) {
+			continue
+		}
+		if newName == "" {
+			delete(c.sequences, name)
+			os.Remove(c.sequenceFile(name))
+		} else if column == "" {
+			s.ownerTable = newName
+		} else {
+			s.ownerColumn = newName
+		}
+	}
+}
+
+// Return the next value of the named sequence.  When the reserved values run
+// out, the next sequenceCacheSize values are reserved by durably writing the
+// new high-water mark before any of them are returned.
+func (c *Catalog) nextval(name string) (int64, error) {
+	c.sequenceMutex.Lock()
+	defer c.sequenceMutex.Unlock()
+	s := c.sequences[name]
+	if s == nil {
+		return 0, GoDBError{NoSuchTableError, fmt.Sprintf("no sequence '%s' found", name)}
+	}
+	if s.remaining == 0 {
+		s.remaining = sequenceCacheSize
+		err := writeFileAtomic(c.sequenceFile(name), []byte(fmt.Sprintf("%d\n", s.limit())))
+		if err != nil {
+			s.remaining = 0
+			return 0, err
+		}
+	}
+	s.current = s.next
+	s.called = true
+	s.next += s.increment
+	s.remaining--
+	return s.current, nil
+}
+
+// Return the value most recently returned by nextval for the named sequence
+func (c *Catalog) currval(name string) (int64, error) {
+	c.sequenceMutex.Lock()
+	defer c.sequenceMutex.Unlock()
+	s := c.sequences[name]
+	if s == nil {
+		return 0, GoDBError{NoSuchTableError, fmt.Sprintf("no sequence '%s' found", name)}
+	}
+	if !s.called {
+		return 0, GoDBError{IllegalOperationError, fmt.Sprintf("currval of sequence '%s' is not yet defined", name)}
+	}
+	return s.current, nil
+}
+
+// Return the name of the file holding the high-water mark of the named
+// sequence
+func (c *Catalog) sequenceFile(name string) string {
+	return c.rootPath + "/" + name + ".seq"
+}
+
+// Advance s past the high-water mark recorded in its file, if there is one,
+// as values up to it may have been handed out since the catalog was saved
+func (c *Catalog) loadSequenceLimit(s *Sequence) error {
+	data, err := os.ReadFile(c.sequenceFile(s.name))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	limit, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return GoDBError{MalformedDataError, fmt.Sprintf("malformed high-water mark for sequence '%s'", s.name)}
+	}
+	if (s.increment > 0 && limit > s.next) || (s.increment < 0 && limit < s.next) {
+		s.next = limit
+	}
+	return nil
+}
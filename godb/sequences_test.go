@@ -0,0 +1,132 @@
+package godb
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSequence(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "t (a int)\n")
+	mustRunSQL(t, c, bp, "insert into t values (1), (2), (3)")
+	mustRunSQL(t, c, bp, "create sequence s start with 10 increment by 5")
+	if _, err := runSQL(c, bp, "select currval('s') from t"); err == nil {
+		t.Errorf("expected error for currval before nextval")
+	}
+	res := mustRunSQL(t, c, bp, "select nextval('s') from t")
+	for i, tup := range res {
+		if tup.Fields[0].(IntField).Value != int64(10+5*i) {
+			t.Errorf("unexpected value %v from nextval", tup.Fields[0])
+		}
+	}
+	res = mustRunSQL(t, c, bp, "select currval('s') from t")
+	if res[0].Fields[0].(IntField).Value != 20 {
+		t.Errorf("unexpected value %v from currval", res[0].Fields[0])
+	}
+
+	for _, sql := range []string{
+		"create sequence s",
+		"create sequence u increment 0",
+		"create sequence u start x",
+		"drop sequence nosuch",
+		"select nextval('nosuch') from t",
+	} {
+		if _, err := runSQL(c, bp, sql); err == nil {
+			t.Errorf("expected error for %s", sql)
+		}
+	}
+	mustRunSQL(t, c, bp, "create sequence if not exists s")
+	mustRunSQL(t, c, bp, "drop sequence s")
+	mustRunSQL(t, c, bp, "drop sequence if exists s")
+	if _, err := runSQL(c, bp, "select nextval('s') from t"); err == nil {
+		t.Errorf("expected error for dropped sequence")
+	}
+}
+
+func TestSequenceDurability(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "t (a int)\n")
+	mustRunSQL(t, c, bp, "insert into t values (1), (2), (3)")
+	mustRunSQL(t, c, bp, "create sequence s")
+	if err := c.SaveToFile("catalog.txt", c.rootPath); err != nil {
+		t.Fatalf(err.Error())
+	}
+	mustRunSQL(t, c, bp, "select nextval('s') from t")
+
+	// the high-water mark is written to a file of its own as values are
+	// handed out, without the catalog being saved again
+	catalogText, err := os.ReadFile(c.rootPath + "/catalog.txt")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if string(catalogText) != "t (a int)\nsequence s start 1 increment 1 next 1\n" {
+		t.Errorf("catalog file rewritten by nextval: %q", catalogText)
+	}
+	c2, err := NewCatalogFromFile("catalog.txt", bp, c.rootPath)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	res := mustRunSQL(t, c2, bp, "select nextval('s') from t")
+	if v := res[0].Fields[0].(IntField).Value; v <= 3 {
+		t.Errorf("value %d returned by nextval again after reload", v)
+	}
+	if c2.CatalogString() != "t (a int)\nsequence s start 1 increment 1 next 65\n" {
+		t.Errorf("unexpected catalog %q", c2.CatalogString())
+	}
+
+	mustRunSQL(t, c2, bp, "drop sequence s")
+	if _, err := os.Stat(c.rootPath + "/s.seq"); err == nil {
+		t.Errorf("high-water mark file of dropped sequence not removed")
+	}
+}
+
+func TestAutoIncrement(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "")
+	mustRunSQL(t, c, bp, "create table t (id serial primary key, name string)")
+	mustRunSQL(t, c, bp, "create table u (name string, id int auto_increment)")
+	mustRunSQL(t, c, bp, "insert into t (name) values ('sam'), ('mary')")
+	mustRunSQL(t, c, bp, "insert into u (name) select name from t")
+	mustRunSQL(t, c, bp, "insert into t (name) values ('joe')")
+
+	res := mustRunSQL(t, c, bp, "select id, name from t order by id")
+	expected := []string{"1,sam", "2,mary", "3,joe"}
+	if len(res) != len(expected) {
+		t.Fatalf("expected %d tuples, got %d", len(expected), len(res))
+	}
+	for i, tup := range res {
+		if tup.PrettyPrintString(false) != expected[i] {
+			t.Errorf("expected %s, got %s", expected[i], tup.PrettyPrintString(false))
+		}
+	}
+	res = mustRunSQL(t, c, bp, "select sum(id) from u")
+	if res[0].Fields[0].(IntField).Value != 3 {
+		t.Errorf("unexpected ids in u: sum is %v", res[0].Fields[0])
+	}
+
+	catString := "t (id int default nextval('t_id_seq') not null, name string, primary key (id))\n" +
+		"u (name string, id int default nextval('u_id_seq'))\n" +
+		"sequence t_id_seq start 1 increment 1 next 33 owned by t.id\n" +
+		"sequence u_id_seq start 1 increment 1 next 33 owned by u.id\n"
+	if c.CatalogString() != catString {
+		t.Fatalf("unexpected catalog %q", c.CatalogString())
+	}
+
+	// owned sequences follow their columns, and are dropped with them
+	if _, err := runSQL(c, bp, "drop sequence t_id_seq"); err == nil {
+		t.Errorf("expected error dropping owned sequence")
+	}
+	mustRunSQL(t, c, bp, "alter table t rename to emp")
+	mustRunSQL(t, c, bp, "insert into emp (name) values ('ann')")
+	mustRunSQL(t, c, bp, "alter table u drop column id")
+	mustRunSQL(t, c, bp, "drop table emp")
+	if c.CatalogString() != "u (name string)\n" {
+		t.Errorf("unexpected catalog after drops %q", c.CatalogString())
+	}
+
+	for _, sql := range []string{
+		"create table v (a string auto_increment)",
+		"create table v (a int auto_increment default 1)",
+	} {
+		if _, err := runSQL(c, bp, sql); err == nil {
+			t.Errorf("expected error for %s", sql)
+		}
+	}
+}
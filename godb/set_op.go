@@ -0,0 +1,290 @@
+package godb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SetOp combines the tuples of two children with the same number and types
+// of fields, using one of the SQL set operations "union", "intersect" or
+// "except".  Unless all is true, the result has no duplicates; otherwise, a
+// tuple that occurs m times in the left child and n times in the right
+// occurs m + n times in the result of UNION ALL, min(m, n) times in that of
+// INTERSECT ALL, and max(m - n, 0) times in that of EXCEPT ALL.  As in SQL,
+// NULLs are considered equal to each other.
+//
+// Except for UNION ALL, which simply returns the tuples of the left child
+// followed by those of the right, the tuples are counted in a hash table,
+// which spills to disk if it grows beyond [SpillTupleLimit] tuples (see
+// spill.go).  The fields of the result have the names of the left child's.
+type SetOp struct {
+	op          string
+	all         bool
+	left, right Operator
+	desc        *TupleDesc
+}
+
+// Construct a set operation, checking that its children's fields have the
+// same types
+func NewSetOp(op string, all bool, left Operator, right Operator) (*SetOp, error) {
+	if op != "union" && op != "intersect" && op != "except" {
+		return nil, GoDBError{ParseError, fmt.Sprintf("unknown set operation %s", op)}
+	}
+	desc, err := setOpDescriptor(op, left.Descriptor(), right.Descriptor())
+	if err != nil {
+		return nil, err
+	}
+	return &SetOp{op, all, left, right, desc}, nil
+}
+
+// Return the descriptor of the result of combining tuples with descriptors
+// left and right, which must have the same number and types of fields,
+// with the set operation op.  Fields of unknown type (NULL literals) match
+// fields of any type.
+func setOpDescriptor(op string, left, right *TupleDesc) (*TupleDesc, error) {
+	lFields, rFields := left.Fields, right.Fields
+	if len(lFields) != len(rFields) {
+		return nil, GoDBError{TypeMismatchError, fmt.Sprintf("each %s query must have the same number of columns", strings.ToUpper(op))}
+	}
+	fields := make([]FieldType, len(lFields))
+	for i, f := range lFields {
+		rType := rFields[i].Ftype
+		if f.Ftype != rType && f.Ftype != UnknownType && rType != UnknownType {
+			return nil, GoDBError{TypeMismatchError, fmt.Sprintf("%s types %s and %s of column %s cannot be matched", strings.ToUpper(op), typeNames[f.Ftype], typeNames[rType], f.Fname)}
+		}
+		fields[i] = f
+		if f.Ftype == UnknownType {
+			fields[i].Ftype = rType
+		}
+	}
+	return &TupleDesc{Fields: fields}, nil
+}
+
+// Return a TupleDescriptor for this set operation, which has the names of
+// the left child's fields
+func (s *SetOp) Descriptor() *TupleDesc {
+	return s.desc
+}
+
+// The number of times a distinct tuple occurs in each child of a set
+// operation
+type setOpEntry struct {
+	fields      []DBValue
+	left, right int
+}
+
+// Return the number of times e occurs in the result
+func (s *SetOp) resultCount(e *setOpEntry) int {
+	n := 0
+	switch s.op {
+	case "union":
+		n = e.left + e.right
+	case "intersect":
+		n = e.left
+		if e.right < n {
+			n = e.right
+		}
+	case "except":
+		n = e.left - e.right
+		if !s.all && e.right > 0 {
+			n = 0
+		}
+	}
+	if n < 0 {
+		n = 0
+	} else if !s.all && n > 1 {
+		n = 1
+	}
+	return n
+}
+
+// The tuples of the children of a set operation that belong to one
+// partition, which are processed together
+type setOpInput struct {
+	left, right func() (*Tuple, error)
+	depth       int
+	files       []*spillFile // the spill files of the partition, removed once it has been read
+}
+
+func (in *setOpInput) remove() {
+	for _, f := range in.files {
+		f.remove()
+	}
+}
+
+// Count the distinct tuples of the input in a hash table, returning its
+// entries in the order they were first seen.  If the input has more than
+// SpillTupleLimit distinct tuples, it is instead partitioned by hash into
+// spill files, and the inputs for the partitions are returned.
+func (s *SetOp) build(in *setOpInput) ([]*setOpEntry, []*setOpInput, error) {
+	defer in.remove()
+	table := make(map[any]*setOpEntry)
+	var entries []*setOpEntry
+	var leftSpill, rightSpill *partitionedSpill
+
+	var add func(t *Tuple, right bool) error
+	add = func(t *Tuple, right bool) error {
+		key := (&Tuple{Fields: t.Fields}).tupleKey()
+		if leftSpill != nil {
+			if right {
+				return rightSpill.add(key, t)
+			}
+			return leftSpill.add(key, t)
+		}
+		e := table[key]
+		if e == nil {
+			// tuples that are only in the right child are not in the
+			// result of INTERSECT or EXCEPT
+			if right && s.op != "union" {
+				return nil
+			}
+			if len(table) >= SpillTupleLimit && in.depth < maxSpillDepth {
+				leftSpill, rightSpill = newPartitionedSpill(s.desc, in.depth), newPartitionedSpill(s.desc, in.depth)
+				for _, e := range entries {
+					key := (&Tuple{Fields: e.fields}).tupleKey()
+					for i := 0; i < e.left; i++ {
+						if err := leftSpill.add(key, &Tuple{Fields: e.fields}); err != nil {
+							return err
+						}
+					}
+					for i := 0; i < e.right; i++ {
+						if err := rightSpill.add(key, &Tuple{Fields: e.fields}); err != nil {
+							return err
+						}
+					}
+				}
+				table, entries = nil, nil
+				return add(t, right)
+			}
+			e = &setOpEntry{fields: t.Fields}
+			table[key] = e
+			entries = append(entries, e)
+		}
+		if right {
+			e.right++
+		} else {
+			e.left++
+		}
+		return nil
+	}
+
+	err := s.addAll(in.left, false, add)
+	if err == nil {
+		err = s.addAll(in.right, true, add)
+	}
+	if leftSpill == nil {
+		return entries, nil, err
+	}
+	if err != nil {
+		leftSpill.remove()
+		rightSpill.remove()
+		return nil, nil, err
+	}
+
+	var inputs []*setOpInput
+	for i := range leftSpill.files {
+		input := &setOpInput{depth: in.depth + 1}
+		for _, f := range []*spillFile{leftSpill.files[i], rightSpill.files[i]} {
+			var iter func() (*Tuple, error)
+			if f != nil {
+				input.files = append(input.files, f)
+				if iter, err = f.iterator(); err != nil {
+					leftSpill.remove()
+					rightSpill.remove()
+					return nil, nil, err
+				}
+			}
+			if input.left == nil {
+				input.left = emptyIterator(iter)
+			} else {
+				input.right = emptyIterator(iter)
+			}
+		}
+		if len(input.files) > 0 {
+			inputs = append(inputs, input)
+		}
+	}
+	return nil, inputs, nil
+}
+
+// Return iter, or an iterator with no tuples if iter is nil
+func emptyIterator(iter func() (*Tuple, error)) func() (*Tuple, error) {
+	if iter == nil {
+		return func() (*Tuple, error) { return nil, nil }
+	}
+	return iter
+}
+
+// Call add on each tuple of iter
+func (s *SetOp) addAll(iter func() (*Tuple, error), right bool, add func(t *Tuple, right bool) error) error {
+	for {
+		t, err := iter()
+		if err != nil || t == nil {
+			return err
+		}
+		if err := add(t, right); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *SetOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	leftIter, err := s.left.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	rightIter, err := s.right.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	if s.op == "union" && s.all {
+		return func() (*Tuple, error) {
+			t, err := leftIter()
+			if err == nil && t == nil {
+				leftIter = emptyIterator(nil)
+				t, err = rightIter()
+			}
+			if err != nil || t == nil {
+				return nil, err
+			}
+			return &Tuple{*s.desc, t.Fields, nil}, nil
+		}, nil
+	}
+
+	inputs := []*setOpInput{{left: leftIter, right: rightIter}}
+	var entries []*setOpEntry
+	remaining := 0 // the number of times entries[0] has yet to be returned
+	return func() (*Tuple, error) {
+		for {
+			if remaining > 0 {
+				remaining--
+				fields := entries[0].fields
+				if remaining == 0 {
+					entries = entries[1:]
+				}
+				return &Tuple{*s.desc, fields, nil}, nil
+			}
+			if len(entries) > 0 {
+				remaining = s.resultCount(entries[0])
+				if remaining == 0 {
+					entries = entries[1:]
+				}
+				continue
+			}
+			if len(inputs) == 0 {
+				return nil, nil
+			}
+			in := inputs[0]
+			newEntries, partitions, err := s.build(in)
+			if err != nil {
+				for _, in := range inputs[1:] {
+					in.remove()
+				}
+				inputs = nil
+				return nil, err
+			}
+			entries = newEntries
+			inputs = append(partitions, inputs[1:]...)
+		}
+	}, nil
+}
@@ -0,0 +1,168 @@
+package godb
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSetOperations(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "emp (name string, age int, dept int)\ndept (id int, dname string, budget int)\n")
+	mustRunSQL(t, c, bp, "insert into emp values ('sam', 25, 1), ('mary', 30, 2), ('joe', 40, 1), ('ann', null, 3), ('bob', 50, null)")
+	mustRunSQL(t, c, bp, "insert into dept values (1, 'eng', 100), (2, 'sales', 20), (3, 'hr', 60)")
+	expectNames(t, c, bp, "select name from emp where dept = 1 union select name from emp where age > 35 order by name", "bob", "joe", "sam")
+	expectNames(t, c, bp, "select name from emp where dept = 1 union all select name from emp where age > 35 order by name", "bob", "joe", "joe", "sam")
+	expectNames(t, c, bp, "select name from emp where dept = 1 intersect select name from emp where age > 35", "joe")
+	expectNames(t, c, bp, "select name from emp where dept = 1 except select name from emp where age > 35", "sam")
+	// the result has the names of the left query's columns
+	expectNames(t, c, bp, "select dname as n from dept union select name from emp order by n limit 3", "ann", "bob", "eng")
+	expectNames(t, c, bp, "(select name from emp where dept = 1) union (select dname from dept where budget > 50) order by name desc", "sam", "joe", "hr", "eng")
+	// INTERSECT binds more tightly than UNION and EXCEPT, which are left
+	// associative
+	expectNames(t, c, bp, "select name from emp union select dname from dept except select name from emp where age < 45 intersect select dname from dept order by name", "ann", "bob", "eng", "hr", "joe", "mary", "sales", "sam")
+	expectNames(t, c, bp, "(select name from emp union select dname from dept except select name from emp where age < 45) intersect select dname from dept order by name", "eng", "hr", "sales")
+	expectNames(t, c, bp, "select name from emp where dept = 1 union select dname from dept intersect select dname from dept where budget > 50 order by name", "eng", "hr", "joe", "sam")
+	expectNames(t, c, bp, "select dname from dept intersect select dname from dept where budget > 50 union select name from emp where dept = 1 order by dname", "eng", "hr", "joe", "sam")
+	expectNames(t, c, bp, "select name from emp except select name from emp where dept = 1 union select name from emp where dept = 1 order by name", "ann", "bob", "joe", "mary", "sam")
+
+	// a column named like an operator is not one
+	mustRunSQL(t, c, bp, "create table ops (`except` string)")
+	mustRunSQL(t, c, bp, "insert into ops values ('x')")
+	expectNames(t, c, bp, "select `except` from ops intersect select 'x' from dept", "x")
+	// nor is one in a string literal
+	expectNames(t, c, bp, "select name from emp where name <> 'except' intersect select name from emp where dept = 1 order by name", "joe", "sam")
+	expectNames(t, c, bp, "select dname from dept where dname <> 'a intersect b' except select 'eng' from dept order by dname", "hr", "sales")
+	expectNames(t, c, bp, "select name from emp where name = 'union' or name = 'x except y'")
+}
+
+func TestSetOperationDuplicates(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "l (a int, b string)\nr (a int, b string)\n")
+	mustRunSQL(t, c, bp, "insert into l values (1, 'x'), (1, 'x'), (1, 'x'), (2, null), (2, null), (3, 'y')")
+	mustRunSQL(t, c, bp, "insert into r values (1, 'x'), (2, null), (2, null), (2, null), (4, 'z')")
+
+	for _, test := range []struct {
+		sql      string
+		expected []string
+	}{
+		{"select * from l union select * from r", []string{"1,x", "2,null", "3,y", "4,z"}},
+		{"select * from l union all select * from r", []string{"1,x", "1,x", "1,x", "2,null", "2,null", "3,y", "1,x", "2,null", "2,null", "2,null", "4,z"}},
+		{"select * from l intersect select * from r", []string{"1,x", "2,null"}},
+		{"select * from l intersect all select * from r", []string{"1,x", "2,null", "2,null"}},
+		{"select * from l except select * from r", []string{"3,y"}},
+		{"select * from l except all select * from r", []string{"1,x", "1,x", "3,y"}},
+		{"select * from r except all select * from l", []string{"2,null", "4,z"}},
+	} {
+		var res []string
+		for _, tup := range mustRunSQL(t, c, bp, test.sql) {
+			res = append(res, tup.PrettyPrintString(false))
+		}
+		if strings.Join(res, " ") != strings.Join(test.expected, " ") {
+			t.Errorf("expected %v from %s, got %v", test.expected, test.sql, res)
+		}
+	}
+}
+
+func TestSetOperationSchemaMismatch(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "emp (name string, age int, dept int)\ndept (id int, dname string, budget int)\n")
+	mustRunSQL(t, c, bp, "insert into emp values ('sam', 25, 1), ('mary', 30, 2), ('joe', 40, 1), ('ann', null, 3), ('bob', 50, null)")
+	mustRunSQL(t, c, bp, "insert into dept values (1, 'eng', 100), (2, 'sales', 20), (3, 'hr', 60)")
+	for _, sql := range []string{
+		"select name, age from emp union select dname from dept",
+		"select name from emp intersect select id from dept",
+		"select age, name from emp except all select id, budget from dept",
+		"select name from emp where dept in (select id from dept intersect select dept from emp)",
+		"select name from emp where dept in (select id from dept union select dept from emp) intersect select dname from dept",
+	} {
+		if _, err := runSQL(c, bp, sql); err == nil {
+			t.Errorf("expected error for %s", sql)
+		}
+	}
+	// NULL literals match columns of any type
+	res := mustRunSQL(t, c, bp, "select name, age from emp where dept = 2 union select null, null from dept")
+	if len(res) != 2 || res[1].Fields[0] != nil || res[1].Fields[1] != nil {
+		t.Errorf("unexpected result of union with NULLs %v", res)
+	}
+}
+
+func TestSetOperationSpill(t *testing.T) {
+	defer func(limit int) { SpillTupleLimit = limit }(SpillTupleLimit)
+	SpillTupleLimit = 8
+	tmpDir := t.TempDir()
+	t.Setenv("TMPDIR", tmpDir)
+
+	c, bp := makeSQLTestCatalog(t, "l (a int, b string)\nr (a int, b string)\n")
+	var lRows, rRows []string
+	for i := 0; i < 500; i++ {
+		lRows = append(lRows, fmt.Sprintf("(%d, 'v%d')", i%200, i%200))
+		if i%3 == 0 {
+			rRows = append(rRows, fmt.Sprintf("(%d, 'v%d')", i%300, i%300))
+		}
+	}
+	mustRunSQL(t, c, bp, "insert into l values "+strings.Join(lRows, ", "))
+	mustRunSQL(t, c, bp, "insert into r values "+strings.Join(rRows, ", "))
+
+	// l has each value in [0, 100) 3 times and each in [100, 200) twice, and
+	// r has each multiple of 3 in [0, 200) twice and each in [200, 300) once
+	lCount := func(v int) int {
+		if v >= 200 {
+			return 0
+		}
+		return 2 + btoi(v < 100)
+	}
+	rCount := func(v int) int {
+		if v%3 != 0 {
+			return 0
+		}
+		return 1 + btoi(v < 200)
+	}
+	for _, test := range []struct {
+		sql   string
+		count func(v int) int
+	}{
+		{"select * from l union select * from r", func(v int) int { return btoi(lCount(v)+rCount(v) > 0) }},
+		{"select * from l intersect select * from r", func(v int) int { return btoi(lCount(v) > 0 && rCount(v) > 0) }},
+		{"select * from l intersect all select * from r", func(v int) int {
+			if rCount(v) < lCount(v) {
+				return rCount(v)
+			}
+			return lCount(v)
+		}},
+		{"select * from l except select * from r", func(v int) int { return btoi(lCount(v) > 0 && rCount(v) == 0) }},
+		{"select * from l except all select * from r", func(v int) int {
+			if rCount(v) > lCount(v) {
+				return 0
+			}
+			return lCount(v) - rCount(v)
+		}},
+	} {
+		counts := make(map[int64]int)
+		for _, tup := range mustRunSQL(t, c, bp, test.sql) {
+			v := tup.Fields[0].(IntField).Value
+			if tup.Fields[1].(StringField).Value != fmt.Sprintf("v%d", v) {
+				t.Fatalf("unexpected tuple %v from %s", tup, test.sql)
+			}
+			counts[v]++
+		}
+		for v := 0; v < 300; v++ {
+			if counts[int64(v)] != test.count(v) {
+				t.Errorf("expected %d copies of %d from %s, got %d", test.count(v), v, test.sql, counts[int64(v)])
+			}
+		}
+	}
+
+	files, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(files) != 0 {
+		t.Errorf("expected spill files to be removed, found %d", len(files))
+	}
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
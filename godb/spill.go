@@ -0,0 +1,138 @@
+package godb
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+)
+
+// Operators whose state may not fit in memory, such as set operations and
+// grouped aggregation, hold at most SpillTupleLimit tuples in memory.  Beyond
+// that, they write their input to temporary spill files, partitioned by hash
+// so that each partition can be processed in memory on its own, and remove
+// the files once they have been read back.
+
+// The maximum number of tuples that an operator holds in memory before it
+// spills to disk
+var SpillTupleLimit = 1 << 20
+
+const (
+	spillPartitionBits = 4 // the number of bits of the hash used to choose a partition
+	spillFanout        = 1 << spillPartitionBits
+
+	// The maximum number of times a partition is partitioned again.  If a
+	// partition still does not fit in memory after that, most of its tuples
+	// must have the same key, and it is processed in memory regardless.
+	maxSpillDepth = 8
+)
+
+// A temporary file of tuples with the same descriptor
+type spillFile struct {
+	desc  *TupleDesc
+	file  *os.File
+	w     *bufio.Writer
+	count int
+}
+
+func newSpillFile(desc *TupleDesc) (*spillFile, error) {
+	f, err := os.CreateTemp("", "godb-spill-")
+	if err != nil {
+		return nil, err
+	}
+	return &spillFile{desc, f, bufio.NewWriter(f), 0}, nil
+}
+
+// Return the number of bytes that a tuple with descriptor desc is
+// serialized into, including its null bitmap
+func tupleSize(desc *TupleDesc) int {
+	size := nullBitmapSize(len(desc.Fields))
+	for _, f := range desc.Fields {
+		switch f.Ftype {
+		case IntType:
+			size += 8
+		case StringType:
+			size += StringLength
+		}
+	}
+	return size
+}
+
+// Append the fields of t to the file
+func (s *spillFile) add(t *Tuple) error {
+	var b bytes.Buffer
+	if err := (&Tuple{Desc: *s.desc, Fields: t.Fields}).writeTo(&b); err != nil {
+		return err
+	}
+	if _, err := s.w.Write(b.Bytes()); err != nil {
+		return err
+	}
+	s.count++
+	return nil
+}
+
+// Return an iterator over the tuples of the file, in the order they were
+// added.  No more tuples may be added once the file has been read.
+func (s *spillFile) iterator() (func() (*Tuple, error), error) {
+	if err := s.w.Flush(); err != nil {
+		return nil, err
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(s.file)
+	buf := make([]byte, tupleSize(s.desc))
+	read := 0
+	return func() (*Tuple, error) {
+		if read == s.count {
+			return nil, nil
+		}
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		read++
+		return readTupleFrom(bytes.NewBuffer(buf), s.desc)
+	}, nil
+}
+
+// Close and delete the file
+func (s *spillFile) remove() {
+	s.file.Close()
+	os.Remove(s.file.Name())
+}
+
+// A set of spill files that tuples are distributed among by the hash of a
+// key.  Partitions that are partitioned again use different bits of the hash
+// at each depth.
+type partitionedSpill struct {
+	desc  *TupleDesc
+	depth int
+	files [spillFanout]*spillFile // created when the first tuple is added
+}
+
+func newPartitionedSpill(desc *TupleDesc, depth int) *partitionedSpill {
+	return &partitionedSpill{desc: desc, depth: depth}
+}
+
+// Add t to the partition of the hash h, which must be a key returned by
+// [Tuple.tupleKey]
+func (p *partitionedSpill) add(h any, t *Tuple) error {
+	i := (h.(uint64) >> (spillPartitionBits * p.depth)) % spillFanout
+	if p.files[i] == nil {
+		f, err := newSpillFile(p.desc)
+		if err != nil {
+			return err
+		}
+		p.files[i] = f
+	}
+	return p.files[i].add(t)
+}
+
+// Remove the files of every partition
+func (p *partitionedSpill) remove() {
+	for _, f := range p.files {
+		if f != nil {
+			f.remove()
+		}
+	}
+}
@@ -0,0 +1,430 @@
+package godb
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// Subqueries that appear in predicates, other than those planned as
+// semi-joins (see [SemiJoin]), are evaluated by expressions whose results are
+// computed once, when the operator that evaluates the predicate starts,
+// rather than for every tuple.  Correlated subqueries, whose results depend
+// on the tuple, are the exception (see [CorrelatedSubqueryExpr]).
+
+// An expression that depends on the result of a subquery, which must be
+// loaded before the expression is evaluated
+type subqueryExpr interface {
+	Expr
+	load(tid TransactionID) error
+}
+
+// Compile and plan an (uncorrelated) subquery
+func planSubquery(c *Catalog, subquery *sqlparser.Subquery) (Operator, error) {
+	sel, ok := subquery.Select.(*sqlparser.Select)
+	if !ok {
+		return nil, GoDBError{ParseError, fmt.Sprintf("unsupported subquery %s", sqlparser.String(subquery))}
+	}
+	plan, err := parseStatement(c, sel)
+	if err != nil {
+		return nil, err
+	}
+	return makePhysicalPlan(c, plan)
+}
+
+// Compile a subquery of a predicate over tuples with descriptor desc into
+// the expression that newExpr makes from its plan, returning the plan too.
+// If the subquery refers to columns of desc, it is compiled into a
+// [CorrelatedSubqueryExpr] instead, whose plan has arbitrary values in place
+// of those columns.
+func compileSubquery(c *Catalog, subquery *sqlparser.Subquery, desc *TupleDesc, tableMap map[string]*PlanNode, newExpr func(op Operator) subqueryExpr) (Expr, Operator, error) {
+	sel, ok := subquery.Select.(*sqlparser.Select)
+	if !ok {
+		return nil, nil, GoDBError{ParseError, fmt.Sprintf("unsupported subquery %s", sqlparser.String(subquery))}
+	}
+	refs, err := outerReferences(c, sel)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(refs) == 0 {
+		op, err := planSubquery(c, subquery)
+		if err != nil {
+			return nil, nil, err
+		}
+		return newExpr(op), op, nil
+	}
+	e := &CorrelatedSubqueryExpr{c: c, sel: sqlparser.String(sel), refs: refs, newExpr: newExpr}
+	vals := make([]DBValue, len(refs))
+	for i, ref := range refs {
+		field, _, err := ref.col.generateExpr(c, desc, tableMap)
+		if err != nil {
+			return nil, nil, err
+		}
+		e.fields = append(e.fields, field)
+		switch field.GetExprType().Ftype {
+		case IntType:
+			vals[i] = IntField{0}
+		case StringType:
+			vals[i] = StringField{""}
+		}
+	}
+	op, err := e.plan(vals)
+	if err != nil {
+		return nil, nil, err
+	}
+	e.op = op
+	return e, op, nil
+}
+
+// Compile a subquery whose result must have a single column
+func compileColumnSubquery(c *Catalog, subquery *sqlparser.Subquery, desc *TupleDesc, tableMap map[string]*PlanNode, newExpr func(op Operator) subqueryExpr) (Expr, Operator, error) {
+	e, op, err := compileSubquery(c, subquery, desc, tableMap, newExpr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(op.Descriptor().Fields) != 1 {
+		return nil, nil, GoDBError{ParseError, fmt.Sprintf("subquery %s must return a single column", sqlparser.String(subquery))}
+	}
+	return e, op, nil
+}
+
+// A column of the query enclosing a subquery that the subquery refers to
+type outerReference struct {
+	pos int                // the position of the reference in subqueryColumns
+	col *LogicalSelectNode // the column it refers to
+}
+
+// Return the columns that a subquery refers to, other than those of its own
+// subqueries, in a fixed order
+func subqueryColumns(sel *sqlparser.Select) []*sqlparser.ColName {
+	var cols []*sqlparser.ColName
+	sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch node := node.(type) {
+		case *sqlparser.ColName:
+			cols = append(cols, node)
+		case *sqlparser.Subquery:
+			return false, nil
+		}
+		return true, nil
+	}, sel)
+	return cols
+}
+
+// Return the references of a subquery to columns that are neither columns
+// of its tables nor names of its select list, which must be columns of the
+// query that encloses it
+func outerReferences(c *Catalog, sel *sqlparser.Select) ([]outerReference, error) {
+	inner, err := parseStatement(c, sel)
+	if err != nil {
+		return nil, err
+	}
+	var refs []outerReference
+	for pos, colName := range subqueryColumns(sel) {
+		col, err := parseExpr(c, colName, "")
+		if err != nil {
+			return nil, err
+		}
+		local := inner.hasColumn(c, col)
+		for _, s := range inner.selects {
+			local = local || (col.table == "" && s.alias == col.field)
+		}
+		if !local {
+			refs = append(refs, outerReference{pos, col})
+		}
+	}
+	return refs, nil
+}
+
+// Return the columns of the enclosing query that the subqueries of a WHERE
+// clause expression refer to
+func correlatedColumns(c *Catalog, expr sqlparser.Expr) ([]*LogicalSelectNode, error) {
+	var cols []*LogicalSelectNode
+	err := sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		subquery, ok := node.(*sqlparser.Subquery)
+		if !ok {
+			return true, nil
+		}
+		if sel, ok := subquery.Select.(*sqlparser.Select); ok {
+			refs, err := outerReferences(c, sel)
+			if err != nil {
+				return false, err
+			}
+			for _, ref := range refs {
+				cols = append(cols, ref.col)
+			}
+		}
+		return false, nil
+	}, expr)
+	return cols, err
+}
+
+// Return a literal with the value v
+func valueLiteral(v DBValue) sqlparser.Expr {
+	switch v := v.(type) {
+	case IntField:
+		return sqlparser.NewIntVal([]byte(strconv.FormatInt(v.Value, 10)))
+	case StringField:
+		return sqlparser.NewStrVal([]byte(v.Value))
+	}
+	return &sqlparser.NullVal{}
+}
+
+// Replace the expression from with to wherever it appears in sel, other than
+// in its subqueries
+func replaceInSelect(sel *sqlparser.Select, from sqlparser.Expr, to sqlparser.Expr) {
+	replace := func(expr *sqlparser.Expr) {
+		*expr = sqlparser.ReplaceExpr(*expr, from, to)
+	}
+	sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch node := node.(type) {
+		case *sqlparser.AliasedExpr:
+			replace(&node.Expr)
+		case *sqlparser.JoinTableExpr:
+			if node.Condition.On != nil {
+				replace(&node.Condition.On)
+			}
+		case *sqlparser.Where:
+			if node != nil {
+				replace(&node.Expr)
+			}
+		case sqlparser.GroupBy:
+			for i := range node {
+				replace(&node[i])
+			}
+		case *sqlparser.Order:
+			replace(&node.Expr)
+		case *sqlparser.Subquery:
+			return false, nil
+		}
+		return true, nil
+	}, sel)
+}
+
+// CorrelatedSubqueryExpr evaluates a correlated subquery that could not be
+// decorrelated (see [LogicalPlan.decorrelate]).  The subquery is planned
+// and run once for each distinct combination of the values of the columns of
+// the enclosing query that it refers to, with literals of those values in
+// place of the references, and the expression that evaluates it for each
+// combination is kept until the subquery is next loaded.
+type CorrelatedSubqueryExpr struct {
+	c       *Catalog
+	sel     string                         // the text of the subquery
+	refs    []outerReference               // its references to the enclosing query
+	fields  []Expr                         // the values of refs in the tuples the expression is evaluated over
+	newExpr func(op Operator) subqueryExpr // makes the expression that evaluates a plan of the subquery
+	op      Operator                       // the subquery planned with arbitrary values of refs
+	tid     TransactionID
+	exprs   map[any]subqueryExpr
+}
+
+func (e *CorrelatedSubqueryExpr) GetExprType() FieldType {
+	return e.newExpr(e.op).GetExprType()
+}
+
+// Plan the subquery with the values vals of its references to the enclosing
+// query
+func (e *CorrelatedSubqueryExpr) plan(vals []DBValue) (Operator, error) {
+	stmt, err := sqlparser.Parse(e.sel)
+	if err != nil {
+		return nil, err
+	}
+	sel := stmt.(*sqlparser.Select)
+	cols := subqueryColumns(sel)
+	for i, ref := range e.refs {
+		replaceInSelect(sel, cols[ref.pos], valueLiteral(vals[i]))
+	}
+	plan, err := parseStatement(e.c, sel)
+	if err != nil {
+		return nil, err
+	}
+	return makePhysicalPlan(e.c, plan)
+}
+
+func (e *CorrelatedSubqueryExpr) load(tid TransactionID) error {
+	e.tid = tid
+	e.exprs = make(map[any]subqueryExpr)
+	return nil
+}
+
+func (e *CorrelatedSubqueryExpr) EvalExpr(t *Tuple) (DBValue, error) {
+	if e.exprs == nil {
+		return nil, GoDBError{IllegalOperationError, "subquery evaluated before it was run"}
+	}
+	vals := make([]DBValue, len(e.fields))
+	for i, field := range e.fields {
+		val, err := field.EvalExpr(t)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = val
+	}
+	key := (&Tuple{Fields: vals}).tupleKey()
+	expr, ok := e.exprs[key]
+	if !ok {
+		op, err := e.plan(vals)
+		if err != nil {
+			return nil, err
+		}
+		expr = e.newExpr(op)
+		for _, sq := range predicateSubqueries(expr) {
+			if err := sq.load(e.tid); err != nil {
+				return nil, err
+			}
+		}
+		e.exprs[key] = expr
+	}
+	return expr.EvalExpr(t)
+}
+
+// Run a subquery, calling f on each tuple of its result
+func runSubquery(op Operator, tid TransactionID, f func(t *Tuple) error) error {
+	iter, err := op.Iterator(tid)
+	if err != nil {
+		return err
+	}
+	for {
+		t, err := iter()
+		if err != nil || t == nil {
+			return err
+		}
+		if err := f(t); err != nil {
+			return err
+		}
+	}
+}
+
+// ScalarSubqueryExpr is the single value of a subquery, or NULL if the
+// subquery returns no tuples.  It is an error for the subquery to return more
+// than one tuple.
+type ScalarSubqueryExpr struct {
+	op     Operator
+	val    DBValue
+	loaded bool
+}
+
+func (e *ScalarSubqueryExpr) GetExprType() FieldType {
+	return e.op.Descriptor().Fields[0]
+}
+
+func (e *ScalarSubqueryExpr) load(tid TransactionID) error {
+	e.val, e.loaded = nil, false
+	found := false
+	err := runSubquery(e.op, tid, func(t *Tuple) error {
+		if found {
+			return GoDBError{IllegalOperationError, "scalar subquery returned more than one tuple"}
+		}
+		found = true
+		e.val = t.Fields[0]
+		return nil
+	})
+	e.loaded = err == nil
+	return err
+}
+
+func (e *ScalarSubqueryExpr) EvalExpr(t *Tuple) (DBValue, error) {
+	if !e.loaded {
+		return nil, GoDBError{IllegalOperationError, "subquery evaluated before it was run"}
+	}
+	return e.val, nil
+}
+
+// InSubqueryExpr tests whether the value of an expression is among the
+// values returned by a subquery.  As in SQL, the result is NULL, rather than
+// false, if the value is not found but is NULL or the subquery returned NULL.
+type InSubqueryExpr struct {
+	left    Expr
+	op      Operator
+	values  map[any]bool
+	hasNull bool
+	loaded  bool
+}
+
+func (e *InSubqueryExpr) GetExprType() FieldType {
+	return FieldType{"predicate", "", IntType}
+}
+
+func (e *InSubqueryExpr) load(tid TransactionID) error {
+	e.values, e.hasNull, e.loaded = make(map[any]bool), false, false
+	err := runSubquery(e.op, tid, func(t *Tuple) error {
+		if key, ok := keyOfFields(t, []int{0}); ok {
+			e.values[key] = true
+		} else {
+			e.hasNull = true
+		}
+		return nil
+	})
+	e.loaded = err == nil
+	return err
+}
+
+func (e *InSubqueryExpr) EvalExpr(t *Tuple) (DBValue, error) {
+	if !e.loaded {
+		return nil, GoDBError{IllegalOperationError, "subquery evaluated before it was run"}
+	}
+	val, err := e.left.EvalExpr(t)
+	if err != nil {
+		return nil, err
+	}
+	if len(e.values) == 0 && !e.hasNull {
+		return falseField, nil
+	}
+	if val == nil {
+		return nil, nil
+	}
+	if e.values[(&Tuple{Fields: []DBValue{val}}).tupleKey()] {
+		return trueField, nil
+	}
+	if e.hasNull {
+		return nil, nil
+	}
+	return falseField, nil
+}
+
+// ExistsExpr tests whether a subquery returns any tuples
+type ExistsExpr struct {
+	op     Operator
+	exists bool
+	loaded bool
+}
+
+func (e *ExistsExpr) GetExprType() FieldType {
+	return FieldType{"predicate", "", IntType}
+}
+
+func (e *ExistsExpr) load(tid TransactionID) error {
+	iter, err := e.op.Iterator(tid)
+	if err != nil {
+		return err
+	}
+	t, err := iter()
+	e.exists, e.loaded = t != nil, err == nil
+	return err
+}
+
+func (e *ExistsExpr) EvalExpr(t *Tuple) (DBValue, error) {
+	if !e.loaded {
+		return nil, GoDBError{IllegalOperationError, "subquery evaluated before it was run"}
+	}
+	return boolField(e.exists), nil
+}
+
+// Return the subqueries of a predicate
+func predicateSubqueries(e Expr) []subqueryExpr {
+	var subqueries []subqueryExpr
+	switch e := e.(type) {
+	case *InSubqueryExpr:
+		subqueries = append(predicateSubqueries(e.left), e)
+	case subqueryExpr:
+		subqueries = append(subqueries, e)
+	case *CompareExpr:
+		subqueries = append(predicateSubqueries(e.left), predicateSubqueries(e.right)...)
+	case *LogicExpr:
+		for _, arg := range e.args {
+			subqueries = append(subqueries, predicateSubqueries(arg)...)
+		}
+	case *IsNullExpr:
+		subqueries = predicateSubqueries(e.expr)
+	}
+	return subqueries
+}
@@ -0,0 +1,89 @@
+package godb
+
+import (
+	"testing"
+)
+
+func TestInSubquery(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "emp (name string, age int, dept int)\ndept (id int, dname string, budget int)\n")
+	mustRunSQL(t, c, bp, "insert into emp values ('sam', 25, 1), ('mary', 30, 2), ('joe', 40, 1), ('ann', null, 3), ('bob', 50, null)")
+	mustRunSQL(t, c, bp, "insert into dept values (1, 'eng', 100), (2, 'sales', 20), (3, 'hr', 60)")
+	expectNames(t, c, bp, "select name from emp where dept in (select id from dept where budget > 50) order by name", "ann", "joe", "sam")
+	expectNames(t, c, bp, "select name from emp where dept not in (select id from dept where budget > 50) order by name", "mary")
+	// NOT IN is never true if the subquery returns a NULL
+	expectNames(t, c, bp, "select name from emp where age not in (select dept from emp)")
+	// but is true for every tuple, including those with NULLs, if it is empty
+	expectNames(t, c, bp, "select name from emp where age not in (select id from dept where budget > 1000) order by name", "ann", "bob", "joe", "mary", "sam")
+
+	// IN and NOT IN nested in other predicates
+	expectNames(t, c, bp, "select name from emp where age > 45 or dept in (select id from dept where dname = 'sales') order by name", "bob", "mary")
+	expectNames(t, c, bp, "select name from emp where not (dept not in (select id from dept where budget < 50)) order by name", "mary")
+	expectNames(t, c, bp, "select name from emp where age is null or age not in (select dept from emp where dept is not null) order by name", "ann", "bob", "joe", "mary", "sam")
+}
+
+func TestExistsSubquery(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "emp (name string, age int, dept int)\ndept (id int, dname string, budget int)\n")
+	mustRunSQL(t, c, bp, "insert into emp values ('sam', 25, 1), ('mary', 30, 2), ('joe', 40, 1), ('ann', null, 3), ('bob', 50, null)")
+	mustRunSQL(t, c, bp, "insert into dept values (1, 'eng', 100), (2, 'sales', 20), (3, 'hr', 60)")
+	expectNames(t, c, bp, "select name from emp where exists (select id from dept where budget > 90) and age < 30", "sam")
+	expectNames(t, c, bp, "select name from emp where exists (select id from dept where budget > 900)")
+	expectNames(t, c, bp, "select name from emp where not exists (select id from dept where budget > 900) and age < 30", "sam")
+	expectNames(t, c, bp, "select name from emp where age < 30 or exists (select id from dept where budget > 900)", "sam")
+}
+
+func TestScalarSubquery(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "emp (name string, age int, dept int)\ndept (id int, dname string, budget int)\n")
+	mustRunSQL(t, c, bp, "insert into emp values ('sam', 25, 1), ('mary', 30, 2), ('joe', 40, 1), ('ann', null, 3), ('bob', 50, null)")
+	mustRunSQL(t, c, bp, "insert into dept values (1, 'eng', 100), (2, 'sales', 20), (3, 'hr', 60)")
+	expectNames(t, c, bp, "select name from emp where age > (select avg(age) from emp) order by name", "bob", "joe")
+	expectNames(t, c, bp, "select name from emp where (select max(budget) from dept) = 100 and dept = 2", "mary")
+	// a scalar subquery with no result is NULL
+	expectNames(t, c, bp, "select name from emp where age > (select budget from dept where budget > 1000)")
+	if _, err := runSQL(c, bp, "select name from emp where age > (select budget from dept)"); err == nil {
+		t.Errorf("expected error for scalar subquery returning several tuples")
+	}
+	for _, sql := range []string{
+		"select name from emp where age > (select id, budget from dept where id = 1)",
+		"select name from emp where age in (select dname from dept)",
+		"select name from emp where age in (select id, budget from dept)",
+	} {
+		if _, err := runSQL(c, bp, sql); err == nil {
+			t.Errorf("expected error for %s", sql)
+		}
+	}
+}
+
+func TestSemiJoinPlan(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "emp (name string, age int, dept int)\ndept (id int, dname string, budget int)\n")
+	mustRunSQL(t, c, bp, "insert into emp values ('sam', 25, 1), ('mary', 30, 2), ('joe', 40, 1), ('ann', null, 3), ('bob', 50, null)")
+	mustRunSQL(t, c, bp, "insert into dept values (1, 'eng', 100), (2, 'sales', 20), (3, 'hr', 60)")
+	sql := "select name from emp where age > 20 and dept in (select id from dept where budget > 50) and not exists (select id from dept where budget > 900)"
+	_, op, err := Parse(c, sql)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// the IN subquery is a semi-join on emp, which the EXISTS anti-join is
+	// applied to
+	anti, ok := op.(*Project).child.(*SemiJoin)
+	if !ok || !anti.anti || len(anti.leftKeys) != 0 {
+		t.Fatalf("expected an anti-join without keys, got %T", op.(*Project).child)
+	}
+	semi, ok := anti.left.(*SemiJoin)
+	if !ok || semi.anti || len(semi.leftKeys) != 1 {
+		t.Fatalf("expected a semi-join, got %T", anti.left)
+	}
+	if _, ok := semi.left.(*PredicateFilter); !ok {
+		t.Errorf("expected the filter on emp below the semi-join, got %T", semi.left)
+	}
+	expectNames(t, c, bp, sql+" order by name", "joe", "sam")
+}
+
+func TestSubqueryDeleteUpdate(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "emp (name string, age int, dept int)\ndept (id int, dname string, budget int)\n")
+	mustRunSQL(t, c, bp, "insert into emp values ('sam', 25, 1), ('mary', 30, 2), ('joe', 40, 1), ('ann', null, 3), ('bob', 50, null)")
+	mustRunSQL(t, c, bp, "insert into dept values (1, 'eng', 100), (2, 'sales', 20), (3, 'hr', 60)")
+	mustRunSQL(t, c, bp, "update emp set age = 0 where dept in (select id from dept where dname = 'eng')")
+	expectNames(t, c, bp, "select name from emp where age = 0 order by name", "joe", "sam")
+	mustRunSQL(t, c, bp, "delete from emp where age < (select avg(budget) from dept where budget < 100)")
+	expectNames(t, c, bp, "select name from emp order by name", "ann", "bob")
+}
@@ -0,0 +1,616 @@
+package godb
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// Statistics about the contents of a table, which the optimizer uses to
+// estimate the number of tuples that plans produce (see optimizer.go).  They
+// are computed by ANALYZE (see analyze.go), recorded in the catalog file, and
+// kept approximately up to date as tuples are inserted and deleted.
+type TableStats struct {
+	mu      sync.Mutex // protects the statistics from concurrent updates
+	rows    float64
+	pages   float64
+	columns map[string]*ColumnStats // by column name; columns without statistics are missing
+}
+
+// Statistics about the values of a column
+type ColumnStats struct {
+	distinct     float64 // the number of distinct non-NULL values
+	nullFraction float64 // the fraction of the values that are NULL
+	min, max     DBValue // the smallest and largest values, or nil if unknown
+
+	// the most common values, and the fraction of all values equal to each
+	mcvs     []DBValue
+	mcvFreqs []float64
+
+	// the bounds of an equi-depth histogram of the other non-NULL values:
+	// each of its len(histogram)-1 buckets holds about the same number of
+	// values, between its bounds
+	histogram []DBValue
+
+	sketch *hyperLogLog // the distinct values, or nil if unknown
+}
+
+// Default selectivities of predicates whose selectivity cannot be estimated
+// from statistics
+const (
+	defaultEqualitySelectivity = 0.1
+	defaultRangeSelectivity    = 1.0 / 3
+	defaultLikeSelectivity     = 0.1
+	defaultNullSelectivity     = 0.05
+)
+
+// The number of tuples assumed for relations without statistics, such as
+// subqueries
+const defaultRelationRows = 1000
+
+func NewTableStats(rows int, pages int) *TableStats {
+	return &TableStats{rows: float64(rows), pages: float64(pages), columns: make(map[string]*ColumnStats)}
+}
+
+// Set the statistics of a column: the number of distinct non-NULL values, the
+// fraction of values that are NULL, and the smallest and largest values
+// (which may be nil if unknown)
+func (s *TableStats) SetColumnStats(column string, distinct int, nullFraction float64, min DBValue, max DBValue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.columns[column] = &ColumnStats{distinct: float64(distinct), nullFraction: nullFraction, min: min, max: max}
+}
+
+// Return a copy of the statistics, which is not changed by later updates
+func (s *TableStats) snapshot() *TableStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := &TableStats{rows: s.rows, pages: s.pages, columns: make(map[string]*ColumnStats)}
+	for name, col := range s.columns {
+		c := *col
+		c.sketch = nil
+		copied.columns[name] = &c
+	}
+	return copied
+}
+
+// Set the statistics of a table, replacing any it had
+func (c *Catalog) SetTableStats(table string, stats *TableStats) error {
+	t, ok := c.tableMap[table]
+	if !ok || t == nil {
+		return GoDBError{NoSuchTableError, fmt.Sprintf("no table '%s' found", table)}
+	}
+	t.stats = stats
+	return nil
+}
+
+// Return the statistics of the table named table with file file.  Tables
+// that have not been analyzed are estimated to have full pages.
+func (c *Catalog) tableStats(table string, file DBFile) *TableStats {
+	if t, ok := c.tableMap[table]; ok && t != nil && t.stats != nil {
+		return t.stats.snapshot()
+	}
+	if hf, ok := file.(*HeapFile); ok {
+		pages := hf.NumPages()
+		perPage := (PageSize - 8) / tupleSize(hf.Descriptor())
+		return NewTableStats(pages*perPage, pages)
+	}
+	return NewTableStats(defaultRelationRows, 0)
+}
+
+// Update the statistics of t after its column has been dropped (if newName
+// is "") or renamed to newName
+func (t *Table) updateStatsColumns(column string, newName string) {
+	if t.stats == nil {
+		return
+	}
+	t.stats.mu.Lock()
+	defer t.stats.mu.Unlock()
+	if col, ok := t.stats.columns[column]; ok {
+		delete(t.stats.columns, column)
+		if newName != "" {
+			t.stats.columns[newName] = col
+		}
+	}
+}
+
+// Return the fraction of the values of the column that are equal to v
+func (s *ColumnStats) equalSelectivity(v DBValue) float64 {
+	if s == nil || s.distinct == 0 {
+		return defaultEqualitySelectivity
+	}
+	if v != nil && s.min != nil && s.max != nil && (compareValues(v, s.min) < 0 || compareValues(v, s.max) > 0) {
+		return 0
+	}
+	// the values that are not most common values are assumed to be equally
+	// common
+	rest := 1 - s.nullFraction
+	for i, mcv := range s.mcvs {
+		if v != nil && compareValues(mcv, v) == 0 {
+			return s.mcvFreqs[i]
+		}
+		rest -= s.mcvFreqs[i]
+	}
+	others := s.distinct - float64(len(s.mcvs))
+	if others < 1 {
+		others = 1
+	}
+	return clampSelectivity(rest / others)
+}
+
+// Return the fraction of the values of the column that compare to v with
+// op, which is one of OpLt, OpLe, OpGt and OpGe.  Values are estimated from
+// the most common values and histogram of the column, if it has them, or
+// otherwise, if the column is an integer column whose smallest and largest
+// values are known, assumed to be uniformly distributed between them.
+func (s *ColumnStats) rangeSelectivity(op BoolOp, v DBValue) float64 {
+	if s == nil || v == nil {
+		return defaultRangeSelectivity
+	}
+	if len(s.histogram) >= 2 {
+		sel := 0.0
+		rest := 1 - s.nullFraction
+		for i, mcv := range s.mcvs {
+			if evalPred(compareValues(mcv, v), 0, op) {
+				sel += s.mcvFreqs[i]
+			}
+			rest -= s.mcvFreqs[i]
+		}
+		below, equal := s.histogramPosition(v)
+		return clampSelectivity(sel + applyRange(op, below, equal)*rest)
+	}
+
+	lo, ok1 := s.min.(IntField)
+	hi, ok2 := s.max.(IntField)
+	x, ok3 := v.(IntField)
+	if !ok1 || !ok2 || !ok3 {
+		return defaultRangeSelectivity
+	}
+	// the fraction of the values below x, and the fraction equal to it
+	var below, equal float64
+	switch {
+	case x.Value < lo.Value:
+		below = 0
+	case x.Value > hi.Value:
+		below = 1
+	default:
+		width := float64(hi.Value - lo.Value + 1)
+		below = float64(x.Value-lo.Value) / width
+		equal = 1 / width
+		if s.distinct > 0 && 1/s.distinct > equal {
+			equal = 1 / s.distinct
+		}
+	}
+	return applyRange(op, below, equal) * (1 - s.nullFraction)
+}
+
+// Return the estimated fractions of the values of the histogram of the
+// column that are below v and equal to v.  Integers are assumed to be
+// uniformly distributed within each bucket, and other values to be in its
+// middle.
+func (s *ColumnStats) histogramPosition(v DBValue) (float64, float64) {
+	buckets := float64(len(s.histogram) - 1)
+	equal := 1 / buckets
+	if others := s.distinct - float64(len(s.mcvs)); others > 1 {
+		equal = 1 / others
+	}
+	if compareValues(v, s.histogram[0]) < 0 {
+		return 0, 0
+	}
+	if compareValues(v, s.histogram[len(s.histogram)-1]) > 0 {
+		return 1, 0
+	}
+	// the first bucket whose upper bound is at least v
+	i := sort.Search(len(s.histogram)-1, func(i int) bool {
+		return compareValues(s.histogram[i+1], v) >= 0
+	})
+	within := 0.5
+	lo, ok1 := s.histogram[i].(IntField)
+	hi, ok2 := s.histogram[i+1].(IntField)
+	x, ok3 := v.(IntField)
+	if ok1 && ok2 && ok3 && hi.Value > lo.Value {
+		within = float64(x.Value-lo.Value) / float64(hi.Value-lo.Value)
+	}
+	return (float64(i) + within) / buckets, equal
+}
+
+// Return the fraction of values that compare to a value with op, given the
+// fractions of values below it and equal to it
+func applyRange(op BoolOp, below float64, equal float64) float64 {
+	var sel float64
+	switch op {
+	case OpLt:
+		sel = below
+	case OpLe:
+		sel = below + equal
+	case OpGt:
+		sel = 1 - below - equal
+	case OpGe:
+		sel = 1 - below
+	}
+	return clampSelectivity(sel)
+}
+
+func clampSelectivity(sel float64) float64 {
+	if sel < 0 {
+		return 0
+	} else if sel > 1 {
+		return 1
+	}
+	return sel
+}
+
+// Applies the tuples that an InsertOp, DeleteOp or UpdateOp inserts into or
+// deletes from an analyzed table to its statistics.  The number of tuples,
+// the fraction of NULLs, the smallest and largest values and the distinct
+// value sketches are kept up to date; the most common values and histograms,
+// whose frequencies are relative, are only recomputed by ANALYZE.  The
+// changes of a statement are collected in a [statsDelta], which is applied
+// to the statistics and written to the catalog file when its transaction
+// commits, and discarded if it aborts.
+type statsUpdater struct {
+	c     *Catalog
+	stats *TableStats
+	desc  *TupleDesc
+}
+
+// Return an updater for the statistics of the named table, or nil if it has
+// none
+func (c *Catalog) getStatsUpdater(table string) *statsUpdater {
+	t := c.tableMap[table]
+	if t == nil || t.stats == nil {
+		return nil
+	}
+	return &statsUpdater{c, t.stats, &t.desc}
+}
+
+// The changes that a statement makes to the statistics of a table
+type statsDelta struct {
+	rows    float64       // the number of tuples inserted less the number deleted
+	columns []columnDelta // by field number
+}
+
+// The changes that a statement makes to the statistics of a column
+type columnDelta struct {
+	nulls    float64      // the number of NULLs inserted less the number deleted
+	inserted bool         // whether any non-NULL values were inserted
+	min, max DBValue      // the smallest and largest inserted values
+	sketch   *hyperLogLog // the inserted values, or nil if the column has no sketch
+}
+
+// Return an empty delta for the statistics of the updater's table
+func (u *statsUpdater) newDelta() *statsDelta {
+	d := &statsDelta{columns: make([]columnDelta, len(u.desc.Fields))}
+	u.stats.mu.Lock()
+	defer u.stats.mu.Unlock()
+	for i, f := range u.desc.Fields {
+		if col := u.stats.columns[f.Fname]; col != nil && col.sketch != nil {
+			d.columns[i].sketch = newHyperLogLog()
+		}
+	}
+	return d
+}
+
+// Record that t has been inserted (if delta is 1) or deleted (if delta is -1)
+func (d *statsDelta) add(t *Tuple, delta float64) {
+	d.rows += delta
+	for i := range d.columns {
+		if i >= len(t.Fields) {
+			break
+		}
+		col := &d.columns[i]
+		v := t.Fields[i]
+		if v == nil {
+			col.nulls += delta
+			continue
+		}
+		if delta < 0 {
+			// deleted values may remain in the sketch and bounds
+			continue
+		}
+		if !col.inserted || compareValues(v, col.min) < 0 {
+			col.min = v
+		}
+		if !col.inserted || compareValues(v, col.max) > 0 {
+			col.max = v
+		}
+		col.inserted = true
+		if col.sketch != nil {
+			col.sketch.add(v)
+		}
+	}
+}
+
+// Apply d to the statistics once transaction tid commits, and write them to
+// the catalog file.  If the catalog file cannot be written, the statistics
+// are written with those of a later commit.
+func (u *statsUpdater) applyAtCommit(tid TransactionID, d *statsDelta) {
+	u.c.bp.onCommit(tid, func() {
+		u.apply(d)
+		u.c.saveStatistics()
+	})
+}
+
+// Apply the changes of d to the statistics
+func (u *statsUpdater) apply(d *statsDelta) {
+	u.stats.mu.Lock()
+	defer u.stats.mu.Unlock()
+	oldRows := u.stats.rows
+	u.stats.rows = math.Max(u.stats.rows+d.rows, 0)
+	for i, f := range u.desc.Fields {
+		col := u.stats.columns[f.Fname]
+		if col == nil || i >= len(d.columns) {
+			continue
+		}
+		delta := d.columns[i]
+		nulls := math.Max(col.nullFraction*oldRows+delta.nulls, 0)
+		col.nullFraction = 0
+		if u.stats.rows > 0 {
+			col.nullFraction = clampSelectivity(nulls / u.stats.rows)
+		}
+		if delta.inserted {
+			if col.min == nil || compareValues(delta.min, col.min) < 0 {
+				col.min = delta.min
+			}
+			if col.max == nil || compareValues(delta.max, col.max) > 0 {
+				col.max = delta.max
+			}
+		}
+		if col.sketch != nil && delta.sketch != nil && delta.inserted {
+			col.sketch.merge(delta.sketch)
+			col.distinct = math.Round(col.sketch.estimate())
+		}
+		col.distinct = math.Max(math.Min(col.distinct, u.stats.rows-nulls), 0)
+	}
+}
+
+// Write the catalog, with the statistics of its tables, to the file it was
+// loaded from, if any
+func (c *Catalog) saveStatistics() error {
+	if c.catalogFile == "" {
+		return nil
+	}
+	return c.SaveToFile(c.catalogFile, c.rootPath)
+}
+
+// Return the lines of the catalog file that record the statistics of the
+// tables, in the format parsed by [tokenStream.statisticsDefinition]
+func (c *Catalog) statisticsString() string {
+	str := ""
+	for _, t := range c.tables {
+		if t.stats == nil {
+			continue
+		}
+		s := t.stats
+		s.mu.Lock()
+		str = str + fmt.Sprintf("statistics %s rows %s pages %s\n", t.name, formatStat(s.rows), formatStat(s.pages))
+		for _, f := range t.desc.Fields {
+			col := s.columns[f.Fname]
+			if col == nil {
+				continue
+			}
+			str = str + fmt.Sprintf("statistics %s.%s distinct %s nulls %s", t.name, f.Fname, formatStat(col.distinct), formatStat(col.nullFraction))
+			if col.min != nil && col.max != nil {
+				str = str + fmt.Sprintf(" min %s max %s", formatStatValue(col.min), formatStatValue(col.max))
+			}
+			if len(col.mcvs) > 0 {
+				mcvs := make([]string, len(col.mcvs))
+				for i, v := range col.mcvs {
+					mcvs[i] = formatStatValue(v) + " " + formatStat(col.mcvFreqs[i])
+				}
+				str = str + " mcv (" + strings.Join(mcvs, ", ") + ")"
+			}
+			if len(col.histogram) > 0 {
+				bounds := make([]string, len(col.histogram))
+				for i, v := range col.histogram {
+					bounds[i] = formatStatValue(v)
+				}
+				str = str + " histogram (" + strings.Join(bounds, ", ") + ")"
+			}
+			if col.sketch != nil {
+				str = str + fmt.Sprintf(" sketch '%s'", col.sketch.String())
+			}
+			str = str + "\n"
+		}
+		s.mu.Unlock()
+	}
+	return str
+}
+
+func formatStat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func formatStatValue(v DBValue) string {
+	switch v := v.(type) {
+	case IntField:
+		return strconv.FormatInt(v.Value, 10)
+	case StringField:
+		return sqlparser.String(sqlparser.NewStrVal([]byte(v.Value)))
+	}
+	return "null"
+}
+
+// Return true if a line of a catalog file records statistics rather than
+// defining a table (which may itself be named statistics)
+func isStatisticsDefinition(line string) bool {
+	ts := newTokenStream(line)
+	return ts.accept("statistics") && ts.typ != '('
+}
+
+// The statistics of a table or of one of its columns, as recorded in a
+// catalog file
+type statisticsEntry struct {
+	table  string
+	column string       // "" for the statistics of the table
+	stats  *TableStats  // if column is ""
+	col    *ColumnStats // otherwise
+}
+
+// Consume the statistics of a table or column recorded in a catalog file,
+// following the STATISTICS keyword, which are either
+//
+//	table ROWS n PAGES n
+//
+// or
+//
+//	table.column DISTINCT n NULLS f [MIN v MAX v] [MCV (v f, ...)] [HISTOGRAM (v, ...)] [SKETCH 'registers']
+//
+// The statistics of a table precede those of its columns.
+func (ts *tokenStream) statisticsDefinition() (*statisticsEntry, error) {
+	table, err := ts.ident()
+	if err != nil {
+		return nil, err
+	}
+	e := &statisticsEntry{table: table}
+	if !ts.acceptChar('.') {
+		if err := ts.expect("rows"); err != nil {
+			return nil, err
+		}
+		rows, err := ts.number()
+		if err != nil {
+			return nil, err
+		}
+		if err := ts.expect("pages"); err != nil {
+			return nil, err
+		}
+		pages, err := ts.number()
+		if err != nil {
+			return nil, err
+		}
+		e.stats = &TableStats{rows: rows, pages: pages, columns: make(map[string]*ColumnStats)}
+		return e, nil
+	}
+
+	if e.column, err = ts.ident(); err != nil {
+		return nil, err
+	}
+	col := &ColumnStats{}
+	e.col = col
+	if err := ts.expect("distinct"); err != nil {
+		return nil, err
+	}
+	if col.distinct, err = ts.number(); err != nil {
+		return nil, err
+	}
+	if err := ts.expect("nulls"); err != nil {
+		return nil, err
+	}
+	if col.nullFraction, err = ts.number(); err != nil {
+		return nil, err
+	}
+	if ts.accept("min") {
+		if col.min, err = ts.literal(); err != nil {
+			return nil, err
+		}
+		if err := ts.expect("max"); err != nil {
+			return nil, err
+		}
+		if col.max, err = ts.literal(); err != nil {
+			return nil, err
+		}
+	}
+	if ts.accept("mcv") {
+		if err := ts.expectChar('('); err != nil {
+			return nil, err
+		}
+		for {
+			v, err := ts.literal()
+			if err != nil {
+				return nil, err
+			}
+			freq, err := ts.number()
+			if err != nil {
+				return nil, err
+			}
+			col.mcvs = append(col.mcvs, v)
+			col.mcvFreqs = append(col.mcvFreqs, freq)
+			if !ts.acceptChar(',') {
+				break
+			}
+		}
+		if err := ts.expectChar(')'); err != nil {
+			return nil, err
+		}
+	}
+	if ts.accept("histogram") {
+		if err := ts.expectChar('('); err != nil {
+			return nil, err
+		}
+		for {
+			v, err := ts.literal()
+			if err != nil {
+				return nil, err
+			}
+			col.histogram = append(col.histogram, v)
+			if !ts.acceptChar(',') {
+				break
+			}
+		}
+		if err := ts.expectChar(')'); err != nil {
+			return nil, err
+		}
+	}
+	if ts.accept("sketch") {
+		if ts.typ != sqlparser.STRING {
+			return nil, ts.errorf("expected a sketch")
+		}
+		if col.sketch, err = parseHyperLogLog(ts.val); err != nil {
+			return nil, err
+		}
+		ts.next()
+	}
+	return e, nil
+}
+
+// Consume a non-negative number, which may have a fractional part
+func (ts *tokenStream) number() (float64, error) {
+	if ts.typ != sqlparser.INTEGRAL && ts.typ != sqlparser.FLOAT {
+		return 0, ts.errorf("expected a number")
+	}
+	val, err := strconv.ParseFloat(ts.val, 64)
+	if err != nil {
+		return 0, ts.errorf("malformed number")
+	}
+	ts.next()
+	return val, nil
+}
+
+// Consume an integer or string literal
+func (ts *tokenStream) literal() (DBValue, error) {
+	if ts.typ == sqlparser.STRING {
+		v := StringField{ts.val}
+		ts.next()
+		return v, nil
+	}
+	n, err := ts.integer()
+	if err != nil {
+		return nil, ts.errorf("expected a value")
+	}
+	return IntField{n}, nil
+}
+
+// Record the statistics of e in the catalog
+func (c *Catalog) addStatisticsEntry(e *statisticsEntry) error {
+	t := c.tableMap[e.table]
+	if t == nil {
+		return GoDBError{NoSuchTableError, fmt.Sprintf("statistics of unknown table '%s'", e.table)}
+	}
+	if e.column == "" {
+		t.stats = e.stats
+		return nil
+	}
+	if t.stats == nil {
+		return GoDBError{ParseError, fmt.Sprintf("statistics of column '%s' precede those of table '%s'", e.column, e.table)}
+	}
+	if _, err := findFieldInTd(FieldType{e.column, "", UnknownType}, &t.desc); err != nil {
+		return GoDBError{NoSuchTableError, fmt.Sprintf("statistics of unknown column '%s' of table '%s'", e.column, e.table)}
+	}
+	t.stats.columns[e.column] = e.col
+	return nil
+}
@@ -0,0 +1,124 @@
+package godb
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+)
+
+// TopN returns the first limit tuples of its child in the order of orderBy,
+// after skipping the first offset, as OrderBy followed by LimitOp would, but
+// only holds limit + offset tuples in memory: those that sort first among the
+// tuples read so far, in a heap whose root is the tuple that sorts last.
+// Tuples that compare equal are returned in the order of the child.
+type TopN struct {
+	orderBy   []Expr
+	ascending []bool
+	limit     Expr
+	offset    Expr // nil for none
+	child     Operator
+}
+
+// Construct a TopN; limit and offset must be constant expressions
+func NewTopN(orderBy []Expr, ascending []bool, limit Expr, offset Expr, child Operator) (*TopN, error) {
+	if len(orderBy) != len(ascending) {
+		return nil, GoDBError{MalformedDataError, "field lengths not equal"}
+	}
+	return &TopN{orderBy, ascending, limit, offset, child}, nil
+}
+
+func (n *TopN) Descriptor() *TupleDesc {
+	return n.child.Descriptor()
+}
+
+// A row of a TopN, with its position in the child
+type topNRow struct {
+	*sortRow
+	seq int
+}
+
+// The rows of a TopN, ordered so that the row that sorts last is the root
+type topNHeap struct {
+	rows      []topNRow
+	ascending []bool
+}
+
+// Return whether a sorts before b
+func (h *topNHeap) before(a, b topNRow) bool {
+	if c := compareRows(a.keys, b.keys, h.ascending); c != 0 {
+		return c < 0
+	}
+	return a.seq < b.seq
+}
+
+func (h *topNHeap) Len() int           { return len(h.rows) }
+func (h *topNHeap) Less(i, j int) bool { return h.before(h.rows[j], h.rows[i]) }
+func (h *topNHeap) Swap(i, j int)      { h.rows[i], h.rows[j] = h.rows[j], h.rows[i] }
+func (h *topNHeap) Push(x any)         { h.rows = append(h.rows, x.(topNRow)) }
+
+func (h *topNHeap) Pop() any {
+	row := h.rows[len(h.rows)-1]
+	h.rows = h.rows[:len(h.rows)-1]
+	return row
+}
+
+func (n *TopN) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	limit, err := evalLimit(n.limit, "LIMIT")
+	if err != nil {
+		return nil, err
+	}
+	offset, err := evalLimit(n.offset, "OFFSET")
+	if err != nil {
+		return nil, err
+	}
+	childIter, err := n.child.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+
+	// the number of rows to keep, which is every row if limit + offset
+	// overflows
+	keep := math.MaxInt
+	if limit <= math.MaxInt64-offset {
+		keep = int(limit + offset)
+	}
+	h := &topNHeap{ascending: n.ascending}
+	for seq := 0; ; seq++ {
+		t, err := childIter()
+		if err != nil {
+			return nil, err
+		}
+		if t == nil {
+			break
+		}
+		if keep == 0 {
+			continue
+		}
+		row, err := newSortRow(n.orderBy, t)
+		if err != nil {
+			return nil, err
+		}
+		if h.Len() < keep {
+			heap.Push(h, topNRow{row, seq})
+		} else if h.before(topNRow{row, seq}, h.rows[0]) {
+			h.rows[0] = topNRow{row, seq}
+			heap.Fix(h, 0)
+		}
+	}
+
+	rows := h.rows
+	sort.Slice(rows, func(i, j int) bool { return h.before(rows[i], rows[j]) })
+	if int(offset) < len(rows) {
+		rows = rows[offset:]
+	} else {
+		rows = nil
+	}
+	return func() (*Tuple, error) {
+		if len(rows) == 0 {
+			return nil, nil
+		}
+		t := rows[0].tuple
+		rows = rows[1:]
+		return t, nil
+	}, nil
+}
@@ -0,0 +1,63 @@
+package godb
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTopN(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "t (k int, g string, v int)\n")
+	var rows []string
+	for i := 0; i < 1000; i++ {
+		rows = append(rows, fmt.Sprintf("(%d, 'g%d', %d)", i%97, i%3, i))
+	}
+	mustRunSQL(t, c, bp, "insert into t values "+strings.Join(rows, ", "))
+	var sorted []string
+	for _, tup := range mustRunSQL(t, c, bp, "select k, g, v from t order by k desc, g") {
+		sorted = append(sorted, tup.PrettyPrintString(false))
+	}
+	for _, test := range []struct{ limit, offset int }{{20, 0}, {20, 5}, {1, 999}, {0, 0}, {5, 998}, {10, 2000}, {1500, 0}} {
+		sql := fmt.Sprintf("select k, g, v from t order by k desc, g limit %d offset %d", test.limit, test.offset)
+		var expected []string
+		if test.offset < len(sorted) {
+			expected = sorted[test.offset:]
+		}
+		if test.limit < len(expected) {
+			expected = expected[:test.limit]
+		}
+		expectRows(t, c, bp, sql, expected...)
+	}
+	// the limit and offset of ORDER BY ... LIMIT are applied by a TopN
+	_, op, err := Parse(c, "select k, v from t order by v limit 3")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, ok := op.(*TopN); !ok {
+		t.Errorf("expected a TopN, got %T", op)
+	}
+	expectRows(t, c, bp, "select k, v from t order by v desc limit 3", "29,999", "28,998", "27,997")
+	expectRows(t, c, bp, "select k, v from t where k = 5 order by k limit 2, 3", "5,199", "5,296", "5,393")
+}
+
+func TestLimitOffset(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "emp (name string, age int, dept int)\ndept (id int, dname string, budget int)\n")
+	mustRunSQL(t, c, bp, "insert into emp values ('sam', 25, 1), ('mary', 30, 2), ('joe', 40, 1), ('ann', null, 3), ('bob', 50, null)")
+	mustRunSQL(t, c, bp, "insert into dept values (1, 'eng', 100), (2, 'sales', 20), (3, 'hr', 60)")
+	expectNames(t, c, bp, "select name from emp limit 2 offset 1", "mary", "joe")
+	expectNames(t, c, bp, "select name from emp limit 3 offset 4", "bob")
+	expectNames(t, c, bp, "select name from emp limit 0")
+	expectNames(t, c, bp, "select dname from dept union select name from emp order by dname limit 3 offset 2", "eng", "hr", "joe")
+	expectNames(t, c, bp, "select name from (select name from emp order by name limit 2 offset 1) t", "bob", "joe")
+	// limit + offset overflows an int64
+	expectNames(t, c, bp, "select name from emp order by name limit 9223372036854775807 offset 1", "bob", "joe", "mary", "sam")
+	expectNames(t, c, bp, "select name from emp order by name limit 1 offset 9223372036854775807")
+	for _, sql := range []string{
+		"select name from emp limit 'a'",
+		"select name from emp order by name limit 1 offset 'b'",
+	} {
+		if _, err := runSQL(c, bp, sql); err == nil {
+			t.Errorf("expected error for %s", sql)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"encoding/binary"
     "errors"
+	"io"
 
 	"github.com/mitchellh/hashstructure/v2"
 )
@@ -127,6 +128,13 @@ func (desc *TupleDesc) merge(desc2 *TupleDesc) *TupleDesc {
 type DBValue interface {
 }
 
+// A nil DBValue represents SQL NULL.  On disk, each tuple begins with a null
+// bitmap, with one bit per field that is set when the field is NULL; the
+// field itself is then stored as zeros.
+func nullBitmapSize(numFields int) int {
+	return (numFields + 7) / 8
+}
+
 // Integer field value
 type IntField struct {
 	Value int64
@@ -152,6 +160,9 @@ type recordID interface {
 // fixed size, this method should simply write the fields in sequential order
 // into the supplied buffer.
 //
+// The fields are preceded by a null bitmap of nullBitmapSize bytes, in which
+// bit i (bit i%8 of byte i/8) is set when field i is NULL.
+//
 // See the function [binary.Write].  Objects should be serialized in little
 // endian oder.
 //
@@ -164,8 +175,32 @@ type recordID interface {
 // tuple.
 func (t *Tuple) writeTo(b *bytes.Buffer) error {
 	// TODO: some code goes here
-    for _, f := range t.Fields {
+    nulls := make([]byte, nullBitmapSize(len(t.Fields)))
+    for i, f := range t.Fields {
+        if f == nil {
+            nulls[i/8] |= 1 << (i % 8)
+        }
+    }
+    if _, err := b.Write(nulls); err != nil {
+        return err
+    }
+    for i, f := range t.Fields {
         switch f := f.(type) {
+        case nil:
+            if i >= len(t.Desc.Fields) {
+                return GoDBError{MalformedDataError, "cannot determine the type of a null field"}
+            }
+            var err error
+            switch t.Desc.Fields[i].Ftype {
+            case IntType:
+                err = binary.Write(b, binary.LittleEndian, int64(0))
+            case StringType:
+                var arr [StringLength]byte
+                err = binary.Write(b, binary.LittleEndian, arr)
+            }
+            if err != nil {
+                return err
+            }
         case IntField:
             err := binary.Write(b, binary.LittleEndian, f.Value)
             if err != nil {
@@ -200,7 +235,12 @@ func readTupleFrom(b *bytes.Buffer, desc *TupleDesc) (*Tuple, error) {
 	// TODO: some code goes here
     var t *Tuple = new(Tuple)
     t.Desc = *desc
-    for _, d := range desc.Fields {
+    nulls := make([]byte, nullBitmapSize(len(desc.Fields)))
+    if _, err := io.ReadFull(b, nulls); err != nil {
+        return nil, err
+    }
+    for i, d := range desc.Fields {
+        isNull := nulls[i/8]&(1<<(i%8)) != 0
         switch d.Ftype {
         case IntType:
             var tmp int64
@@ -208,6 +248,10 @@ func readTupleFrom(b *bytes.Buffer, desc *TupleDesc) (*Tuple, error) {
             if err != nil {
                 return nil, err
             }
+            if isNull {
+                t.Fields = append(t.Fields, nil)
+                continue
+            }
             t.Fields = append(t.Fields, IntField{Value: tmp})
         case StringType:
             var tmp [StringLength]byte
@@ -215,6 +259,10 @@ func readTupleFrom(b *bytes.Buffer, desc *TupleDesc) (*Tuple, error) {
             if err != nil {
                 return nil, err
             }
+            if isNull {
+                t.Fields = append(t.Fields, nil)
+                continue
+            }
             lastIndex := 0
             for lastIndex < len(tmp) && tmp[lastIndex] != 0 {
                 lastIndex++
@@ -411,6 +459,8 @@ func (t *Tuple) PrettyPrintString(aligned bool) string {
 			str = fmt.Sprintf("%d", f.Value)
 		case StringField:
 			str = f.Value
+		case nil:
+			str = "null"
 		}
 		if aligned {
 			outstr = fmt.Sprintf("%s %s", outstr, fmtCol(str, len(t.Fields)))
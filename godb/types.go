@@ -11,19 +11,20 @@ import (
 type GoDBErrorCode int
 
 const (
-	TupleNotFoundError      GoDBErrorCode = iota
-	PageFullError           GoDBErrorCode = iota
-	IncompatibleTypesError  GoDBErrorCode = iota
-	TypeMismatchError       GoDBErrorCode = iota
-	MalformedDataError      GoDBErrorCode = iota
-	BufferPoolFullError     GoDBErrorCode = iota
-	ParseError              GoDBErrorCode = iota
-	DuplicateTableError     GoDBErrorCode = iota
-	NoSuchTableError        GoDBErrorCode = iota
-	AmbiguousNameError      GoDBErrorCode = iota
-	IllegalOperationError   GoDBErrorCode = iota
-	DeadlockError           GoDBErrorCode = iota
-	IllegalTransactionError GoDBErrorCode = iota
+	TupleNotFoundError       GoDBErrorCode = iota
+	PageFullError            GoDBErrorCode = iota
+	IncompatibleTypesError   GoDBErrorCode = iota
+	TypeMismatchError        GoDBErrorCode = iota
+	MalformedDataError       GoDBErrorCode = iota
+	BufferPoolFullError      GoDBErrorCode = iota
+	ParseError               GoDBErrorCode = iota
+	DuplicateTableError      GoDBErrorCode = iota
+	NoSuchTableError         GoDBErrorCode = iota
+	AmbiguousNameError       GoDBErrorCode = iota
+	IllegalOperationError    GoDBErrorCode = iota
+	DeadlockError            GoDBErrorCode = iota
+	IllegalTransactionError  GoDBErrorCode = iota
+	ConstraintViolationError GoDBErrorCode = iota
 )
 
 type GoDBError struct {
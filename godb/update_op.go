@@ -0,0 +1,145 @@
+package godb
+
+import (
+	"fmt"
+)
+
+type UpdateOp struct {
+	file   DBFile
+	fields []FieldType // the columns of file that are assigned to
+	exprs  []Expr      // the new value of each column, evaluated on the old tuple
+	child  Operator
+
+	constraints *constraintChecker // may be nil, if the table has no constraints
+	references  *referenceEnforcer // may be nil, if no foreign keys refer to the table
+	stats       *statsUpdater      // may be nil, if the table has not been analyzed
+}
+
+// Constructor.  The update operator replaces each record in the child Operator
+// with a copy in which the ith field in fields is set to the result of
+// evaluating the ith expression in exprs on the original record.  Returns an
+// error if fields and exprs have different lengths, or if an expression's type
+// does not match the type of the column it is assigned to.
+func NewUpdateOp(updateFile DBFile, fields []FieldType, exprs []Expr, child Operator) (*UpdateOp, error) {
+	if len(fields) != len(exprs) {
+		return nil, GoDBError{MalformedDataError, "field lengths not equal"}
+	}
+	for i, f := range fields {
+		// an UnknownType expression is a NULL, which may be assigned to any column
+		if t := exprs[i].GetExprType().Ftype; t != f.Ftype && t != UnknownType {
+			return nil, GoDBError{TypeMismatchError, fmt.Sprintf("cannot assign %s value to %s column %s", typeNames[exprs[i].GetExprType().Ftype], typeNames[f.Ftype], f.Fname)}
+		}
+	}
+	return &UpdateOp{updateFile, fields, exprs, child, nil, nil, nil}, nil
+}
+
+// The update TupleDesc is a one column descriptor with an integer field named "count"
+func (u *UpdateOp) Descriptor() *TupleDesc {
+	ft := FieldType{"count", "", IntType}
+	fts := []FieldType{ft}
+	td := TupleDesc{}
+	td.Fields = fts
+	return &td
+}
+
+// Return an iterator function that updates all of the tuples from the child
+// iterator and then returns a one-field tuple with a "count" field indicating
+// the number of tuples that were updated.  Each update is performed as a
+// [DBFile.deleteTuple] of the old tuple followed by a [DBFile.insertTuple] of
+// the new one, so the changes are made on behalf of tid and are subject to the
+// same page locking and abort behavior as inserts and deletes.
+//
+// All of the child's tuples are read before any are modified, so that a tuple
+// that is reinserted into a page the child has not yet scanned is not updated
+// a second time.
+func (u *UpdateOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	childIter, err := u.child.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	desc := u.file.Descriptor()
+	fieldNos := make([]int, len(u.fields))
+	for i, f := range u.fields {
+		fieldNos[i], err = findFieldInTd(f, desc)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var oldTuples []*Tuple
+	for t, err := childIter(); t != nil || err != nil; t, err = childIter() {
+		if err != nil {
+			return nil, err
+		}
+		oldTuples = append(oldTuples, t)
+	}
+
+	newTuples := make([]*Tuple, len(oldTuples))
+	for j, t := range oldTuples {
+		fields := make([]DBValue, len(t.Fields))
+		copy(fields, t.Fields)
+		for i, expr := range u.exprs {
+			val, err := expr.EvalExpr(t)
+			if err != nil {
+				return nil, err
+			}
+			fields[fieldNos[i]] = val
+		}
+		newTuples[j] = &Tuple{*desc, fields, nil}
+	}
+
+	// constraints are checked against the table as it will be once the whole
+	// statement has run, so, e.g., "SET id = id + 1" does not fail because an
+	// updated key collides with one that has not been updated yet
+	if u.constraints != nil {
+		err = u.constraints.start(u.file, tid, oldTuples)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range newTuples {
+			err = u.constraints.check(t)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var stats *statsDelta
+	if u.stats != nil {
+		stats = u.stats.newDelta()
+	}
+	count := 0
+	for j, t := range oldTuples {
+		err = u.file.deleteTuple(t, tid)
+		if err != nil {
+			return nil, err
+		}
+		err = u.file.insertTuple(newTuples[j], tid)
+		if err != nil {
+			return nil, err
+		}
+		if stats != nil {
+			stats.add(t, -1)
+			stats.add(newTuples[j], 1)
+		}
+		count++
+	}
+	if stats != nil && count > 0 {
+		u.stats.applyAtCommit(tid, stats)
+	}
+	if u.references != nil {
+		err = u.references.updated(tid, oldTuples, newTuples)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	done := false
+	return func() (*Tuple, error) {
+		if done {
+			return nil, nil
+		}
+		done = true
+		return &Tuple{*u.Descriptor(), []DBValue{IntField{int64(count)}}, nil}, nil
+	}, nil
+}
@@ -0,0 +1,135 @@
+package godb
+
+import (
+	"os"
+	"testing"
+)
+
+// Create a catalog in a fresh temporary directory from the supplied catalog
+// text, returning the catalog and its buffer pool.
+func makeSQLTestCatalog(t *testing.T, catalogText string) (*Catalog, *BufferPool) {
+	dir := t.TempDir()
+	err := os.WriteFile(dir+"/catalog.txt", []byte(catalogText), 0644)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp := NewBufferPool(100)
+	c, err := NewCatalogFromFile("catalog.txt", bp, dir)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return c, bp
+}
+
+// Parse and run a query in its own transaction, returning all of the tuples
+// it produces.  The transaction is aborted if the query fails.
+func runSQL(c *Catalog, bp *BufferPool, sql string) ([]*Tuple, error) {
+	_, op, err := Parse(c, sql)
+	if err != nil {
+		return nil, err
+	}
+	if op == nil {
+		return nil, nil
+	}
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	tups, err := runOp(op, tid)
+	if err != nil {
+		bp.AbortTransaction(tid)
+		return nil, err
+	}
+	bp.CommitTransaction(tid)
+	return tups, nil
+}
+
+func runOp(op Operator, tid TransactionID) ([]*Tuple, error) {
+	iter, err := op.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	var tups []*Tuple
+	for {
+		tup, err := iter()
+		if err != nil {
+			return nil, err
+		}
+		if tup == nil {
+			return tups, nil
+		}
+		tups = append(tups, tup)
+	}
+}
+
+func mustRunSQL(t *testing.T, c *Catalog, bp *BufferPool, sql string) []*Tuple {
+	tups, err := runSQL(c, bp, sql)
+	if err != nil {
+		t.Fatalf("%s: %s", sql, err.Error())
+	}
+	return tups
+}
+
+func TestUpdate(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "t (name string, age int)\n")
+	mustRunSQL(t, c, bp, "insert into t values ('sam', 25), ('george jones', 999), ('mary', 30)")
+	res := mustRunSQL(t, c, bp, "update t set age = age + 1, name = 'samuel' where name = 'sam'")
+	if len(res) != 1 || res[0].Fields[0].(IntField).Value != 1 {
+		t.Fatalf("expected a single count of 1, got %v", res)
+	}
+	res = mustRunSQL(t, c, bp, "select name, age from t where age = 26")
+	if len(res) != 1 || res[0].Fields[0].(StringField).Value != "samuel" {
+		t.Fatalf("updated tuple not found, got %v", res)
+	}
+	res = mustRunSQL(t, c, bp, "select count(*) from t")
+	if res[0].Fields[0].(IntField).Value != 3 {
+		t.Errorf("expected 3 tuples after update, got %v", res[0].Fields[0])
+	}
+}
+
+func TestUpdateAllRowsOnce(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "t (name string, age int)\n")
+	mustRunSQL(t, c, bp, "insert into t values ('sam', 25), ('george jones', 999), ('mary', 30)")
+	res := mustRunSQL(t, c, bp, "update t set age = age + 1000")
+	if res[0].Fields[0].(IntField).Value != 3 {
+		t.Fatalf("expected 3 updated tuples, got %v", res[0].Fields[0])
+	}
+	res = mustRunSQL(t, c, bp, "select sum(age) from t")
+	if res[0].Fields[0].(IntField).Value != 25+999+30+3000 {
+		t.Errorf("unexpected sum after update %v", res[0].Fields[0])
+	}
+}
+
+func TestUpdateAbort(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "t (name string, age int)\n")
+	mustRunSQL(t, c, bp, "insert into t values ('sam', 25), ('george jones', 999), ('mary', 30)")
+	_, op, err := Parse(c, "update t set age = 0")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	_, err = runOp(op, tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	bp.AbortTransaction(tid)
+
+	res := mustRunSQL(t, c, bp, "select sum(age) from t")
+	if res[0].Fields[0].(IntField).Value != 25+999+30 {
+		t.Errorf("update was not rolled back, sum is %v", res[0].Fields[0])
+	}
+}
+
+func TestUpdateErrors(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "t (name string, age int)\n")
+	mustRunSQL(t, c, bp, "insert into t values ('sam', 25), ('george jones', 999), ('mary', 30)")
+	for _, sql := range []string{
+		"update t set age = 'old'",
+		"update t set height = 10",
+		"update t set age = 1, age = 2",
+	} {
+		_, err := runSQL(c, bp, sql)
+		if err == nil {
+			t.Errorf("expected error for %s", sql)
+		}
+	}
+}
@@ -0,0 +1,413 @@
+package godb
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Window computes window functions, which, unlike aggregates, return a value
+// for every tuple of their input rather than for every group.  The tuples
+// are divided into partitions by the values of the partitionBy expressions
+// and ordered within each partition by the orderBy expressions; each function
+// is then evaluated over the tuples of the current tuple's partition, or, for
+// aggregates and first_value, over those of its frame (see [WindowFrame]).
+// The output has the fields of the child followed by one field for each
+// function, in partition order.
+type Window struct {
+	partitionBy []Expr
+	orderBy     []Expr
+	ascending   []bool
+	funcs       []*WindowFunc
+	child       Operator
+	desc        *TupleDesc
+}
+
+// The kinds of frame bounds
+type FrameBoundKind int
+
+const (
+	UnboundedPreceding FrameBoundKind = iota
+	Preceding          FrameBoundKind = iota
+	CurrentRow         FrameBoundKind = iota
+	Following          FrameBoundKind = iota
+	UnboundedFollowing FrameBoundKind = iota
+)
+
+// The start or end of a window frame.  offset is the number of rows (for
+// ROWS frames) or the difference of the ORDER BY value (for RANGE frames) of
+// a Preceding or Following bound.
+type FrameBound struct {
+	kind   FrameBoundKind
+	offset int64
+}
+
+// WindowFrame is the set of tuples of a partition that a function is
+// evaluated over for each tuple.  Bounds of ROWS frames count tuples, while
+// bounds of RANGE frames compare values of the single ORDER BY expression,
+// and a CURRENT ROW bound includes all of the current tuple's peers, the
+// tuples with the same ORDER BY values.
+type WindowFrame struct {
+	rows       bool
+	start, end FrameBound
+}
+
+// The frame of windows without a frame clause, which is the whole partition
+// if there is no ORDER BY, and otherwise the tuples up to the current tuple
+// and its peers
+var defaultWindowFrame = WindowFrame{false, FrameBound{UnboundedPreceding, 0}, FrameBound{CurrentRow, 0}}
+
+// A window function, which is row_number, rank, dense_rank, lag, lead,
+// first_value or an aggregate
+type WindowFunc struct {
+	name  string
+	args  []Expr
+	agg   AggState // the initialized state of an aggregate, which is copied for each frame
+	frame WindowFrame
+	alias string
+}
+
+// Construct a window function named name that computes the field alias.
+// agg must be non-nil if and only if the function is an aggregate, in which
+// case it computes the aggregate of the function's argument.
+func NewWindowFunc(name string, args []Expr, agg AggState, frame WindowFrame, alias string) (*WindowFunc, error) {
+	nArgs := [2]int{0, 0}
+	switch name {
+	case "row_number", "rank", "dense_rank":
+	case "lag", "lead":
+		nArgs = [2]int{1, 3}
+	case "first_value":
+		nArgs = [2]int{1, 1}
+	default:
+		if agg == nil {
+			return nil, GoDBError{ParseError, fmt.Sprintf("unknown window function %s", name)}
+		}
+		nArgs = [2]int{len(args), len(args)}
+	}
+	if len(args) < nArgs[0] || len(args) > nArgs[1] {
+		return nil, GoDBError{ParseError, fmt.Sprintf("wrong number of arguments to window function %s", name)}
+	}
+	if frame.start.kind == UnboundedFollowing || frame.end.kind == UnboundedPreceding || frame.start.kind > frame.end.kind {
+		return nil, GoDBError{ParseError, fmt.Sprintf("invalid frame for window function %s", name)}
+	}
+	return &WindowFunc{name, args, agg, frame, alias}, nil
+}
+
+func (f *WindowFunc) fieldType() FieldType {
+	switch {
+	case f.agg != nil:
+		return FieldType{f.alias, "", f.agg.GetTupleDesc().Fields[0].Ftype}
+	case f.name == "lag" || f.name == "lead" || f.name == "first_value":
+		return FieldType{f.alias, "", f.args[0].GetExprType().Ftype}
+	}
+	return FieldType{f.alias, "", IntType}
+}
+
+// Construct a window operator.  RANGE frames with offsets require a single
+// integer ORDER BY expression.
+func NewWindow(partitionBy []Expr, orderBy []Expr, ascending []bool, funcs []*WindowFunc, child Operator) (*Window, error) {
+	fields := append([]FieldType{}, child.Descriptor().Fields...)
+	for _, f := range funcs {
+		for _, b := range []FrameBound{f.frame.start, f.frame.end} {
+			if f.frame.rows || (b.kind != Preceding && b.kind != Following) {
+				continue
+			}
+			if len(orderBy) != 1 || orderBy[0].GetExprType().Ftype != IntType {
+				return nil, GoDBError{ParseError, "RANGE frames with offsets require a single integer ORDER BY expression"}
+			}
+		}
+		fields = append(fields, f.fieldType())
+	}
+	return &Window{partitionBy, orderBy, ascending, funcs, child, &TupleDesc{Fields: fields}}, nil
+}
+
+// Return a TupleDescriptor for this window operator, which has the fields of
+// its child followed by those of its functions
+func (w *Window) Descriptor() *TupleDesc {
+	return w.desc
+}
+
+// Compare two values, ordering NULLs before all other values
+func compareValues(a, b DBValue) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	switch a := a.(type) {
+	case IntField:
+		b := b.(IntField)
+		if a.Value < b.Value {
+			return -1
+		} else if a.Value > b.Value {
+			return 1
+		}
+	case StringField:
+		b := b.(StringField)
+		if a.Value < b.Value {
+			return -1
+		} else if a.Value > b.Value {
+			return 1
+		}
+	}
+	return 0
+}
+
+// A tuple of the child, with the values of its PARTITION BY and ORDER BY
+// expressions
+type windowRow struct {
+	tuple     *Tuple
+	partition []DBValue
+	order     []DBValue
+}
+
+func evalExprs(exprs []Expr, t *Tuple) ([]DBValue, error) {
+	vals := make([]DBValue, len(exprs))
+	for i, e := range exprs {
+		v, err := e.EvalExpr(t)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = v
+	}
+	return vals, nil
+}
+
+func compareRows(a, b []DBValue, ascending []bool) int {
+	for i := range a {
+		if c := compareValues(a[i], b[i]); c != 0 {
+			if ascending != nil && !ascending[i] {
+				return -c
+			}
+			return c
+		}
+	}
+	return 0
+}
+
+func (w *Window) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	childIter, err := w.child.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	var rows []*windowRow
+	for {
+		t, err := childIter()
+		if err != nil {
+			return nil, err
+		}
+		if t == nil {
+			break
+		}
+		row := &windowRow{tuple: t}
+		if row.partition, err = evalExprs(w.partitionBy, t); err != nil {
+			return nil, err
+		}
+		if row.order, err = evalExprs(w.orderBy, t); err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if c := compareRows(rows[i].partition, rows[j].partition, nil); c != 0 {
+			return c < 0
+		}
+		return compareRows(rows[i].order, rows[j].order, w.ascending) < 0
+	})
+
+	var partition [][]DBValue // the values of the functions for the current partition
+	start, end := 0, 0        // the rows of the current partition
+	return func() (*Tuple, error) {
+		if start == len(rows) {
+			return nil, nil
+		}
+		if start == end {
+			for end < len(rows) && compareRows(rows[start].partition, rows[end].partition, nil) == 0 {
+				end++
+			}
+			partition = make([][]DBValue, end-start)
+			for i := range partition {
+				partition[i] = append([]DBValue{}, rows[start+i].tuple.Fields...)
+			}
+			for _, f := range w.funcs {
+				vals, err := w.evalFunc(f, rows[start:end])
+				if err != nil {
+					return nil, err
+				}
+				for i, v := range vals {
+					partition[i] = append(partition[i], v)
+				}
+			}
+		}
+		fields := partition[0]
+		partition = partition[1:]
+		start++
+		return &Tuple{*w.desc, fields, nil}, nil
+	}, nil
+}
+
+// Return the values of f for each of the rows of a partition
+func (w *Window) evalFunc(f *WindowFunc, rows []*windowRow) ([]DBValue, error) {
+	vals := make([]DBValue, len(rows))
+	switch f.name {
+	case "row_number":
+		for i := range rows {
+			vals[i] = IntField{int64(i + 1)}
+		}
+	case "rank", "dense_rank":
+		rank := 0
+		for i := range rows {
+			if i == 0 || compareRows(rows[i-1].order, rows[i].order, nil) != 0 {
+				if f.name == "rank" {
+					rank = i + 1
+				} else {
+					rank++
+				}
+			}
+			vals[i] = IntField{int64(rank)}
+		}
+	case "lag", "lead":
+		for i, row := range rows {
+			offset := int64(1)
+			if len(f.args) > 1 {
+				v, err := f.args[1].EvalExpr(row.tuple)
+				if err != nil {
+					return nil, err
+				}
+				n, ok := v.(IntField)
+				if !ok {
+					return nil, GoDBError{TypeMismatchError, fmt.Sprintf("offset of %s must be an integer", f.name)}
+				}
+				offset = n.Value
+			}
+			if f.name == "lag" {
+				offset = -offset
+			}
+			arg, at := f.args[0], row.tuple
+			if j := int64(i) + offset; j < 0 || j >= int64(len(rows)) {
+				if len(f.args) < 3 {
+					continue
+				}
+				arg = f.args[2]
+			} else {
+				at = rows[j].tuple
+			}
+			v, err := arg.EvalExpr(at)
+			if err != nil {
+				return nil, err
+			}
+			vals[i] = v
+		}
+	default:
+		return w.evalFrameFunc(f, rows)
+	}
+	return vals, nil
+}
+
+// Return the values of f, which is first_value or an aggregate, over the
+// frames of each of the rows of a partition
+func (w *Window) evalFrameFunc(f *WindowFunc, rows []*windowRow) ([]DBValue, error) {
+	vals := make([]DBValue, len(rows))
+	var state AggState // with UNBOUNDED PRECEDING, the state of the rows up to frameEnd
+	frameStart, frameEnd := 0, -1
+	for i := range rows {
+		for frameStart < len(rows) && !w.afterStart(f.frame, rows, frameStart, i) {
+			frameStart++
+		}
+		prevEnd := frameEnd
+		for frameEnd+1 < len(rows) && w.beforeEnd(f.frame, rows, frameEnd+1, i) {
+			frameEnd++
+		}
+		if f.agg == nil {
+			if frameStart <= frameEnd {
+				v, err := f.args[0].EvalExpr(rows[frameStart].tuple)
+				if err != nil {
+					return nil, err
+				}
+				vals[i] = v
+			}
+			continue
+		}
+		// frames that start with the partition grow incrementally; others
+		// are aggregated again for each row
+		if f.frame.start.kind != UnboundedPreceding || state == nil {
+			state, prevEnd = f.agg.Copy(), frameStart-1
+		}
+		for j := prevEnd + 1; j <= frameEnd; j++ {
+			state.AddTuple(rows[j].tuple)
+		}
+		vals[i] = state.Finalize().Fields[0]
+	}
+	return vals, nil
+}
+
+// Return the difference between the ORDER BY values of rows j and i, in
+// the direction of the order; ok is false if either value is NULL
+func (w *Window) orderDistance(rows []*windowRow, j, i int) (dist int64, ok bool) {
+	a, b := rows[j].order[0], rows[i].order[0]
+	if a == nil || b == nil {
+		return 0, false
+	}
+	dist = a.(IntField).Value - b.(IntField).Value
+	if !w.ascending[0] {
+		dist = -dist
+	}
+	return dist, true
+}
+
+// Return whether row j of a partition is at or after the start of the frame
+// of row i
+func (w *Window) afterStart(frame WindowFrame, rows []*windowRow, j, i int) bool {
+	b := frame.start
+	switch {
+	case b.kind == UnboundedPreceding:
+		return true
+	case b.kind == CurrentRow && frame.rows:
+		return j >= i
+	case b.kind == CurrentRow:
+		return j >= i || compareRows(rows[j].order, rows[i].order, nil) == 0
+	case frame.rows:
+		if b.kind == Preceding {
+			return int64(j) >= int64(i)-b.offset
+		}
+		return int64(j) >= int64(i)+b.offset
+	}
+	dist, ok := w.orderDistance(rows, j, i)
+	if !ok {
+		// NULLs are only in frames of rows that are also NULL
+		return j >= i || compareRows(rows[j].order, rows[i].order, nil) == 0
+	}
+	if b.kind == Preceding {
+		return dist >= -b.offset
+	}
+	return dist >= b.offset
+}
+
+// Return whether row j of a partition is at or before the end of the frame
+// of row i
+func (w *Window) beforeEnd(frame WindowFrame, rows []*windowRow, j, i int) bool {
+	b := frame.end
+	switch {
+	case b.kind == UnboundedFollowing:
+		return true
+	case b.kind == CurrentRow && frame.rows:
+		return j <= i
+	case b.kind == CurrentRow:
+		return j <= i || compareRows(rows[j].order, rows[i].order, nil) == 0
+	case frame.rows:
+		if b.kind == Preceding {
+			return int64(j) <= int64(i)-b.offset
+		}
+		return int64(j) <= int64(i)+b.offset
+	}
+	dist, ok := w.orderDistance(rows, j, i)
+	if !ok {
+		return j <= i || compareRows(rows[j].order, rows[i].order, nil) == 0
+	}
+	if b.kind == Preceding {
+		return dist <= -b.offset
+	}
+	return dist <= b.offset
+}
@@ -0,0 +1,111 @@
+package godb
+
+import (
+	"testing"
+)
+
+// Check that sql returns the tuples expected, formatted as comma separated
+// values
+func expectRows(t *testing.T, c *Catalog, bp *BufferPool, sql string, expected ...string) {
+	t.Helper()
+	res := mustRunSQL(t, c, bp, sql)
+	if len(res) != len(expected) {
+		t.Errorf("expected %d tuples from %s, got %d", len(expected), sql, len(res))
+		return
+	}
+	for i, tup := range res {
+		if got := tup.PrettyPrintString(false); got != expected[i] {
+			t.Errorf("expected %s from %s, got %s", expected[i], sql, got)
+		}
+	}
+}
+
+func TestWindowRanking(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "emp (name string, age int, dept int)\ndept (id int, dname string, budget int)\n")
+	mustRunSQL(t, c, bp, "insert into emp values ('sam', 25, 1), ('mary', 30, 2), ('joe', 40, 1), ('ann', null, 3), ('bob', 50, null)")
+	mustRunSQL(t, c, bp, "insert into dept values (1, 'eng', 100), (2, 'sales', 20), (3, 'hr', 60)")
+	mustRunSQL(t, c, bp, "insert into emp values ('tim', 40, 2)")
+	expectRows(t, c, bp, "select name, row_number() over (order by name) from emp",
+		"ann,1", "bob,2", "joe,3", "mary,4", "sam,5", "tim,6")
+	expectRows(t, c, bp, "select name, rank() over (order by age desc) as r, dense_rank() over (order by age desc) as d from emp order by r, name",
+		"bob,1,1", "joe,2,2", "tim,2,2", "mary,4,3", "sam,5,4", "ann,6,5")
+	expectRows(t, c, bp, "select name, row_number() over (partition by dept order by age desc) as n from emp where dept is not null order by name",
+		"ann,1", "joe,1", "mary,2", "sam,2", "tim,1")
+	// OVER in a string literal is not a window
+	expectRows(t, c, bp, "select name, row_number() over (order by name) from emp where name <> 'x) over (y' and name < 'c'",
+		"ann,1", "bob,2")
+	// the output column is named after the function
+	res := mustRunSQL(t, c, bp, "select name, row_number() over () from emp")
+	if len(res) != 6 || res[0].Desc.Fields[1].Fname != "row_number" {
+		t.Errorf("unexpected result %v", res)
+	}
+}
+
+func TestWindowOffsets(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "emp (name string, age int, dept int)\ndept (id int, dname string, budget int)\n")
+	mustRunSQL(t, c, bp, "insert into emp values ('sam', 25, 1), ('mary', 30, 2), ('joe', 40, 1), ('ann', null, 3), ('bob', 50, null)")
+	mustRunSQL(t, c, bp, "insert into dept values (1, 'eng', 100), (2, 'sales', 20), (3, 'hr', 60)")
+	mustRunSQL(t, c, bp, "insert into emp values ('tim', 40, 2)")
+	expectRows(t, c, bp, "select name, lag(name) over (order by name), lead(name, 2) over (order by name) from emp order by name",
+		"ann,null,joe", "bob,ann,mary", "joe,bob,sam", "mary,joe,tim", "sam,mary,null", "tim,sam,null")
+	expectRows(t, c, bp, "select name, lag(age, 1, 0) over (partition by dept order by name) + 1 from emp where dept = 1 or dept = 2 order by name",
+		"joe,1", "mary,1", "sam,41", "tim,31")
+	expectRows(t, c, bp, "select name, first_value(name) over (partition by dept order by age) from emp where dept is not null order by name",
+		"ann,ann", "joe,sam", "mary,mary", "sam,sam", "tim,mary")
+}
+
+func TestWindowAggregates(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "emp (name string, age int, dept int)\ndept (id int, dname string, budget int)\n")
+	mustRunSQL(t, c, bp, "insert into emp values ('sam', 25, 1), ('mary', 30, 2), ('joe', 40, 1), ('ann', null, 3), ('bob', 50, null)")
+	mustRunSQL(t, c, bp, "insert into dept values (1, 'eng', 100), (2, 'sales', 20), (3, 'hr', 60)")
+	mustRunSQL(t, c, bp, "insert into emp values ('tim', 40, 2)")
+	// running totals include the peers of each tuple
+	expectRows(t, c, bp, "select name, sum(age) over (order by age) as s from emp where age is not null order by s, name",
+		"sam,25", "mary,55", "joe,135", "tim,135", "bob,185")
+	expectRows(t, c, bp, "select name, count(*) over (partition by dept) as n, max(age) over (partition by dept) from emp where dept is not null order by name",
+		"ann,1,null", "joe,2,40", "mary,2,40", "sam,2,40", "tim,2,40")
+	expectRows(t, c, bp, "select name, avg(age) over (order by name rows between 1 preceding and 1 following) from emp where age is not null order by name",
+		"bob,45", "joe,40", "mary,31", "sam,31", "tim,32")
+	expectRows(t, c, bp, "select name, count(*) over (order by name rows between unbounded preceding and 1 preceding) from emp order by name",
+		"ann,0", "bob,1", "joe,2", "mary,3", "sam,4", "tim,5")
+	expectRows(t, c, bp, "select name, min(name) over (order by name rows between 1 following and unbounded following) from emp order by name",
+		"ann,bob", "bob,joe", "joe,mary", "mary,sam", "sam,tim", "tim,null")
+	// tuples with ages within 10 below each tuple's age
+	expectRows(t, c, bp, "select name, count(*) over (order by age range between 10 preceding and current row) from emp order by name",
+		"ann,1", "bob,3", "joe,3", "mary,2", "sam,1", "tim,3")
+	expectRows(t, c, bp, "select name, sum(age) over (order by age desc range 5 preceding) from emp where age is not null order by name",
+		"bob,50", "joe,80", "mary,30", "sam,55", "tim,80")
+
+	// aggregates over windows skip NULLs
+	expectRows(t, c, bp, "select name, sum(age) over (partition by dept), count(age) over (partition by dept) from emp where dept = 3",
+		"ann,null,0")
+
+	// window functions are computed after grouping, and may use aggregates
+	expectRows(t, c, bp, "select dept, sum(age) as total, rank() over (order by sum(age) desc) from emp where dept is not null group by dept order by dept",
+		"1,65,2", "2,70,1", "3,null,3")
+	expectRows(t, c, bp, "select name, r from (select name, rank() over (partition by dept order by age desc) as r from emp) t where r = 1 order by name",
+		"ann,1", "bob,1", "joe,1", "tim,1")
+}
+
+func TestWindowErrors(t *testing.T) {
+	c, bp := makeSQLTestCatalog(t, "emp (name string, age int, dept int)\ndept (id int, dname string, budget int)\n")
+	mustRunSQL(t, c, bp, "insert into emp values ('sam', 25, 1), ('mary', 30, 2), ('joe', 40, 1), ('ann', null, 3), ('bob', 50, null)")
+	mustRunSQL(t, c, bp, "insert into dept values (1, 'eng', 100), (2, 'sales', 20), (3, 'hr', 60)")
+	mustRunSQL(t, c, bp, "insert into emp values ('tim', 40, 2)")
+	for _, sql := range []string{
+		"select name, ntile(2) over (order by age) from emp",
+		"select name, lag() over (order by age) from emp",
+		"select name, count(*) over (order by name range 1 preceding) from emp",
+		"select name, sum(age) over (order by age rows between current row and 1 preceding) from emp",
+		"select name, sum(rank() over (order by age)) over () from emp",
+		"select name, rank() over (order by age rows) from emp",
+		"select name, rank() over (partition age) from emp",
+		"select name from emp where rank() over (order by age) = 1",
+		"select name from emp order by row_number() over (order by age)",
+		"select dept, count(*) from emp group by dept having rank() over (order by dept) = 1",
+	} {
+		if _, err := runSQL(c, bp, sql); err == nil {
+			t.Errorf("expected error for %s", sql)
+		}
+	}
+}
@@ -0,0 +1,475 @@
+package godb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// The sql parser does not support OVER clauses, so before a query is parsed,
+// each window function call
+//
+//	f(args) OVER (PARTITION BY p, ... ORDER BY o [ASC|DESC], ... ROWS|RANGE BETWEEN start AND end)
+//
+// is rewritten into a call of the pseudo function __over, whose arguments
+// are the call and pseudo functions for each of the parts of the window:
+//
+//	__over(f(args), __partition(p, ...), __order(o, 'asc', ...), __frame('rows', 'preceding', 1, 'current row', 0))
+//
+// parseWindows then turns these calls into LogicalWindowNodes.
+
+// A token of a query, with its offsets in the query
+type queryToken struct {
+	typ        int
+	val        string
+	start, end int
+}
+
+func tokenizeQuery(query string) []queryToken {
+	var toks []queryToken
+	for ts := newTokenStream(query); !ts.atEnd(); ts.next() {
+		start := ts.prevEnd + strings.IndexFunc(query[ts.prevEnd:ts.end], func(r rune) bool { return !strings.ContainsRune(" \t\r\n", r) })
+		toks = append(toks, queryToken{ts.typ, ts.val, start, ts.end})
+	}
+	return toks
+}
+
+// Return whether the token is the unquoted word w
+func (t queryToken) is(query string, w string) bool {
+	return t.typ >= 256 && strings.EqualFold(t.val, w) && strings.EqualFold(query[t.start:t.end], w)
+}
+
+// Return the index of the token that closes the parenthesis toks[i], or -1
+func matchingParen(toks []queryToken, i int) int {
+	depth := 0
+	for j := i; j < len(toks); j++ {
+		switch toks[j].typ {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// Rewrite the window function calls of query into calls of __over
+func rewriteWindowFunctions(query string) (string, error) {
+	toks := tokenizeQuery(query)
+	var rewritten strings.Builder
+	last := 0
+	for i := 1; i+1 < len(toks); i++ {
+		if !toks[i].is(query, "over") || toks[i-1].typ != ')' || toks[i+1].typ != '(' {
+			continue
+		}
+		// find the start of the function call that OVER follows
+		open, depth := i-1, 0
+		for ; open >= 0; open-- {
+			if toks[open].typ == ')' {
+				depth++
+			} else if toks[open].typ == '(' {
+				depth--
+				if depth == 0 {
+					break
+				}
+			}
+		}
+		if open < 1 || toks[open-1].typ < 256 {
+			return "", GoDBError{ParseError, "OVER must follow a function call"}
+		}
+		callStart := toks[open-1].start
+		if callStart < last {
+			return "", GoDBError{ParseError, "window functions may not be nested"}
+		}
+		end := matchingParen(toks, i+1)
+		if end < 0 {
+			return "", GoDBError{ParseError, "unterminated OVER clause"}
+		}
+		spec, err := rewriteWindowSpec(query, toks[i+2:end])
+		if err != nil {
+			return "", err
+		}
+		rewritten.WriteString(query[last:callStart])
+		rewritten.WriteString("__over(" + query[callStart:toks[i-1].end] + spec + ")")
+		last = toks[end].end
+		i = end
+	}
+	if last == 0 {
+		return query, nil
+	}
+	rewritten.WriteString(query[last:])
+	return rewritten.String(), nil
+}
+
+// Rewrite the tokens of a window specification, between the parentheses
+// after OVER, into arguments of __over
+func rewriteWindowSpec(query string, toks []queryToken) (string, error) {
+	pos := 0
+	at := func(w string) bool {
+		return pos < len(toks) && toks[pos].is(query, w)
+	}
+	expect := func(w string) error {
+		if !at(w) {
+			return GoDBError{ParseError, fmt.Sprintf("expected %s in OVER clause", strings.ToUpper(w))}
+		}
+		pos++
+		return nil
+	}
+	// split the tokens up to one of the words stops into comma separated
+	// lists of tokens
+	list := func(stops ...string) [][]queryToken {
+		var items [][]queryToken
+		start, depth := pos, 0
+		for ; pos < len(toks); pos++ {
+			if depth == 0 {
+				stop := false
+				for _, w := range stops {
+					stop = stop || at(w)
+				}
+				if stop {
+					break
+				}
+			}
+			switch toks[pos].typ {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			case ',':
+				if depth == 0 {
+					items = append(items, toks[start:pos])
+					start = pos + 1
+				}
+			}
+		}
+		return append(items, toks[start:pos])
+	}
+	text := func(item []queryToken) (string, error) {
+		if len(item) == 0 {
+			return "", GoDBError{ParseError, "expected an expression in OVER clause"}
+		}
+		return query[item[0].start:item[len(item)-1].end], nil
+	}
+	bound := func() (string, error) {
+		switch {
+		case at("unbounded"):
+			pos++
+			if at("preceding") || at("following") {
+				pos++
+				return fmt.Sprintf("'unbounded %s', 0", strings.ToLower(toks[pos-1].val)), nil
+			}
+		case at("current"):
+			pos++
+			if err := expect("row"); err != nil {
+				return "", err
+			}
+			return "'current row', 0", nil
+		case pos < len(toks) && toks[pos].typ == sqlparser.INTEGRAL:
+			pos++
+			if at("preceding") || at("following") {
+				pos++
+				return fmt.Sprintf("'%s', %s", strings.ToLower(toks[pos-1].val), toks[pos-2].val), nil
+			}
+		}
+		return "", GoDBError{ParseError, "expected a frame bound in OVER clause"}
+	}
+
+	var spec strings.Builder
+	if at("partition") {
+		pos++
+		if err := expect("by"); err != nil {
+			return "", err
+		}
+		var exprs []string
+		for _, item := range list("order", "rows", "range") {
+			expr, err := text(item)
+			if err != nil {
+				return "", err
+			}
+			exprs = append(exprs, expr)
+		}
+		spec.WriteString(", __partition(" + strings.Join(exprs, ", ") + ")")
+	}
+	if at("order") {
+		pos++
+		if err := expect("by"); err != nil {
+			return "", err
+		}
+		var exprs []string
+		for _, item := range list("rows", "range") {
+			dir := "asc"
+			if n := len(item); n > 0 && (item[n-1].is(query, "asc") || item[n-1].is(query, "desc")) {
+				dir = strings.ToLower(item[n-1].val)
+				item = item[:n-1]
+			}
+			expr, err := text(item)
+			if err != nil {
+				return "", err
+			}
+			exprs = append(exprs, fmt.Sprintf("%s, '%s'", expr, dir))
+		}
+		spec.WriteString(", __order(" + strings.Join(exprs, ", ") + ")")
+	}
+	if at("rows") || at("range") {
+		mode := strings.ToLower(toks[pos].val)
+		pos++
+		var start, end string
+		var err error
+		if at("between") {
+			pos++
+			if start, err = bound(); err != nil {
+				return "", err
+			}
+			if err := expect("and"); err != nil {
+				return "", err
+			}
+			end, err = bound()
+		} else {
+			start, err = bound()
+			end = "'current row', 0"
+		}
+		if err != nil {
+			return "", err
+		}
+		spec.WriteString(fmt.Sprintf(", __frame('%s', %s, %s)", mode, start, end))
+	}
+	if pos != len(toks) {
+		return "", GoDBError{ParseError, fmt.Sprintf("unexpected %s in OVER clause", toks[pos].val)}
+	}
+	return spec.String(), nil
+}
+
+// A window function of the select list of a query
+type LogicalWindowNode struct {
+	name        string
+	args        []*LogicalSelectNode // empty for COUNT(*)
+	partitionBy []*LogicalSelectNode
+	orderBy     []*OrderByNode
+	frame       WindowFrame
+	spec        string // the text of the PARTITION BY and ORDER BY clauses; functions with the same spec share a Window
+	alias       string
+}
+
+// Replace the window functions of the select list with references to the
+// fields that compute them, named __window0, __window1, ..., and return
+// them.  A window function that is a whole select expression is named after
+// the function unless it has an alias.
+func parseWindows(c *Catalog, selectExprs sqlparser.SelectExprs) ([]*LogicalWindowNode, error) {
+	var windows []*LogicalWindowNode
+	for _, sel := range selectExprs {
+		sel, ok := sel.(*sqlparser.AliasedExpr)
+		if !ok {
+			continue
+		}
+		var calls []*sqlparser.FuncExpr
+		sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+			switch node := node.(type) {
+			case *sqlparser.FuncExpr:
+				if node.Name.Lowered() == "__over" {
+					calls = append(calls, node)
+					return false, nil
+				}
+			case *sqlparser.Subquery:
+				return false, nil
+			}
+			return true, nil
+		}, sel.Expr)
+
+		for _, call := range calls {
+			w, err := parseWindow(c, call)
+			if err != nil {
+				return nil, err
+			}
+			w.alias = fmt.Sprintf("__window%d", len(windows))
+			windows = append(windows, w)
+			if sel.Expr == call && sel.As.IsEmpty() {
+				sel.As = sqlparser.NewColIdent(w.name)
+			}
+			sel.Expr = sqlparser.ReplaceExpr(sel.Expr, call, &sqlparser.ColName{Name: sqlparser.NewColIdent(w.alias)})
+		}
+	}
+	return windows, nil
+}
+
+// Return an error if s has a window function outside of its select list,
+// once parseWindows has replaced those of the select list
+func checkWindowPlacement(s *sqlparser.Select) error {
+	return sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch node := node.(type) {
+		case *sqlparser.FuncExpr:
+			if node.Name.Lowered() == "__over" {
+				return false, GoDBError{ParseError, "window functions are only supported in the select list"}
+			}
+		case *sqlparser.Subquery:
+			return false, nil
+		}
+		return true, nil
+	}, s)
+}
+
+// Parse a call of __over made by rewriteWindowFunctions
+func parseWindow(c *Catalog, call *sqlparser.FuncExpr) (*LogicalWindowNode, error) {
+	w := &LogicalWindowNode{frame: defaultWindowFrame}
+	var fn *sqlparser.FuncExpr
+	if ae, ok := call.Exprs[0].(*sqlparser.AliasedExpr); ok {
+		fn, _ = ae.Expr.(*sqlparser.FuncExpr)
+	}
+	if fn == nil || fn.Distinct {
+		return nil, GoDBError{ParseError, fmt.Sprintf("unsupported window function %s", sqlparser.String(call.Exprs[0]))}
+	}
+	w.name = fn.Name.Lowered()
+	for i, arg := range fn.Exprs {
+		if _, ok := arg.(*sqlparser.StarExpr); ok && w.name == "count" && len(fn.Exprs) == 1 {
+			continue
+		}
+		parse := parseSelect
+		if i == 0 && isAgg(w.name) {
+			parse = parseAggArg
+		}
+		node, err := parse(c, arg)
+		if err != nil {
+			return nil, err
+		}
+		w.args = append(w.args, node)
+	}
+
+	for _, part := range call.Exprs[1:] {
+		part, _ := part.(*sqlparser.AliasedExpr)
+		f, _ := part.Expr.(*sqlparser.FuncExpr)
+		var exprs []sqlparser.Expr
+		for _, e := range f.Exprs {
+			exprs = append(exprs, e.(*sqlparser.AliasedExpr).Expr)
+		}
+		switch f.Name.Lowered() {
+		case "__partition":
+			w.spec += sqlparser.String(f)
+			for _, e := range exprs {
+				node, err := parseExpr(c, e, "")
+				if err != nil {
+					return nil, err
+				}
+				w.partitionBy = append(w.partitionBy, node)
+			}
+		case "__order":
+			w.spec += sqlparser.String(f)
+			for i := 0; i < len(exprs); i += 2 {
+				node, err := parseExpr(c, exprs[i], "")
+				if err != nil {
+					return nil, err
+				}
+				w.orderBy = append(w.orderBy, &OrderByNode{node, sqlparser.String(exprs[i+1]) == "'asc'"})
+			}
+		case "__frame":
+			w.frame.rows = sqlparser.String(exprs[0]) == "'rows'"
+			for i, b := range []*FrameBound{&w.frame.start, &w.frame.end} {
+				kind := strings.Trim(sqlparser.String(exprs[2*i+1]), "'")
+				b.kind = map[string]FrameBoundKind{"unbounded preceding": UnboundedPreceding, "preceding": Preceding,
+					"current row": CurrentRow, "following": Following, "unbounded following": UnboundedFollowing}[kind]
+				offset, err := strconv.ParseInt(sqlparser.String(exprs[2*i+2]), 10, 64)
+				if err != nil {
+					return nil, GoDBError{ParseError, fmt.Sprintf("invalid frame offset %s", sqlparser.String(exprs[2*i+2]))}
+				}
+				b.offset = offset
+			}
+		}
+	}
+	return w, nil
+}
+
+// Return the aggregates that the expressions of w refer to, which must be
+// computed before the window function
+func (w *LogicalWindowNode) aggs() []*LogicalSelectNode {
+	var aggs []*LogicalSelectNode
+	for _, arg := range append(append([]*LogicalSelectNode{}, w.args...), w.partitionBy...) {
+		aggs = append(aggs, extractAggs(arg)...)
+	}
+	for _, oby := range w.orderBy {
+		aggs = append(aggs, extractAggs(oby.expr)...)
+	}
+	return aggs
+}
+
+// Add Window operators that compute the window functions windows over the
+// output of op, one for each distinct PARTITION BY and ORDER BY
+func addWindows(c *Catalog, op Operator, windows []*LogicalWindowNode, tableMap map[string]*PlanNode) (Operator, error) {
+	var specs []string
+	bySpec := make(map[string][]*LogicalWindowNode)
+	for _, w := range windows {
+		if bySpec[w.spec] == nil {
+			specs = append(specs, w.spec)
+		}
+		bySpec[w.spec] = append(bySpec[w.spec], w)
+	}
+
+	for _, spec := range specs {
+		first := bySpec[spec][0]
+		desc := op.Descriptor()
+		var partitionBy, orderBy []Expr
+		var ascending []bool
+		for _, p := range first.partitionBy {
+			expr, _, err := p.generateExpr(c, desc, tableMap)
+			if err != nil {
+				return nil, err
+			}
+			partitionBy = append(partitionBy, expr)
+		}
+		for _, oby := range first.orderBy {
+			expr, _, err := oby.expr.generateExpr(c, desc, tableMap)
+			if err != nil {
+				return nil, err
+			}
+			orderBy = append(orderBy, expr)
+			ascending = append(ascending, oby.ascending)
+		}
+
+		var funcs []*WindowFunc
+		for _, w := range bySpec[spec] {
+			args := make([]Expr, len(w.args))
+			for i, arg := range w.args {
+				expr, _, err := arg.generateExpr(c, desc, tableMap)
+				if err != nil {
+					return nil, err
+				}
+				args[i] = expr
+			}
+			var agg AggState
+			if isAgg(w.name) {
+				if len(args) == 0 && w.name != "count" {
+					return nil, GoDBError{ParseError, fmt.Sprintf("expected an argument to aggregate %s", w.name)}
+				}
+				var argExpr Expr
+				argType := IntType
+				var params []string
+				if len(args) > 0 {
+					argExpr, argType = args[0], args[0].GetExprType().Ftype
+					params = aggParams(w.args[1:])
+					args = args[:1]
+				}
+				as, getter, err := newAggState(w.name, argType, false, params)
+				if err != nil {
+					return nil, err
+				}
+				if err := as.Init(w.alias, argExpr, getter); err != nil {
+					return nil, err
+				}
+				agg = as
+			}
+			f, err := NewWindowFunc(w.name, args, agg, w.frame, w.alias)
+			if err != nil {
+				return nil, err
+			}
+			funcs = append(funcs, f)
+		}
+		window, err := NewWindow(partitionBy, orderBy, ascending, funcs, op)
+		if err != nil {
+			return nil, err
+		}
+		op = window
+	}
+	return op, nil
+}
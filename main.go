@@ -189,19 +189,12 @@ func main() {
 					hasHeader = splits[4] != "false"
 				}
 
-				//todo -- following code assumes data is in heap files
-				hf, err := c.GetTable(table)
-				if err != nil {
-					fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
-					continue
-				}
-				columnFile := hf.(*godb.ColumnFile)
 				f, err := os.Open(path)
 				if err != nil {
 					fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
 					continue
 				}
-				err = columnFile.LoadFromCSV(f, hasHeader, sep, false)
+				err = c.LoadTableFromCSV(table, f, hasHeader, sep, false)
 				if err != nil {
 					fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
 					continue
@@ -344,6 +337,30 @@ func main() {
 			if err != nil {
 				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
 			}
+		case godb.AlterTableQueryType:
+			fmt.Printf("\033[32;1mALTER\033[0m\n\n")
+			err := c.SaveToFile(catName, catPath)
+			if err != nil {
+				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+			}
+		case godb.CreateSequenceQueryType:
+			fmt.Printf("\033[32;1mCREATE SEQUENCE\033[0m\n\n")
+			err := c.SaveToFile(catName, catPath)
+			if err != nil {
+				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+			}
+		case godb.DropSequenceQueryType:
+			fmt.Printf("\033[32;1mDROP SEQUENCE\033[0m\n\n")
+			err := c.SaveToFile(catName, catPath)
+			if err != nil {
+				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+			}
+		case godb.AnalyzeQueryType:
+			fmt.Printf("\033[32;1mANALYZE\033[0m\n\n")
+			err := c.SaveToFile(catName, catPath)
+			if err != nil {
+				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+			}
 		}
 
 	}